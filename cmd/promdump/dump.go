@@ -0,0 +1,88 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/text"
+)
+
+// defaultAccept prefers the delimited protobuf format over the text format.
+const defaultAccept = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3`
+
+// outputFormats maps the values of the -format flag to the encoders of the
+// text package.
+var outputFormats = map[string]func(io.Writer, *dto.MetricFamily) (int, error){
+	"text":          text.MetricFamilyToText,
+	"proto":         text.WriteProtoDelimited,
+	"proto-text":    text.WriteProtoText,
+	"proto-compact": text.WriteProtoCompactText,
+	"influx":        text.MetricFamilyToInflux,
+}
+
+func outputFormatNames() string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// decode reads metric families from in. contentType is either a media type as
+// sent in a Content-Type header, "proto", "text", or empty for text.
+func decode(in io.Reader, contentType string) ([]*dto.MetricFamily, error) {
+	switch contentType {
+	case "proto":
+		return text.ReadProtoDelimited(in)
+	case "text", "":
+		return text.ParseText(in)
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %s", contentType, err)
+	}
+	switch {
+	case mediaType == "application/vnd.google.protobuf" && params["encoding"] == "delimited":
+		return text.ReadProtoDelimited(in)
+	case mediaType == "text/plain":
+		return text.ParseText(in)
+	}
+	return nil, fmt.Errorf("unsupported content type %q", contentType)
+}
+
+// encode writes mfs to out in the provided output format.
+func encode(out io.Writer, mfs []*dto.MetricFamily, format string) error {
+	write, ok := outputFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown output format %q, valid formats are %s", format, outputFormatNames())
+	}
+	for _, mf := range mfs {
+		if _, err := write(out, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
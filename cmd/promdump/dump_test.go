@@ -0,0 +1,56 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testText = `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{code="200"} 42
+`
+
+func TestDecodeEncode(t *testing.T) {
+	mfs, err := decode(strings.NewReader(testText), "text/plain; version=0.0.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delimited bytes.Buffer
+	if err := encode(&delimited, mfs, "proto"); err != nil {
+		t.Fatal(err)
+	}
+
+	contentType := `application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited`
+	mfs, err = decode(&delimited, contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := encode(&out, mfs, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != testText {
+		t.Errorf("got round trip output\n%s\nwant\n%s", out.String(), testText)
+	}
+
+	if err := encode(&out, mfs, "xml"); err == nil {
+		t.Error("expected error for unknown output format")
+	}
+	if _, err := decode(strings.NewReader(testText), "application/json"); err == nil {
+		t.Error("expected error for unsupported content type")
+	}
+}
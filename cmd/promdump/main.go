@@ -0,0 +1,101 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// promdump fetches the metrics exposed by a /metrics endpoint, or reads them
+// from a file, and prints them in a selectable format. It is meant for
+// debugging what an instrumented program actually exposes, e.g.
+//
+//     promdump http://localhost:9100/metrics
+//     promdump -format=proto-text http://localhost:9100/metrics
+//     curl -s http://localhost:9100/metrics | promdump -input-format=text -format=proto -
+//
+// Endpoints are asked for the delimited protobuf format first, so the output
+// shows exactly what Prometheus would ingest. Use -accept to request another
+// format.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	format      = flag.String("format", "text", "Output format: "+outputFormatNames()+".")
+	inputFormat = flag.String("input-format", "auto", "Input format: auto, text, or proto. auto uses the Content-Type of HTTP responses and text for files.")
+	accept      = flag.String("accept", defaultAccept, "Accept header sent to HTTP endpoints.")
+	timeout     = flag.Duration("timeout", 10*time.Second, "Timeout for HTTP requests.")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: promdump [flags] url|file|-")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, "promdump:", err)
+		os.Exit(1)
+	}
+}
+
+func run(source string) error {
+	in, contentType, err := open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if *inputFormat != "auto" {
+		contentType = *inputFormat
+	}
+	mfs, err := decode(in, contentType)
+	if err != nil {
+		return err
+	}
+	return encode(os.Stdout, mfs, *format)
+}
+
+// open returns a reader for the provided URL, file name, or "-" for standard
+// input, along with the content type if known.
+func open(source string) (io.ReadCloser, string, error) {
+	switch {
+	case source == "-":
+		return os.Stdin, "", nil
+	case isURL(source):
+		client := &http.Client{Timeout: *timeout}
+		req, err := http.NewRequest("GET", source, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Accept", *accept)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, "", fmt.Errorf("unexpected status %s from %s", resp.Status, source)
+		}
+		return resp.Body, resp.Header.Get("Content-Type"), nil
+	default:
+		f, err := os.Open(source)
+		return f, "", err
+	}
+}
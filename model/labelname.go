@@ -33,6 +33,18 @@ const (
 	// JobLabel is the label name indicating the job from which a timeseries
 	// was scraped.
 	JobLabel LabelName = "job"
+
+	// InstanceLabel is the label name indicating the instance from which a
+	// timeseries was scraped.
+	InstanceLabel LabelName = "instance"
+
+	// BucketLabel is the label name used for the upper bound of a bucket of
+	// a histogram.
+	BucketLabel LabelName = "le"
+
+	// QuantileLabel is the label name used for the quantile rank of a
+	// summary.
+	QuantileLabel LabelName = "quantile"
 )
 
 // A LabelName is a key for a LabelSet or Metric.  It has a value associated
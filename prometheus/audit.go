@@ -0,0 +1,65 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "time"
+
+// ScrapeInfo describes a scrape served via HTTP by a Registry (including the
+// handlers returned by Handler, FilteredHandler, and similar), see OnScrape.
+type ScrapeInfo struct {
+	// RemoteAddr is the network address of the client as reported by
+	// http.Request.RemoteAddr.
+	RemoteAddr string
+	// ContentType and Encoding are the negotiated format of the response.
+	// Both are empty if the scrape failed.
+	ContentType, Encoding string
+	// Duration is the time spent collecting and writing the metrics.
+	Duration time.Duration
+	// BytesWritten is the size of the response body, after compression.
+	BytesWritten int
+	// Status is the HTTP status code of the response, or 0 if the client
+	// went away before the response could be written.
+	Status int
+	// Err is the error the scrape failed with, or nil.
+	Err error
+}
+
+// OnScrape registers a function that is called after every scrape served via
+// HTTP, so that scrape activity can be fed into audit or capacity planning
+// pipelines. Unlike OnAfterGather, it is only called for HTTP requests and is
+// provided with the details of the request and response. Hooks are called in
+// the order of their registration, after the response has been written, and
+// must be callable concurrently.
+func OnScrape(hook func(ScrapeInfo)) {
+	defRegistry.OnScrape(hook)
+}
+
+// OnScrape works like the package-level function of the same name, but for
+// this Registry.
+func (r *Registry) OnScrape(hook func(ScrapeInfo)) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.scrapeHooks = append(r.scrapeHooks, hook)
+}
+
+// runScrapeHooks calls the hooks registered with OnScrape, see
+// runBeforeGatherHooks.
+func (r *Registry) runScrapeHooks(info ScrapeInfo) {
+	r.mtx.RLock()
+	hooks := r.scrapeHooks
+	r.mtx.RUnlock()
+	for _, hook := range hooks {
+		hook(info)
+	}
+}
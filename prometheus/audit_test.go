@@ -0,0 +1,58 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOnScrape(t *testing.T) {
+	r := newRegistry()
+	r.MustRegister(NewGauge(GaugeOpts{Name: "up", Help: "Up."}))
+	var infos []ScrapeInfo
+	r.OnScrape(func(info ScrapeInfo) {
+		infos = append(infos, info)
+	})
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	req.RemoteAddr = "10.0.0.1:4711"
+	req.Header.Set(acceptEncodingHeader, "gzip")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if len(infos) != 1 {
+		t.Fatalf("got %d scrape infos, want 1", len(infos))
+	}
+	info := infos[0]
+	if info.RemoteAddr != "10.0.0.1:4711" {
+		t.Errorf("got remote address %q, want 10.0.0.1:4711", info.RemoteAddr)
+	}
+	if info.ContentType != rec.Header().Get(contentTypeHeader) || info.ContentType == "" {
+		t.Errorf("got content type %q, want %q", info.ContentType, rec.Header().Get(contentTypeHeader))
+	}
+	if info.Encoding != "gzip" {
+		t.Errorf("got encoding %q, want gzip", info.Encoding)
+	}
+	if info.BytesWritten != rec.Body.Len() || info.BytesWritten == 0 {
+		t.Errorf("got %d bytes written, want %d", info.BytesWritten, rec.Body.Len())
+	}
+	if info.Status != http.StatusOK || info.Err != nil {
+		t.Errorf("got status %d and error %v, want 200 and no error", info.Status, info.Err)
+	}
+	if info.Duration <= 0 {
+		t.Errorf("got duration %s, want > 0", info.Duration)
+	}
+}
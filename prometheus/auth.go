@@ -0,0 +1,177 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefAuthRealm is the default value for HandlerOpts.Realm.
+const DefAuthRealm = "metrics"
+
+// HandlerOpts bundles the access control options for AuthHandler. Requests
+// are accepted if they come from an allowed network (if any are configured)
+// and provide any of the configured credentials (if any are configured).
+// Credentials are compared in constant time.
+type HandlerOpts struct {
+	// BasicAuthUsers maps user names to the passwords accepted via HTTP
+	// basic authentication.
+	BasicAuthUsers map[string]string
+
+	// BearerTokens are the tokens accepted in an "Authorization: Bearer"
+	// header.
+	BearerTokens []string
+
+	// Realm is reported to unauthenticated clients in the
+	// WWW-Authenticate header. The default value is DefAuthRealm.
+	Realm string
+
+	// AllowedNetworks restricts scrapes to clients with an address in any
+	// of the provided networks (e.g. parsed with net.ParseCIDR). Requests
+	// from other clients are answered with 403.
+	AllowedNetworks []*net.IPNet
+
+	// TrustedProxyHeader is the name of a header like "X-Forwarded-For"
+	// whose last address is used as the address of the client instead of
+	// the address of the connection. Only set it if all requests pass
+	// through a proxy setting the header, as clients could fake their
+	// address otherwise.
+	TrustedProxyHeader string
+
+	// ScrapeRate limits the number of scrapes per second of each client
+	// (by address, see TrustedProxyHeader) to protect expensive
+	// collectors from aggressive scrapers. Requests exceeding the limit
+	// are answered with 429 and a Retry-After header. The default value
+	// of 0 means no limit.
+	ScrapeRate float64
+
+	// ScrapeBurst is the number of scrapes a client may perform at once
+	// before ScrapeRate applies. The default value is 1.
+	ScrapeBurst int
+
+	// Clock is used to limit the scrape rate. The default is SystemClock.
+	Clock Clock
+}
+
+// AuthHandler returns an http.Handler that passes requests on to the provided
+// handler only if they are allowed by opts. Requests from other networks are
+// answered with 403, requests exceeding the scrape rate with 429, and requests
+// without valid credentials with 401. If opts configures no restrictions at
+// all, h is returned unchanged. Later changes to opts have no effect on the
+// returned handler.
+//
+// Usage example:
+//
+//     http.Handle("/metrics", prometheus.AuthHandler(prometheus.Handler(), prometheus.HandlerOpts{
+//         BearerTokens: []string{os.Getenv("METRICS_TOKEN")},
+//     }))
+//
+// Note that credentials are sent in clear text unless the handler is served via
+// HTTPS, see TelemetryServerOpts.TLSConfig.
+func AuthHandler(h http.Handler, opts HandlerOpts) http.Handler {
+	h = authenticate(h, opts)
+	h = limitScrapeRate(h, opts)
+	if len(opts.AllowedNetworks) == 0 {
+		return h
+	}
+	networks := append([]*net.IPNet(nil), opts.AllowedNetworks...)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip := clientIP(req, opts.TrustedProxyHeader)
+		for _, network := range networks {
+			if ip != nil && network.Contains(ip) {
+				h.ServeHTTP(w, req)
+				return
+			}
+		}
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	})
+}
+
+// authenticate returns an http.Handler that passes requests on to h only if
+// they provide any of the credentials configured in opts.
+func authenticate(h http.Handler, opts HandlerOpts) http.Handler {
+	if len(opts.BasicAuthUsers) == 0 && len(opts.BearerTokens) == 0 {
+		return h
+	}
+	if opts.Realm == "" {
+		opts.Realm = DefAuthRealm
+	}
+	// Only hashes are kept and compared, so that the comparison does not
+	// depend on the lengths of the credentials either.
+	users := make([][sha256.Size]byte, 0, len(opts.BasicAuthUsers))
+	for user, password := range opts.BasicAuthUsers {
+		users = append(users, hashCredentials(user, password))
+	}
+	tokens := make([][sha256.Size]byte, 0, len(opts.BearerTokens))
+	for _, token := range opts.BearerTokens {
+		tokens = append(tokens, hashCredentials(token))
+	}
+	challenge := `Basic realm="` + opts.Realm + `"`
+	if len(users) == 0 {
+		challenge = `Bearer realm="` + opts.Realm + `"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var (
+			got     [sha256.Size]byte
+			allowed [][sha256.Size]byte
+		)
+		if user, password, ok := req.BasicAuth(); ok {
+			got, allowed = hashCredentials(user, password), users
+		} else if auth := req.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			got, allowed = hashCredentials(auth[7:]), tokens
+		}
+		if !containsHash(allowed, got) {
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// hashCredentials returns the hash of the provided credential parts, separated
+// by a null byte.
+func hashCredentials(parts ...string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+}
+
+// containsHash returns whether hashes contains h. All hashes are compared in
+// constant time.
+func containsHash(hashes [][sha256.Size]byte, h [sha256.Size]byte) bool {
+	found := 0
+	for i := range hashes {
+		found |= subtle.ConstantTimeCompare(hashes[i][:], h[:])
+	}
+	return found == 1
+}
+
+// clientIP returns the address of the client that sent req, taken from the
+// last address in the provided header if it is not empty. It returns nil if
+// the address cannot be parsed.
+func clientIP(req *http.Request, trustedProxyHeader string) net.IP {
+	if trustedProxyHeader != "" {
+		addrs := strings.Split(req.Header.Get(trustedProxyHeader), ",")
+		return net.ParseIP(strings.TrimSpace(addrs[len(addrs)-1]))
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
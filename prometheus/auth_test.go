@@ -0,0 +1,211 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+
+	scenarios := []struct {
+		opts      HandlerOpts
+		user      string
+		password  string
+		auth      string
+		want      int
+		challenge string
+	}{
+		{ // 0: No credentials configured.
+			want: http.StatusOK,
+		},
+		{ // 1: Valid basic auth.
+			opts: HandlerOpts{BasicAuthUsers: map[string]string{"prom": "secret"}},
+			user: "prom", password: "secret",
+			want: http.StatusOK,
+		},
+		{ // 2: Wrong password.
+			opts: HandlerOpts{BasicAuthUsers: map[string]string{"prom": "secret"}},
+			user: "prom", password: "wrong",
+			want:      http.StatusUnauthorized,
+			challenge: `Basic realm="metrics"`,
+		},
+		{ // 3: Credentials must not be shifted between user and password.
+			opts: HandlerOpts{BasicAuthUsers: map[string]string{"pro": "msecret"}},
+			user: "prom", password: "secret",
+			want:      http.StatusUnauthorized,
+			challenge: `Basic realm="metrics"`,
+		},
+		{ // 4: Valid bearer token.
+			opts: HandlerOpts{BearerTokens: []string{"t1", "t2"}},
+			auth: "Bearer t2",
+			want: http.StatusOK,
+		},
+		{ // 5: Missing credentials.
+			opts:      HandlerOpts{BearerTokens: []string{"t1"}, Realm: "internal"},
+			want:      http.StatusUnauthorized,
+			challenge: `Bearer realm="internal"`,
+		},
+		{ // 6: A token is not accepted as basic auth password.
+			opts: HandlerOpts{
+				BasicAuthUsers: map[string]string{"prom": "secret"},
+				BearerTokens:   []string{"t1"},
+			},
+			user: "prom", password: "t1",
+			want:      http.StatusUnauthorized,
+			challenge: `Basic realm="metrics"`,
+		},
+	}
+
+	for i, s := range scenarios {
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		if s.user != "" {
+			req.SetBasicAuth(s.user, s.password)
+		}
+		if s.auth != "" {
+			req.Header.Set("Authorization", s.auth)
+		}
+		rec := httptest.NewRecorder()
+		AuthHandler(ok, s.opts).ServeHTTP(rec, req)
+		if rec.Code != s.want {
+			t.Errorf("%d. got status %d, want %d", i, rec.Code, s.want)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != s.challenge {
+			t.Errorf("%d. got challenge %q, want %q", i, got, s.challenge)
+		}
+	}
+}
+
+func TestAuthHandlerAllowedNetworks(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+	_, local, _ := net.ParseCIDR("::1/128")
+
+	scenarios := []struct {
+		opts       HandlerOpts
+		remoteAddr string
+		forwarded  string
+		want       int
+	}{
+		{ // 0: Allowed network.
+			opts:       HandlerOpts{AllowedNetworks: []*net.IPNet{internal, local}},
+			remoteAddr: "10.1.2.3:4711",
+			want:       http.StatusOK,
+		},
+		{ // 1: IPv6.
+			opts:       HandlerOpts{AllowedNetworks: []*net.IPNet{internal, local}},
+			remoteAddr: "[::1]:4711",
+			want:       http.StatusOK,
+		},
+		{ // 2: Other network.
+			opts:       HandlerOpts{AllowedNetworks: []*net.IPNet{internal}},
+			remoteAddr: "192.168.1.1:4711",
+			want:       http.StatusForbidden,
+		},
+		{ // 3: Header is ignored if not trusted.
+			opts:       HandlerOpts{AllowedNetworks: []*net.IPNet{internal}},
+			remoteAddr: "192.168.1.1:4711",
+			forwarded:  "10.1.2.3",
+			want:       http.StatusForbidden,
+		},
+		{ // 4: Last address appended by the trusted proxy counts.
+			opts: HandlerOpts{
+				AllowedNetworks:    []*net.IPNet{internal},
+				TrustedProxyHeader: "X-Forwarded-For",
+			},
+			remoteAddr: "192.168.1.1:4711",
+			forwarded:  "192.168.7.7, 10.1.2.3",
+			want:       http.StatusOK,
+		},
+		{ // 5: Faked first address.
+			opts: HandlerOpts{
+				AllowedNetworks:    []*net.IPNet{internal},
+				TrustedProxyHeader: "X-Forwarded-For",
+			},
+			remoteAddr: "10.1.1.1:4711",
+			forwarded:  "10.1.2.3, 192.168.7.7",
+			want:       http.StatusForbidden,
+		},
+		{ // 6: Missing header.
+			opts: HandlerOpts{
+				AllowedNetworks:    []*net.IPNet{internal},
+				TrustedProxyHeader: "X-Forwarded-For",
+			},
+			remoteAddr: "10.1.1.1:4711",
+			want:       http.StatusForbidden,
+		},
+		{ // 7: Credentials are still required.
+			opts: HandlerOpts{
+				AllowedNetworks: []*net.IPNet{internal},
+				BearerTokens:    []string{"t1"},
+			},
+			remoteAddr: "10.1.2.3:4711",
+			want:       http.StatusUnauthorized,
+		},
+	}
+
+	for i, s := range scenarios {
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = s.remoteAddr
+		if s.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", s.forwarded)
+		}
+		rec := httptest.NewRecorder()
+		AuthHandler(ok, s.opts).ServeHTTP(rec, req)
+		if rec.Code != s.want {
+			t.Errorf("%d. got status %d, want %d", i, rec.Code, s.want)
+		}
+	}
+}
+
+func TestAuthHandlerScrapeRate(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+	current := time.Unix(1e9, 0)
+	h := AuthHandler(ok, HandlerOpts{
+		ScrapeRate:  0.1,
+		ScrapeBurst: 2,
+		Clock:       ClockFunc(func() time.Time { return current }),
+	})
+
+	scrape := func(remoteAddr string, want int, wantRetryAfter string) {
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s at %s: got status %d, want %d", remoteAddr, current, rec.Code, want)
+		}
+		if got := rec.Header().Get("Retry-After"); got != wantRetryAfter {
+			t.Errorf("%s at %s: got Retry-After %q, want %q", remoteAddr, current, got, wantRetryAfter)
+		}
+	}
+
+	scrape("10.0.0.1:1234", http.StatusOK, "")
+	scrape("10.0.0.1:1235", http.StatusOK, "")
+	scrape("10.0.0.1:1236", http.StatusTooManyRequests, "10")
+	scrape("10.0.0.2:1234", http.StatusOK, "") // Other clients are not affected.
+	current = current.Add(2500 * time.Millisecond)
+	scrape("10.0.0.1:1234", http.StatusTooManyRequests, "8")
+	current = current.Add(7500 * time.Millisecond)
+	scrape("10.0.0.1:1234", http.StatusOK, "")
+	scrape("10.0.0.1:1234", http.StatusTooManyRequests, "10")
+	current = current.Add(time.Hour)
+	scrape("10.0.0.1:1234", http.StatusOK, "")
+	scrape("10.0.0.1:1234", http.StatusOK, "")
+}
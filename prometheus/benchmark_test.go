@@ -14,6 +14,7 @@
 package prometheus
 
 import (
+	"strconv"
 	"testing"
 )
 
@@ -32,6 +33,23 @@ func BenchmarkCounterWithLabelValues(b *testing.B) {
 	}
 }
 
+func BenchmarkCounterWithLabelValuesParallel(b *testing.B) {
+	m := NewCounterVec(
+		CounterOpts{
+			Name: "benchmark_counter",
+			Help: "A counter to benchmark it.",
+		},
+		[]string{"one", "two", "three"},
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.WithLabelValues("eins", "zwei", "drei").Inc()
+		}
+	})
+}
+
 func BenchmarkCounterWithMappedLabels(b *testing.B) {
 	m := NewCounterVec(
 		CounterOpts{
@@ -129,3 +147,34 @@ func BenchmarkSummaryNoLabels(b *testing.B) {
 		m.Observe(3.1415)
 	}
 }
+
+func benchmarkCounterVecFill(b *testing.B, expectedChildren int) {
+	const children = 10000
+	lvs := make([]string, children)
+	for i := range lvs {
+		lvs[i] = strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := NewCounterVec(
+			CounterOpts{
+				Name:             "benchmark_counter",
+				Help:             "A counter to benchmark it.",
+				ExpectedChildren: expectedChildren,
+			},
+			[]string{"endpoint"},
+		)
+		for _, lv := range lvs {
+			m.WithLabelValues(lv).Inc()
+		}
+	}
+}
+
+func BenchmarkCounterVecFill(b *testing.B) {
+	benchmarkCounterVecFill(b, 0)
+}
+
+func BenchmarkCounterVecFillExpectedChildren(b *testing.B) {
+	benchmarkCounterVecFill(b, 10000)
+}
@@ -0,0 +1,165 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefRefreshInterval is the default interval at which a CachedCollector
+// refreshes its cache.
+const DefRefreshInterval = time.Minute
+
+// CachedCollectorOpts bundles the options for creating a CachedCollector. Only
+// Collector is mandatory.
+type CachedCollectorOpts struct {
+	// Collector is the underlying (expensive) collector whose metrics are
+	// cached.
+	Collector Collector
+	// RefreshInterval is the minimum interval between two runs of the
+	// underlying collector. The default value is DefRefreshInterval.
+	RefreshInterval time.Duration
+
+	// Namespace, Subsystem, and ConstLabels are used for the staleness
+	// gauge, which is named "cache_age_seconds" within the namespace and
+	// subsystem. The staleness gauge reports the time in seconds since the
+	// cached metrics have been collected.
+	Namespace   string
+	Subsystem   string
+	ConstLabels Labels
+
+	// Clock determines when the cache is due for a refresh and the value
+	// of the staleness gauge. The default is SystemClock.
+	Clock Clock
+}
+
+// CachedCollector is a Collector that serves cached results of an expensive
+// underlying collector, e.g. one whose data source is a slow cloud API or a
+// walk of a large directory tree. It runs the underlying collector at most
+// once per refresh interval. If the cache is older than the refresh interval
+// when a scrape happens, the underlying collector is run in the background,
+// while the scrape is answered with the cached metrics. Only the very first
+// scrape has to wait for the underlying collector. In addition to the cached
+// metrics, a gauge reporting the age of the cache is collected.
+//
+// The cached metrics are snapshots of the metrics collected by the underlying
+// collector, i.e. the cache is not affected by later changes of those metrics.
+type CachedCollector struct {
+	collector Collector
+	interval  time.Duration
+	ageDesc   *Desc
+	clock     Clock
+
+	mtx        sync.Mutex // Protects the fields below.
+	metrics    []Metric
+	lastUpdate time.Time
+	refreshing bool
+	refreshed  *sync.Cond // Signalled after each refresh.
+}
+
+// NewCachedCollector returns a CachedCollector with the provided options.
+func NewCachedCollector(opts CachedCollectorOpts) *CachedCollector {
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = DefRefreshInterval
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	c := &CachedCollector{
+		collector: opts.Collector,
+		interval:  opts.RefreshInterval,
+		ageDesc: NewDesc(
+			BuildFQName(opts.Namespace, opts.Subsystem, "cache_age_seconds"),
+			"Time in seconds since the cached metrics have been collected.",
+			nil, opts.ConstLabels,
+		),
+		clock: opts.Clock,
+	}
+	c.refreshed = sync.NewCond(&c.mtx)
+	return c
+}
+
+// Describe returns all descriptions of the collector.
+func (c *CachedCollector) Describe(ch chan<- *Desc) {
+	c.collector.Describe(ch)
+	ch <- c.ageDesc
+}
+
+// Collect returns the cached metrics and the age of the cache. It triggers a
+// refresh of the cache if the cache is older than the refresh interval.
+func (c *CachedCollector) Collect(ch chan<- Metric) {
+	c.mtx.Lock()
+	now := c.clock.Now()
+	if !c.refreshing && now.Sub(c.lastUpdate) >= c.interval {
+		c.refreshing = true
+		go c.refresh(now)
+	}
+	for c.lastUpdate.IsZero() {
+		// Nothing cached yet, wait for the first refresh.
+		c.refreshed.Wait()
+	}
+	metrics, lastUpdate := c.metrics, c.lastUpdate
+	c.mtx.Unlock()
+
+	for _, m := range metrics {
+		ch <- m
+	}
+	ch <- MustNewConstMetric(c.ageDesc, GaugeValue, now.Sub(lastUpdate).Seconds())
+}
+
+// refresh runs the underlying collector and replaces the cache. The cache age
+// is counted from the start of the refresh.
+func (c *CachedCollector) refresh(start time.Time) {
+	ch := make(chan Metric)
+	go func() {
+		c.collector.Collect(ch)
+		close(ch)
+	}()
+	var metrics []Metric
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			// Keep the metric, so that the error is reported on
+			// scrape.
+			metrics = append(metrics, m)
+			continue
+		}
+		metrics = append(metrics, &cachedMetric{desc: m.Desc(), pb: pb})
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.metrics = metrics
+	c.lastUpdate = start
+	c.refreshing = false
+	c.refreshed.Broadcast()
+}
+
+// cachedMetric is a snapshot of a Metric.
+type cachedMetric struct {
+	desc *Desc
+	pb   *dto.Metric
+}
+
+func (m *cachedMetric) Desc() *Desc {
+	return m.desc
+}
+
+func (m *cachedMetric) Write(out *dto.Metric) error {
+	*out = *m.pb
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCachedCollector(t *testing.T) {
+	desc := NewDesc("expensive", "An expensive metric.", nil, nil)
+	var (
+		mtx   sync.Mutex
+		calls int
+		done  = make(chan struct{}, 10)
+	)
+	underlying := CollectorFunc(func(ch chan<- Metric) {
+		mtx.Lock()
+		calls++
+		v := calls
+		mtx.Unlock()
+		ch <- MustNewConstMetric(desc, GaugeValue, float64(v))
+		done <- struct{}{}
+	})
+
+	start := time.Unix(1000, 0)
+	current := start
+	c := NewCachedCollector(CachedCollectorOpts{
+		Collector:       underlying,
+		RefreshInterval: time.Minute,
+		Namespace:       "test",
+		Clock:           ClockFunc(func() time.Time { return current }),
+	})
+
+	// The first scrape waits for the underlying collector.
+	got := collectValues(t, c)
+	<-done
+	if got["expensive"] != 1 || got["test_cache_age_seconds"] != 0 {
+		t.Errorf("first scrape: got %v", got)
+	}
+
+	// Within the refresh interval, the cache is served.
+	current = start.Add(30 * time.Second)
+	got = collectValues(t, c)
+	if got["expensive"] != 1 || got["test_cache_age_seconds"] != 30 {
+		t.Errorf("cached scrape: got %v", got)
+	}
+
+	// After the refresh interval, the stale cache is served and a refresh
+	// is triggered in the background.
+	current = start.Add(90 * time.Second)
+	got = collectValues(t, c)
+	if got["expensive"] != 1 || got["test_cache_age_seconds"] != 90 {
+		t.Errorf("stale scrape: got %v", got)
+	}
+	<-done
+	for {
+		c.mtx.Lock()
+		refreshing := c.refreshing
+		c.mtx.Unlock()
+		if !refreshing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	got = collectValues(t, c)
+	if got["expensive"] != 2 || got["test_cache_age_seconds"] != 0 {
+		t.Errorf("refreshed scrape: got %v", got)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if calls != 2 {
+		t.Errorf("underlying collector called %d times, want 2", calls)
+	}
+}
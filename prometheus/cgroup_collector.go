@@ -0,0 +1,232 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupV1UnlimitedMemory is the lower bound of the values cgroup v1 reports as
+// memory limit if there is no limit (the actual value depends on the page
+// size).
+const cgroupV1UnlimitedMemory = 1 << 62
+
+type cgroupCollector struct {
+	root       string // Mount point of the cgroup hierarchies.
+	procCgroup string // File listing the cgroups of the process.
+
+	cpuUsage, cpuPeriods, cpuThrottledPeriods, cpuThrottled *Desc
+	memUsage, memLimit, oomKills                            *Desc
+}
+
+// NewCgroupCollector returns a collector which exports resource usage and
+// limits of the cgroup the current process is running in, under the given
+// namespace: the CPU time used, CFS scheduling periods and throttling, memory
+// usage and limit, and the number of OOM kills. Those are the numbers that
+// matter when running inside a container with resource limits (e.g. in
+// Kubernetes), and they are not visible to the process collector. Both cgroup
+// v1 and v2 are supported. Metrics whose files are not available (e.g. the
+// memory limit if no limit is set, or everything if the process is not running
+// on Linux) are silently omitted.
+func NewCgroupCollector(namespace string) *cgroupCollector {
+	return newCgroupCollector(namespace, "/sys/fs/cgroup", "/proc/self/cgroup")
+}
+
+func newCgroupCollector(namespace, root, procCgroup string) *cgroupCollector {
+	return &cgroupCollector{
+		root:       root,
+		procCgroup: procCgroup,
+
+		cpuUsage: NewDesc(
+			BuildFQName(namespace, "cgroup", "cpu_usage_seconds_total"),
+			"Total CPU time consumed by all tasks in the cgroup in seconds.",
+			nil, nil,
+		),
+		cpuPeriods: NewDesc(
+			BuildFQName(namespace, "cgroup", "cpu_periods_total"),
+			"Total number of elapsed CFS enforcement periods.",
+			nil, nil,
+		),
+		cpuThrottledPeriods: NewDesc(
+			BuildFQName(namespace, "cgroup", "cpu_throttled_periods_total"),
+			"Total number of CFS enforcement periods in which the cgroup was throttled.",
+			nil, nil,
+		),
+		cpuThrottled: NewDesc(
+			BuildFQName(namespace, "cgroup", "cpu_throttled_seconds_total"),
+			"Total time the cgroup was throttled in seconds.",
+			nil, nil,
+		),
+		memUsage: NewDesc(
+			BuildFQName(namespace, "cgroup", "memory_usage_bytes"),
+			"Current memory usage of the cgroup in bytes.",
+			nil, nil,
+		),
+		memLimit: NewDesc(
+			BuildFQName(namespace, "cgroup", "memory_limit_bytes"),
+			"Memory limit of the cgroup in bytes.",
+			nil, nil,
+		),
+		oomKills: NewDesc(
+			BuildFQName(namespace, "cgroup", "memory_oom_kills_total"),
+			"Total number of processes in the cgroup killed by the OOM killer.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe returns all descriptions of the collector.
+func (c *cgroupCollector) Describe(ch chan<- *Desc) {
+	ch <- c.cpuUsage
+	ch <- c.cpuPeriods
+	ch <- c.cpuThrottledPeriods
+	ch <- c.cpuThrottled
+	ch <- c.memUsage
+	ch <- c.memLimit
+	ch <- c.oomKills
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *cgroupCollector) Collect(ch chan<- Metric) {
+	paths, err := c.cgroupPaths()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(c.root, "cgroup.controllers")); err == nil {
+		c.collectV2(ch, c.dir("", paths[""]))
+		return
+	}
+	c.collectV1(ch, paths)
+}
+
+func (c *cgroupCollector) collectV2(ch chan<- Metric, dir string) {
+	if stat, err := readFlatKeyed(filepath.Join(dir, "cpu.stat")); err == nil {
+		c.sendIfPresent(ch, c.cpuUsage, CounterValue, stat, "usage_usec", 1e-6)
+		c.sendIfPresent(ch, c.cpuPeriods, CounterValue, stat, "nr_periods", 1)
+		c.sendIfPresent(ch, c.cpuThrottledPeriods, CounterValue, stat, "nr_throttled", 1)
+		c.sendIfPresent(ch, c.cpuThrottled, CounterValue, stat, "throttled_usec", 1e-6)
+	}
+	if v, err := readUint(filepath.Join(dir, "memory.current")); err == nil {
+		ch <- MustNewConstMetric(c.memUsage, GaugeValue, v)
+	}
+	// memory.max contains "max" if there is no limit, which fails to parse.
+	if v, err := readUint(filepath.Join(dir, "memory.max")); err == nil {
+		ch <- MustNewConstMetric(c.memLimit, GaugeValue, v)
+	}
+	if events, err := readFlatKeyed(filepath.Join(dir, "memory.events")); err == nil {
+		c.sendIfPresent(ch, c.oomKills, CounterValue, events, "oom_kill", 1)
+	}
+}
+
+func (c *cgroupCollector) collectV1(ch chan<- Metric, paths map[string]string) {
+	if v, err := readUint(filepath.Join(c.dir("cpuacct", paths["cpuacct"]), "cpuacct.usage")); err == nil {
+		ch <- MustNewConstMetric(c.cpuUsage, CounterValue, v/1e9)
+	}
+	if stat, err := readFlatKeyed(filepath.Join(c.dir("cpu", paths["cpu"]), "cpu.stat")); err == nil {
+		c.sendIfPresent(ch, c.cpuPeriods, CounterValue, stat, "nr_periods", 1)
+		c.sendIfPresent(ch, c.cpuThrottledPeriods, CounterValue, stat, "nr_throttled", 1)
+		c.sendIfPresent(ch, c.cpuThrottled, CounterValue, stat, "throttled_time", 1e-9)
+	}
+	memDir := c.dir("memory", paths["memory"])
+	if v, err := readUint(filepath.Join(memDir, "memory.usage_in_bytes")); err == nil {
+		ch <- MustNewConstMetric(c.memUsage, GaugeValue, v)
+	}
+	if v, err := readUint(filepath.Join(memDir, "memory.limit_in_bytes")); err == nil && v < cgroupV1UnlimitedMemory {
+		ch <- MustNewConstMetric(c.memLimit, GaugeValue, v)
+	}
+	if oom, err := readFlatKeyed(filepath.Join(memDir, "memory.oom_control")); err == nil {
+		c.sendIfPresent(ch, c.oomKills, CounterValue, oom, "oom_kill", 1)
+	}
+}
+
+func (c *cgroupCollector) sendIfPresent(ch chan<- Metric, desc *Desc, valType ValueType, values map[string]float64, key string, scale float64) {
+	if v, ok := values[key]; ok {
+		ch <- MustNewConstMetric(desc, valType, v*scale)
+	}
+}
+
+// cgroupPaths returns the cgroup paths of the process by controller name. The
+// path of the cgroup v2 unified hierarchy has the empty string as key.
+func (c *cgroupCollector) cgroupPaths() (map[string]string, error) {
+	f, err := os.Open(c.procCgroup)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	paths := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Format: hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			paths[""] = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// dir returns the directory of the cgroup with the provided path in the
+// hierarchy of the provided controller ("" for the v2 unified hierarchy). If
+// the directory does not exist, the root of the hierarchy is returned, which is
+// the case inside a container with its own cgroup namespace or with only its
+// own cgroup mounted.
+func (c *cgroupCollector) dir(controller, path string) string {
+	root := filepath.Join(c.root, controller)
+	dir := filepath.Join(root, path)
+	if _, err := os.Stat(dir); err != nil {
+		return root
+	}
+	return dir
+}
+
+func readUint(file string) (float64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	return float64(v), err
+}
+
+// readFlatKeyed reads a file with lines of the form "<key> <value>".
+func readFlatKeyed(file string) (map[string]float64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]float64{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = float64(v)
+		}
+	}
+	return values, nil
+}
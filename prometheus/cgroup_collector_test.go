@@ -0,0 +1,125 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func collectValues(t *testing.T, c Collector) map[string]float64 {
+	ch := make(chan Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	values := map[string]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		v := pb.GetGauge().GetValue()
+		if pb.Counter != nil {
+			v = pb.GetCounter().GetValue()
+		}
+		values[m.Desc().fqName] = v
+	}
+	return values
+}
+
+func TestCgroupCollectorV2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"proc_self_cgroup":                 "0::/kubepods/pod1\n",
+		"sys/cgroup.controllers":           "cpu memory\n",
+		"sys/kubepods/pod1/cpu.stat":       "usage_usec 2500000\nnr_periods 10\nnr_throttled 4\nthrottled_usec 500000\n",
+		"sys/kubepods/pod1/memory.current": "1048576\n",
+		"sys/kubepods/pod1/memory.max":     "max\n",
+		"sys/kubepods/pod1/memory.events":  "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+	})
+
+	c := newCgroupCollector("test", filepath.Join(dir, "sys"), filepath.Join(dir, "proc_self_cgroup"))
+	want := map[string]float64{
+		"test_cgroup_cpu_usage_seconds_total":     2.5,
+		"test_cgroup_cpu_periods_total":           10,
+		"test_cgroup_cpu_throttled_periods_total": 4,
+		"test_cgroup_cpu_throttled_seconds_total": 0.5,
+		"test_cgroup_memory_usage_bytes":          1048576,
+		"test_cgroup_memory_oom_kills_total":      1,
+	}
+	if got := collectValues(t, c); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCgroupCollectorV1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The cgroup paths do not exist, as inside a container, so the roots of
+	// the hierarchies are used.
+	writeFiles(t, dir, map[string]string{
+		"proc_self_cgroup":                 "5:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n",
+		"sys/cpuacct/cpuacct.usage":        "3000000000\n",
+		"sys/cpu/cpu.stat":                 "nr_periods 20\nnr_throttled 5\nthrottled_time 2000000000\n",
+		"sys/memory/memory.usage_in_bytes": "2048\n",
+		"sys/memory/memory.limit_in_bytes": "4096\n",
+		"sys/memory/memory.oom_control":    "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n",
+	})
+
+	c := newCgroupCollector("", filepath.Join(dir, "sys"), filepath.Join(dir, "proc_self_cgroup"))
+	want := map[string]float64{
+		"cgroup_cpu_usage_seconds_total":     3,
+		"cgroup_cpu_periods_total":           20,
+		"cgroup_cpu_throttled_periods_total": 5,
+		"cgroup_cpu_throttled_seconds_total": 2,
+		"cgroup_memory_usage_bytes":          2048,
+		"cgroup_memory_limit_bytes":          4096,
+		"cgroup_memory_oom_kills_total":      2,
+	}
+	if got := collectValues(t, c); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCgroupCollectorUnavailable(t *testing.T) {
+	c := newCgroupCollector("", "/nonexistent/sys", "/nonexistent/cgroup")
+	if got := collectValues(t, c); len(got) != 0 {
+		t.Errorf("want no metrics, got %v", got)
+	}
+}
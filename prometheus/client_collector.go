@@ -0,0 +1,148 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync/atomic"
+)
+
+// clientNamespace is the namespace of the metrics about this library itself.
+const clientNamespace = "prometheus_client"
+
+// vecCollector is implemented by all metric vectors, i.e. by every type that
+// embeds MetricVec.
+type vecCollector interface {
+	Collector
+	childStats() (fqName string, children int, dropped uint64)
+}
+
+type clientCollector struct {
+	registry                              *Registry
+	children, dropped, collisions, panics *Desc
+	instrumentationErrors, deprecatedUses *Desc
+}
+
+// NewClientCollector returns a collector which exports metrics about the
+// instrumentation layer itself, i.e. about this library and the provided
+// Registry: the number of children of each registered metric vector, the
+// number of label value combinations each of them dropped or evicted because
+// of its limit on children (see Opts.MaxChildren), the number of label fingerprint
+// collisions detected, the number of panics of Collectors recovered during
+// collection, the number of instrumentation errors counted instead of causing
+// a panic (see PanicOnInstrumentationError), the number of uses of deprecated
+// metric families (see Opts.Deprecation), and summaries of the time spent and
+// the bytes produced while serializing the metrics of the Registry. If r is
+// nil, the default registry is used.
+//
+// The metrics help to notice capacity issues, e.g. metric vectors whose number
+// of children grows without bound. Register the collector with the Registry it
+// observes:
+//
+//     r := prometheus.NewRegistry()
+//     r.MustRegister(prometheus.NewClientCollector(r))
+func NewClientCollector(r *Registry) Collector {
+	if r == nil {
+		r = defRegistry
+	}
+	return &clientCollector{
+		registry: r,
+		children: NewDesc(
+			BuildFQName(clientNamespace, "", "family_children"),
+			"Number of children of a registered metric vector.",
+			[]string{"family"}, nil,
+		),
+		dropped: NewDesc(
+			BuildFQName(clientNamespace, "", "family_children_dropped_total"),
+			"Total number of label value combinations a registered metric vector dropped or evicted because of its limit on children.",
+			[]string{"family"}, nil,
+		),
+		collisions: NewDesc(
+			BuildFQName(clientNamespace, "", "fingerprint_collisions_total"),
+			"Total number of label fingerprint collisions detected in metric vectors.",
+			nil, nil,
+		),
+		panics: NewDesc(
+			BuildFQName(clientNamespace, "", "collector_panics_recovered_total"),
+			"Total number of panics of collectors recovered during collection.",
+			nil, nil,
+		),
+		deprecatedUses: NewDesc(
+			BuildFQName(clientNamespace, "", "deprecated_family_uses_total"),
+			"Total number of collections in which a metric of a deprecated metric family had changed its value.",
+			[]string{"family"}, nil,
+		),
+		instrumentationErrors: NewDesc(
+			BuildFQName(clientNamespace, "", "instrumentation_errors_total"),
+			"Total number of instrumentation errors that were counted instead of causing a panic.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe returns all descriptions of the collector.
+func (c *clientCollector) Describe(ch chan<- *Desc) {
+	ch <- c.children
+	ch <- c.dropped
+	ch <- c.collisions
+	ch <- c.panics
+	ch <- c.instrumentationErrors
+	ch <- c.deprecatedUses
+	ch <- c.registry.serializeDuration.Desc()
+	ch <- c.registry.serializeSize.Desc()
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *clientCollector) Collect(ch chan<- Metric) {
+	// Do not send while holding the registry lock, as the registry might
+	// need it to process the sent metrics.
+	children := map[string]int{}
+	dropped := map[string]uint64{}
+	c.registry.mtx.RLock()
+	for _, collector := range c.registry.collectorsByID {
+		if v, ok := collector.(vecCollector); ok {
+			name, n, d := v.childStats()
+			children[name] += n
+			dropped[name] += d
+		}
+	}
+	c.registry.mtx.RUnlock()
+
+	for name, n := range children {
+		ch <- MustNewConstMetric(c.children, GaugeValue, float64(n), name)
+		ch <- MustNewConstMetric(c.dropped, CounterValue, float64(dropped[name]), name)
+	}
+	ch <- MustNewConstMetric(
+		c.collisions, CounterValue,
+		float64(atomic.LoadUint64(&fingerprintCollisions)),
+	)
+	ch <- MustNewConstMetric(
+		c.panics, CounterValue,
+		float64(atomic.LoadUint64(&c.registry.collectorPanics)),
+	)
+	ch <- MustNewConstMetric(
+		c.instrumentationErrors, CounterValue,
+		float64(atomic.LoadUint64(&instrumentationErrors)),
+	)
+	deprecatedUses.mtx.Lock()
+	uses := make(map[string]uint64, len(deprecatedUses.byName))
+	for name, n := range deprecatedUses.byName {
+		uses[name] = n
+	}
+	deprecatedUses.mtx.Unlock()
+	for name, n := range uses {
+		ch <- MustNewConstMetric(c.deprecatedUses, CounterValue, float64(n), name)
+	}
+	ch <- c.registry.serializeDuration
+	ch <- c.registry.serializeSize
+}
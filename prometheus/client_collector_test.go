@@ -0,0 +1,88 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+type panickingCollector struct {
+	desc *Desc
+}
+
+func (c panickingCollector) Describe(ch chan<- *Desc) { ch <- c.desc }
+
+func (c panickingCollector) Collect(ch chan<- Metric) { panic("boom") }
+
+func TestClientCollector(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(NewClientCollector(r))
+	vec := NewCounterVec(
+		CounterOpts{Name: "test_total", Help: "Test counter."},
+		[]string{"a", "b"},
+	)
+	r.MustRegister(vec)
+	vec.WithLabelValues("x", "y").Inc()
+	vec.WithLabelValues("x", "z").Inc()
+
+	// Fake a hash collision between two children.
+	colliding := NewCounterVec(
+		CounterOpts{Name: "colliding_total", Help: "Colliding counter."},
+		[]string{"a"},
+	)
+	collisionsBefore := atomic.LoadUint64(&fingerprintCollisions)
+	colliding.getOrCreateMetric(42, "a")
+	colliding.getOrCreateMetric(42, "b")
+	if got := atomic.LoadUint64(&fingerprintCollisions) - collisionsBefore; got != 1 {
+		t.Errorf("got %d new collisions, want 1", got)
+	}
+
+	r.ServeHTTP(httptest.NewRecorder(), &http.Request{Header: http.Header{}})
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]*dto.MetricFamily{}
+	for _, mf := range mfs {
+		byName[mf.GetName()] = mf
+	}
+	children := byName["prometheus_client_family_children"]
+	if children == nil || len(children.Metric) != 1 {
+		t.Fatalf("unexpected children family: %v", children)
+	}
+	if got, want := children.Metric[0].GetGauge().GetValue(), 2.; got != want {
+		t.Errorf("got %v children, want %v", got, want)
+	}
+	if got, want := children.Metric[0].Label[0].GetValue(), "test_total"; got != want {
+		t.Errorf("got family %q, want %q", got, want)
+	}
+	duration := byName["prometheus_client_serialization_duration_seconds"]
+	if duration == nil || duration.Metric[0].GetSummary().GetSampleCount() != 1 {
+		t.Errorf("want one observed serialization, got %v", duration)
+	}
+
+	r.MustRegister(panickingCollector{NewDesc("panicking", "Panics.", nil, nil)})
+	if _, err := r.Gather(); err == nil {
+		t.Error("expected error from panicking collector")
+	}
+	if got := atomic.LoadUint64(&r.collectorPanics); got != 1 {
+		t.Errorf("got %d recovered panics, want 1", got)
+	}
+}
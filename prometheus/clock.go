@@ -0,0 +1,35 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "time"
+
+// Clock provides the current time to time-dependent metrics and collectors,
+// e.g. the sliding time window of a Summary (see SummaryOpts.Clock). Tests can
+// provide their own Clock to advance time deterministically instead of
+// sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is an adapter to allow the use of ordinary functions as a Clock.
+type ClockFunc func() time.Time
+
+// Now implements Clock by calling f.
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is the Clock used if none is configured. It returns time.Now().
+var SystemClock Clock = ClockFunc(time.Now)
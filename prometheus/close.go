@@ -0,0 +1,82 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRegistryClosed is returned by Register and RegisterOrGet of a Registry
+// that has been closed.
+var ErrRegistryClosed = errors.New("registry is closed")
+
+// OnClose registers a function that is called by Close of the default
+// registry. See Registry.OnClose.
+func OnClose(hook func(ctx context.Context) error) {
+	defRegistry.OnClose(hook)
+}
+
+// Close closes the default registry. See Registry.Close.
+func Close(ctx context.Context) error {
+	return defRegistry.Close(ctx)
+}
+
+// OnClose registers a function that is called by Close to stop a background
+// worker or to perform a final flush, e.g. a final push to a Pushgateway,
+// writing a last process file (see WriteProcessFile), or saving the state
+// (see SaveState). The Shutdown method of a TelemetryServer can be registered
+// as it is:
+//
+//     r.OnClose(server.Shutdown)
+//     r.OnClose(func(context.Context) error { return finalPush.Close() })
+//
+// The hooks are called in the reverse order of their registration, like
+// deferred functions, so that a flush registered after the start of a worker
+// happens before the worker is stopped. Hooks registered after Close are
+// ignored.
+func (r *Registry) OnClose(hook func(ctx context.Context) error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if !r.closed {
+		r.closeHooks = append(r.closeHooks, hook)
+	}
+}
+
+// Close tears down the instrumentation of a daemon that is about to exit. It
+// rejects all further registrations with ErrRegistryClosed and then calls the
+// hooks registered with OnClose, passing ctx on to them, so that they can stop
+// background workers and perform a final flush in time. The errors returned
+// by the hooks are returned as a MultiError, or as is if there is only one.
+// Metrics can still be collected after Close, e.g. by a final scrape. Calling
+// Close again does nothing and returns nil.
+func (r *Registry) Close(ctx context.Context) error {
+	r.mtx.Lock()
+	if r.closed {
+		r.mtx.Unlock()
+		return nil
+	}
+	r.closed = true
+	hooks := r.closeHooks
+	r.closeHooks = nil
+	r.mtx.Unlock()
+
+	var errs MultiError
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.MaybeUnwrap()
+}
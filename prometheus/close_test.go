@@ -0,0 +1,92 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type closeTestKey struct{}
+
+func TestRegistryClose(t *testing.T) {
+	r := newRegistry()
+	c := NewCounter(CounterOpts{Name: "test_total", Help: "helpless"})
+	r.MustRegister(c)
+
+	var calls []string
+	r.OnClose(func(context.Context) error {
+		calls = append(calls, "stop worker")
+		return nil
+	})
+	errFlush := errors.New("flush failed")
+	r.OnClose(func(ctx context.Context) error {
+		calls = append(calls, "flush")
+		if ctx.Value(closeTestKey{}) != "value" {
+			t.Error("context not passed on to hook")
+		}
+		return errFlush
+	})
+
+	ctx := context.WithValue(context.Background(), closeTestKey{}, "value")
+	if err := r.Close(ctx); err != errFlush {
+		t.Errorf("got error %v, want %v", err, errFlush)
+	}
+	if want := []string{"flush", "stop worker"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("got hook calls %v, want %v", calls, want)
+	}
+
+	if err := r.Register(NewGauge(GaugeOpts{Name: "late", Help: "helpless"})); err != ErrRegistryClosed {
+		t.Errorf("got error %v registering after Close, want %v", err, ErrRegistryClosed)
+	}
+	if _, err := r.RegisterOrGet(c); err != ErrRegistryClosed {
+		t.Errorf("got error %v from RegisterOrGet after Close, want %v", err, ErrRegistryClosed)
+	}
+	c.Inc()
+	if mfs, err := r.Gather(); err != nil || len(mfs) != 1 {
+		t.Errorf("gathering after Close returned %v, %v", mfs, err)
+	}
+
+	r.OnClose(func(context.Context) error {
+		t.Error("hook registered after Close called")
+		return nil
+	})
+	if err := r.Close(ctx); err != nil {
+		t.Errorf("second Close returned %v", err)
+	}
+}
+
+// closingCollector closes its registry while describing itself.
+type closingCollector struct {
+	Gauge
+	r *Registry
+}
+
+func (c closingCollector) Describe(ch chan<- *Desc) {
+	c.r.Close(context.Background())
+	c.Gauge.Describe(ch)
+}
+
+func TestRegisterDuringClose(t *testing.T) {
+	r := newRegistry()
+	c := closingCollector{NewGauge(GaugeOpts{Name: "racy", Help: "helpless"}), r}
+	if err := r.Register(c); err != ErrRegistryClosed {
+		t.Errorf("got error %v registering while closing, want %v", err, ErrRegistryClosed)
+	}
+	if mfs, err := r.Gather(); err != nil || len(mfs) != 0 {
+		t.Errorf("gathering after Close returned %v, %v", mfs, err)
+	}
+}
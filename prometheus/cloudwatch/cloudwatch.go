@@ -0,0 +1,264 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cloudwatch provides an Exporter that periodically ships metrics to
+// Amazon CloudWatch via PutMetricData calls. The package does not depend on the
+// AWS SDK. Instead, the Exporter uses a Client, which is a small interface
+// easily implemented on top of the CloudWatch client of the SDK.
+//
+// The metric name is used as the CloudWatch metric name, and the labels are
+// used as dimensions (labels with an empty value are omitted). Counters,
+// gauges, and untyped metrics are sent with their current value. Summaries are
+// expanded in the same way as in the text format, i.e. into one datum per
+// quantile (with an additional "quantile" dimension) and the two datums with
+// the suffixes "_sum" and "_count". NaN and infinite values are not supported
+// by CloudWatch and are skipped.
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Limits imposed by the CloudWatch API.
+const (
+	// MaxDatumsPerCall is the maximum number of datums sent with one call
+	// of PutMetricData. Larger batches are split by the Exporter.
+	MaxDatumsPerCall = 20
+	// MaxDimensions is the maximum number of dimensions of a datum.
+	// Metrics with more labels are skipped by the Exporter.
+	MaxDimensions = 10
+)
+
+// DefInterval is the default interval between two exports of Exporter.Run.
+const DefInterval = time.Minute
+
+// Datum is a single value to send to CloudWatch.
+type Datum struct {
+	MetricName string
+	Dimensions map[string]string
+	Value      float64
+	Timestamp  time.Time
+}
+
+// Client sends datums to CloudWatch. Implementations wrap the PutMetricData
+// call of an AWS SDK. The Exporter never passes more than MaxDatumsPerCall
+// datums at once.
+type Client interface {
+	PutMetricData(ctx context.Context, namespace string, data []Datum) error
+}
+
+// ExporterOpts bundles the options for creating an Exporter. It is mandatory to
+// set Client and Namespace. All other fields are optional and can safely be
+// left at their zero value.
+type ExporterOpts struct {
+	// Client is used to send the datums. Mandatory!
+	Client Client
+
+	// Namespace is the CloudWatch namespace of all sent metrics, e.g.
+	// "MyApp". Mandatory!
+	Namespace string
+
+	// Gatherer provides the metrics to export. The default value is
+	// prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+
+	// Filter selects the metric families to export by their name. As
+	// CloudWatch charges per metric, it is usually a good idea to select
+	// only the metrics actually needed in CloudWatch. The default is to
+	// export all metric families.
+	Filter func(name string) bool
+
+	// Dimensions are added to all sent datums, e.g. to identify the
+	// instance. They count towards MaxDimensions.
+	Dimensions map[string]string
+
+	// Interval is the interval between two exports when the Exporter is
+	// running (see Run). The default value is DefInterval.
+	Interval time.Duration
+
+	// ErrorHandler is called with every error encountered by Run. Run
+	// continues with the next interval after an error. If nil, errors are
+	// silently dropped.
+	ErrorHandler func(error)
+}
+
+// Exporter ships metrics of a Gatherer to CloudWatch. Create instances with
+// NewExporter.
+type Exporter struct {
+	client       Client
+	namespace    string
+	gatherer     prometheus.Gatherer
+	filter       func(string) bool
+	dimensions   map[string]string
+	interval     time.Duration
+	errorHandler func(error)
+}
+
+// NewExporter creates a new Exporter based on the provided ExporterOpts.
+func NewExporter(opts ExporterOpts) *Exporter {
+	e := &Exporter{
+		client:       opts.Client,
+		namespace:    opts.Namespace,
+		gatherer:     opts.Gatherer,
+		filter:       opts.Filter,
+		dimensions:   opts.Dimensions,
+		interval:     opts.Interval,
+		errorHandler: opts.ErrorHandler,
+	}
+	if e.gatherer == nil {
+		e.gatherer = prometheus.DefaultGatherer
+	}
+	if e.interval <= 0 {
+		e.interval = DefInterval
+	}
+	return e
+}
+
+// Export gathers all metrics once and sends the selected ones to CloudWatch in
+// batches of at most MaxDatumsPerCall datums. If a metric has too many
+// dimensions, it is skipped, and an error is returned after all other metrics
+// have been sent.
+func (e *Exporter) Export(ctx context.Context) error {
+	if e.client == nil {
+		return errors.New("no CloudWatch client")
+	}
+	if e.namespace == "" {
+		return errors.New("empty CloudWatch namespace")
+	}
+	mfs, err := e.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	var (
+		data    []Datum
+		skipped []string
+		now     = time.Now()
+	)
+	for _, mf := range mfs {
+		if e.filter != nil && !e.filter(mf.GetName()) {
+			continue
+		}
+		for _, m := range mf.Metric {
+			ts := now
+			if m.TimestampMs != nil {
+				ts = time.Unix(0, m.GetTimestampMs()*int64(time.Millisecond))
+			}
+			dims := e.dimensionsFor(m.Label)
+			if len(dims)+quantileDims(mf) > MaxDimensions {
+				skipped = append(skipped, mf.GetName())
+				continue
+			}
+			data = appendDatums(data, mf, m, dims, ts)
+		}
+	}
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > MaxDatumsPerCall {
+			n = MaxDatumsPerCall
+		}
+		if err := e.client.PutMetricData(ctx, e.namespace, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	if len(skipped) > 0 {
+		return fmt.Errorf("metrics with more than %d dimensions skipped: %v", MaxDimensions, skipped)
+	}
+	return nil
+}
+
+// Run calls Export once per configured interval until ctx is done. Errors are
+// passed to the configured ErrorHandler.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Export(ctx); err != nil && e.errorHandler != nil {
+				e.errorHandler(err)
+			}
+		}
+	}
+}
+
+// dimensionsFor returns the dimensions for the provided labels, including the
+// constant dimensions of the Exporter.
+func (e *Exporter) dimensionsFor(labels []*dto.LabelPair) map[string]string {
+	dims := make(map[string]string, len(e.dimensions)+len(labels))
+	for name, value := range e.dimensions {
+		dims[name] = value
+	}
+	for _, lp := range labels {
+		if lp.GetValue() != "" {
+			dims[lp.GetName()] = lp.GetValue()
+		}
+	}
+	return dims
+}
+
+// quantileDims returns the number of dimensions added to the datums of the
+// MetricFamily in addition to the labels, i.e. 1 for summaries and 0 otherwise.
+func quantileDims(mf *dto.MetricFamily) int {
+	if mf.GetType() == dto.MetricType_SUMMARY {
+		return 1
+	}
+	return 0
+}
+
+func appendDatums(data []Datum, mf *dto.MetricFamily, m *dto.Metric, dims map[string]string, ts time.Time) []Datum {
+	add := func(name string, value float64, dims map[string]string) {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+		data = append(data, Datum{
+			MetricName: name,
+			Dimensions: dims,
+			Value:      value,
+			Timestamp:  ts,
+		})
+	}
+	name := mf.GetName()
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		add(name, m.GetCounter().GetValue(), dims)
+	case dto.MetricType_GAUGE:
+		add(name, m.GetGauge().GetValue(), dims)
+	case dto.MetricType_UNTYPED:
+		add(name, m.GetUntyped().GetValue(), dims)
+	case dto.MetricType_SUMMARY:
+		for _, q := range m.GetSummary().Quantile {
+			qDims := make(map[string]string, len(dims)+1)
+			for k, v := range dims {
+				qDims[k] = v
+			}
+			qDims["quantile"] = fmt.Sprint(q.GetQuantile())
+			add(name, q.GetValue(), qDims)
+		}
+		add(name+"_sum", m.GetSummary().GetSampleSum(), dims)
+		add(name+"_count", float64(m.GetSummary().GetSampleCount()), dims)
+	}
+	return data
+}
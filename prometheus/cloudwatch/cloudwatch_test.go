@@ -0,0 +1,133 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fakeClient struct {
+	calls [][]Datum
+}
+
+func (c *fakeClient) PutMetricData(ctx context.Context, namespace string, data []Datum) error {
+	if namespace != "MyApp" {
+		return fmt.Errorf("unexpected namespace %q", namespace)
+	}
+	c.calls = append(c.calls, append([]Datum(nil), data...))
+	return nil
+}
+
+func TestExportBatching(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "queue_size",
+		Help: "docstring",
+	}, []string{"queue"})
+	for i := 0; i < 45; i++ {
+		gauge.WithLabelValues(fmt.Sprint(i)).Set(float64(i))
+	}
+	reg.MustRegister(gauge)
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ignored_total",
+		Help: "docstring",
+	}))
+
+	client := &fakeClient{}
+	e := NewExporter(ExporterOpts{
+		Client:     client,
+		Namespace:  "MyApp",
+		Gatherer:   reg,
+		Filter:     func(name string) bool { return name == "queue_size" },
+		Dimensions: map[string]string{"instance": "i-123"},
+	})
+	if err := e.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes []int
+	for _, c := range client.calls {
+		sizes = append(sizes, len(c))
+	}
+	if want := []int{20, 20, 5}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("got batch sizes %v, want %v", sizes, want)
+	}
+	d := client.calls[0][0]
+	if d.MetricName != "queue_size" {
+		t.Errorf("got metric name %q", d.MetricName)
+	}
+	if want := map[string]string{"instance": "i-123", "queue": "0"}; !reflect.DeepEqual(d.Dimensions, want) {
+		t.Errorf("got dimensions %v, want %v", d.Dimensions, want)
+	}
+	if d.Timestamp.IsZero() {
+		t.Error("timestamp not set")
+	}
+}
+
+func TestExportSummaryAndTooManyDimensions(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:       "latency",
+		Help:       "docstring",
+		Objectives: map[float64]float64{0.5: 0.05},
+	})
+	summary.Observe(2)
+	reg.MustRegister(summary)
+	labels := make([]string, MaxDimensions+1)
+	values := make([]string, MaxDimensions+1)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("l%d", i)
+		values[i] = "v"
+	}
+	wide := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wide",
+		Help: "docstring",
+	}, labels)
+	wide.WithLabelValues(values...).Set(1)
+	reg.MustRegister(wide)
+
+	client := &fakeClient{}
+	e := NewExporter(ExporterOpts{Client: client, Namespace: "MyApp", Gatherer: reg})
+	err := e.Export(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "wide") {
+		t.Errorf("expected error about skipped metric, got %v", err)
+	}
+	var got []string
+	for _, d := range client.calls[0] {
+		got = append(got, fmt.Sprintf("%s %v %v", d.MetricName, d.Dimensions, d.Value))
+	}
+	want := []string{
+		"latency map[quantile:0.5] 2",
+		"latency_sum map[] 2",
+		"latency_count map[] 1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	if err := NewExporter(ExporterOpts{Namespace: "MyApp"}).Export(context.Background()); err == nil {
+		t.Error("expected error for missing client, got none")
+	}
+	if err := NewExporter(ExporterOpts{Client: &fakeClient{}}).Export(context.Background()); err == nil {
+		t.Error("expected error for empty namespace, got none")
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package collectd provides a Writer that periodically emits metrics as PUTVAL
+// commands, the plain text protocol of collectd. The commands can be written to
+// stdout, which is what collectd's exec plugin expects from the programs it
+// runs, or sent to the socket of collectd's unixsock plugin.
+//
+// A program run by the exec plugin would typically do:
+//
+//     w := collectd.NewWriter(collectd.WriterOpts{})
+//     w.Run(context.Background())
+//
+// Each sample is mapped to a collectd value list identified by
+//
+//     <host>/<metric name>-<labels>/<type>
+//
+// where <labels> are the label pairs in the form "name=value", separated by
+// ",", and omitted (together with the "-") if there are none. Any "/" in label
+// values is replaced by "_". Counters and the sample count of summaries have
+// the collectd type "derive" (and are truncated to integers), all other values
+// have the type "gauge". Summaries are expanded in the same way as in the text
+// format, i.e. into one gauge per quantile (with an additional "quantile"
+// label) and the two series with the suffixes "_sum" and "_count".
+package collectd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefInterval is the default interval between two writes of Writer.Run if the
+// COLLECTD_INTERVAL environment variable is not set.
+const DefInterval = 10 * time.Second
+
+// WriterOpts bundles the options for creating a Writer. All fields are optional
+// and can safely be left at their zero value.
+type WriterOpts struct {
+	// Out is where the PUTVAL commands are written to. The default value
+	// is os.Stdout, as required by the exec plugin. Out is ignored if
+	// Socket is set.
+	Out io.Writer
+
+	// Socket is the path of the UNIX socket of collectd's unixsock
+	// plugin. If set, the commands are sent to that socket, and the
+	// response to each command is checked.
+	Socket string
+
+	// Gatherer provides the metrics to write. The default value is
+	// prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+
+	// Host is the host part of the value list identifiers. The default
+	// value is the content of the COLLECTD_HOSTNAME environment variable
+	// (set by the exec plugin) or, if that is empty, the hostname as
+	// reported by the kernel.
+	Host string
+
+	// Interval is the interval between two writes when the Writer is
+	// running (see Run). It is also reported to collectd with each
+	// command. The default value is the content of the COLLECTD_INTERVAL
+	// environment variable (set by the exec plugin) or, if that is not
+	// set, DefInterval.
+	Interval time.Duration
+
+	// ErrorHandler is called with every error encountered by Run. Run
+	// continues with the next interval after an error. If nil, errors are
+	// silently dropped.
+	ErrorHandler func(error)
+}
+
+// Writer writes metrics of a Gatherer as collectd PUTVAL commands. Create
+// instances with NewWriter.
+type Writer struct {
+	out          io.Writer
+	socket       string
+	gatherer     prometheus.Gatherer
+	host         string
+	interval     time.Duration
+	errorHandler func(error)
+}
+
+// NewWriter creates a new Writer based on the provided WriterOpts.
+func NewWriter(opts WriterOpts) *Writer {
+	w := &Writer{
+		out:          opts.Out,
+		socket:       opts.Socket,
+		gatherer:     opts.Gatherer,
+		host:         opts.Host,
+		interval:     opts.Interval,
+		errorHandler: opts.ErrorHandler,
+	}
+	if w.out == nil {
+		w.out = os.Stdout
+	}
+	if w.gatherer == nil {
+		w.gatherer = prometheus.DefaultGatherer
+	}
+	if w.host == "" {
+		w.host = os.Getenv("COLLECTD_HOSTNAME")
+	}
+	if w.host == "" {
+		w.host, _ = os.Hostname()
+	}
+	if w.interval <= 0 {
+		if secs, err := strconv.ParseFloat(os.Getenv("COLLECTD_INTERVAL"), 64); err == nil && secs > 0 {
+			w.interval = time.Duration(secs * float64(time.Second))
+		} else {
+			w.interval = DefInterval
+		}
+	}
+	return w
+}
+
+// Write gathers all metrics once and writes them as PUTVAL commands.
+func (w *Writer) Write() error {
+	mfs, err := w.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	var commands []string
+	now := time.Now()
+	for _, mf := range mfs {
+		commands = append(commands, w.putvals(mf, now)...)
+	}
+	if w.socket != "" {
+		return w.sendToSocket(commands)
+	}
+	buf := &bytes.Buffer{}
+	for _, c := range commands {
+		buf.WriteString(c)
+		buf.WriteByte('\n')
+	}
+	_, err = w.out.Write(buf.Bytes())
+	return err
+}
+
+// Run calls Write once per configured interval until ctx is done. Errors are
+// passed to the configured ErrorHandler.
+func (w *Writer) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Write(); err != nil && w.errorHandler != nil {
+				w.errorHandler(err)
+			}
+		}
+	}
+}
+
+// sendToSocket sends the commands to the unixsock plugin one by one. The
+// plugin answers each command with a line starting with a status code, which is
+// negative in case of an error.
+func (w *Writer) sendToSocket(commands []string) error {
+	conn, err := net.Dial("unix", w.socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for _, c := range commands {
+		if _, err := io.WriteString(conn, c+"\n"); err != nil {
+			return err
+		}
+		resp, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		resp = strings.TrimSpace(resp)
+		fields := strings.SplitN(resp, " ", 2)
+		if status, err := strconv.Atoi(fields[0]); err != nil || status < 0 {
+			return fmt.Errorf("collectd rejected command %q: %s", c, resp)
+		}
+	}
+	return nil
+}
+
+// putvals returns the PUTVAL commands for all samples of the MetricFamily.
+func (w *Writer) putvals(mf *dto.MetricFamily, now time.Time) []string {
+	var commands []string
+	name := mf.GetName()
+	for _, m := range mf.Metric {
+		t := now
+		if m.TimestampMs != nil {
+			t = time.Unix(0, m.GetTimestampMs()*int64(time.Millisecond))
+		}
+		add := func(name, typ string, value float64, extraLabel ...string) {
+			commands = append(commands, fmt.Sprintf(
+				"PUTVAL %q interval=%v %d:%s",
+				w.identifier(name, m.Label, typ, extraLabel...),
+				w.interval.Seconds(), t.Unix(), formatValue(typ, value),
+			))
+		}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			add(name, "derive", m.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			add(name, "gauge", m.GetGauge().GetValue())
+		case dto.MetricType_UNTYPED:
+			add(name, "gauge", m.GetUntyped().GetValue())
+		case dto.MetricType_SUMMARY:
+			for _, q := range m.GetSummary().Quantile {
+				add(name, "gauge", q.GetValue(), "quantile", fmt.Sprint(q.GetQuantile()))
+			}
+			add(name+"_sum", "gauge", m.GetSummary().GetSampleSum())
+			add(name+"_count", "derive", float64(m.GetSummary().GetSampleCount()))
+		}
+	}
+	return commands
+}
+
+// identifier returns the value list identifier for the provided metric name,
+// labels (plus an optional additional label name and value), and collectd type.
+func (w *Writer) identifier(name string, labels []*dto.LabelPair, typ string, extraLabel ...string) string {
+	pairs := make([]string, 0, len(labels)+1)
+	for _, lp := range labels {
+		pairs = append(pairs, lp.GetName()+"="+strings.Replace(lp.GetValue(), "/", "_", -1))
+	}
+	if len(extraLabel) == 2 {
+		pairs = append(pairs, extraLabel[0]+"="+extraLabel[1])
+	}
+	plugin := name
+	if len(pairs) > 0 {
+		plugin += "-" + strings.Join(pairs, ",")
+	}
+	return w.host + "/" + plugin + "/" + typ
+}
+
+// formatValue formats v for the provided collectd type. "U" is collectd's
+// representation of an undefined value.
+func formatValue(typ string, v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "U"
+	}
+	if typ == "derive" {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,138 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectd
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "docstring",
+	}, []string{"code", "path"})
+	counter.WithLabelValues("200", "/api").Add(3.7)
+	reg.MustRegister(counter)
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:       "latency",
+		Help:       "docstring",
+		Objectives: map[float64]float64{0.5: 0.05},
+	})
+	summary.Observe(1.5)
+	reg.MustRegister(summary)
+	return reg
+}
+
+func TestWrite(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(WriterOpts{
+		Out:      &out,
+		Gatherer: newTestRegistry(),
+		Host:     "myhost",
+		Interval: 20 * time.Second,
+	})
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{
+		`PUTVAL "myhost/latency-quantile=0.5/gauge" interval=20 [0-9]+:1.5`,
+		`PUTVAL "myhost/latency_sum/gauge" interval=20 [0-9]+:1.5`,
+		`PUTVAL "myhost/latency_count/derive" interval=20 [0-9]+:1`,
+		`PUTVAL "myhost/requests_total-code=200,path=_api/derive" interval=20 [0-9]+:3`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(expected), out.String())
+	}
+	for i, e := range expected {
+		if !regexp.MustCompile("^" + e + "$").MatchString(lines[i]) {
+			t.Errorf("%d. got %q, want match for %q", i, lines[i], e)
+		}
+	}
+}
+
+func TestNewWriterFromEnv(t *testing.T) {
+	defer os.Setenv("COLLECTD_HOSTNAME", os.Getenv("COLLECTD_HOSTNAME"))
+	defer os.Setenv("COLLECTD_INTERVAL", os.Getenv("COLLECTD_INTERVAL"))
+	os.Setenv("COLLECTD_HOSTNAME", "envhost")
+	os.Setenv("COLLECTD_INTERVAL", "2.5")
+
+	w := NewWriter(WriterOpts{})
+	if got, want := w.host, "envhost"; got != want {
+		t.Errorf("got host %q, want %q", got, want)
+	}
+	if got, want := w.interval, 2500*time.Millisecond; got != want {
+		t.Errorf("got interval %v, want %v", got, want)
+	}
+}
+
+func TestWriteToSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collectd_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "unixsock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		var commands []string
+		defer func() { received <- commands }()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			commands = append(commands, scanner.Text())
+			if strings.Contains(scanner.Text(), "latency_count") {
+				conn.Write([]byte("-1 Parse error\n"))
+				continue
+			}
+			conn.Write([]byte("0 Success: 1 value has been dispatched.\n"))
+		}
+	}()
+
+	w := NewWriter(WriterOpts{
+		Socket:   socket,
+		Gatherer: newTestRegistry(),
+		Host:     "myhost",
+	})
+	err = w.Write()
+	if err == nil || !strings.Contains(err.Error(), "Parse error") {
+		t.Errorf("expected error from rejected command, got %v", err)
+	}
+	if got := <-received; len(got) != 3 {
+		t.Errorf("got %d commands before the rejected one, want 3: %q", len(got), got)
+	}
+}
@@ -73,3 +73,45 @@ func (c *SelfCollector) Describe(ch chan<- *Desc) {
 func (c *SelfCollector) Collect(ch chan<- Metric) {
 	ch <- c.self
 }
+
+// CollectorFunc is an adapter to allow the use of an ordinary function as a
+// Collector, analogous to http.HandlerFunc. The function is called by Collect
+// to send the collected metrics to the provided channel.
+//
+// As a function cannot describe its metrics, Describe calls the function, too,
+// and sends the descriptors of all metrics it collects. Therefore, the function
+// has to collect the same set of descriptors each time it is called (although
+// the values and, for metric vectors, the label values may vary). In
+// particular, it must collect at least one metric of each kind when it is
+// registered.
+//
+// Example:
+//
+//     desc := NewDesc("queue_length", "Length of the work queue.", nil, nil)
+//     MustRegister(CollectorFunc(func(ch chan<- Metric) {
+//         ch <- MustNewConstMetric(desc, GaugeValue, float64(queue.Len()))
+//     }))
+type CollectorFunc func(chan<- Metric)
+
+// Describe implements Collector.
+func (f CollectorFunc) Describe(ch chan<- *Desc) {
+	metrics := make(chan Metric)
+	go func() {
+		f(metrics)
+		close(metrics)
+	}()
+	seen := map[*Desc]struct{}{}
+	for m := range metrics {
+		desc := m.Desc()
+		if _, ok := seen[desc]; ok {
+			continue
+		}
+		seen[desc] = struct{}{}
+		ch <- desc
+	}
+}
+
+// Collect implements Collector.
+func (f CollectorFunc) Collect(ch chan<- Metric) {
+	f(ch)
+}
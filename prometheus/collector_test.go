@@ -0,0 +1,57 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "testing"
+
+func TestCollectorFunc(t *testing.T) {
+	length := NewDesc("queue_length", "Length of the queue.", []string{"queue"}, nil)
+	capacity := NewDesc("queue_capacity", "Capacity of the queue.", nil, nil)
+	var calls int
+	c := CollectorFunc(func(ch chan<- Metric) {
+		calls++
+		ch <- MustNewConstMetric(length, GaugeValue, float64(calls), "a")
+		ch <- MustNewConstMetric(length, GaugeValue, float64(calls), "b")
+		ch <- MustNewConstMetric(capacity, GaugeValue, 10)
+	})
+
+	descs := make(chan *Desc)
+	go func() {
+		c.Describe(descs)
+		close(descs)
+	}()
+	var got []*Desc
+	for d := range descs {
+		got = append(got, d)
+	}
+	if len(got) != 2 || got[0] != length || got[1] != capacity {
+		t.Errorf("got descs %v, want %v and %v", got, length, capacity)
+	}
+
+	reg := NewRegistry()
+	reg.EnableCollectChecks(true)
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if got := collectValues(t, c); got["queue_length"] != float64(calls) || got["queue_capacity"] != 10 {
+		t.Errorf("unexpected values %v", got)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 2 {
+		t.Errorf("got %d metric families, want 2", len(mfs))
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+)
+
+type labelsKey struct{}
+
+// ContextWithLabels returns a copy of ctx carrying the provided labels in
+// addition to the labels already carried by ctx (where the provided labels take
+// precedence). The labels are picked up by the GetMetricWithContext and
+// WithContext methods of the metric vectors. This way, label values known high
+// up in the call stack (e.g. a tenant or a request class) reach deep library
+// code without being passed through every function.
+func ContextWithLabels(ctx context.Context, labels Labels) context.Context {
+	merged := Labels{}
+	for name, value := range LabelsFromContext(ctx) {
+		merged[name] = value
+	}
+	for name, value := range labels {
+		merged[name] = value
+	}
+	return context.WithValue(ctx, labelsKey{}, merged)
+}
+
+// LabelsFromContext returns the labels carried by ctx. The returned Labels must
+// not be modified.
+func LabelsFromContext(ctx context.Context) Labels {
+	labels, _ := ctx.Value(labelsKey{}).(Labels)
+	return labels
+}
+
+// GetMetricWithContext works like GetMetricWith, but the labels carried by ctx
+// (see ContextWithLabels) are used for those variable labels that are missing
+// in the provided Labels. Labels carried by ctx that are not variable labels of
+// the MetricVec are ignored. labels may be nil if ctx carries all the required
+// labels.
+func (m *MetricVec) GetMetricWithContext(ctx context.Context, labels Labels) (Metric, error) {
+	ctxLabels := LabelsFromContext(ctx)
+	merged := make(Labels, len(m.desc.variableLabels))
+	for _, name := range m.desc.variableLabels {
+		if m.isCurried(name) {
+			continue
+		}
+		if value, ok := ctxLabels[name]; ok {
+			merged[name] = value
+		}
+	}
+	for name, value := range labels {
+		merged[name] = value
+	}
+	return m.GetMetricWith(merged)
+}
+
+// WithContext works as GetMetricWithContext, but panics if an error occurs (see
+// PanicOnInstrumentationError).
+func (m *MetricVec) WithContext(ctx context.Context, labels Labels) Metric {
+	metric, err := m.GetMetricWithContext(ctx, labels)
+	if err != nil {
+		handleInstrumentationError(err)
+		return discardMetric
+	}
+	return metric
+}
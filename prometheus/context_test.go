@@ -0,0 +1,50 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestWithContext(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{Name: "test_total", Help: "Test counter."},
+		[]string{"tenant", "op"},
+	)
+
+	ctx := ContextWithLabels(context.Background(), Labels{"tenant": "a", "unrelated": "x"})
+	ctx = ContextWithLabels(ctx, Labels{"tenant": "b"})
+	if got, want := len(LabelsFromContext(ctx)), 2; got != want {
+		t.Errorf("got %d labels in context, want %d", got, want)
+	}
+
+	vec.WithContext(ctx, Labels{"op": "read"}).Inc()
+	// Explicit labels take precedence.
+	vec.WithContext(ctx, Labels{"tenant": "c", "op": "read"}).Inc()
+
+	for _, lvs := range [][]string{{"b", "read"}, {"c", "read"}} {
+		out := &dto.Metric{}
+		vec.WithLabelValues(lvs...).Write(out)
+		if got := out.GetCounter().GetValue(); got != 1 {
+			t.Errorf("got %v for %v, want 1", got, lvs)
+		}
+	}
+
+	if _, err := vec.GetMetricWithContext(context.Background(), Labels{"op": "read"}); err == nil {
+		t.Error("expected error for missing label")
+	}
+}
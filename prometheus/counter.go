@@ -14,8 +14,12 @@
 package prometheus
 
 import (
+	"context"
 	"errors"
-	"hash/fnv"
+	"math"
+	"sync/atomic"
+
+	dto "github.com/prometheus/client_model/go"
 )
 
 // Counter is a Metric that represents a single numerical value that only ever
@@ -40,37 +44,144 @@ type Counter interface {
 	// Inc increments the counter by 1.
 	Inc()
 	// Add adds the given value to the counter. It panics if the value is <
-	// 0.
+	// 0 (see PanicOnInstrumentationError).
 	Add(float64)
 }
 
+// BatchCounter is a Counter that can add many values at once. All Counters
+// created by this package implement it. Use the function AddMany to add many
+// values to any Counter.
+type BatchCounter interface {
+	Counter
+
+	// AddMany adds all the given values to the counter. It is equivalent
+	// to calling Add for each of them, but cheaper for producers that
+	// aggregate locally and flush periodically. Values < 0 are handled
+	// like by Add, all other values are still added.
+	AddMany([]float64)
+}
+
+// AddMany adds all the given values to c, with a single call of AddMany if c is
+// a BatchCounter, or else by calling Add for each of them.
+func AddMany(c Counter, vs []float64) {
+	if bc, ok := c.(BatchCounter); ok {
+		bc.AddMany(vs)
+		return
+	}
+	for _, v := range vs {
+		c.Add(v)
+	}
+}
+
 // CounterOpts is an alias for Opts. See there for doc comments.
 type CounterOpts Opts
 
 // NewCounter creates a new Counter based on the provided CounterOpts.
 func NewCounter(opts CounterOpts) Counter {
-	desc := NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		nil,
-		opts.ConstLabels,
-	)
-	result := &counter{value: value{desc: desc, valType: CounterValue, labelPairs: desc.constLabelPairs}}
-	result.Init(result) // Init self-collection.
-	return result
+	return newCounterValue(newOptsDesc(Opts(opts), nil, dto.MetricType_COUNTER), opts.ValueStorage)
 }
 
 type counter struct {
+	// valInt holds the integer part of all increments, which can be added
+	// without the float conversions required for the float64 value. Adds
+	// that would make it wrap around go to the float64 value instead. The
+	// reported value is the sum of valInt and the float64 value. valInt has
+	// to go first in the struct to guarantee 64-bit alignment on 32-bit
+	// platforms.
+	valInt uint64
+
 	value
 }
 
+func (c *counter) Set(v float64) {
+	c.value.Set(v)
+	atomic.StoreUint64(&c.valInt, 0)
+}
+
+func (c *counter) Inc() {
+	if !addUint64(&c.valInt, 1) {
+		c.value.Add(1)
+	}
+}
+
 func (c *counter) Add(v float64) {
 	if v < 0 {
-		panic(errors.New("counter cannot decrease in value"))
+		handleInstrumentationError(errors.New("counter cannot decrease in value"))
+		return
+	}
+	if v <= maxExactFloat && v == math.Trunc(v) && addUint64(&c.valInt, uint64(v)) {
+		return
 	}
 	c.value.Add(v)
 }
 
+func (c *counter) AddMany(vs []float64) {
+	valInt, valFloat := sumCounterValues(vs, handleInstrumentationError)
+	if valInt != 0 && !addUint64(&c.valInt, valInt) {
+		valFloat += float64(valInt)
+	}
+	if valFloat != 0 {
+		c.value.Add(valFloat)
+	}
+}
+
+// sumCounterValues sums up the provided values separately into integer and
+// float parts, like they are stored by counters. Negative values are passed
+// to handleNegative as an error and skipped. Integers that would make the
+// integer part wrap around are added to the float part.
+func sumCounterValues(vs []float64, handleNegative func(error)) (valInt uint64, valFloat float64) {
+	for _, v := range vs {
+		switch {
+		case v < 0:
+			handleNegative(errors.New("counter cannot decrease in value"))
+		case v <= maxExactFloat && v == math.Trunc(v) && valInt+uint64(v) >= valInt:
+			valInt += uint64(v)
+		default:
+			valFloat += v
+		}
+	}
+	return valInt, valFloat
+}
+
+func (c *counter) Write(out *dto.Metric) error {
+	val := math.Float64frombits(atomic.LoadUint64(&c.valBits)) +
+		float64(atomic.LoadUint64(&c.valInt))
+	return populateMetric(c.valType, val, c.labelPairs, out)
+}
+
+// writeForReset implements scrapeResetter. The integer and the float part of
+// the value are decreased separately.
+func (c *counter) writeForReset(out *dto.Metric) (func(), error) {
+	valInt := atomic.LoadUint64(&c.valInt)
+	valFloat := math.Float64frombits(atomic.LoadUint64(&c.valBits))
+	if err := populateMetric(c.valType, valFloat+float64(valInt), c.labelPairs, out); err != nil {
+		return nil, err
+	}
+	return func() {
+		atomic.AddUint64(&c.valInt, -valInt)
+		c.value.Add(-valFloat)
+	}, nil
+}
+
+// maxExactFloat is the largest float64 up to which all integers are exactly
+// representable. Only integers up to it are added to the integer part of a
+// counter, as larger ones are not precise anyway.
+const maxExactFloat = 1 << 53
+
+// addUint64 atomically adds u to *addr unless that would make *addr wrap
+// around. It reports whether u was added.
+func addUint64(addr *uint64, u uint64) bool {
+	for {
+		old := atomic.LoadUint64(addr)
+		if old+u < old {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(addr, old, old+u) {
+			return true
+		}
+	}
+}
+
 // CounterVec is a Collector that bundles a set of Counters that all share the
 // same Desc, but have different values for their variable labels. This is used
 // if you want to count the same thing partitioned by various dimensions
@@ -87,25 +198,18 @@ type CounterVec struct {
 // partitioned by the given label names. At least one label name must be
 // provided.
 func NewCounterVec(opts CounterOpts, labelNames []string) *CounterVec {
-	desc := NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		labelNames,
-		opts.ConstLabels,
-	)
+	desc := newOptsDesc(Opts(opts), labelNames, dto.MetricType_COUNTER)
 	return &CounterVec{
 		MetricVec: MetricVec{
-			children: map[uint64]Metric{},
-			desc:     desc,
-			hash:     fnv.New64a(),
+			desc:             desc,
+			sanitize:         opts.SanitizeLabelValues,
+			maxChildren:      opts.MaxChildren,
+			overflow:         opts.OverflowPolicy,
+			defaults:         opts.DefaultLabelValues,
+			normalizers:      opts.LabelValueNormalizers,
+			expectedChildren: opts.ExpectedChildren,
 			newMetric: func(lvs ...string) Metric {
-				result := &counter{value: value{
-					desc:       desc,
-					valType:    CounterValue,
-					labelPairs: makeLabelPairs(desc, lvs),
-				}}
-				result.Init(result) // Init self-collection.
-				return result
+				return newCounterValue(desc, opts.ValueStorage, lvs...)
 			},
 		},
 	}
@@ -133,6 +237,28 @@ func (m *CounterVec) GetMetricWith(labels Labels) (Counter, error) {
 	return nil, err
 }
 
+// GetOrCreateMetricWithLabelValues replaces the method of the same name in
+// MetricVec. The difference is that this method returns a Counter and not a
+// Metric so that no type conversion is required.
+func (m *CounterVec) GetOrCreateMetricWithLabelValues(lvs ...string) (Counter, bool, error) {
+	metric, created, err := m.MetricVec.GetOrCreateMetricWithLabelValues(lvs...)
+	if metric != nil {
+		return metric.(Counter), created, err
+	}
+	return nil, false, err
+}
+
+// GetOrCreateMetricWith replaces the method of the same name in MetricVec. The
+// difference is that this method returns a Counter and not a Metric so that no
+// type conversion is required.
+func (m *CounterVec) GetOrCreateMetricWith(labels Labels) (Counter, bool, error) {
+	metric, created, err := m.MetricVec.GetOrCreateMetricWith(labels)
+	if metric != nil {
+		return metric.(Counter), created, err
+	}
+	return nil, false, err
+}
+
 // WithLabelValues works as GetMetricWithLabelValues, but panics where
 // GetMetricWithLabelValues would have returned an error. By not returning an
 // error, WithLabelValues allows shortcuts like
@@ -148,6 +274,43 @@ func (m *CounterVec) With(labels Labels) Counter {
 	return m.MetricVec.With(labels).(Counter)
 }
 
+// GetMetricWithContext replaces the method of the same name in MetricVec. The
+// difference is that this method returns a Counter and not a Metric so that no
+// type conversion is required.
+func (m *CounterVec) GetMetricWithContext(ctx context.Context, labels Labels) (Counter, error) {
+	metric, err := m.MetricVec.GetMetricWithContext(ctx, labels)
+	if metric != nil {
+		return metric.(Counter), err
+	}
+	return nil, err
+}
+
+// WithContext works as GetMetricWithContext, but panics where
+// GetMetricWithContext would have returned an error.
+func (m *CounterVec) WithContext(ctx context.Context, labels Labels) Counter {
+	return m.MetricVec.WithContext(ctx, labels).(Counter)
+}
+
+// CurryWith returns a CounterVec curried with the provided labels. See
+// MetricVec.CurryWith for details.
+func (m *CounterVec) CurryWith(labels Labels) (*CounterVec, error) {
+	curried := &CounterVec{}
+	if err := m.MetricVec.curryInto(labels, &curried.MetricVec); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *CounterVec) MustCurryWith(labels Labels) *CounterVec {
+	curried, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return curried
+}
+
 // CounterFunc is a Counter whose value is determined at collect time by calling a
 // provided function.
 //
@@ -166,10 +329,5 @@ type CounterFunc interface {
 // the contract for a Counter (values only go up, not down), but compliance will
 // not be checked.
 func NewCounterFunc(opts CounterOpts, function func() float64) CounterFunc {
-	return newValueFunc(NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		nil,
-		opts.ConstLabels,
-	), CounterValue, function)
+	return newValueFunc(newOptsDesc(Opts(opts), nil, dto.MetricType_COUNTER), CounterValue, function)
 }
@@ -15,6 +15,7 @@ package prometheus
 
 import (
 	"math"
+	"sync"
 	"testing"
 
 	dto "github.com/prometheus/client_model/go"
@@ -27,11 +28,15 @@ func TestCounterAdd(t *testing.T) {
 		ConstLabels: Labels{"a": "1", "b": "2"},
 	}).(*counter)
 	counter.Inc()
-	if expected, got := 1., math.Float64frombits(counter.valBits); expected != got {
-		t.Errorf("Expected %f, got %f.", expected, got)
+	if expected, got := uint64(1), counter.valInt; expected != got {
+		t.Errorf("Expected %d, got %d.", expected, got)
 	}
 	counter.Add(42)
-	if expected, got := 43., math.Float64frombits(counter.valBits); expected != got {
+	if expected, got := uint64(43), counter.valInt; expected != got {
+		t.Errorf("Expected %d, got %d.", expected, got)
+	}
+	counter.Add(0.5)
+	if expected, got := 0.5, math.Float64frombits(counter.valBits); expected != got {
 		t.Errorf("Expected %f, got %f.", expected, got)
 	}
 
@@ -42,7 +47,7 @@ func TestCounterAdd(t *testing.T) {
 	m := &dto.Metric{}
 	counter.Write(m)
 
-	if expected, got := `label:<name:"a" value:"1" > label:<name:"b" value:"2" > counter:<value:43 > `, m.String(); expected != got {
+	if expected, got := `label:<name:"a" value:"1" > label:<name:"b" value:"2" > counter:<value:43.5 > `, m.String(); expected != got {
 		t.Errorf("expected %q, got %q", expected, got)
 	}
 }
@@ -56,3 +61,98 @@ func decreaseCounter(c *counter) (err error) {
 	c.Add(-1)
 	return nil
 }
+
+func TestCounterAddLarge(t *testing.T) {
+	c := NewCounter(CounterOpts{Name: "test", Help: "test help"}).(*counter)
+	c.Add(1e19)
+	c.Add(1e19)
+	c.AddMany([]float64{1e19, 1e19})
+	m := &dto.Metric{}
+	c.Write(m)
+	if expected, got := 4e19, m.Counter.GetValue(); expected != got {
+		t.Errorf("Expected %g, got %g.", expected, got)
+	}
+
+	// Integer adds that would make the integer part wrap around go to the
+	// float part.
+	full := NewCounter(CounterOpts{Name: "test", Help: "test help"}).(*counter)
+	full.valInt = math.MaxUint64 - 1
+	full.Inc()
+	full.Inc()
+	full.Add(1 << 53)
+	full.AddMany([]float64{1 << 53, 1 << 53})
+	if expected, got := uint64(math.MaxUint64), full.valInt; expected != got {
+		t.Errorf("Expected %d, got %d.", expected, got)
+	}
+	if expected, got := float64(1+3<<53), math.Float64frombits(full.valBits); expected != got {
+		t.Errorf("Expected %g, got %g.", expected, got)
+	}
+}
+
+// plainCounter is a Counter that is not a BatchCounter.
+type plainCounter struct {
+	Counter
+}
+
+func TestAddMany(t *testing.T) {
+	for _, c := range []Counter{
+		NewCounter(CounterOpts{Name: "test", Help: "test help"}),
+		plainCounter{NewCounter(CounterOpts{Name: "test", Help: "test help"})},
+	} {
+		AddMany(c, []float64{1, 2.5})
+		m := &dto.Metric{}
+		c.Write(m)
+		if expected, got := 3.5, m.GetCounter().GetValue(); expected != got {
+			t.Errorf("%T: expected %v, got %v", c, expected, got)
+		}
+	}
+}
+
+func TestCounterAddMany(t *testing.T) {
+	counter := NewCounter(CounterOpts{Name: "test", Help: "test help"}).(*counter)
+	counter.AddMany([]float64{1, 2, 0.25, 39, 0.25})
+	if expected, got := uint64(42), counter.valInt; expected != got {
+		t.Errorf("Expected %d, got %d.", expected, got)
+	}
+	if expected, got := 0.5, math.Float64frombits(counter.valBits); expected != got {
+		t.Errorf("Expected %f, got %f.", expected, got)
+	}
+	counter.AddMany(nil)
+
+	defer func() {
+		if e := recover(); e == nil {
+			t.Error("Expected panic for negative value.")
+		}
+	}()
+	counter.AddMany([]float64{1, -1})
+}
+
+func TestCounterAddConcurrent(t *testing.T) {
+	counter := NewCounter(CounterOpts{Name: "test", Help: "test help"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				counter.Inc()
+				counter.Add(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	m := &dto.Metric{}
+	counter.Write(m)
+	if expected, got := 15000., m.GetCounter().GetValue(); expected != got {
+		t.Errorf("Expected %f, got %f.", expected, got)
+	}
+
+	counter.Set(2)
+	m.Reset()
+	counter.Write(m)
+	if expected, got := 2., m.GetCounter().GetValue(); expected != got {
+		t.Errorf("Expected %f, got %f.", expected, got)
+	}
+}
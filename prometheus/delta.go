@@ -0,0 +1,96 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/model"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// counterDeltas keeps the state of a Registry reporting counter deltas, see
+// Registry.ReportCounterDeltas.
+type counterDeltas struct {
+	mtx     sync.Mutex
+	enabled bool
+	// last maps the hash of the name and labels of each counter to the
+	// value reported cumulatively by the counter in the previous
+	// collection.
+	last map[uint64]float64
+}
+
+// ReportCounterDeltas sets whether the counters of the default registry report
+// their increase since the previous collection instead of their cumulative
+// value. It is meant for pushing metrics into systems that expect deltas, like
+// StatsD-style backends. Conceptually, the counters are reset after each
+// collection, but the counters themselves are not touched. The Registry
+// remembers the values reported previously instead.
+//
+// Each collection (scrape, push, WriteNegotiated, or Gather) consumes the
+// increase, so there must be a single consumer, and the increase reported by
+// a collection that fails to be delivered is lost. A decreasing counter, e.g.
+// after Reset, reports its full value. Counters injected with
+// SetMetricFamilyInjectionHook are reported as they are. Changing the setting
+// forgets the previously reported values.
+func ReportCounterDeltas(b bool) {
+	defRegistry.ReportCounterDeltas(b)
+}
+
+// ReportCounterDeltas works like the package-level function of the same name,
+// but for this Registry.
+func (r *Registry) ReportCounterDeltas(b bool) {
+	r.counterDeltas.mtx.Lock()
+	defer r.counterDeltas.mtx.Unlock()
+	r.counterDeltas.enabled = b
+	r.counterDeltas.last = nil
+}
+
+// applyCounterDeltas replaces the value of each counter in the provided
+// metric families registered with r by its increase since the previous call,
+// if r reports counter deltas. Counters not collected anymore are forgotten.
+func (r *Registry) applyCounterDeltas(metricFamilies map[string]*dto.MetricFamily) {
+	d := &r.counterDeltas
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if !d.enabled {
+		return
+	}
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	last := make(map[uint64]float64, len(d.last))
+	for name, mf := range metricFamilies {
+		if _, registered := r.metaByName[name]; !registered || mf.GetType() != dto.MetricType_COUNTER {
+			continue
+		}
+		for _, m := range mf.Metric {
+			h := hashAdd(hashNew(), name)
+			for _, lp := range m.Label {
+				h = hashAddByte(h, model.SeparatorByte)
+				h = hashAdd(h, lp.GetName())
+				h = hashAddByte(h, model.SeparatorByte)
+				h = hashAdd(h, lp.GetValue())
+			}
+			v := m.Counter.GetValue()
+			last[h] = v
+			if prev, ok := d.last[h]; ok && prev <= v {
+				m.Counter.Value = proto.Float64(v - prev)
+			}
+		}
+	}
+	d.last = last
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+func TestReportCounterDeltas(t *testing.T) {
+	r := newRegistry()
+	vec := NewCounterVec(CounterOpts{Name: "events_total", Help: "Events."}, []string{"kind"})
+	gauge := NewGauge(GaugeOpts{Name: "level", Help: "Level."})
+	r.MustRegister(vec)
+	r.MustRegister(gauge)
+	r.SetMetricFamilyInjectionHook(func() []*dto.MetricFamily {
+		return []*dto.MetricFamily{{
+			Name:   proto.String("injected_total"),
+			Type:   dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{Counter: &dto.Counter{Value: proto.Float64(7)}}},
+		}}
+	})
+	r.ReportCounterDeltas(true)
+
+	values := func() map[string]float64 {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				key := mf.GetName()
+				for _, lp := range m.Label {
+					key += "/" + lp.GetValue()
+				}
+				if m.Counter != nil {
+					values[key] = m.Counter.GetValue()
+				} else {
+					values[key] = m.Gauge.GetValue()
+				}
+			}
+		}
+		return values
+	}
+
+	vec.WithLabelValues("a").Add(3)
+	gauge.Set(5)
+	for _, s := range []struct {
+		update func()
+		want   map[string]float64
+	}{
+		{
+			update: func() {},
+			want:   map[string]float64{"events_total/a": 3, "level": 5, "injected_total": 7},
+		},
+		{
+			update: func() {
+				vec.WithLabelValues("a").Add(2)
+				vec.WithLabelValues("b").Inc()
+			},
+			want: map[string]float64{"events_total/a": 2, "events_total/b": 1, "level": 5, "injected_total": 7},
+		},
+		{
+			update: func() {},
+			want:   map[string]float64{"events_total/a": 0, "events_total/b": 0, "level": 5, "injected_total": 7},
+		},
+		{
+			update: func() {
+				vec.Reset()
+				vec.WithLabelValues("a").Inc()
+			},
+			want: map[string]float64{"events_total/a": 1, "level": 5, "injected_total": 7},
+		},
+	} {
+		s.update()
+		got := values()
+		if len(got) != len(s.want) {
+			t.Errorf("got %v, want %v", got, s.want)
+			continue
+		}
+		for k, v := range s.want {
+			if got[k] != v {
+				t.Errorf("got %v, want %v", got, s.want)
+				break
+			}
+		}
+	}
+
+	r.ReportCounterDeltas(false)
+	if got := values()["events_total/a"]; got != 1 {
+		t.Errorf("got cumulative value %v, want 1", got)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/model"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Deprecation marks a metric as deprecated, see Opts.Deprecation.
+type Deprecation struct {
+	// Replacement is the name of the metric to use instead, if any.
+	Replacement string `json:"replacement,omitempty"`
+	// Since is the date or version since which the metric is deprecated,
+	// if known.
+	Since string `json:"since,omitempty"`
+}
+
+func (d Deprecation) String() string {
+	s := "deprecated"
+	if d.Since != "" {
+		s += " since " + d.Since
+	}
+	if d.Replacement != "" {
+		s += ", use " + d.Replacement + " instead"
+	}
+	return s
+}
+
+// Logger is the interface for logging messages of this library. A *log.Logger
+// from the standard library implements it.
+type Logger interface {
+	Println(v ...interface{})
+}
+
+// deprecatedUses counts the uses of deprecated metric families by name, see
+// reportDeprecatedUse. It is reported by the ClientCollector.
+var deprecatedUses = struct {
+	mtx    sync.Mutex
+	byName map[string]uint64
+	logger Logger
+}{byName: map[string]uint64{}}
+
+// SetDeprecationLogger sets the Logger that is notified once per metric family
+// when a deprecated metric (see Opts.Deprecation) is written to for the first
+// time. Writes are detected on collection: a metric counts as written to if
+// its value (or, for a summary, its count of observations) has changed since
+// the previous collection by the same Registry, so metrics that are never
+// collected are never reported, and several writes between two collections
+// count as one. The default nil Logger disables logging. All uses detected
+// that way are also counted by the ClientCollector.
+func SetDeprecationLogger(l Logger) {
+	deprecatedUses.mtx.Lock()
+	defer deprecatedUses.mtx.Unlock()
+	deprecatedUses.logger = l
+}
+
+// reportDeprecatedUse counts a use of the deprecated metric family with the
+// provided name and logs the first use.
+func reportDeprecatedUse(name string, deprecation Deprecation) {
+	deprecatedUses.mtx.Lock()
+	defer deprecatedUses.mtx.Unlock()
+	deprecatedUses.byName[name]++
+	if deprecatedUses.byName[name] == 1 && deprecatedUses.logger != nil {
+		deprecatedUses.logger.Println(fmt.Sprintf(
+			"metric %s is %s", name, deprecation,
+		))
+	}
+}
+
+// deprecatedWrites keeps the state a Registry needs to detect writes to
+// deprecated metrics, see reportDeprecatedWrites.
+type deprecatedWrites struct {
+	mtx sync.Mutex
+	// last maps the hash of the name and labels of each metric of a
+	// deprecated family to its value in the previous collection.
+	last map[uint64]float64
+}
+
+// reportDeprecatedWrites reports a use of each metric of a deprecated family
+// in the provided metric families whose value has changed since the previous
+// call. Metrics seen for the first time count as changed unless their value
+// is zero. Metrics not collected anymore are forgotten.
+func (r *Registry) reportDeprecatedWrites(metricFamilies map[string]*dto.MetricFamily) {
+	w := &r.deprecatedWrites
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	var last map[uint64]float64
+	for name, mf := range metricFamilies {
+		meta, registered := r.metaByName[name]
+		if !registered || !meta.deprecated {
+			continue
+		}
+		if last == nil {
+			last = make(map[uint64]float64, len(w.last))
+		}
+		for _, m := range mf.Metric {
+			h := hashAdd(hashNew(), name)
+			for _, lp := range m.Label {
+				h = hashAddByte(h, model.SeparatorByte)
+				h = hashAdd(h, lp.GetName())
+				h = hashAddByte(h, model.SeparatorByte)
+				h = hashAdd(h, lp.GetValue())
+			}
+			var v float64
+			switch {
+			case m.Counter != nil:
+				v = m.Counter.GetValue()
+			case m.Gauge != nil:
+				v = m.Gauge.GetValue()
+			case m.Untyped != nil:
+				v = m.Untyped.GetValue()
+			case m.Summary != nil:
+				v = float64(m.Summary.GetSampleCount())
+			}
+			last[h] = v
+			if v != w.last[h] {
+				reportDeprecatedUse(name, meta.deprecation)
+			}
+		}
+	}
+	w.last = last
+}
@@ -0,0 +1,106 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+type recordingLogger []string
+
+func (l *recordingLogger) Println(v ...interface{}) {
+	*l = append(*l, fmt.Sprint(v...))
+}
+
+func TestDeprecation(t *testing.T) {
+	var logged recordingLogger
+	SetDeprecationLogger(&logged)
+	defer SetDeprecationLogger(nil)
+	// Start from scratch as uses are counted per process.
+	deprecatedUses.mtx.Lock()
+	deprecatedUses.byName = map[string]uint64{}
+	deprecatedUses.mtx.Unlock()
+
+	deprecation := &Deprecation{Replacement: "new_requests_total", Since: "0.2.0"}
+	vec := NewCounterVec(CounterOpts{
+		Name:        "old_requests_total",
+		Help:        "Deprecated requests.",
+		Deprecation: deprecation,
+	}, []string{"code"})
+	unused := NewGauge(GaugeOpts{Name: "unused_gauge", Help: "Deprecated gauge.", Deprecation: &Deprecation{}})
+	used := NewGauge(GaugeOpts{Name: "old_gauge", Help: "Deprecated gauge.", Deprecation: &Deprecation{}})
+	current := NewGauge(GaugeOpts{Name: "current_gauge", Help: "Current gauge."})
+	r := newRegistry()
+	r.MustRegister(vec)
+	r.MustRegister(unused)
+	r.MustRegister(used)
+	r.MustRegister(current)
+
+	// Creating metrics does not count as a use, writing to them does.
+	vec.WithLabelValues("200").Inc()
+	vec.WithLabelValues("200").Inc()
+	vec.WithLabelValues("500").Inc()
+	vec.WithLabelValues("404")
+	used.Set(1)
+	current.Set(1)
+	for _, scenario := range []struct {
+		write    func()
+		wantUses uint64
+	}{
+		{func() {}, 2},
+		{func() {}, 2}, // No writes since the previous collection.
+		{func() { vec.WithLabelValues("404").Inc() }, 3},
+	} {
+		scenario.write()
+		if _, err := r.Gather(); err != nil {
+			t.Fatal(err)
+		}
+		deprecatedUses.mtx.Lock()
+		uses := deprecatedUses.byName["old_requests_total"]
+		gaugeUses := deprecatedUses.byName["old_gauge"]
+		_, unusedCounted := deprecatedUses.byName["unused_gauge"]
+		_, currentCounted := deprecatedUses.byName["current_gauge"]
+		deprecatedUses.mtx.Unlock()
+		if uses != scenario.wantUses || gaugeUses != 1 || unusedCounted || currentCounted {
+			t.Errorf(
+				"got %d, %d uses, counted unused and current metric: %t, %t; want %d, 1, false, false",
+				uses, gaugeUses, unusedCounted, currentCounted, scenario.wantUses,
+			)
+		}
+	}
+	sort.Strings(logged)
+	want := recordingLogger{
+		"metric old_gauge is deprecated",
+		"metric old_requests_total is deprecated since 0.2.0, use new_requests_total instead",
+	}
+	if fmt.Sprint(logged) != fmt.Sprint(want) {
+		t.Errorf("got log %q, want %q", logged, want)
+	}
+
+	r = NewRegistry()
+	r.MustRegister(vec)
+	md := r.Metadata()
+	if len(md) != 1 || md[0].Deprecation == nil || *md[0].Deprecation != *deprecation {
+		t.Errorf("unexpected metadata %+v", md)
+	}
+	if err := r.Register(NewCounterVec(CounterOpts{
+		Name:        "old_requests_total",
+		Help:        "Deprecated requests.",
+		ConstLabels: Labels{"a": "b"},
+	}, []string{"code"})); err == nil {
+		t.Error("expected error for descriptor disagreeing on deprecation")
+	}
+}
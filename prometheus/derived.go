@@ -0,0 +1,232 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DerivedOpts bundles the options for a metric family computed at gather time
+// from other metric families, see Derive. It is mandatory to set Name, Help,
+// Inputs, and Compute.
+type DerivedOpts struct {
+	// Namespace, Subsystem, and Name are components of the fully-qualified
+	// name of the derived metric family, as in Opts.
+	Namespace string
+	Subsystem string
+	Name      string
+
+	// Help provides information about the derived metric family.
+	// Mandatory!
+	Help string
+
+	// Inputs are the names of the metric families the derived metric
+	// family is computed from. If one of them is missing in a collection
+	// (e.g. because it is paused or its collector is not registered
+	// (yet)), the derived metric family is left out of that collection.
+	Inputs []string
+
+	// Compute calculates the derived metrics from the gathered input
+	// metric families, which are passed in the order of Inputs and must
+	// not be modified. A returned error fails the whole collection.
+	Compute func(inputs []*dto.MetricFamily) ([]DerivedSample, error)
+}
+
+// DerivedSample is a single metric of a derived metric family, see
+// DerivedOpts.
+type DerivedSample struct {
+	Labels Labels
+	Value  float64
+}
+
+// derivedFamily is a metric family registered with Derive.
+type derivedFamily struct {
+	name, help string
+	inputs     []string
+	compute    func([]*dto.MetricFamily) ([]DerivedSample, error)
+}
+
+// Derive registers a metric family that is computed during every collection
+// from the metric families gathered from the registered Collectors, so that
+// simple derived signals like an error ratio do not need a recording rule on
+// the Prometheus server:
+//
+//     prometheus.Derive(prometheus.DerivedOpts{
+//         Name:    "http_error_ratio",
+//         Help:    "Ratio of failed HTTP requests.",
+//         Inputs:  []string{"http_errors_total", "http_requests_total"},
+//         Compute: prometheus.Ratio,
+//     })
+//
+// Derived metric families are exposed as gauges. They are computed in the
+// order of their registration, after the metric families returned by the hook
+// set with SetMetricFamilyInjectionHook have been added, so a derived metric
+// family can serve as an input of derived metric families registered after
+// it. Derive returns an error if opts is incomplete or the name is already
+// taken by a registered Collector or another derived metric family.
+func Derive(opts DerivedOpts) error {
+	return defRegistry.Derive(opts)
+}
+
+// Derive works like the package-level function of the same name, but for this
+// Registry.
+func (r *Registry) Derive(opts DerivedOpts) error {
+	name := BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)
+	switch {
+	case !IsValidMetricName(name):
+		return fmt.Errorf("%q is not a valid metric name", name)
+	case opts.Help == "":
+		return fmt.Errorf("derived metric family %q has no help string", name)
+	case len(opts.Inputs) == 0:
+		return fmt.Errorf("derived metric family %q has no inputs", name)
+	case opts.Compute == nil:
+		return fmt.Errorf("derived metric family %q has no Compute function", name)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exists := r.dimHashesByName[name]; exists {
+		return fmt.Errorf("metric family %q is already registered", name)
+	}
+	if r.isDerived(name) {
+		return fmt.Errorf("derived metric family %q is already registered", name)
+	}
+	r.derived = append(r.derived, derivedFamily{
+		name:    name,
+		help:    opts.Help,
+		inputs:  append([]string(nil), opts.Inputs...),
+		compute: opts.Compute,
+	})
+	return nil
+}
+
+// isDerived returns whether a derived metric family with the provided name has
+// been registered. It needs mtx locked.
+func (r *Registry) isDerived(name string) bool {
+	for _, d := range r.derived {
+		if d.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deriveFamilies adds the derived metric families to metricFamiliesByName.
+// The protobufs are allocated with the provided functions, see gather.
+func (r *Registry) deriveFamilies(
+	metricFamiliesByName map[string]*dto.MetricFamily,
+	pausedNames map[string]struct{},
+	newMetricFamily func() *dto.MetricFamily,
+	newMetric func() *dto.Metric,
+) error {
+	r.mtx.RLock()
+	derived := r.derived
+	r.mtx.RUnlock()
+
+derivedLoop:
+	for _, d := range derived {
+		if _, ok := pausedNames[d.name]; ok {
+			continue
+		}
+		if _, exists := metricFamiliesByName[d.name]; exists {
+			return fmt.Errorf("derived metric family %q collides with a collected metric family", d.name)
+		}
+		inputs := make([]*dto.MetricFamily, 0, len(d.inputs))
+		for _, name := range d.inputs {
+			mf, ok := metricFamiliesByName[name]
+			if !ok {
+				continue derivedLoop
+			}
+			inputs = append(inputs, mf)
+		}
+		samples, err := d.compute(inputs)
+		if err != nil {
+			return fmt.Errorf("error computing derived metric family %q: %s", d.name, err)
+		}
+
+		metricFamily := newMetricFamily()
+		metricFamily.Name = proto.String(d.name)
+		metricFamily.Help = proto.String(d.help)
+		metricFamily.Type = dto.MetricType_GAUGE.Enum()
+		for _, s := range samples {
+			dtoMetric := newMetric()
+			for name, value := range s.Labels {
+				if !checkLabelName(name) {
+					return fmt.Errorf("derived metric family %q has invalid label name %q", d.name, name)
+				}
+				dtoMetric.Label = append(dtoMetric.Label, &dto.LabelPair{
+					Name:  proto.String(name),
+					Value: proto.String(value),
+				})
+			}
+			sort.Sort(LabelPairSorter(dtoMetric.Label))
+			dtoMetric.Gauge = &dto.Gauge{Value: proto.Float64(s.Value)}
+			metricFamily.Metric = append(metricFamily.Metric, dtoMetric)
+		}
+		metricFamiliesByName[d.name] = metricFamily
+	}
+	return nil
+}
+
+// Ratio is a Compute function for DerivedOpts with exactly two inputs. It
+// divides each metric of the first input by the metric of the second input
+// with the same labels. Metrics without a counterpart are skipped. Counters,
+// gauges, and untyped metrics contribute their value, summaries the quotient
+// of their sample sum and count. Division by zero results in +Inf or NaN, as
+// it does in the Prometheus query language.
+func Ratio(inputs []*dto.MetricFamily) ([]DerivedSample, error) {
+	if len(inputs) != 2 {
+		return nil, errors.New("ratio needs exactly two inputs")
+	}
+	denominators := make(map[string]float64, len(inputs[1].Metric))
+	for _, m := range inputs[1].Metric {
+		denominators[stateKey("", m.Label)] = scalarValue(m)
+	}
+	samples := make([]DerivedSample, 0, len(inputs[0].Metric))
+	for _, m := range inputs[0].Metric {
+		d, ok := denominators[stateKey("", m.Label)]
+		if !ok {
+			continue
+		}
+		labels := make(Labels, len(m.Label))
+		for _, lp := range m.Label {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		samples = append(samples, DerivedSample{
+			Labels: labels,
+			Value:  scalarValue(m) / d,
+		})
+	}
+	return samples, nil
+}
+
+// scalarValue returns the value of a counter, gauge, or untyped metric, or the
+// average observation of a summary.
+func scalarValue(m *dto.Metric) float64 {
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Summary != nil:
+		return m.Summary.GetSampleSum() / float64(m.Summary.GetSampleCount())
+	}
+	return m.GetUntyped().GetValue()
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestDerive(t *testing.T) {
+	r := newRegistry()
+	errs := NewCounterVec(CounterOpts{
+		Name: "errors_total",
+		Help: "Errors.",
+	}, []string{"handler"})
+	reqs := NewCounterVec(CounterOpts{
+		Name: "requests_total",
+		Help: "Requests.",
+	}, []string{"handler"})
+	r.MustRegister(errs)
+	r.MustRegister(reqs)
+	errs.WithLabelValues("api").Add(3)
+	errs.WithLabelValues("orphan").Inc()
+	reqs.WithLabelValues("api").Add(12)
+	reqs.WithLabelValues("static").Add(5)
+
+	if err := r.Derive(DerivedOpts{
+		Name:    "error_ratio",
+		Help:    "Ratio of failed requests.",
+		Inputs:  []string{"errors_total", "requests_total"},
+		Compute: Ratio,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Derived from a derived metric family.
+	if err := r.Derive(DerivedOpts{
+		Name:   "error_percent",
+		Help:   "Percentage of failed requests.",
+		Inputs: []string{"error_ratio"},
+		Compute: func(inputs []*dto.MetricFamily) ([]DerivedSample, error) {
+			var samples []DerivedSample
+			for _, m := range inputs[0].Metric {
+				samples = append(samples, DerivedSample{
+					Labels: Labels{"handler": m.Label[0].GetValue()},
+					Value:  100 * m.Gauge.GetValue(),
+				})
+			}
+			return samples, nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, _, err := r.writeNegotiated(context.Background(), &buf, "", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE error_ratio gauge\nerror_ratio{handler=\"api\"} 0.25\n",
+		"# TYPE error_percent gauge\nerror_percent{handler=\"api\"} 25\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+	for _, unwanted := range []string{`error_ratio{handler="orphan"}`, `error_ratio{handler="static"}`} {
+		if strings.Contains(buf.String(), unwanted) {
+			t.Errorf("output contains %q without counterpart:\n%s", unwanted, buf.String())
+		}
+	}
+
+	// Missing inputs leave the derived metric family out.
+	r.Pause("requests_total")
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "error_ratio" || mf.GetName() == "error_percent" {
+			t.Errorf("derived metric family %q gathered without its inputs", mf.GetName())
+		}
+	}
+	r.Resume("requests_total")
+
+	// Name clashes are rejected in both directions.
+	if err := r.Derive(DerivedOpts{
+		Name:    "requests_total",
+		Help:    "Clash.",
+		Inputs:  []string{"errors_total"},
+		Compute: Ratio,
+	}); err == nil {
+		t.Error("deriving a registered name succeeded")
+	}
+	if err := r.Register(NewGauge(GaugeOpts{Name: "error_ratio", Help: "Clash."})); err == nil {
+		t.Error("registering a derived name succeeded")
+	}
+	if err := r.Derive(DerivedOpts{Name: "incomplete", Help: "No inputs."}); err == nil {
+		t.Error("deriving without inputs succeeded")
+	}
+
+	// Errors of Compute fail the collection.
+	if err := r.Derive(DerivedOpts{
+		Name:   "broken",
+		Help:   "Always fails.",
+		Inputs: []string{"errors_total"},
+		Compute: func([]*dto.MetricFamily) ([]DerivedSample, error) {
+			return nil, errors.New("boom")
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Gather(); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("got error %v, want error containing %q", err, "boom")
+	}
+}
+
+func TestRatio(t *testing.T) {
+	num := &dto.MetricFamily{Metric: []*dto.Metric{
+		{Gauge: &dto.Gauge{Value: proto.Float64(1)}},
+	}}
+	den := &dto.MetricFamily{Metric: []*dto.Metric{
+		{Gauge: &dto.Gauge{Value: proto.Float64(0)}},
+	}}
+	samples, err := Ratio([]*dto.MetricFamily{num, den})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || !math.IsInf(samples[0].Value, 1) {
+		t.Errorf("got %v, want a single +Inf sample", samples)
+	}
+	if _, err := Ratio([]*dto.MetricFamily{num}); err == nil {
+		t.Error("ratio of a single input succeeded")
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/prometheus/client_golang/model"
 
@@ -17,10 +20,46 @@ import (
 )
 
 var (
-	metricNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_:]*$`)
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
 	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	// nameComponentRE matches name components that are valid if preceded
+	// by another component, i.e. they may start with a digit.
+	nameComponentRE = regexp.MustCompile(`^[a-zA-Z0-9_:]*$`)
 )
 
+// utf8Names is 1 if metric and label names may contain any UTF-8 characters
+// and 0 if they are restricted to the legacy character set (the default).
+// Accessed atomically.
+var utf8Names uint32
+
+// AllowUTF8Names sets whether metric and label names may consist of arbitrary
+// UTF-8 characters, e.g. "http.server.duration" or "service.name", as
+// supported by newer Prometheus servers. By default, names are restricted to
+// the legacy character set described at IsValidMetricName and
+// IsValidLabelName, and descriptors with other names fail registration.
+//
+// In the text format, names outside the legacy character set are quoted, e.g.
+//
+//     {"http.server.requests","service.name"="checkout"} 42
+//
+// which older Prometheus servers cannot parse. Only allow UTF-8 names if all
+// consumers of the exposed metrics understand that syntax. Names within the
+// legacy character set are exposed as before.
+//
+// The setting is consulted whenever a descriptor is created, so it should be
+// made before any metric is created, typically at the start of the program.
+func AllowUTF8Names(b bool) {
+	var v uint32
+	if b {
+		v = 1
+	}
+	atomic.StoreUint32(&utf8Names, v)
+}
+
+func utf8NamesAllowed() bool {
+	return atomic.LoadUint32(&utf8Names) != 0
+}
+
 // Labels represents a collection of label name -> value mappings. This type is
 // commonly used with the With(Labels) and GetMetricWith(Labels) methods of
 // metric vector Collectors, e.g.:
@@ -68,11 +107,32 @@ type Desc struct {
 	// err is an error that occured during construction. It is reported on
 	// registration time.
 	err error
+	// meta is the metadata from Opts.
+	meta familyMeta
+	// metricType is the type of the described metrics if known, i.e. if
+	// the Desc has been created from Opts by this library.
+	metricType *dto.MetricType
+}
+
+// familyMeta is the metadata of a metric family set via Opts. All descriptors
+// with the same fully-qualified name registered with a Registry must have the
+// same familyMeta.
+type familyMeta struct {
+	// debug is set for metrics only exposed by a DebugHandler, see
+	// Opts.Debug.
+	debug         bool
+	stability     Stability
+	deprecated    bool
+	deprecation   Deprecation
+	helpExposure  HelpExposure
+	resetOnScrape bool
 }
 
 // NewDesc allocates and initializes a new Desc. Errors are recorded in the Desc
-// and will be reported on registration time. variableLabels and constLabels can
-// be nil if no such labels should be set. fqName and help must not be empty.
+// and will be reported on registration time. If there is more than one
+// problem, all of them are reported at once as a MultiError. variableLabels
+// and constLabels can be nil if no such labels should be set. fqName and help
+// must not be empty.
 //
 // variableLabels only contain the label names. Their label values are variable
 // and therefore not part of the Desc. (They are managed within the Metric.)
@@ -86,13 +146,12 @@ func NewDesc(fqName, help string, variableLabels []string, constLabels Labels) *
 		help:           help,
 		variableLabels: variableLabels,
 	}
+	var errs MultiError
 	if help == "" {
-		d.err = errors.New("empty help string")
-		return d
+		errs = append(errs, errors.New("empty help string"))
 	}
-	if !metricNameRE.MatchString(fqName) {
-		d.err = fmt.Errorf("%q is not a valid metric name", fqName)
-		return d
+	if !IsValidMetricName(fqName) {
+		errs = append(errs, fmt.Errorf("%q is not a valid metric name", fqName))
 	}
 	// labelValues contains the label values of const labels (in order of
 	// their sorted label names) plus the fqName (at position 0).
@@ -102,33 +161,41 @@ func NewDesc(fqName, help string, variableLabels []string, constLabels Labels) *
 	labelNameSet := map[string]struct{}{}
 	// First add only the const label names and sort them...
 	for labelName := range constLabels {
-		if !checkLabelName(labelName) {
-			d.err = fmt.Errorf("%q is not a valid label name", labelName)
-			return d
-		}
 		labelNames = append(labelNames, labelName)
 		labelNameSet[labelName] = struct{}{}
 	}
 	sort.Strings(labelNames)
+	for _, labelName := range labelNames {
+		if !checkLabelName(labelName) {
+			errs = append(errs, fmt.Errorf("%q is not a valid label name", labelName))
+		}
+		if !utf8.ValidString(constLabels[labelName]) {
+			errs = append(errs, fmt.Errorf("label value %q is not valid UTF-8", constLabels[labelName]))
+		}
+	}
 	// ... so that we can now add const label values in the order of their names.
 	for _, labelName := range labelNames {
 		labelValues = append(labelValues, constLabels[labelName])
 	}
 	// Now add the variable label names, but prefix them with something that
-	// cannot be in a regular label name. That prevents matching the label
-	// dimension with a different mix between preset and variable labels.
+	// cannot be in a label name, not even a UTF-8 one. That prevents
+	// matching the label dimension with a different mix between preset and
+	// variable labels.
 	for _, labelName := range variableLabels {
 		if !checkLabelName(labelName) {
-			d.err = fmt.Errorf("%q is not a valid label name", labelName)
-			return d
+			errs = append(errs, fmt.Errorf("%q is not a valid label name", labelName))
 		}
-		labelNames = append(labelNames, "$"+labelName)
+		labelNames = append(labelNames, "\xff"+labelName)
 		labelNameSet[labelName] = struct{}{}
 	}
 	if len(labelNames) != len(labelNameSet) {
-		d.err = errors.New("duplicate label names")
+		errs = append(errs, errors.New("duplicate label names"))
+	}
+	if err := errs.MaybeUnwrap(); err != nil {
+		d.err = err
 		return d
 	}
+	warnReservedLabelNames(fqName, labelNameSet)
 	h := fnv.New64a()
 	var b bytes.Buffer // To copy string contents into, avoiding []byte allocations.
 	for _, val := range labelValues {
@@ -166,6 +233,40 @@ func NewDesc(fqName, help string, variableLabels []string, constLabels Labels) *
 	return d
 }
 
+// MultiError is a slice of errors implementing the error interface. It is used
+// to report several problems at once, e.g. all problems of the arguments of
+// NewDesc.
+type MultiError []error
+
+func (errs MultiError) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(errs), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the contained errors so that errors.Is and errors.As inspect
+// all of them.
+func (errs MultiError) Unwrap() []error {
+	return errs
+}
+
+// MaybeUnwrap returns nil if errs is empty, the only contained error if errs
+// has exactly one element, and errs itself otherwise.
+func (errs MultiError) MaybeUnwrap() error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return errs
+}
+
 // NewInvalidDesc returns an invalid descriptor, i.e. a descriptor with the
 // provided error set. If a collector returning such a descriptor is registered,
 // registration will fail with the provided error. NewInvalidDesc can be used by
@@ -193,7 +294,266 @@ func (d *Desc) String() string {
 	)
 }
 
+// IsValidMetricName reports whether name is a valid metric name, i.e. whether
+// it matches the regular expression [a-zA-Z_:][a-zA-Z0-9_:]*, or, if
+// AllowUTF8Names is in effect, whether it is non-empty valid UTF-8.
+// Descriptors with invalid names fail registration.
+func IsValidMetricName(name string) bool {
+	if utf8NamesAllowed() {
+		return name != "" && utf8.ValidString(name)
+	}
+	return metricNameRE.MatchString(name)
+}
+
+// SanitizeNameComponent returns s with every character that is invalid in a
+// metric name replaced by "_" and with a "_" prepended if s starts with a
+// digit, so that the result can be used as any of the Namespace, Subsystem, or
+// Name in Opts. Use it for components derived from configuration or external
+// input, e.g. SanitizeNameComponent("my-service") returns "my_service".
+func SanitizeNameComponent(s string) string {
+	if IsValidMetricName(s) {
+		return s
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == ':') {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// checkNameComponents returns an error naming the first invalid one of the
+// provided components of a fully-qualified name. The first non-empty component
+// has to be a valid metric name on its own, while later components may start
+// with a digit.
+func checkNameComponents(namespace, subsystem, name string) error {
+	first := true
+	for _, c := range []struct{ kind, value string }{
+		{"namespace", namespace},
+		{"subsystem", subsystem},
+		{"name", name},
+	} {
+		if c.value == "" {
+			continue
+		}
+		if first && !IsValidMetricName(c.value) || !isValidNameComponent(c.value) {
+			return fmt.Errorf("invalid metric %s %q, see SanitizeNameComponent", c.kind, c.value)
+		}
+		first = false
+	}
+	return nil
+}
+
+// isValidNameComponent reports whether s is valid as a later component of a
+// fully-qualified name.
+func isValidNameComponent(s string) bool {
+	if utf8NamesAllowed() {
+		return utf8.ValidString(s)
+	}
+	return nameComponentRE.MatchString(s)
+}
+
+// newOptsDesc returns the Desc for the provided Opts and type of metric. It
+// works like NewDesc, but the fully-qualified name is built from the name
+// components with the unit appended (see withUnit) unless Opts.FQName is set,
+// invalid components, unknown units, value storages, and stability levels are
+// reported along with the problems found by NewDesc, and the metadata in Opts
+// and the type are recorded in the Desc.
+func newOptsDesc(opts Opts, variableLabels []string, metricType dto.MetricType) *Desc {
+	var (
+		errs   MultiError
+		fqName string
+	)
+	if opts.FQName != "" {
+		if opts.Namespace != "" || opts.Subsystem != "" || opts.Name != "" {
+			errs = append(errs, fmt.Errorf(
+				"metric %s: FQName cannot be combined with Namespace, Subsystem, or Name",
+				opts.FQName,
+			))
+		}
+		fqName = opts.FQName
+		if _, err := withUnit(fqName, opts.Unit); err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		if opts.Name == "" {
+			errs = append(errs, errors.New("empty metric name"))
+		}
+		if err := checkNameComponents(opts.Namespace, opts.Subsystem, opts.Name); err != nil {
+			errs = append(errs, err)
+		}
+		var err error
+		fqName, err = withUnit(BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Unit)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if opts.HelpExposure < HelpDefault || opts.HelpExposure > HelpNever {
+		errs = append(errs, fmt.Errorf("metric %s has unknown help exposure %d", fqName, opts.HelpExposure))
+	}
+	if opts.ValueStorage < StorageFloat64 || opts.ValueStorage > StorageInt64 {
+		errs = append(errs, fmt.Errorf("metric %s has unknown value storage %s", fqName, opts.ValueStorage))
+	}
+	if opts.Stability < StabilityAlpha || opts.Stability > StabilityStable {
+		errs = append(errs, fmt.Errorf("metric %s has unknown stability %s", fqName, opts.Stability))
+	}
+	desc := NewDesc(fqName, opts.Help, variableLabels, opts.ConstLabels)
+	if len(errs) > 0 {
+		// Merge with the problems found by NewDesc.
+		if multi, ok := desc.err.(MultiError); ok {
+			errs = append(errs, multi...)
+		} else if desc.err != nil {
+			errs = append(errs, desc.err)
+		}
+		desc.err = errs.MaybeUnwrap()
+	}
+	desc.metricType = metricType.Enum()
+	desc.meta = familyMeta{
+		debug:         opts.Debug,
+		stability:     opts.Stability,
+		helpExposure:  opts.HelpExposure,
+		resetOnScrape: opts.ResetOnScrape,
+	}
+	if opts.Deprecation != nil {
+		desc.meta.deprecated = true
+		desc.meta.deprecation = *opts.Deprecation
+	}
+	return desc
+}
+
+// IsValidLabelName reports whether name is a valid label name, i.e. whether it
+// matches the regular expression [a-zA-Z_][a-zA-Z0-9_]*, or, if AllowUTF8Names
+// is in effect, whether it is non-empty valid UTF-8, and whether it does not
+// start with the reserved prefix "__".
+func IsValidLabelName(name string) bool {
+	return checkLabelName(name)
+}
+
+// SanitizeLabelValue returns v with each run of invalid UTF-8 bytes replaced by
+// the Unicode replacement character U+FFFD. Valid label values are returned
+// unchanged.
+func SanitizeLabelValue(v string) string {
+	if utf8.ValidString(v) {
+		return v
+	}
+	var (
+		buf     bytes.Buffer
+		invalid bool // Whether the previous byte was part of an invalid run.
+	)
+	buf.Grow(len(v))
+	for len(v) > 0 {
+		r, size := utf8.DecodeRuneInString(v)
+		if r == utf8.RuneError && size == 1 {
+			if !invalid {
+				buf.WriteRune(utf8.RuneError)
+				invalid = true
+			}
+		} else {
+			buf.WriteString(v[:size])
+			invalid = false
+		}
+		v = v[size:]
+	}
+	return buf.String()
+}
+
+// IsReservedLabelName reports whether name has a special meaning in Prometheus
+// and should therefore not be used as the name of a constant or variable label:
+// label names with the prefix "__" (like "__name__"), "le" and "quantile"
+// (used in the exposition of histograms and summaries), and "job" and
+// "instance" (attached by the Prometheus server to every scraped time series,
+// which renames colliding labels to "exported_job" and "exported_instance").
+// Only the first group is rejected in general, "le" and "quantile" are
+// rejected for summaries, and NewDesc warns about all others (see
+// SetReservedLabelLogger).
+func IsReservedLabelName(name string) bool {
+	if strings.HasPrefix(name, model.ReservedLabelPrefix) {
+		return true
+	}
+	switch model.LabelName(name) {
+	case model.BucketLabel, model.QuantileLabel, model.JobLabel, model.InstanceLabel:
+		return true
+	}
+	return false
+}
+
+// checkReservedLabelName sets an error in d if d has a constant or variable
+// label with the provided name and d has no error yet.
+func (d *Desc) checkReservedLabelName(name model.LabelName) {
+	if d.err == nil && d.hasLabel(string(name)) {
+		d.err = fmt.Errorf("%q is a reserved label name for %s", name, d.fqName)
+	}
+}
+
+// hasLabel returns whether d has a constant or variable label with the provided
+// name.
+func (d *Desc) hasLabel(name string) bool {
+	for _, l := range d.variableLabels {
+		if l == name {
+			return true
+		}
+	}
+	for _, lp := range d.constLabelPairs {
+		if lp.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedLabelWarnings holds the Logger set by SetReservedLabelLogger and
+// remembers the metrics warned about, so that each is logged only once.
+var reservedLabelWarnings = struct {
+	mtx    sync.Mutex
+	logger Logger
+	warned map[string]struct{}
+}{warned: map[string]struct{}{}}
+
+// SetReservedLabelLogger sets the Logger that is notified once per metric name
+// and label name when NewDesc (and thereby any constructor of a metric) is
+// called with a constant or variable label that is reserved (see
+// IsReservedLabelName) but not rejected: "job" and "instance", which the
+// Prometheus server renames to "exported_job" and "exported_instance" on
+// scraping, and "le", which is meant for the buckets of histograms. The
+// default nil Logger disables the warnings.
+func SetReservedLabelLogger(l Logger) {
+	reservedLabelWarnings.mtx.Lock()
+	defer reservedLabelWarnings.mtx.Unlock()
+	reservedLabelWarnings.logger = l
+}
+
+// warnReservedLabelNames logs a warning for each of the provided label names
+// that is reserved but not rejected, see SetReservedLabelLogger.
+func warnReservedLabelNames(fqName string, labelNames map[string]struct{}) {
+	reservedLabelWarnings.mtx.Lock()
+	defer reservedLabelWarnings.mtx.Unlock()
+	if reservedLabelWarnings.logger == nil {
+		return
+	}
+	for _, name := range []model.LabelName{model.BucketLabel, model.InstanceLabel, model.JobLabel} {
+		if _, ok := labelNames[string(name)]; !ok {
+			continue
+		}
+		key := fqName + "\xff" + string(name)
+		if _, ok := reservedLabelWarnings.warned[key]; ok {
+			continue
+		}
+		reservedLabelWarnings.warned[key] = struct{}{}
+		reservedLabelWarnings.logger.Println(fmt.Sprintf(
+			"metric %s uses the reserved label name %q", fqName, name,
+		))
+	}
+}
+
 func checkLabelName(l string) bool {
+	if utf8NamesAllowed() {
+		return l != "" && utf8.ValidString(l) &&
+			!strings.HasPrefix(l, model.ReservedLabelPrefix)
+	}
 	return labelNameRE.MatchString(l) &&
 		!strings.HasPrefix(l, model.ReservedLabelPrefix)
 }
@@ -0,0 +1,269 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewDescInvalidNames(t *testing.T) {
+	scenarios := []struct {
+		fqName      string
+		varLabels   []string
+		constLabels Labels
+		valid       bool
+	}{
+		{fqName: "valid_name", valid: true},
+		{fqName: ":recorded:rule", valid: true},
+		{fqName: "1starts_with_digit"},
+		{fqName: "has-dash"},
+		{fqName: ""},
+		{fqName: "valid", varLabels: []string{"ok_label"}, valid: true},
+		{fqName: "valid", varLabels: []string{"has:colon"}},
+		{fqName: "valid", varLabels: []string{"__reserved"}},
+		{fqName: "valid", constLabels: Labels{"9lives": "x"}},
+		{fqName: "valid", constLabels: Labels{"": "x"}},
+	}
+	for i, s := range scenarios {
+		d := NewDesc(s.fqName, "help", s.varLabels, s.constLabels)
+		if got := d.err == nil; got != s.valid {
+			t.Errorf("%d. %q %v %v: got valid=%t, want %t (err: %v)", i, s.fqName, s.varLabels, s.constLabels, got, s.valid, d.err)
+		}
+	}
+
+	r := newRegistry()
+	if err := r.Register(NewCounter(CounterOpts{Name: "bad-name", Help: "Bad."})); err == nil {
+		t.Error("expected registration of invalid metric name to fail")
+	}
+}
+
+func TestAggregatedDescErrors(t *testing.T) {
+	d := NewDesc("has-dash", "", []string{"ok", "bad-label", "ok"}, Labels{"9lives": "x"})
+	errs, ok := d.err.(MultiError)
+	if !ok || len(errs) != 5 {
+		t.Fatalf("got error %v, want MultiError with 5 errors", d.err)
+	}
+
+	c := NewCounterVec(CounterOpts{
+		Namespace: "my-app",
+		Help:      "",
+		Unit:      "milliseconds",
+	}, []string{"code", "code"})
+	errs, ok = c.desc.err.(MultiError)
+	if !ok {
+		t.Fatalf("got error %v, want MultiError", c.desc.err)
+	}
+	for _, want := range []string{"empty metric name", "invalid metric namespace", "unknown unit", "empty help string", "duplicate label names"} {
+		if !strings.Contains(errs.Error(), want) {
+			t.Errorf("error %q does not mention %q", errs, want)
+		}
+	}
+	if err := newRegistry().Register(c); err == nil || !strings.Contains(err.Error(), "unknown unit") {
+		t.Errorf("got registration error %v, want all problems reported", err)
+	}
+
+	// A single problem is reported as is.
+	if d := NewDesc("valid", "", nil, nil); d.err == nil || d.err.Error() != "empty help string" {
+		t.Errorf("got error %v, want plain error", d.err)
+	}
+}
+
+func TestFQNameOverride(t *testing.T) {
+	c := NewCounter(CounterOpts{FQName: "ExternalRequests:total", Help: "help", Unit: UnitBytes})
+	if err := c.Desc().err; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.Desc().fqName, "ExternalRequests:total"; got != want {
+		t.Errorf("got name %q, want %q", got, want)
+	}
+	s := NewSummary(SummaryOpts{FQName: "external_latency", Help: "help"})
+	if got, want := s.Desc().fqName, "external_latency"; got != want {
+		t.Errorf("got name %q, want %q", got, want)
+	}
+	for _, opts := range []CounterOpts{
+		{FQName: "x", Namespace: "ns", Help: "help"},
+		{FQName: "has-dash", Help: "help"},
+		{FQName: "x", Unit: "megabytes", Help: "help"},
+	} {
+		if err := NewCounter(opts).Desc().err; err == nil {
+			t.Errorf("%+v: expected error", opts)
+		}
+	}
+}
+
+func TestNameComponents(t *testing.T) {
+	scenarios := []struct {
+		namespace, subsystem, name string
+		valid                      bool
+	}{
+		{"app", "http", "requests_total", true},
+		{"", "", "requests_total", true},
+		{"app", "2xx", "requests_total", true},
+		{"", "2xx", "requests_total", false},
+		{"my-app", "http", "requests_total", false},
+		{"app", "http.server", "requests_total", false},
+		{"app", "", "requests total", false},
+	}
+	for i, s := range scenarios {
+		c := NewCounter(CounterOpts{Namespace: s.namespace, Subsystem: s.subsystem, Name: s.name, Help: "help"})
+		if got := c.Desc().err == nil; got != s.valid {
+			t.Errorf("%d. %q %q %q: got valid=%t, want %t (err: %v)", i, s.namespace, s.subsystem, s.name, got, s.valid, c.Desc().err)
+		}
+	}
+
+	for in, want := range map[string]string{
+		"valid":      "valid",
+		"my-service": "my_service",
+		"9lives":     "_9lives",
+		"a.b c":      "a_b_c",
+		"":           "",
+	} {
+		if got := SanitizeNameComponent(in); got != want {
+			t.Errorf("SanitizeNameComponent(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIsValidNames(t *testing.T) {
+	if !IsValidMetricName("http_requests_total") || IsValidMetricName("http.requests") {
+		t.Error("unexpected IsValidMetricName result")
+	}
+	if !IsValidLabelName("code") || IsValidLabelName("__name__") || IsValidLabelName("a:b") {
+		t.Error("unexpected IsValidLabelName result")
+	}
+}
+
+func TestAllowUTF8Names(t *testing.T) {
+	AllowUTF8Names(true)
+	defer AllowUTF8Names(false)
+
+	if !IsValidMetricName("http.server.requests") || IsValidMetricName("") || IsValidMetricName("\xff") {
+		t.Error("unexpected IsValidMetricName result")
+	}
+	if !IsValidLabelName("service.name") || IsValidLabelName("__name__") || IsValidLabelName("") {
+		t.Error("unexpected IsValidLabelName result")
+	}
+
+	r := newRegistry()
+	vec := NewCounterVec(CounterOpts{
+		Namespace:   "http.server",
+		Name:        "requests_total",
+		Help:        "Requests.",
+		ConstLabels: Labels{"service.name": "checkout"},
+	}, []string{"http.method"})
+	r.MustRegister(vec)
+	vec.WithLabelValues("GET").Inc()
+	r.MustRegister(NewGauge(GaugeOpts{Name: "legacy", Help: "Legacy."}))
+	var buf bytes.Buffer
+	if _, _, err := r.writeNegotiated(context.Background(), &buf, "", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`# TYPE "http.server_requests_total" counter`,
+		`{"http.server_requests_total","http.method"="GET","service.name"="checkout"} 1`,
+		"# TYPE legacy gauge\nlegacy 0\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	// A variable label does not share its dimension with a const label
+	// whose name is the internal prefix plus the variable label name.
+	variable := NewDesc("a", "help", []string{"x"}, nil)
+	constant := NewDesc("a", "help", nil, Labels{"$x": "v"})
+	if variable.err != nil || constant.err != nil {
+		t.Fatal(variable.err, constant.err)
+	}
+	if variable.dimHash == constant.dimHash {
+		t.Error("variable and const label dimensions hash identically")
+	}
+
+	AllowUTF8Names(false)
+	if err := newRegistry().Register(NewCounter(CounterOpts{Name: "a.b", Help: "help"})); err == nil {
+		t.Error("registering a UTF-8 name succeeded with the legacy name rules")
+	}
+}
+
+func TestReservedLabelNames(t *testing.T) {
+	for _, name := range []string{"__name__", "le", "quantile", "job", "instance"} {
+		if !IsReservedLabelName(name) {
+			t.Errorf("%q should be reserved", name)
+		}
+	}
+	if IsReservedLabelName("code") {
+		t.Error(`"code" should not be reserved`)
+	}
+
+	r := newRegistry()
+	if err := r.Register(NewSummaryVec(SummaryOpts{Name: "a", Help: "a"}, []string{"quantile"})); err == nil {
+		t.Error("expected error for variable label quantile in summary")
+	}
+	if err := r.Register(NewSummary(SummaryOpts{Name: "b", Help: "b", ConstLabels: Labels{"quantile": "x"}})); err == nil {
+		t.Error("expected error for constant label quantile in summary")
+	}
+	if err := r.Register(NewSummaryVec(SummaryOpts{Name: "d", Help: "d"}, []string{"le"})); err == nil {
+		t.Error("expected error for variable label le in summary")
+	}
+	if err := r.Register(NewSummary(SummaryOpts{Name: "e", Help: "e", ConstLabels: Labels{"le": "1"}})); err == nil {
+		t.Error("expected error for constant label le in summary")
+	}
+	for _, name := range []string{"quantile", "le"} {
+		desc := NewDesc("f_"+name, "f", []string{name}, nil)
+		if _, err := NewConstSummary(desc, 1, 1, nil, "x"); err == nil {
+			t.Errorf("expected error for label %s in const summary", name)
+		}
+	}
+	if err := r.Register(NewCounterVec(CounterOpts{Name: "c", Help: "c"}, []string{"quantile"})); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if d := NewDesc("g", "g", []string{"__name__"}, nil); d.err == nil {
+		t.Error("expected error for label __name__")
+	}
+
+	var logged recordingLogger
+	SetReservedLabelLogger(&logged)
+	defer SetReservedLabelLogger(nil)
+	NewDesc("h", "h", []string{"job", "code"}, Labels{"instance": "a"})
+	NewDesc("h", "h", []string{"job", "code"}, Labels{"instance": "a"})
+	NewCounterVec(CounterOpts{Name: "i", Help: "i"}, []string{"le"})
+	want := recordingLogger{
+		`metric h uses the reserved label name "instance"`,
+		`metric h uses the reserved label name "job"`,
+		`metric i uses the reserved label name "le"`,
+	}
+	if fmt.Sprint(logged) != fmt.Sprint(want) {
+		t.Errorf("got log %q, want %q", logged, want)
+	}
+}
+
+func TestSanitizeLabelValue(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                   "",
+		"valid ✓":            "valid ✓",
+		"/path/\xff\xfe":     "/path/�",
+		"a\xffb\xfe\xfdc":    "a�b�c",
+		"\xe2\x9c�\xff":      "���",
+		"truncated \xe2\x9c": "truncated �",
+		"� stays �":          "� stays �",
+	} {
+		if got := SanitizeLabelValue(in); got != want {
+			t.Errorf("SanitizeLabelValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
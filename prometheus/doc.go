@@ -84,6 +84,15 @@
 // Functions to fine-tune how the metric registry works: EnableCollectChecks,
 // PanicOnCollectError, Register, Unregister, SetMetricFamilyInjectionHook.
 //
+// By default, invalid label values passed to With, WithLabelValues, or
+// WithContext of a metric vector cause a panic. PanicOnInstrumentationError
+// switches to counting those errors instead, so that a bad label value does
+// not take down a serving binary.
+//
+// Additional registries can be created with NewRegistry. A MultiHandler serves
+// the metrics of different registries (or filtered views of them, see
+// FilteredHandler) under different paths.
+//
 // For custom metric collection, there are two entry points: Custom Metric
 // implementations and custom Collector implementations. A Metric is the
 // fundamental unit in the Prometheus data model: a sample at a point in time
@@ -104,5 +113,6 @@
 //
 // A good example for a custom Collector is the ExpVarCollector included in this
 // package, which exports variables exported via the "expvar" package as
-// Prometheus metrics.
+// Prometheus metrics. The FederationCollector is another example: It includes
+// the metrics scraped from another metrics endpoint.
 package prometheus
@@ -0,0 +1,268 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dogstatsd provides an Emitter that periodically sends metrics as
+// DogStatsD datagrams to a Datadog agent. It allows the same instrumentation
+// to feed a Datadog agent alongside the exposition to Prometheus:
+//
+//     e := dogstatsd.NewEmitter(dogstatsd.EmitterOpts{})
+//     go e.Run(ctx)
+//     http.Handle("/metrics", prometheus.Handler())
+//
+// Counters are sent as DogStatsD counts of the increments since the previous
+// emission (counter resets are detected and handled). Gauges and untyped
+// metrics are sent as DogStatsD gauges. Summaries are sent as one gauge per
+// quantile (with an additional "quantile" tag) and the increments of the
+// sample sum and count as counts with the suffixes "_sum" and "_count". Labels
+// are sent as tags of the form "<label name>:<label value>".
+package dogstatsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Default values for EmitterOpts.
+const (
+	// DefAddr is the default address of the Datadog agent.
+	DefAddr = "127.0.0.1:8125"
+	// DefInterval is the default interval between two emissions of
+	// Emitter.Run.
+	DefInterval = 10 * time.Second
+	// DefMaxPacketSize is the default maximum size of a datagram. It fits
+	// into the MTU of a typical Ethernet network.
+	DefMaxPacketSize = 1432
+)
+
+var tagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// EmitterOpts bundles the options for creating an Emitter. All fields are
+// optional and can safely be left at their zero value.
+type EmitterOpts struct {
+	// Addr is the UDP address of the Datadog agent. The default value is
+	// DefAddr.
+	Addr string
+
+	// Gatherer provides the metrics to emit. The default value is
+	// prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+
+	// Interval is the interval between two emissions when the Emitter is
+	// running (see Run). The default value is DefInterval.
+	Interval time.Duration
+
+	// Prefix is prepended to all metric names, e.g. "myapp.".
+	Prefix string
+
+	// Tags are added to all sent metrics, e.g. "env:prod".
+	Tags []string
+
+	// MaxPacketSize is the maximum size of a datagram. Several metrics are
+	// packed into one datagram, separated by newlines, as long as they
+	// fit. The default value is DefMaxPacketSize.
+	MaxPacketSize int
+
+	// ErrorHandler is called with every error encountered by Run. Run
+	// continues with the next interval after an error. If nil, errors are
+	// silently dropped.
+	ErrorHandler func(error)
+}
+
+// Emitter sends metrics of a Gatherer as DogStatsD datagrams. Create instances
+// with NewEmitter. An Emitter is safe to be used concurrently.
+type Emitter struct {
+	addr          string
+	gatherer      prometheus.Gatherer
+	interval      time.Duration
+	prefix        string
+	tags          []string
+	maxPacketSize int
+	errorHandler  func(error)
+
+	mtx  sync.Mutex
+	conn net.Conn
+	// Previous values of counters (and of sums and counts of summaries)
+	// by their line without the value, to calculate the increments. Only
+	// the values of the most recent emission are kept, so that series that
+	// have disappeared do not accumulate.
+	prev map[string]float64
+}
+
+// NewEmitter creates a new Emitter based on the provided EmitterOpts.
+func NewEmitter(opts EmitterOpts) *Emitter {
+	e := &Emitter{
+		addr:          opts.Addr,
+		gatherer:      opts.Gatherer,
+		interval:      opts.Interval,
+		prefix:        opts.Prefix,
+		tags:          opts.Tags,
+		maxPacketSize: opts.MaxPacketSize,
+		errorHandler:  opts.ErrorHandler,
+		prev:          map[string]float64{},
+	}
+	if e.addr == "" {
+		e.addr = DefAddr
+	}
+	if e.gatherer == nil {
+		e.gatherer = prometheus.DefaultGatherer
+	}
+	if e.interval <= 0 {
+		e.interval = DefInterval
+	}
+	if e.maxPacketSize <= 0 {
+		e.maxPacketSize = DefMaxPacketSize
+	}
+	return e
+}
+
+// Emit gathers all metrics once and sends them to the Datadog agent.
+func (e *Emitter) Emit() error {
+	mfs, err := e.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.conn == nil {
+		if e.conn, err = net.Dial("udp", e.addr); err != nil {
+			return err
+		}
+	}
+	var lines []string
+	next := make(map[string]float64, len(e.prev))
+	for _, mf := range mfs {
+		lines = append(lines, e.lines(mf, next)...)
+	}
+	e.prev = next
+
+	packet := &bytes.Buffer{}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > e.maxPacketSize {
+			if _, err := e.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		if _, err := e.conn.Write(packet.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run calls Emit once per configured interval until ctx is done. Errors are
+// passed to the configured ErrorHandler.
+func (e *Emitter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Emit(); err != nil && e.errorHandler != nil {
+				e.errorHandler(err)
+			}
+		}
+	}
+}
+
+// lines returns the DogStatsD lines for all metrics of the MetricFamily. The
+// current values of counters are stored in next, which replaces e.prev once all
+// MetricFamilies are processed. It must be called with e.mtx locked.
+func (e *Emitter) lines(mf *dto.MetricFamily, next map[string]float64) []string {
+	var lines []string
+	gauge := func(name string, tags string, v float64) {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return
+		}
+		lines = append(lines, e.prefix+name+":"+formatFloat(v)+"|g"+tags)
+	}
+	count := func(name string, tags string, v float64) {
+		key := name + tags
+		prev, ok := e.prev[key]
+		next[key] = v
+		delta := v - prev
+		if !ok || v < prev {
+			// First emission or counter reset.
+			delta = v
+		}
+		if delta == 0 || math.IsNaN(delta) || math.IsInf(delta, 0) {
+			return
+		}
+		lines = append(lines, e.prefix+name+":"+formatFloat(delta)+"|c"+tags)
+	}
+
+	name := mf.GetName()
+	for _, m := range mf.Metric {
+		tags := e.formatTags(m.Label, "")
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			count(name, tags, m.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			gauge(name, tags, m.GetGauge().GetValue())
+		case dto.MetricType_UNTYPED:
+			gauge(name, tags, m.GetUntyped().GetValue())
+		case dto.MetricType_SUMMARY:
+			for _, q := range m.GetSummary().Quantile {
+				gauge(name, e.formatTags(m.Label, fmt.Sprint(q.GetQuantile())), q.GetValue())
+			}
+			count(name+"_sum", tags, m.GetSummary().GetSampleSum())
+			count(name+"_count", tags, float64(m.GetSummary().GetSampleCount()))
+		}
+	}
+	return lines
+}
+
+// formatTags returns the "|#..." suffix of a DogStatsD line for the provided
+// labels, the constant tags, and (if not empty) a quantile tag. Tags are
+// sorted so that the same label set always results in the same suffix.
+func (e *Emitter) formatTags(labels []*dto.LabelPair, quantile string) string {
+	tags := make([]string, 0, len(labels)+len(e.tags)+1)
+	tags = append(tags, e.tags...)
+	for _, lp := range labels {
+		tags = append(tags, lp.GetName()+":"+tagEscaper.Replace(lp.GetValue()))
+	}
+	if quantile != "" {
+		tags = append(tags, "quantile:"+quantile)
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,146 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dogstatsd
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// receive reads datagrams from conn until no more arrive and returns all
+// received lines, sorted.
+func receive(t *testing.T, conn net.PacketConn) []string {
+	var lines []string
+	buf := make([]byte, 65535)
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestEmit(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "docstring",
+	}, []string{"code"})
+	reg.MustRegister(counter)
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "queue_size",
+		Help: "docstring",
+	})
+	reg.MustRegister(gauge)
+
+	e := NewEmitter(EmitterOpts{
+		Addr:     agent.LocalAddr().String(),
+		Gatherer: reg,
+		Prefix:   "app.",
+		Tags:     []string{"env:test"},
+	})
+
+	counter.WithLabelValues("200").Add(3)
+	counter.WithLabelValues("5|0,0").Add(1)
+	gauge.Set(7)
+	if err := e.Emit(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"app.queue_size:7|g|#env:test",
+		"app.requests_total:1|c|#code:5_0_0,env:test",
+		"app.requests_total:3|c|#code:200,env:test",
+	}
+	if got := receive(t, agent); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Only increments are sent for counters.
+	counter.WithLabelValues("200").Add(2)
+	if err := e.Emit(); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"app.queue_size:7|g|#env:test",
+		"app.requests_total:2|c|#code:200,env:test",
+	}
+	if got := receive(t, agent); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Previous values of disappeared series are forgotten.
+	counter.DeleteLabelValues("5|0,0")
+	if err := e.Emit(); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, agent)
+	if got, want := len(e.prev), 1; got != want {
+		t.Errorf("got %d previous values, want %d", got, want)
+	}
+}
+
+func TestEmitPacketSize(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "g",
+		Help: "docstring",
+	}, []string{"l"})
+	gauge.WithLabelValues("a").Set(1)
+	gauge.WithLabelValues("b").Set(2)
+	reg.MustRegister(gauge)
+
+	e := NewEmitter(EmitterOpts{
+		Addr:          agent.LocalAddr().String(),
+		Gatherer:      reg,
+		MaxPacketSize: 20,
+	})
+	if err := e.Emit(); err != nil {
+		t.Fatal(err)
+	}
+	var packets []string
+	buf := make([]byte, 100)
+	for {
+		agent.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := agent.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+	if want := []string{"g:1|g|#l:a", "g:2|g|#l:b"}; !reflect.DeepEqual(packets, want) {
+		t.Errorf("got packets %q, want %q", packets, want)
+	}
+}
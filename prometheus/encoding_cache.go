@@ -0,0 +1,182 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"io"
+	"math"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/model"
+)
+
+// encodingCache keeps the encoded form of selected metric families around
+// between scrapes. An entry is reused as long as the fingerprint of the
+// gathered family is unchanged, so that info-style metrics and rarely
+// changing gauges are only encoded again after one of their values changed.
+type encodingCache struct {
+	mtx     sync.Mutex // Protects the fields below.
+	names   map[string]struct{}
+	entries map[string]*cachedEncoding // By metric family name.
+}
+
+// cachedEncoding holds the encodings of one metric family, by format, all
+// created from the metric family with the given fingerprint.
+type cachedEncoding struct {
+	fingerprint uint64
+	encoded     map[string][]byte
+}
+
+// add marks the metric families with the provided names as cacheable.
+func (c *encodingCache) add(names []string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.names == nil {
+		c.names = map[string]struct{}{}
+		c.entries = map[string]*cachedEncoding{}
+	}
+	for _, name := range names {
+		c.names[name] = struct{}{}
+	}
+}
+
+// remove removes the metric families with the provided names from the cache.
+func (c *encodingCache) remove(names []string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, name := range names {
+		delete(c.names, name)
+		delete(c.entries, name)
+	}
+}
+
+// cached returns the encoding of mf in the provided format if mf is cacheable
+// and the cached encoding has been created from an identical metric family.
+// The returned fingerprint is only meaningful if ok is true.
+func (c *encodingCache) cached(mf *dto.MetricFamily, format string) (encoded []byte, fingerprint uint64, ok bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.names[mf.GetName()]; !ok {
+		return nil, 0, false
+	}
+	fingerprint = familyFingerprint(mf)
+	if e, ok := c.entries[mf.GetName()]; ok && e.fingerprint == fingerprint {
+		return e.encoded[format], fingerprint, true
+	}
+	return nil, fingerprint, true
+}
+
+// store remembers the encoding of the metric family with the provided name and
+// fingerprint in the provided format. Encodings in other formats are discarded
+// if they were created from a different fingerprint.
+func (c *encodingCache) store(name string, fingerprint uint64, format string, encoded []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.names[name]; !ok {
+		return
+	}
+	e, ok := c.entries[name]
+	if !ok || e.fingerprint != fingerprint {
+		e = &cachedEncoding{
+			fingerprint: fingerprint,
+			encoded:     map[string][]byte{},
+		}
+		c.entries[name] = e
+	}
+	e.encoded[format] = encoded
+}
+
+// CacheEncoding works like the package-level function of the same name, but
+// for this Registry.
+func (r *Registry) CacheEncoding(familyNames ...string) {
+	r.encodingCache.add(familyNames)
+}
+
+// UncacheEncoding works like the package-level function of the same name, but
+// for this Registry.
+func (r *Registry) UncacheEncoding(familyNames ...string) {
+	r.encodingCache.remove(familyNames)
+}
+
+// writeCached writes mf with writeEncoded, reusing the cached encoding in the
+// provided format if there is one. Metric families not marked for caching are
+// simply passed on to writeEncoded.
+func (r *Registry) writeCached(w io.Writer, mf *dto.MetricFamily, format string, writeEncoded encoder) (int, error) {
+	encoded, fingerprint, ok := r.encodingCache.cached(mf, format)
+	if !ok {
+		return writeEncoded(w, mf)
+	}
+	if encoded != nil {
+		return w.Write(encoded)
+	}
+
+	buf := r.getBuf()
+	defer r.giveBuf(buf)
+	if _, err := writeEncoded(buf, mf); err != nil {
+		return 0, err
+	}
+	// The buffer goes back into the pool, so the cache needs its own copy.
+	r.encodingCache.store(mf.GetName(), fingerprint, format, append([]byte(nil), buf.Bytes()...))
+	return w.Write(buf.Bytes())
+}
+
+// familyFingerprint hashes everything in mf that ends up in its encoding. It
+// is much cheaper than encoding mf, in particular in the text format.
+func familyFingerprint(mf *dto.MetricFamily) uint64 {
+	h := hashNew()
+	h = hashAdd(h, mf.GetName())
+	h = hashAddByte(h, model.SeparatorByte)
+	h = hashAdd(h, mf.GetHelp())
+	h = hashAddByte(h, model.SeparatorByte)
+	h = hashAddByte(h, byte(mf.GetType()))
+	for _, m := range mf.Metric {
+		h = hashAddByte(h, model.SeparatorByte)
+		for _, lp := range m.Label {
+			h = hashAdd(h, lp.GetName())
+			h = hashAddByte(h, model.SeparatorByte)
+			h = hashAdd(h, lp.GetValue())
+			h = hashAddByte(h, model.SeparatorByte)
+		}
+		switch {
+		case m.Counter != nil:
+			h = hashAddFloat(h, m.Counter.GetValue())
+		case m.Gauge != nil:
+			h = hashAddFloat(h, m.Gauge.GetValue())
+		case m.Untyped != nil:
+			h = hashAddFloat(h, m.Untyped.GetValue())
+		case m.Summary != nil:
+			h = hashAddUint64(h, m.Summary.GetSampleCount())
+			h = hashAddFloat(h, m.Summary.GetSampleSum())
+			for _, q := range m.Summary.Quantile {
+				h = hashAddFloat(h, q.GetQuantile())
+				h = hashAddFloat(h, q.GetValue())
+			}
+		}
+		if m.TimestampMs != nil {
+			h = hashAddByte(h, 1)
+			h = hashAddUint64(h, uint64(m.GetTimestampMs()))
+		}
+	}
+	return h
+}
+
+func hashAddFloat(h uint64, f float64) uint64 {
+	return hashAddUint64(h, math.Float64bits(f))
+}
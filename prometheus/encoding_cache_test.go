@@ -0,0 +1,110 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	"github.com/prometheus/client_golang/text"
+)
+
+func TestEncodingCache(t *testing.T) {
+	r := newRegistry()
+	info := NewGauge(GaugeOpts{Name: "build_info", Help: "Build info."})
+	other := NewGauge(GaugeOpts{Name: "other", Help: "Not cached."})
+	r.MustRegister(info)
+	r.MustRegister(other)
+	r.CacheEncoding("build_info")
+	info.Set(1)
+
+	encoded := map[string]int{}
+	countingEncoder := func(w io.Writer, mf *dto.MetricFamily) (int, error) {
+		encoded[mf.GetName()]++
+		return text.MetricFamilyToText(w, mf)
+	}
+	scrape := func() string {
+		var buf bytes.Buffer
+		if _, err := r.writePB(context.Background(), &buf, countingEncoder, "text", nil, false); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	first := scrape()
+	if second := scrape(); second != first {
+		t.Errorf("cached scrape differs:\n%s\nwant:\n%s", second, first)
+	}
+	if got, want := encoded["build_info"], 1; got != want {
+		t.Errorf("build_info encoded %d times, want %d", got, want)
+	}
+	if got, want := encoded["other"], 2; got != want {
+		t.Errorf("other encoded %d times, want %d", got, want)
+	}
+
+	info.Set(2)
+	changed := scrape()
+	if got, want := encoded["build_info"], 2; got != want {
+		t.Errorf("build_info encoded %d times after change, want %d", got, want)
+	}
+	if !bytes.Contains([]byte(changed), []byte("build_info 2")) {
+		t.Errorf("stale encoding served after change:\n%s", changed)
+	}
+
+	// A different format must not be served from the text encoding.
+	var buf bytes.Buffer
+	if _, err := r.writePB(context.Background(), &buf, countingEncoder, "other-format", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := encoded["build_info"], 3; got != want {
+		t.Errorf("build_info encoded %d times for new format, want %d", got, want)
+	}
+
+	r.UncacheEncoding("build_info")
+	scrape()
+	scrape()
+	if got, want := encoded["build_info"], 5; got != want {
+		t.Errorf("build_info encoded %d times after uncaching, want %d", got, want)
+	}
+}
+
+func TestFamilyFingerprint(t *testing.T) {
+	newFamily := func(labelValue string, value float64) *dto.MetricFamily {
+		return &dto.MetricFamily{
+			Name: proto.String("name"),
+			Help: proto.String("help"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{{Name: proto.String("l"), Value: proto.String(labelValue)}},
+				Gauge: &dto.Gauge{Value: proto.Float64(value)},
+			}},
+		}
+	}
+	base := familyFingerprint(newFamily("a", 1))
+	if got := familyFingerprint(newFamily("a", 1)); got != base {
+		t.Error("identical families have different fingerprints")
+	}
+	if got := familyFingerprint(newFamily("b", 1)); got == base {
+		t.Error("changed label value did not change the fingerprint")
+	}
+	if got := familyFingerprint(newFamily("a", 2)); got == base {
+		t.Error("changed value did not change the fingerprint")
+	}
+}
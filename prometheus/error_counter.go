@@ -0,0 +1,209 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ErrorTypeLabel is the name of the label by which an ErrorCounter partitions
+// the counted errors.
+const ErrorTypeLabel = "error_type"
+
+// ErrorTypeUnknown is the value of ErrorTypeLabel for errors not matched by any
+// ErrorClass of an ErrorCounter.
+const ErrorTypeUnknown = "unknown"
+
+// ErrorClass assigns the value of ErrorTypeLabel to the errors it matches.
+type ErrorClass struct {
+	// Type is the value of ErrorTypeLabel for matching errors.
+	Type string
+	// Match reports whether the error belongs to the class.
+	Match func(error) bool
+}
+
+// ErrorIs returns an ErrorClass matching all errors for which errors.Is(err,
+// target) is true, i.e. err or an error it wraps is equal to target or has an
+// Is method reporting so. Wrapped errors are found like by walkErrors.
+func ErrorIs(target error, errorType string) ErrorClass {
+	comparable := target == nil || reflect.TypeOf(target).Comparable()
+	return ErrorClass{
+		Type: errorType,
+		Match: func(err error) bool {
+			return walkErrors(err, func(err error) bool {
+				if comparable && err == target {
+					return true
+				}
+				is, ok := err.(interface {
+					Is(error) bool
+				})
+				return ok && is.Is(target)
+			})
+		},
+	}
+}
+
+// ErrorAs returns an ErrorClass matching all errors for which errors.As(err,
+// target) would succeed, e.g. ErrorAs(new(*net.OpError), "network"), i.e. err
+// or an error it wraps is assignable to the type target points to or has an As
+// method reporting so. target must be a pointer as required by errors.As. It is
+// only used for its type and never written to, so that the ErrorClass is safe
+// for concurrent use. Wrapped errors are found like by walkErrors.
+func ErrorAs(target interface{}, errorType string) ErrorClass {
+	typ := reflect.TypeOf(target)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		panic(fmt.Errorf("ErrorAs target must be a pointer, got %T", target))
+	}
+	typ = typ.Elem()
+	return ErrorClass{
+		Type: errorType,
+		Match: func(err error) bool {
+			return walkErrors(err, func(err error) bool {
+				if reflect.TypeOf(err).AssignableTo(typ) {
+					return true
+				}
+				as, ok := err.(interface {
+					As(interface{}) bool
+				})
+				return ok && as.As(reflect.New(typ).Interface())
+			})
+		},
+	}
+}
+
+// walkErrors calls match for err and the errors it wraps, depth-first, until
+// match returns true. Wrapped errors are those returned by an Unwrap method
+// returning an error or, like MultiError, a slice of errors. This follows the
+// conventions of the errors package of Go 1.13 and later while still building
+// with older Go versions.
+func walkErrors(err error, match func(error) bool) bool {
+	for err != nil {
+		if match(err) {
+			return true
+		}
+		switch u := err.(type) {
+		case interface {
+			Unwrap() error
+		}:
+			err = u.Unwrap()
+		case interface {
+			Unwrap() []error
+		}:
+			for _, err := range u.Unwrap() {
+				if walkErrors(err, match) {
+					return true
+				}
+			}
+			return false
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// ErrorCounter counts errors in a CounterVec partitioned by ErrorTypeLabel,
+// classifying each error by the first matching ErrorClass. This standardizes
+// metrics about errors across code bases. Create instances with
+// NewErrorCounter.
+type ErrorCounter struct {
+	classCounter
+}
+
+// NewErrorCounter returns an ErrorCounter incrementing the children of vec,
+// which must have ErrorTypeLabel as one of its variable labels. Errors are
+// matched against the classes in the given order. Errors matching none of them
+// are counted as ErrorTypeUnknown. If ErrorTypeLabel is the only variable
+// label of vec, the children for all classes are initialized to zero so that
+// they are exported before the first error occurs.
+func NewErrorCounter(vec *CounterVec, classes ...ErrorClass) *ErrorCounter {
+	return &ErrorCounter{newClassCounter(vec, ErrorTypeLabel, ErrorTypeUnknown, classes)}
+}
+
+// Inc increments the child for the class of err and the provided values of the
+// other variable labels. It does nothing if err is nil. Invalid labels are
+// handled as by CounterVec.With.
+func (e *ErrorCounter) Inc(err error, labels Labels) {
+	if err == nil {
+		return
+	}
+	e.inc(e.Classify(err), labels)
+}
+
+// Classify returns the value of ErrorTypeLabel for err.
+func (e *ErrorCounter) Classify(err error) string {
+	return e.classify(err)
+}
+
+// classCounter is the part ErrorCounter and OutcomeCounter have in common: a
+// CounterVec partitioned by a label whose value for an error is the type of
+// the first matching ErrorClass, or a fallback value.
+type classCounter struct {
+	vec      *CounterVec
+	label    string
+	classes  []ErrorClass
+	fallback string
+}
+
+// newClassCounter returns a classCounter for vec, which must have label as one
+// of its variable labels. If label is the only variable label of vec, the
+// children for the provided initial values, for all classes, and for fallback
+// are initialized to zero, in that order.
+func newClassCounter(vec *CounterVec, label, fallback string, classes []ErrorClass, initial ...string) classCounter {
+	found := false
+	for _, name := range vec.desc.variableLabels {
+		if name == label {
+			found = true
+		}
+	}
+	if !found {
+		panic(fmt.Errorf(
+			"metric vector %s has no variable label %q",
+			vec.desc.fqName, label,
+		))
+	}
+	if len(vec.desc.variableLabels) == 1 {
+		for _, value := range initial {
+			vec.WithLabelValues(value)
+		}
+		for _, class := range classes {
+			vec.WithLabelValues(class.Type)
+		}
+		vec.WithLabelValues(fallback)
+	}
+	return classCounter{vec: vec, label: label, classes: classes, fallback: fallback}
+}
+
+// classify returns the type of the first class matching err, or the fallback
+// value.
+func (c *classCounter) classify(err error) string {
+	for _, class := range c.classes {
+		if class.Match(err) {
+			return class.Type
+		}
+	}
+	return c.fallback
+}
+
+// inc increments the child with the label of c set to value and the other
+// variable labels set to the provided labels.
+func (c *classCounter) inc(value string, labels Labels) {
+	merged := make(Labels, len(labels)+1)
+	for name, v := range labels {
+		merged[name] = v
+	}
+	merged[c.label] = value
+	c.vec.With(merged).Inc()
+}
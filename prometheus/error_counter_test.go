@@ -0,0 +1,86 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestErrorCounter(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{Name: "errors_total", Help: "Errors."},
+		[]string{"op", ErrorTypeLabel},
+	)
+	errs := NewErrorCounter(
+		vec,
+		ErrorIs(io.EOF, "eof"),
+		ErrorAs(new(*os.PathError), "path"),
+	)
+
+	errs.Inc(nil, Labels{"op": "read"})
+	errs.Inc(wrappedError{"reading header", io.EOF}, Labels{"op": "read"})
+	errs.Inc(MultiError{errors.New("closing"), io.EOF}, Labels{"op": "read"})
+	errs.Inc(io.EOF, Labels{"op": "read"})
+	errs.Inc(&os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, Labels{"op": "open"})
+	errs.Inc(errors.New("boom"), Labels{"op": "open"})
+
+	for _, c := range []struct {
+		op, errorType string
+		want          float64
+	}{
+		{"read", "eof", 3},
+		{"open", "path", 1},
+		{"open", ErrorTypeUnknown, 1},
+	} {
+		m := &dto.Metric{}
+		vec.WithLabelValues(c.op, c.errorType).Write(m)
+		if got := m.GetCounter().GetValue(); got != c.want {
+			t.Errorf("op %q, %s %q: got %v, want %v", c.op, ErrorTypeLabel, c.errorType, got, c.want)
+		}
+	}
+	if got, want := vec.numChildren, 3; got != want {
+		t.Errorf("got %d children, want %d", got, want)
+	}
+
+	single := NewCounterVec(
+		CounterOpts{Name: "single_errors_total", Help: "Errors."},
+		[]string{ErrorTypeLabel},
+	)
+	NewErrorCounter(single, ErrorIs(io.EOF, "eof"))
+	if got, want := single.numChildren, 2; got != want {
+		t.Errorf("got %d initialized children, want %d", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for vector without error_type label")
+		}
+	}()
+	NewErrorCounter(NewCounterVec(CounterOpts{Name: "x", Help: "x"}, []string{"op"}))
+}
+
+// wrappedError wraps err like fmt.Errorf with the %w verb, which is not
+// available in all supported Go versions.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e wrappedError) Error() string { return e.msg + ": " + e.err.Error() }
+func (e wrappedError) Unwrap() error { return e.err }
@@ -16,6 +16,10 @@ package prometheus
 import (
 	"encoding/json"
 	"expvar"
+	"math"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
 )
 
 // ExpvarCollector collects metrics from the expvar interface. It provides a
@@ -117,3 +121,107 @@ func (e *ExpvarCollector) Collect(ch chan<- Metric) {
 		processValue(v, 0)
 	}
 }
+
+// ExpvarFunc returns an expvar.Func that gathers from the provided Gatherer each
+// time it is evaluated and returns a snapshot of the result as created by
+// Snapshot. It is the inverse of the ExpvarCollector: It allows tooling that
+// only understands expvar to read Prometheus metrics, which is mostly useful
+// during a migration. If gathering fails, the snapshot is an object with the
+// error message in the field "error".
+func ExpvarFunc(g Gatherer) expvar.Func {
+	return func() interface{} {
+		mfs, err := g.Gather()
+		if err != nil {
+			return map[string]string{"error": err.Error()}
+		}
+		return Snapshot(mfs)
+	}
+}
+
+// Snapshot converts the provided MetricFamily protobufs into a form suitable for
+// JSON encoding. The snapshot maps each metric name to an object with the fields
+// "help", "type", and "metrics". The latter is a list of objects with the
+// fields "labels" (an object mapping label names to label values), "value",
+// and, if the metric has an explicit timestamp, "timestamp_ms". For summaries,
+// "value" is replaced by "count", "sum", and "quantiles" (an object mapping
+// quantiles to their values). Values that cannot be represented in JSON (NaN
+// and infinities) are encoded as strings.
+func Snapshot(mfs []*dto.MetricFamily) map[string]interface{} {
+	snapshot := make(map[string]interface{}, len(mfs))
+	for _, mf := range mfs {
+		metrics := make([]map[string]interface{}, 0, len(mf.Metric))
+		for _, m := range mf.Metric {
+			metrics = append(metrics, expvarMetric(m))
+		}
+		snapshot[mf.GetName()] = map[string]interface{}{
+			"help":    mf.GetHelp(),
+			"type":    expvarType(mf.GetType()),
+			"metrics": metrics,
+		}
+	}
+	return snapshot
+}
+
+// PublishExpvar publishes the metrics of the provided Gatherer under the given
+// name via expvar, see ExpvarFunc. Use DefaultGatherer to publish the metrics
+// of the default registry. As expvar.Publish, it panics if the name is already
+// in use.
+func PublishExpvar(name string, g Gatherer) {
+	expvar.Publish(name, ExpvarFunc(g))
+}
+
+func expvarMetric(m *dto.Metric) map[string]interface{} {
+	labels := make(map[string]string, len(m.Label))
+	for _, lp := range m.Label {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	result := map[string]interface{}{"labels": labels}
+	if m.TimestampMs != nil {
+		result["timestamp_ms"] = m.GetTimestampMs()
+	}
+	switch {
+	case m.Counter != nil:
+		result["value"] = expvarFloat(m.Counter.GetValue())
+	case m.Gauge != nil:
+		result["value"] = expvarFloat(m.Gauge.GetValue())
+	case m.Untyped != nil:
+		result["value"] = expvarFloat(m.Untyped.GetValue())
+	case m.Summary != nil:
+		quantiles := make(map[string]interface{}, len(m.Summary.Quantile))
+		for _, q := range m.Summary.Quantile {
+			quantiles[strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)] = expvarFloat(q.GetValue())
+		}
+		result["count"] = m.Summary.GetSampleCount()
+		result["sum"] = expvarFloat(m.Summary.GetSampleSum())
+		result["quantiles"] = quantiles
+	}
+	return result
+}
+
+func expvarType(t dto.MetricType) string {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return "counter"
+	case dto.MetricType_GAUGE:
+		return "gauge"
+	case dto.MetricType_SUMMARY:
+		return "summary"
+	default:
+		return "untyped"
+	}
+}
+
+// expvarFloat returns v as is if it can be represented in JSON, or as a string
+// otherwise.
+func expvarFloat(v float64) interface{} {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return v
+	}
+}
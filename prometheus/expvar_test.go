@@ -14,10 +14,14 @@
 package prometheus_test
 
 import (
+	"encoding/json"
 	"expvar"
 	"fmt"
+	"math"
+	"reflect"
 	"sort"
 	"strings"
+	"testing"
 
 	dto "github.com/prometheus/client_model/go"
 
@@ -95,3 +99,67 @@ func ExampleExpvarCollector() {
 	// label:<name:"code" value:"404" > label:<name:"method" value:"POST" > untyped:<value:3 >
 	// untyped:<value:42 >
 }
+
+func TestExpvarFunc(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "Total requests.",
+	}, []string{"code"})
+	counter.WithLabelValues("200").Add(3)
+	reg.MustRegister(counter)
+	reg.MustRegister(prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:       "latency",
+		Help:       "Latency.",
+		Objectives: map[float64]float64{0.5: 0.05},
+	}))
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "limit",
+		Help: "A limit.",
+	})
+	gauge.Set(math.Inf(1))
+	reg.MustRegister(gauge)
+
+	f := prometheus.ExpvarFunc(reg)
+	var got interface{}
+	if err := json.Unmarshal([]byte(f.String()), &got); err != nil {
+		t.Fatalf("snapshot is not valid JSON: %s\n%s", err, f.String())
+	}
+	want := map[string]interface{}{
+		"requests_total": map[string]interface{}{
+			"help": "Total requests.",
+			"type": "counter",
+			"metrics": []interface{}{
+				map[string]interface{}{
+					"labels": map[string]interface{}{"code": "200"},
+					"value":  3.,
+				},
+			},
+		},
+		"latency": map[string]interface{}{
+			"help": "Latency.",
+			"type": "summary",
+			"metrics": []interface{}{
+				map[string]interface{}{
+					"labels":    map[string]interface{}{},
+					"count":     0.,
+					"sum":       0.,
+					"quantiles": map[string]interface{}{"0.5": 0.},
+				},
+			},
+		},
+		"limit": map[string]interface{}{
+			"help": "A limit.",
+			"type": "gauge",
+			"metrics": []interface{}{
+				map[string]interface{}{
+					"labels": map[string]interface{}{},
+					"value":  "+Inf",
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got snapshot\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/matttproud/golang_protobuf_extensions/ext"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/text"
+)
+
+// FederationCollectorOpts bundles the options for creating a
+// FederationCollector. It is mandatory to set URL to a non-empty string. All
+// other fields are optional and can safely be left at their zero value.
+type FederationCollectorOpts struct {
+	// URL is the URL of the metrics endpoint to scrape, e.g.
+	// "http://localhost:9101/metrics". Mandatory!
+	URL string
+
+	// Prefix is prepended to the names of all scraped metrics.
+	Prefix string
+
+	// ConstLabels are added to all scraped metrics. They replace labels of
+	// the same name already present on a scraped metric. They are also
+	// attached to the federation_up metric.
+	ConstLabels Labels
+
+	// Client is the HTTP client used for scraping. Set a Timeout on the
+	// client to prevent a hanging endpoint from blocking the collection of
+	// the registry. The default value is http.DefaultClient.
+	Client *http.Client
+}
+
+// FederationCollector is a Collector that scrapes another metrics endpoint on
+// each collection and includes the scraped metrics in its own results. It
+// allows a process to expose the metrics of child processes it supervises (or
+// of any other exposition in the text or delimited protobuf format) via its own
+// endpoint. Create instances with NewFederationCollector.
+//
+// Additionally, a gauge federation_up is collected, which is 1 if the last
+// scrape succeeded and 0 otherwise. A failed scrape does not fail the
+// collection of the registry. To distinguish the federation_up metrics of
+// several FederationCollectors registered with the same registry, set
+// different ConstLabels on them.
+//
+// The scraped metrics are not known in advance, so they cannot be described
+// by Describe. Thus, a registry with collect checks enabled (see
+// EnableCollectChecks) will report an error when collecting them.
+type FederationCollector struct {
+	url         string
+	prefix      string
+	constLabels Labels
+	client      *http.Client
+	upDesc      *Desc
+}
+
+// NewFederationCollector returns a newly allocated FederationCollector based on
+// the provided FederationCollectorOpts. It still has to be registered.
+func NewFederationCollector(opts FederationCollectorOpts) *FederationCollector {
+	c := &FederationCollector{
+		url:         opts.URL,
+		prefix:      opts.Prefix,
+		constLabels: opts.ConstLabels,
+		client:      opts.Client,
+		upDesc: NewDesc(
+			"federation_up",
+			"Whether the last scrape of the federated metrics endpoint was successful.",
+			nil, opts.ConstLabels,
+		),
+	}
+	if c.client == nil {
+		c.client = http.DefaultClient
+	}
+	return c
+}
+
+// Describe implements Collector. Only the descriptor of the federation_up
+// metric is sent.
+func (c *FederationCollector) Describe(ch chan<- *Desc) {
+	ch <- c.upDesc
+}
+
+// Collect implements Collector.
+func (c *FederationCollector) Collect(ch chan<- Metric) {
+	mfs, err := c.scrape()
+	if err != nil {
+		ch <- MustNewConstMetric(c.upDesc, GaugeValue, 0)
+		return
+	}
+	ch <- MustNewConstMetric(c.upDesc, GaugeValue, 1)
+	for _, mf := range mfs {
+		desc := NewDesc(c.prefix+mf.GetName(), mf.GetHelp(), nil, nil)
+		for _, m := range mf.Metric {
+			c.relabel(m)
+			ch <- &federatedMetric{desc: desc, metric: m}
+		}
+	}
+}
+
+// scrape fetches and decodes the metrics from the URL.
+func (c *FederationCollector) scrape() ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequest("GET", c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(acceptHeader, DelimitedTelemetryContentType+";q=0.7,text/plain;version="+APIVersion+";q=0.3")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d while scraping %s", resp.StatusCode, c.url)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get(contentTypeHeader))
+	if err == nil && mediaType == "application/vnd.google.protobuf" &&
+		params["encoding"] == "delimited" &&
+		params["proto"] == "io.prometheus.client.MetricFamily" {
+		var mfs []*dto.MetricFamily
+		for {
+			mf := &dto.MetricFamily{}
+			if _, err := ext.ReadDelimited(resp.Body, mf); err != nil {
+				if err == io.EOF {
+					return mfs, nil
+				}
+				return nil, err
+			}
+			mfs = append(mfs, mf)
+		}
+	}
+
+	return text.ParseText(resp.Body)
+}
+
+// relabel applies the ConstLabels of the collector to the metric and sorts its
+// labels.
+func (c *FederationCollector) relabel(m *dto.Metric) {
+	labels := make([]*dto.LabelPair, 0, len(m.Label)+len(c.constLabels))
+	for _, lp := range m.Label {
+		if _, ok := c.constLabels[lp.GetName()]; !ok {
+			labels = append(labels, lp)
+		}
+	}
+	for name, value := range c.constLabels {
+		labels = append(labels, &dto.LabelPair{
+			Name:  proto.String(name),
+			Value: proto.String(value),
+		})
+	}
+	sort.Sort(LabelPairSorter(labels))
+	m.Label = labels
+}
+
+// federatedMetric is a Metric that writes a previously scraped dto.Metric.
+type federatedMetric struct {
+	desc   *Desc
+	metric *dto.Metric
+}
+
+func (m *federatedMetric) Desc() *Desc {
+	return m.desc
+}
+
+func (m *federatedMetric) Write(out *dto.Metric) error {
+	out.Label = m.metric.Label
+	out.Counter = m.metric.Counter
+	out.Gauge = m.metric.Gauge
+	out.Summary = m.metric.Summary
+	out.Untyped = m.metric.Untyped
+	out.TimestampMs = m.metric.TimestampMs
+	return nil
+}
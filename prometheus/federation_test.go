@@ -0,0 +1,78 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFederationCollector(t *testing.T) {
+	child := NewRegistry()
+	counter := NewCounterVec(CounterOpts{
+		Name: "jobs_total",
+		Help: "Total jobs.",
+	}, []string{"worker", "zone"})
+	counter.WithLabelValues("1", "child").Add(5)
+	child.MustRegister(counter)
+
+	for _, format := range []string{"proto", "text"} {
+		var handler http.Handler = child
+		if format == "text" {
+			handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Del(acceptHeader)
+				child.ServeHTTP(w, r)
+			})
+		}
+		server := httptest.NewServer(handler)
+
+		parent := NewRegistry()
+		parent.MustRegister(NewFederationCollector(FederationCollectorOpts{
+			URL:         server.URL,
+			Prefix:      "child_",
+			ConstLabels: Labels{"zone": "parent"},
+		}))
+		parent.MustRegister(NewFederationCollector(FederationCollectorOpts{
+			URL:         "http://127.0.0.1:1/metrics",
+			ConstLabels: Labels{"zone": "broken"},
+		}))
+
+		resp := httptest.NewRecorder()
+		parent.ServeHTTP(resp, &http.Request{
+			Method: "GET",
+			URL:    &url.URL{Path: "/metrics"},
+			Header: http.Header{},
+		})
+		server.Close()
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: got code %d", format, resp.Code)
+		}
+		body := resp.Body.String()
+		for _, want := range []string{
+			"# HELP child_jobs_total Total jobs.",
+			"# TYPE child_jobs_total counter",
+			`child_jobs_total{worker="1",zone="parent"} 5`,
+			`federation_up{zone="parent"} 1`,
+			`federation_up{zone="broken"} 0`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: body does not contain %q:\n%s", format, want, body)
+			}
+		}
+	}
+}
@@ -13,7 +13,11 @@
 
 package prometheus
 
-import "hash/fnv"
+import (
+	"context"
+
+	dto "github.com/prometheus/client_model/go"
+)
 
 // Gauge is a Metric that represents a single numerical value that can
 // arbitrarily go up and down.
@@ -46,12 +50,7 @@ type GaugeOpts Opts
 
 // NewGauge creates a new Gauge based on the provided GaugeOpts.
 func NewGauge(opts GaugeOpts) Gauge {
-	return newValue(NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		nil,
-		opts.ConstLabels,
-	), GaugeValue, 0)
+	return newGaugeValue(newOptsDesc(Opts(opts), nil, dto.MetricType_GAUGE), opts.ValueStorage)
 }
 
 // GaugeVec is a Collector that bundles a set of Gauges that all share the same
@@ -67,19 +66,18 @@ type GaugeVec struct {
 // partitioned by the given label names. At least one label name must be
 // provided.
 func NewGaugeVec(opts GaugeOpts, labelNames []string) *GaugeVec {
-	desc := NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		labelNames,
-		opts.ConstLabels,
-	)
+	desc := newOptsDesc(Opts(opts), labelNames, dto.MetricType_GAUGE)
 	return &GaugeVec{
 		MetricVec: MetricVec{
-			children: map[uint64]Metric{},
-			desc:     desc,
-			hash:     fnv.New64a(),
+			desc:             desc,
+			sanitize:         opts.SanitizeLabelValues,
+			maxChildren:      opts.MaxChildren,
+			overflow:         opts.OverflowPolicy,
+			defaults:         opts.DefaultLabelValues,
+			normalizers:      opts.LabelValueNormalizers,
+			expectedChildren: opts.ExpectedChildren,
 			newMetric: func(lvs ...string) Metric {
-				return newValue(desc, GaugeValue, 0, lvs...)
+				return newGaugeValue(desc, opts.ValueStorage, lvs...)
 			},
 		},
 	}
@@ -107,6 +105,28 @@ func (m *GaugeVec) GetMetricWith(labels Labels) (Gauge, error) {
 	return nil, err
 }
 
+// GetOrCreateMetricWithLabelValues replaces the method of the same name in
+// MetricVec. The difference is that this method returns a Gauge and not a
+// Metric so that no type conversion is required.
+func (m *GaugeVec) GetOrCreateMetricWithLabelValues(lvs ...string) (Gauge, bool, error) {
+	metric, created, err := m.MetricVec.GetOrCreateMetricWithLabelValues(lvs...)
+	if metric != nil {
+		return metric.(Gauge), created, err
+	}
+	return nil, false, err
+}
+
+// GetOrCreateMetricWith replaces the method of the same name in MetricVec. The
+// difference is that this method returns a Gauge and not a Metric so that no
+// type conversion is required.
+func (m *GaugeVec) GetOrCreateMetricWith(labels Labels) (Gauge, bool, error) {
+	metric, created, err := m.MetricVec.GetOrCreateMetricWith(labels)
+	if metric != nil {
+		return metric.(Gauge), created, err
+	}
+	return nil, false, err
+}
+
 // WithLabelValues works as GetMetricWithLabelValues, but panics where
 // GetMetricWithLabelValues would have returned an error. By not returning an
 // error, WithLabelValues allows shortcuts like
@@ -122,6 +142,43 @@ func (m *GaugeVec) With(labels Labels) Gauge {
 	return m.MetricVec.With(labels).(Gauge)
 }
 
+// GetMetricWithContext replaces the method of the same name in MetricVec. The
+// difference is that this method returns a Gauge and not a Metric so that no
+// type conversion is required.
+func (m *GaugeVec) GetMetricWithContext(ctx context.Context, labels Labels) (Gauge, error) {
+	metric, err := m.MetricVec.GetMetricWithContext(ctx, labels)
+	if metric != nil {
+		return metric.(Gauge), err
+	}
+	return nil, err
+}
+
+// WithContext works as GetMetricWithContext, but panics where
+// GetMetricWithContext would have returned an error.
+func (m *GaugeVec) WithContext(ctx context.Context, labels Labels) Gauge {
+	return m.MetricVec.WithContext(ctx, labels).(Gauge)
+}
+
+// CurryWith returns a GaugeVec curried with the provided labels. See
+// MetricVec.CurryWith for details.
+func (m *GaugeVec) CurryWith(labels Labels) (*GaugeVec, error) {
+	curried := &GaugeVec{}
+	if err := m.MetricVec.curryInto(labels, &curried.MetricVec); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *GaugeVec) MustCurryWith(labels Labels) *GaugeVec {
+	curried, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return curried
+}
+
 // GaugeFunc is a Gauge whose value is determined at collect time by calling a
 // provided function.
 //
@@ -138,10 +195,24 @@ type GaugeFunc interface {
 // where a GaugeFunc is directly registered with Prometheus, the provided
 // function must be concurrency-safe.
 func NewGaugeFunc(opts GaugeOpts, function func() float64) GaugeFunc {
-	return newValueFunc(NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		nil,
-		opts.ConstLabels,
-	), GaugeValue, function)
+	return newValueFunc(newOptsDesc(Opts(opts), nil, dto.MetricType_GAUGE), GaugeValue, function)
+}
+
+// NewGaugeFuncWithLabels creates a new GaugeFunc based on the provided
+// GaugeOpts with the provided variable labels. Both the value and the label
+// values are determined by calling the given functions from within the Write
+// method, so that state changing between scrapes (e.g. the ID of the current
+// leader) can be exposed without deleting and re-creating metrics in a
+// GaugeVec. labelValues must return as many values as there are labelNames,
+// otherwise the Write method returns an error. The same concurrency
+// considerations as for NewGaugeFunc apply to both functions.
+func NewGaugeFuncWithLabels(opts GaugeOpts, labelNames []string, labelValues func() []string, function func() float64) GaugeFunc {
+	result := &valueFunc{
+		desc:        newOptsDesc(Opts(opts), labelNames, dto.MetricType_GAUGE),
+		valType:     GaugeValue,
+		function:    function,
+		labelValues: labelValues,
+	}
+	result.Init(result)
+	return result
 }
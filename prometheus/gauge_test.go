@@ -180,3 +180,40 @@ func TestGaugeFunc(t *testing.T) {
 		t.Errorf("expected %q, got %q", expected, got)
 	}
 }
+
+func TestGaugeFuncWithLabels(t *testing.T) {
+	leader := "node-1"
+	gf := NewGaugeFuncWithLabels(
+		GaugeOpts{
+			Name:        "test_name",
+			Help:        "test help",
+			ConstLabels: Labels{"a": "1"},
+		},
+		[]string{"leader"},
+		func() []string { return []string{leader} },
+		func() float64 { return 1 },
+	)
+
+	m := &dto.Metric{}
+	gf.Write(m)
+	if expected, got := `label:<name:"a" value:"1" > label:<name:"leader" value:"node-1" > gauge:<value:1 > `, m.String(); expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	leader = "node-2"
+	m.Reset()
+	gf.Write(m)
+	if expected, got := `label:<name:"a" value:"1" > label:<name:"leader" value:"node-2" > gauge:<value:1 > `, m.String(); expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	gf = NewGaugeFuncWithLabels(
+		GaugeOpts{Name: "test_name", Help: "test help"},
+		[]string{"leader"},
+		func() []string { return nil },
+		func() float64 { return 1 },
+	)
+	if err := gf.Write(&dto.Metric{}); err == nil {
+		t.Error("expected error for inconsistent label values")
+	}
+}
@@ -2,6 +2,7 @@ package prometheus
 
 import (
 	"reflect"
+	"runtime"
 	"testing"
 	"time"
 
@@ -30,6 +31,9 @@ func TestGoCollector(t *testing.T) {
 	for {
 		select {
 		case metric := <-ch:
+			if metric.Desc() != c.goroutines.Desc() {
+				continue
+			}
 			switch m := metric.(type) {
 			// Attention, this also catches Counter...
 			case Gauge:
@@ -56,3 +60,49 @@ func TestGoCollector(t *testing.T) {
 		}
 	}
 }
+
+func TestGoCollectorGC(t *testing.T) {
+	var (
+		c  = NewGoCollector()
+		ch = make(chan Metric)
+	)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	runtime.GC()
+	found := map[string]*dto.Metric{}
+	for metric := range ch {
+		pb := &dto.Metric{}
+		if err := metric.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		found[metric.Desc().fqName] = pb
+	}
+
+	gc, ok := found["go_gc_duration_seconds"]
+	if !ok {
+		t.Fatal("go_gc_duration_seconds not collected")
+	}
+	if len(gc.GetSummary().Quantile) != 5 {
+		t.Errorf("want 5 GC pause quantiles, got %d", len(gc.GetSummary().Quantile))
+	}
+	for _, name := range []string{
+		"go_memstats_heap_alloc_bytes",
+		"go_memstats_stack_inuse_bytes",
+		"go_memstats_next_gc_bytes",
+	} {
+		m, ok := found[name]
+		if !ok {
+			t.Errorf("%s not collected", name)
+			continue
+		}
+		if m.GetGauge().GetValue() <= 0 {
+			t.Errorf("want positive value for %s, got %v", name, m.GetGauge().GetValue())
+		}
+	}
+	if found["go_memstats_alloc_bytes_total"].GetCounter() == nil {
+		t.Error("go_memstats_alloc_bytes_total is not a counter")
+	}
+}
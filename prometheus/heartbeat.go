@@ -0,0 +1,151 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync"
+	"time"
+)
+
+// DefHeartbeatInterval is the default interval of a Heartbeat.
+const DefHeartbeatInterval = 15 * time.Second
+
+// HeartbeatOpts bundles the options for StartHeartbeat. All fields are
+// optional and can safely be left at their zero value.
+type HeartbeatOpts struct {
+	// Namespace, Subsystem, and ConstLabels are used for the metrics of
+	// the Heartbeat, which are named "heartbeat_timestamp_seconds" and
+	// "heartbeat_ticks_total" within the namespace and subsystem.
+	Namespace   string
+	Subsystem   string
+	ConstLabels Labels
+
+	// Interval is the interval at which the metrics are updated. The
+	// default value is DefHeartbeatInterval.
+	Interval time.Duration
+
+	// Register is called to register the Heartbeat. The default value is
+	// Register, i.e. the Heartbeat is exposed via the default registry.
+	Register func(Collector) error
+
+	// Clock provides the time reported by the timestamp gauge. The
+	// default is SystemClock.
+	Clock Clock
+}
+
+// Heartbeat is a Collector with a gauge set to the current Unix time and a
+// counter incremented once per interval. Together they are a standard signal
+// that a process is alive, that its main loop is not stuck, and that its clock
+// is sane, e.g. alerting on
+//
+//     time() - heartbeat_timestamp_seconds > 60
+//
+// or on a heartbeat_ticks_total that does not increase. Create instances with
+// StartHeartbeat.
+type Heartbeat struct {
+	timestamp Gauge
+	ticks     Counter
+	clock     Clock
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// StartHeartbeat registers a new Heartbeat as configured by opts and starts
+// updating its metrics in a separate goroutine, right away and then once per
+// interval, until Stop is called. If the registration fails, the error is
+// returned and nothing is started.
+//
+// Usage example:
+//
+//     hb, err := prometheus.StartHeartbeat(prometheus.HeartbeatOpts{Namespace: "myapp"})
+//     if err != nil {
+//         log.Fatal(err)
+//     }
+//     defer hb.Stop()
+func StartHeartbeat(opts HeartbeatOpts) (*Heartbeat, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefHeartbeatInterval
+	}
+	if opts.Register == nil {
+		opts.Register = Register
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	h := &Heartbeat{
+		timestamp: NewGauge(GaugeOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "heartbeat_timestamp_seconds",
+			Help:        "Unix time of the last heartbeat of the process.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		ticks: NewCounter(CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "heartbeat_ticks_total",
+			Help:        "Total number of heartbeats of the process.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		clock: opts.Clock,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if err := opts.Register(h); err != nil {
+		return nil, err
+	}
+	h.beat()
+	go h.run(opts.Interval)
+	return h, nil
+}
+
+// Describe implements Collector.
+func (h *Heartbeat) Describe(ch chan<- *Desc) {
+	h.timestamp.Describe(ch)
+	h.ticks.Describe(ch)
+}
+
+// Collect implements Collector.
+func (h *Heartbeat) Collect(ch chan<- Metric) {
+	h.timestamp.Collect(ch)
+	h.ticks.Collect(ch)
+}
+
+// Stop stops updating the metrics. The Heartbeat stays registered, so that
+// the stopped heartbeat is visible. Stop can be called multiple times.
+func (h *Heartbeat) Stop() {
+	h.stopOnce.Do(func() { close(h.stop) })
+	<-h.done
+}
+
+func (h *Heartbeat) run(interval time.Duration) {
+	defer close(h.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.beat()
+		}
+	}
+}
+
+func (h *Heartbeat) beat() {
+	h.timestamp.Set(float64(h.clock.Now().UnixNano()) / 1e9)
+	h.ticks.Inc()
+}
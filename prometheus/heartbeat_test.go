@@ -0,0 +1,66 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestHeartbeat(t *testing.T) {
+	r := newRegistry()
+	now := time.Unix(1234567890, 500000000)
+	hb, err := StartHeartbeat(HeartbeatOpts{
+		Namespace: "app",
+		Interval:  time.Millisecond,
+		Register:  r.Register,
+		Clock:     ClockFunc(func() time.Time { return now }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &dto.Metric{}
+	hb.timestamp.Write(m)
+	if got, want := m.GetGauge().GetValue(), 1234567890.5; got != want {
+		t.Errorf("got timestamp %v, want %v", got, want)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		hb.ticks.Write(m)
+		if m.GetCounter().GetValue() >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v ticks, want at least 3", m.GetCounter().GetValue())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	hb.Stop()
+	hb.Stop()
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 2 || mfs[0].GetName() != "app_heartbeat_ticks_total" || mfs[1].GetName() != "app_heartbeat_timestamp_seconds" {
+		t.Errorf("got unexpected metric families %v", mfs)
+	}
+
+	if _, err := StartHeartbeat(HeartbeatOpts{Namespace: "app", Register: r.Register}); err == nil {
+		t.Error("starting a second heartbeat with the same names succeeded")
+	}
+}
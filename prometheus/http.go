@@ -14,6 +14,8 @@
 package prometheus
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -22,22 +24,11 @@ import (
 
 var instLabels = []string{"method", "code"}
 
-type nower interface {
-	Now() time.Time
-}
-
-type nowFunc func() time.Time
-
-func (n nowFunc) Now() time.Time {
-	return n()
-}
-
-var now nower = nowFunc(func() time.Time {
-	return time.Now()
-})
+// now is the Clock used to time HTTP requests. Replaced in tests.
+var now = SystemClock
 
-func nowSeries(t ...time.Time) nower {
-	return nowFunc(func() time.Time {
+func nowSeries(t ...time.Time) Clock {
+	return ClockFunc(func() time.Time {
 		defer func() {
 			t = t[1:]
 		}()
@@ -132,7 +123,7 @@ func InstrumentHandlerFuncWithOpts(opts SummaryOpts, handlerFunc func(http.Respo
 	regResSz := MustRegisterOrGet(resSz).(Summary)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		now := time.Now()
+		begin := now.Now()
 
 		delegate := &responseWriterDelegator{ResponseWriter: w}
 		out := make(chan int)
@@ -143,7 +134,7 @@ func InstrumentHandlerFuncWithOpts(opts SummaryOpts, handlerFunc func(http.Respo
 		go computeApproximateRequestSize(r, out, urlLen)
 		handlerFunc(delegate, r)
 
-		elapsed := float64(time.Since(now)) / float64(time.Microsecond)
+		elapsed := float64(now.Now().Sub(begin)) / float64(time.Microsecond)
 
 		method := sanitizeMethod(r.Method)
 		code := sanitizeCode(delegate.status)
@@ -154,6 +145,222 @@ func InstrumentHandlerFuncWithOpts(opts SummaryOpts, handlerFunc func(http.Respo
 	})
 }
 
+// InstrumentHandlerCounter is a middleware that wraps the provided
+// http.Handler to count the handled requests with the provided CounterVec. In
+// contrast to InstrumentHandler, the caller has full control over the
+// collector (its name, help string, const labels, and registration). The
+// CounterVec may have the variable labels "code" and "method" (either, both,
+// or none of them), which are then set to the HTTP status code and the HTTP
+// method of the request, respectively. Further variable labels are possible if
+// they are provided by one of the optional LabelExtractors, which derive label
+// values from the request. InstrumentHandlerCounter panics if the CounterVec
+// has any other variable label.
+//
+// The middleware functions InstrumentHandlerCounter,
+// InstrumentHandlerDuration, InstrumentHandlerRequestSize, and
+// InstrumentHandlerResponseSize can be chained to get the usual request rate,
+// error rate, and duration metrics as well as the payload sizes:
+//
+//     handler = prometheus.InstrumentHandlerCounter(reqCnt,
+//         prometheus.InstrumentHandlerDuration(reqDur, handler),
+//     )
+func InstrumentHandlerCounter(counter *CounterVec, next http.Handler, extractors ...*LabelExtractor) http.HandlerFunc {
+	checkInstrumentLabels(counter.desc, extractors, "code", "method")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := newInstValues(r, extractors)
+		delegate := &responseWriterDelegator{ResponseWriter: w}
+		next.ServeHTTP(delegate, r)
+		v.code = delegate.statusCode()
+		counter.WithLabelValues(v.labelValues(counter.desc)...).Inc()
+	})
+}
+
+// InstrumentHandlerDuration is a middleware that wraps the provided
+// http.Handler to observe the request duration in seconds with the provided
+// SummaryVec. The duration is measured until the wrapped handler
+// returns. The same rules as for InstrumentHandlerCounter apply to the variable
+// labels of the SummaryVec.
+func InstrumentHandlerDuration(obs *SummaryVec, next http.Handler, extractors ...*LabelExtractor) http.HandlerFunc {
+	checkInstrumentLabels(obs.desc, extractors, "code", "method")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		begin := time.Now()
+		v := newInstValues(r, extractors)
+		delegate := &responseWriterDelegator{ResponseWriter: w}
+		next.ServeHTTP(delegate, r)
+		v.code = delegate.statusCode()
+		obs.WithLabelValues(v.labelValues(obs.desc)...).Observe(time.Since(begin).Seconds())
+	})
+}
+
+// InstrumentHandlerResponseSize is a middleware that wraps the provided
+// http.Handler to observe the size of the response body in bytes with the
+// provided SummaryVec. The same rules as for InstrumentHandlerCounter apply to
+// the variable labels of the SummaryVec.
+func InstrumentHandlerResponseSize(obs *SummaryVec, next http.Handler, extractors ...*LabelExtractor) http.HandlerFunc {
+	checkInstrumentLabels(obs.desc, extractors, "code", "method")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := newInstValues(r, extractors)
+		delegate := &responseWriterDelegator{ResponseWriter: w}
+		next.ServeHTTP(delegate, r)
+		v.code = delegate.statusCode()
+		obs.WithLabelValues(v.labelValues(obs.desc)...).Observe(float64(delegate.written))
+	})
+}
+
+// InstrumentHandlerRequestSize is a middleware that wraps the provided
+// http.Handler to observe the size of the request body in bytes with the
+// provided SummaryVec. Only the bytes actually read from the body by the
+// wrapped handler are counted (which is the size of the whole body for handlers
+// consuming it completely). In contrast to the request_size_bytes summary of
+// InstrumentHandler, neither the header nor the URL are included. The same rules
+// as for InstrumentHandlerCounter apply to the variable labels of the
+// SummaryVec.
+func InstrumentHandlerRequestSize(obs *SummaryVec, next http.Handler, extractors ...*LabelExtractor) http.HandlerFunc {
+	checkInstrumentLabels(obs.desc, extractors, "code", "method")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := newInstValues(r, extractors)
+		body := &countingReadCloser{}
+		if r.Body != nil {
+			body.ReadCloser = r.Body
+			r.Body = body
+		}
+		delegate := &responseWriterDelegator{ResponseWriter: w}
+		next.ServeHTTP(delegate, r)
+		v.code = delegate.statusCode()
+		obs.WithLabelValues(v.labelValues(obs.desc)...).Observe(float64(body.read))
+	})
+}
+
+// InstrumentHandlerInFlight is a middleware that wraps the provided
+// http.Handler to track the number of requests currently handled with the
+// provided Gauge. The Gauge is incremented when a request starts and
+// decremented when the wrapped handler returns, even if it panics. To track the
+// concurrency per handler, use a separate Gauge (e.g. a child of a GaugeVec
+// partitioned by handler name) for each wrapped handler. The middleware can be
+// combined with the other InstrumentHandler... middlewares.
+func InstrumentHandlerInFlight(g Gauge, next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Inc()
+		defer g.Dec()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// InstrumentHandlerPanics is a middleware that wraps the provided http.Handler
+// to recover panics of the handler and count them. Similar to InstrumentHandler,
+// it registers a Counter named http_panics_total with the default registry (if
+// not already done), which has a constant label named "handler" with the
+// provided handlerName as value. If repanic is true, the recovered panic is
+// re-raised after counting, so that it is handled as without the middleware
+// (i.e. by net/http). Otherwise, the panic is converted into a response with
+// status code 500, unless the handler has already written the response
+// header. The sentinel panic value http.ErrAbortHandler is always re-raised and
+// not counted, as it is not a crash but a deliberate abort of the response.
+func InstrumentHandlerPanics(handlerName string, repanic bool, handler http.Handler) http.HandlerFunc {
+	panics := MustRegisterOrGet(NewCounter(CounterOpts{
+		Subsystem:   "http",
+		Name:        "panics_total",
+		Help:        "Total number of panics recovered from HTTP handlers.",
+		ConstLabels: Labels{"handler": handlerName},
+	})).(Counter)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delegate := &responseWriterDelegator{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			panics.Inc()
+			if repanic {
+				panic(p)
+			}
+			if !delegate.wroteHeader {
+				http.Error(delegate, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		handler.ServeHTTP(delegate, r)
+	})
+}
+
+// checkInstrumentLabels panics if desc has a variable label not contained in
+// allowed and not provided by any of the extractors.
+func checkInstrumentLabels(desc *Desc, extractors []*LabelExtractor, allowed ...string) {
+	if desc.err != nil {
+		panic(desc.err)
+	}
+	for _, e := range extractors {
+		allowed = append(allowed, e.Names...)
+	}
+outer:
+	for _, l := range desc.variableLabels {
+		for _, a := range allowed {
+			if l == a {
+				continue outer
+			}
+		}
+		panic(fmt.Errorf(
+			"label %q of %s cannot be used for instrumentation, allowed labels are %q",
+			l, desc, allowed,
+		))
+	}
+}
+
+// instValues are the possible values of the variable labels of collectors
+// used by the instrumentation middlewares.
+type instValues struct {
+	code         int
+	method, host string
+	// extraNames and extraValues are the labels derived by
+	// LabelExtractors.
+	extraNames, extraValues []string
+}
+
+// newInstValues returns the instValues known from the request before it has
+// been handled.
+func newInstValues(r *http.Request, extractors []*LabelExtractor) instValues {
+	v := instValues{method: r.Method}
+	if r.URL != nil {
+		v.host = r.URL.Host
+	}
+	for _, e := range extractors {
+		v.extraNames = append(v.extraNames, e.Names...)
+		v.extraValues = append(v.extraValues, e.labelValues(r)...)
+	}
+	return v
+}
+
+// labelValues returns the label values in the order of the variable labels of
+// desc.
+func (v instValues) labelValues(desc *Desc) []string {
+	lvs := make([]string, len(desc.variableLabels))
+	for i, l := range desc.variableLabels {
+		switch l {
+		case "code":
+			lvs[i] = sanitizeCode(v.code)
+		case "method":
+			lvs[i] = sanitizeMethod(v.method)
+		case "host":
+			lvs[i] = v.host
+		default:
+			for j, n := range v.extraNames {
+				if n == l {
+					lvs[i] = v.extraValues[j]
+					break
+				}
+			}
+		}
+	}
+	return lvs
+}
+
 func computeApproximateRequestSize(r *http.Request, out chan int, s int) {
 	s += len(r.Method)
 	s += len(r.Proto)
@@ -173,6 +380,18 @@ func computeApproximateRequestSize(r *http.Request, out chan int, s int) {
 	out <- s
 }
 
+// countingReadCloser counts the bytes read from the wrapped io.ReadCloser.
+type countingReadCloser struct {
+	io.ReadCloser
+	read int
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += n
+	return n, err
+}
+
 type responseWriterDelegator struct {
 	http.ResponseWriter
 
@@ -188,6 +407,15 @@ func (r *responseWriterDelegator) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
+// statusCode returns the status code written so far. A handler that has not
+// written anything yet implicitly answers with http.StatusOK.
+func (r *responseWriterDelegator) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
 func (r *responseWriterDelegator) Write(b []byte) (int, error) {
 	if !r.wroteHeader {
 		r.WriteHeader(http.StatusOK)
@@ -0,0 +1,113 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"time"
+)
+
+// RoundTripperFunc is an adapter to allow the use of ordinary functions as
+// http.RoundTripper, analogous to http.HandlerFunc.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// InstrumentRoundTripperCounter is a middleware that wraps the provided
+// http.RoundTripper to count the outgoing requests with the provided
+// CounterVec. If next is nil, http.DefaultTransport is used. The CounterVec
+// may have the variable labels "code", "method", and "host" (in any
+// combination), which are then set to the HTTP status code of the response,
+// the HTTP method, and the host of the request URL, respectively. Further
+// variable labels are possible if they are provided by one of the optional
+// LabelExtractors. InstrumentRoundTripperCounter panics if the CounterVec has
+// any other variable label.
+//
+// Requests that fail without a response (e.g. because the connection could not
+// be established) are not counted, as they have no status code. Those errors
+// are returned to the caller unchanged.
+//
+// The middleware functions InstrumentRoundTripperCounter,
+// InstrumentRoundTripperDuration, and InstrumentRoundTripperInFlight can be
+// chained:
+//
+//     client := &http.Client{
+//         Transport: prometheus.InstrumentRoundTripperCounter(reqCnt,
+//             prometheus.InstrumentRoundTripperInFlight(inFlight, nil),
+//         ),
+//     }
+func InstrumentRoundTripperCounter(counter *CounterVec, next http.RoundTripper, extractors ...*LabelExtractor) RoundTripperFunc {
+	checkInstrumentLabels(counter.desc, extractors, "code", "method", "host")
+	next = defaultTransport(next)
+
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		v := newInstValues(r, extractors)
+		resp, err := next.RoundTrip(r)
+		if err == nil {
+			v.code = resp.StatusCode
+			counter.WithLabelValues(v.labelValues(counter.desc)...).Inc()
+		}
+		return resp, err
+	})
+}
+
+// InstrumentRoundTripperDuration is a middleware that wraps the provided
+// http.RoundTripper to observe the request duration in seconds with the
+// provided SummaryVec. The duration is measured until the response headers
+// have been received. The same rules as for InstrumentRoundTripperCounter
+// apply to next, to the variable labels of the SummaryVec, and to failed
+// requests.
+func InstrumentRoundTripperDuration(obs *SummaryVec, next http.RoundTripper, extractors ...*LabelExtractor) RoundTripperFunc {
+	checkInstrumentLabels(obs.desc, extractors, "code", "method", "host")
+	next = defaultTransport(next)
+
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		begin := time.Now()
+		v := newInstValues(r, extractors)
+		resp, err := next.RoundTrip(r)
+		if err == nil {
+			v.code = resp.StatusCode
+			obs.WithLabelValues(v.labelValues(obs.desc)...).Observe(time.Since(begin).Seconds())
+		}
+		return resp, err
+	})
+}
+
+// InstrumentRoundTripperInFlight is a middleware that wraps the provided
+// http.RoundTripper to track the number of requests currently in flight with
+// the provided GaugeVec. If next is nil, http.DefaultTransport is used. The
+// GaugeVec may have the variable labels "method" and "host" and those provided
+// by the optional LabelExtractors (but not "code", as it is not known at the
+// start of the request).
+func InstrumentRoundTripperInFlight(gauge *GaugeVec, next http.RoundTripper, extractors ...*LabelExtractor) RoundTripperFunc {
+	checkInstrumentLabels(gauge.desc, extractors, "method", "host")
+	next = defaultTransport(next)
+
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		g := gauge.WithLabelValues(newInstValues(r, extractors).labelValues(gauge.desc)...)
+		g.Inc()
+		defer g.Dec()
+		return next.RoundTrip(r)
+	})
+}
+
+func defaultTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		return http.DefaultTransport
+	}
+	return rt
+}
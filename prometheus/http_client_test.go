@@ -0,0 +1,102 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestInstrumentRoundTripper(t *testing.T) {
+	server := httptest.NewServer(respBody("Howdy there!"))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqCnt := NewCounterVec(
+		CounterOpts{Name: "client_requests_total", Help: "Total requests."},
+		[]string{"code", "host"},
+	)
+	reqDur := NewSummaryVec(
+		SummaryOpts{Name: "client_request_duration_seconds", Help: "Request durations."},
+		[]string{"method"},
+	)
+	inFlight := NewGaugeVec(
+		GaugeOpts{Name: "client_in_flight_requests", Help: "In-flight requests."},
+		[]string{"host"},
+	)
+	var inFlightDuringRequest float64
+	probe := RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		out := &dto.Metric{}
+		inFlight.WithLabelValues(u.Host).Write(out)
+		inFlightDuringRequest = out.GetGauge().GetValue()
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	client := &http.Client{
+		Transport: InstrumentRoundTripperCounter(reqCnt,
+			InstrumentRoundTripperDuration(reqDur,
+				InstrumentRoundTripperInFlight(inFlight, probe),
+			),
+		),
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if want, got := 1., inFlightDuringRequest; want != got {
+		t.Errorf("want %f requests in flight during request, got %f", want, got)
+	}
+	out := &dto.Metric{}
+	inFlight.WithLabelValues(u.Host).Write(out)
+	if want, got := 0., out.GetGauge().GetValue(); want != got {
+		t.Errorf("want %f requests in flight after request, got %f", want, got)
+	}
+	out.Reset()
+	reqCnt.WithLabelValues("418", u.Host).Write(out)
+	if want, got := 1., out.GetCounter().GetValue(); want != got {
+		t.Errorf("want reqCnt of %f, got %f", want, got)
+	}
+	out.Reset()
+	reqDur.WithLabelValues("get").Write(out)
+	if want, got := uint64(1), out.GetSummary().GetSampleCount(); want != got {
+		t.Errorf("want sample count %d in reqDur, got %d", want, got)
+	}
+}
+
+func TestInstrumentRoundTripperError(t *testing.T) {
+	reqCnt := NewCounterVec(
+		CounterOpts{Name: "client_requests_total", Help: "Total requests."},
+		[]string{"code"},
+	)
+	failing := RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	rt := InstrumentRoundTripperCounter(reqCnt, failing)
+	if _, err := rt.RoundTrip(&http.Request{Method: "GET", URL: &url.URL{Host: "example.org"}}); err == nil {
+		t.Error("expected error")
+	}
+	if got := reqCnt.numChildren; got != 0 {
+		t.Errorf("want no counted requests, got %d", got)
+	}
+}
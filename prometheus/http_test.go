@@ -14,8 +14,10 @@
 package prometheus
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -30,8 +32,8 @@ func (b respBody) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func TestInstrumentHandler(t *testing.T) {
-	defer func(n nower) {
-		now = n.(nower)
+	defer func(c Clock) {
+		now = c
 	}(now)
 
 	instant := time.Now()
@@ -95,7 +97,7 @@ func TestInstrumentHandler(t *testing.T) {
 	}
 
 	out.Reset()
-	if want, got := 1, len(reqCnt.children); want != got {
+	if want, got := 1, reqCnt.numChildren; want != got {
 		t.Errorf("want %d children in reqCnt, got %d", want, got)
 	}
 	cnt, err := reqCnt.GetMetricWithLabelValues("get", "418")
@@ -119,3 +121,193 @@ func TestInstrumentHandler(t *testing.T) {
 		t.Errorf("want reqCnt of %f, got %f", want, got)
 	}
 }
+
+func TestInstrumentHandlerCounterAndDuration(t *testing.T) {
+	reqCnt := NewCounterVec(
+		CounterOpts{Name: "requests_total", Help: "Total requests."},
+		[]string{"method", "code"},
+	)
+	reqDur := NewSummaryVec(
+		SummaryOpts{Name: "request_duration_seconds", Help: "Request durations."},
+		[]string{"method"},
+	)
+	resSz := NewSummaryVec(
+		SummaryOpts{Name: "response_size_bytes", Help: "Response sizes."},
+		nil,
+	)
+	hndlr := InstrumentHandlerCounter(reqCnt,
+		InstrumentHandlerDuration(reqDur,
+			InstrumentHandlerResponseSize(resSz, respBody("Howdy there!")),
+		),
+	)
+
+	resp := httptest.NewRecorder()
+	hndlr.ServeHTTP(resp, &http.Request{Method: "POST"})
+	if resp.Code != http.StatusTeapot {
+		t.Fatalf("expected status %d, got %d", http.StatusTeapot, resp.Code)
+	}
+
+	out := &dto.Metric{}
+	if err := reqCnt.WithLabelValues("post", "418").Write(out); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1., out.Counter.GetValue(); want != got {
+		t.Errorf("want reqCnt of %f, got %f", want, got)
+	}
+	out.Reset()
+	if err := reqDur.WithLabelValues("post").Write(out); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(1), out.Summary.GetSampleCount(); want != got {
+		t.Errorf("want sample count %d in reqDur, got %d", want, got)
+	}
+	out.Reset()
+	if err := resSz.WithLabelValues().Write(out); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := float64(len("Howdy there!")), out.Summary.GetSampleSum(); want != got {
+		t.Errorf("want sample sum %f in resSz, got %f", want, got)
+	}
+}
+
+func TestInstrumentHandlerCounterInvalidLabel(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for invalid label")
+		}
+	}()
+	InstrumentHandlerCounter(NewCounterVec(
+		CounterOpts{Name: "requests_total", Help: "Total requests."},
+		[]string{"path"},
+	), respBody(""))
+}
+
+func TestInstrumentHandlerInFlight(t *testing.T) {
+	inFlight := NewGauge(GaugeOpts{Name: "in_flight_requests", Help: "In-flight requests."})
+	value := func() float64 {
+		out := &dto.Metric{}
+		inFlight.Write(out)
+		return out.GetGauge().GetValue()
+	}
+
+	var during float64
+	hndlr := InstrumentHandlerInFlight(inFlight, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = value()
+		if r.Method == "POST" {
+			panic("boom")
+		}
+	}))
+
+	hndlr.ServeHTTP(httptest.NewRecorder(), &http.Request{Method: "GET"})
+	if want, got := 1., during; want != got {
+		t.Errorf("want %f in-flight requests during request, got %f", want, got)
+	}
+	if want, got := 0., value(); want != got {
+		t.Errorf("want %f in-flight requests after request, got %f", want, got)
+	}
+
+	func() {
+		defer func() { recover() }()
+		hndlr.ServeHTTP(httptest.NewRecorder(), &http.Request{Method: "POST"})
+	}()
+	if want, got := 0., value(); want != got {
+		t.Errorf("want %f in-flight requests after panic, got %f", want, got)
+	}
+}
+
+func TestInstrumentHandlerRequestSize(t *testing.T) {
+	reqSz := NewSummaryVec(
+		SummaryOpts{Name: "request_body_size_bytes", Help: "Request body sizes."},
+		[]string{"code"},
+	)
+	hndlr := InstrumentHandlerRequestSize(reqSz, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			ioutil.ReadAll(r.Body)
+		}
+	}))
+
+	req, err := http.NewRequest("POST", "http://example.org/", strings.NewReader("Howdy there!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hndlr.ServeHTTP(httptest.NewRecorder(), req)
+	// Requests without body must work, too.
+	hndlr.ServeHTTP(httptest.NewRecorder(), &http.Request{Method: "GET"})
+
+	out := &dto.Metric{}
+	if err := reqSz.WithLabelValues("200").Write(out); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(2), out.Summary.GetSampleCount(); want != got {
+		t.Errorf("want sample count %d in reqSz, got %d", want, got)
+	}
+	if want, got := float64(len("Howdy there!")), out.Summary.GetSampleSum(); want != got {
+		t.Errorf("want sample sum %f in reqSz, got %f", want, got)
+	}
+}
+
+func TestInstrumentHandlerLabelExtractor(t *testing.T) {
+	reqCnt := NewCounterVec(
+		CounterOpts{Name: "requests_total", Help: "Total requests."},
+		[]string{"code", "tenant"},
+	)
+	tenants := NewLabelExtractor([]string{"tenant"}, 2, func(r *http.Request) []string {
+		return []string{r.Header.Get("X-Tenant")}
+	})
+	hndlr := InstrumentHandlerCounter(reqCnt, respBody(""), tenants)
+
+	for _, tenant := range []string{"a", "b", "c", "a", "d"} {
+		hndlr.ServeHTTP(httptest.NewRecorder(), &http.Request{
+			Method: "GET",
+			Header: http.Header{"X-Tenant": []string{tenant}},
+		})
+	}
+
+	for tenant, want := range map[string]float64{"a": 2, "b": 1, OverflowLabelValue: 2} {
+		out := &dto.Metric{}
+		if err := reqCnt.WithLabelValues("418", tenant).Write(out); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.GetCounter().GetValue(); got != want {
+			t.Errorf("want %f requests for tenant %q, got %f", want, tenant, got)
+		}
+	}
+}
+
+func TestInstrumentHandlerPanics(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	panics := MustRegisterOrGet(NewCounter(CounterOpts{
+		Subsystem:   "http",
+		Name:        "panics_total",
+		Help:        "Total number of panics recovered from HTTP handlers.",
+		ConstLabels: Labels{"handler": "test-panics"},
+	})).(Counter)
+	value := func() float64 {
+		out := &dto.Metric{}
+		panics.Write(out)
+		return out.GetCounter().GetValue()
+	}
+
+	resp := httptest.NewRecorder()
+	InstrumentHandlerPanics("test-panics", false, panicking).ServeHTTP(resp, &http.Request{Method: "GET"})
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, resp.Code)
+	}
+	if want, got := 1., value(); want != got {
+		t.Errorf("want %f panics, got %f", want, got)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected re-raised panic")
+			}
+		}()
+		InstrumentHandlerPanics("test-panics", true, panicking).ServeHTTP(httptest.NewRecorder(), &http.Request{Method: "GET"})
+	}()
+	if want, got := 2., value(); want != got {
+		t.Errorf("want %f panics, got %f", want, got)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package influx provides a Writer that periodically sends metrics to an
+// InfluxDB write endpoint in the InfluxDB line protocol (see
+// text.MetricFamilyToInflux for the mapping):
+//
+//     w := influx.NewWriter(influx.WriterOpts{
+//         URL: "http://influxdb:8086/write?db=metrics",
+//     })
+//     go w.Run(ctx)
+package influx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/text"
+)
+
+// DefInterval is the default interval between two writes of Writer.Run.
+const DefInterval = 15 * time.Second
+
+// WriterOpts bundles the options for creating a Writer. It is mandatory to set
+// URL to a non-empty string. All other fields are optional and can safely be
+// left at their zero value.
+type WriterOpts struct {
+	// URL is the write endpoint of InfluxDB including the query parameters
+	// selecting the database, e.g. "http://influxdb:8086/write?db=metrics".
+	// Mandatory!
+	URL string
+
+	// Gatherer provides the metrics to send. The default value is
+	// prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+
+	// Interval is the interval between two writes when the Writer is
+	// running (see Run). The default value is DefInterval.
+	Interval time.Duration
+
+	// Client is the HTTP client used for sending. The default value is
+	// http.DefaultClient.
+	Client *http.Client
+
+	// ErrorHandler is called with every error encountered by Run. Run
+	// continues with the next interval after an error. If nil, errors are
+	// silently dropped.
+	ErrorHandler func(error)
+}
+
+// Writer sends metrics of a Gatherer to an InfluxDB write endpoint. Create
+// instances with NewWriter.
+type Writer struct {
+	url          string
+	gatherer     prometheus.Gatherer
+	interval     time.Duration
+	client       *http.Client
+	errorHandler func(error)
+}
+
+// NewWriter creates a new Writer based on the provided WriterOpts.
+func NewWriter(opts WriterOpts) *Writer {
+	w := &Writer{
+		url:          opts.URL,
+		gatherer:     opts.Gatherer,
+		interval:     opts.Interval,
+		client:       opts.Client,
+		errorHandler: opts.ErrorHandler,
+	}
+	if w.gatherer == nil {
+		w.gatherer = prometheus.DefaultGatherer
+	}
+	if w.interval <= 0 {
+		w.interval = DefInterval
+	}
+	if w.client == nil {
+		w.client = http.DefaultClient
+	}
+	return w
+}
+
+// Write gathers all metrics once and sends them to the InfluxDB write
+// endpoint. Metrics without an explicit timestamp are sent with the time of
+// gathering so that all points of one write share the same timestamp.
+func (w *Writer) Write(ctx context.Context) error {
+	if w.url == "" {
+		return errors.New("empty InfluxDB URL")
+	}
+	mfs, err := w.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	buf := &bytes.Buffer{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			if m.TimestampMs == nil {
+				m.TimestampMs = proto.Int64(nowMs)
+			}
+		}
+		if _, err := text.MetricFamilyToInflux(buf, mf); err != nil {
+			return err
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequest("POST", w.url, buf)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d while writing to %s: %s", resp.StatusCode, w.url, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Run calls Write once per configured interval until ctx is done. Errors are
+// passed to the configured ErrorHandler.
+func (w *Writer) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Write(ctx); err != nil && w.errorHandler != nil {
+				w.errorHandler(err)
+			}
+		}
+	}
+}
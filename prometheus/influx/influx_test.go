@@ -0,0 +1,66 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influx
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriterWrite(t *testing.T) {
+	var lastBody []byte
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.URL.Query().Get("db"), "metrics"; got != want {
+			t.Errorf("got db %q, want %q", got, want)
+		}
+		var err error
+		if lastBody, err = ioutil.ReadAll(r.Body); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "docstring",
+	}, []string{"code"})
+	counter.WithLabelValues("200").Add(3)
+	reg.MustRegister(counter)
+
+	w := NewWriter(WriterOpts{URL: backend.URL + "/write?db=metrics", Gatherer: reg})
+	if err := w.Write(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^requests_total,code=200 value=3 [0-9]+000000\n$`).Match(lastBody) {
+		t.Errorf("unexpected body %q", lastBody)
+	}
+
+	backend.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	})
+	if err := w.Write(context.Background()); err == nil {
+		t.Error("expected error for status 404, got none")
+	}
+	if err := NewWriter(WriterOpts{Gatherer: reg}).Write(context.Background()); err == nil {
+		t.Error("expected error for empty URL, got none")
+	}
+}
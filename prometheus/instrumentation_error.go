@@ -0,0 +1,80 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "sync/atomic"
+
+// panicOnInstrumentationError is 1 if instrumentation errors panic (the
+// default) and 0 if they are only counted. Accessed atomically.
+var panicOnInstrumentationError uint32 = 1
+
+// instrumentationErrors counts the instrumentation errors that did not cause a
+// panic because of PanicOnInstrumentationError(false). Accessed atomically. It
+// is reported by the ClientCollector.
+var instrumentationErrors uint64
+
+// PanicOnInstrumentationError sets the behavior upon errors of instrumentation
+// calls that have no way to return them, i.e. invalid label values passed to
+// With, WithLabelValues, and WithContext of metric vectors and a negative value
+// passed to Counter.Add.
+//
+// By default, those errors cause a panic, which is the right thing during
+// development and in tests. A serving binary should not be taken down by a bad
+// label value, though. With PanicOnInstrumentationError(false), the error is
+// counted instead (exposed by the ClientCollector as
+// prometheus_client_instrumentation_errors_total), and the call returns a
+// metric that discards all updates or ignores the invalid update,
+// respectively.
+//
+// The setting affects all metrics of the process and may be changed at any
+// time.
+func PanicOnInstrumentationError(b bool) {
+	var v uint32
+	if b {
+		v = 1
+	}
+	atomic.StoreUint32(&panicOnInstrumentationError, v)
+}
+
+// handleInstrumentationError panics with err or counts it, depending on
+// PanicOnInstrumentationError.
+func handleInstrumentationError(err error) {
+	if atomic.LoadUint32(&panicOnInstrumentationError) != 0 {
+		panic(err)
+	}
+	atomic.AddUint64(&instrumentationErrors, 1)
+}
+
+// discardMetric is returned by the vectors instead of panicking if
+// PanicOnInstrumentationError is false. It implements Counter, Gauge, Summary,
+// and Untyped, so that the typed vectors can return it as any of them.
+var discardMetric Metric = discard{}
+
+type discard struct{ noopMetric }
+
+func (discard) Set(float64)           {}
+func (discard) Inc()                  {}
+func (discard) Dec()                  {}
+func (discard) Add(float64)           {}
+func (discard) Sub(float64)           {}
+func (discard) Observe(float64)       {}
+func (discard) AddMany([]float64)     {}
+func (discard) ObserveMany([]float64) {}
+
+var (
+	_ Counter = discard{}
+	_ Gauge   = discard{}
+	_ Summary = discard{}
+	_ Untyped = discard{}
+)
@@ -0,0 +1,63 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestPanicOnInstrumentationError(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{Name: "test_total", Help: "Test counter."},
+		[]string{"code"},
+	)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for inconsistent label cardinality")
+			}
+		}()
+		vec.WithLabelValues("200", "GET")
+	}()
+
+	PanicOnInstrumentationError(false)
+	defer PanicOnInstrumentationError(true)
+	before := atomic.LoadUint64(&instrumentationErrors)
+
+	vec.WithLabelValues("200", "GET").Inc()
+	vec.With(Labels{"method": "GET"}).Inc()
+	vec.WithContext(context.Background(), Labels{"code": "\xff"}).Inc()
+	NewGaugeVec(GaugeOpts{Name: "g", Help: "Gauge."}, []string{"a"}).WithLabelValues().Dec()
+	NewSummaryVec(SummaryOpts{Name: "s", Help: "Summary."}, []string{"a"}).WithLabelValues().Observe(1)
+	NewUntypedVec(UntypedOpts{Name: "u", Help: "Untyped."}, []string{"a"}).WithLabelValues().Sub(1)
+	c := vec.WithLabelValues("200")
+	c.Add(-1)
+
+	if got, want := atomic.LoadUint64(&instrumentationErrors)-before, uint64(7); got != want {
+		t.Errorf("got %d instrumentation errors, want %d", got, want)
+	}
+	if got := vec.numChildren; got != 1 {
+		t.Errorf("got %d children, want 1", got)
+	}
+	m := &dto.Metric{}
+	c.Write(m)
+	if got := m.GetCounter().GetValue(); got != 0 {
+		t.Errorf("got counter value %v after negative Add, want 0", got)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/model"
+)
+
+// jsonEntity is a metric family in the legacy JSON format (version 0.0.2).
+type jsonEntity struct {
+	BaseLabels map[string]string `json:"baseLabels"`
+	Docstring  string            `json:"docstring"`
+	Metric     struct {
+		Type  string      `json:"type"`
+		Value interface{} `json:"value"`
+	} `json:"metric"`
+}
+
+type jsonValue struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// jsonSummaryValue is a summary, which was called histogram in the JSON
+// format, with its quantiles by their string representation.
+type jsonSummaryValue struct {
+	Labels map[string]string  `json:"labels"`
+	Value  map[string]float64 `json:"value"`
+}
+
+// writeJSONEntity writes mf as an entity of the legacy JSON format, followed
+// by a newline. It is an encoder for writeJSON, which turns the entities into
+// a JSON array. Untyped metrics are written as gauges. The count and sum of
+// summaries as well as NaN and infinite values cannot be represented and are
+// left out.
+func writeJSONEntity(w io.Writer, mf *dto.MetricFamily) (int, error) {
+	e := jsonEntity{
+		BaseLabels: map[string]string{string(model.MetricNameLabel): mf.GetName()},
+		Docstring:  mf.GetHelp(),
+	}
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER, dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		e.Metric.Type = "gauge"
+		if mf.GetType() == dto.MetricType_COUNTER {
+			e.Metric.Type = "counter"
+		}
+		values := make([]jsonValue, 0, len(mf.Metric))
+		for _, m := range mf.Metric {
+			v := jsonValue{Labels: jsonLabels(m)}
+			switch {
+			case m.Counter != nil:
+				v.Value = m.Counter.GetValue()
+			case m.Gauge != nil:
+				v.Value = m.Gauge.GetValue()
+			case m.Untyped != nil:
+				v.Value = m.Untyped.GetValue()
+			default:
+				return 0, fmt.Errorf("expected %s in metric %s", mf.GetType(), m)
+			}
+			if isFinite(v.Value) {
+				values = append(values, v)
+			}
+		}
+		e.Metric.Value = values
+	case dto.MetricType_SUMMARY:
+		e.Metric.Type = "histogram"
+		values := make([]jsonSummaryValue, 0, len(mf.Metric))
+		for _, m := range mf.Metric {
+			if m.Summary == nil {
+				return 0, fmt.Errorf("expected summary in metric %s", m)
+			}
+			v := jsonSummaryValue{
+				Labels: jsonLabels(m),
+				Value:  map[string]float64{},
+			}
+			for _, q := range m.Summary.Quantile {
+				if isFinite(q.GetValue()) {
+					v.Value[fmt.Sprint(q.GetQuantile())] = q.GetValue()
+				}
+			}
+			values = append(values, v)
+		}
+		e.Metric.Value = values
+	default:
+		return 0, fmt.Errorf("metric type %s not supported in JSON format", mf.GetType())
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(append(b, '\n'))
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func jsonLabels(m *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(m.Label))
+	for _, lp := range m.Label {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	return labels
+}
+
+// writeJSON works like writePB, but writes the newline-separated entities
+// created by writeJSONEntity as a JSON array. Unlike writePB, it buffers the
+// whole output.
+func (r *Registry) writeJSON(ctx context.Context, w io.Writer, writeEncoded encoder, format string, filter familyFilter, debug bool) (int, error) {
+	buf := r.getBuf()
+	defer r.giveBuf(buf)
+	if _, err := r.writePB(ctx, buf, writeEncoded, format, filter, debug); err != nil {
+		return 0, err
+	}
+	entities := bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
+	out := make([]byte, 0, len(entities)+2)
+	out = append(out, '[')
+	out = append(out, bytes.Replace(entities, []byte{'\n'}, []byte{','}, -1)...)
+	out = append(out, ']')
+	return w.Write(out)
+}
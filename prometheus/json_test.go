@@ -0,0 +1,77 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/extraction"
+	"github.com/prometheus/client_golang/model"
+)
+
+type sampleCollector map[string]model.SampleValue
+
+func (c sampleCollector) Ingest(samples model.Samples) error {
+	for _, s := range samples {
+		c[s.Metric.String()] = s.Value
+	}
+	return nil
+}
+
+func TestJSONFormat(t *testing.T) {
+	r := newRegistry()
+	requests := NewCounterVec(CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"code"})
+	requests.WithLabelValues("200").Add(3)
+	requests.WithLabelValues("500").Add(math.NaN())
+	latency := NewSummary(SummaryOpts{Name: "latency_seconds", Help: "Latency.", Objectives: map[float64]float64{0.5: 0.05}})
+	latency.Observe(2)
+	r.MustRegister(requests)
+	r.MustRegister(latency)
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	req.Header.Set(acceptHeader, `application/json; schema="prometheus/telemetry"; version=0.0.2`)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if got := rec.Header().Get(contentTypeHeader); got != JSONTelemetryContentType {
+		t.Fatalf("got content type %q, want %q", got, JSONTelemetryContentType)
+	}
+
+	samples := sampleCollector{}
+	if err := extraction.Processor002.ProcessSingle(rec.Body, samples, &extraction.ProcessOptions{}); err != nil {
+		t.Fatalf("legacy JSON processor failed: %s\n%s", err, rec.Body.String())
+	}
+	want := sampleCollector{
+		`requests_total{code="200"}`:        3,
+		`latency_seconds{percentile="0.5"}`: 2,
+	}
+	if len(samples) != len(want) {
+		t.Errorf("got samples %v, want %v", samples, want)
+	}
+	for metric, v := range want {
+		if samples[metric] != v {
+			t.Errorf("got %v for %s, want %v", samples[metric], metric, v)
+		}
+	}
+
+	// Without families, an empty array is written.
+	req.Header.Set(acceptHeader, `application/json; schema=prometheus/telemetry`)
+	rec = httptest.NewRecorder()
+	newRegistry().ServeHTTP(rec, req)
+	if got := rec.Body.String(); got != "[]" {
+		t.Errorf("got body %q, want []", got)
+	}
+}
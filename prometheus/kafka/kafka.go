@@ -0,0 +1,181 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kafka provides a Publisher that periodically produces snapshots of
+// metrics to a Kafka topic, e.g. for pipelines that archive raw telemetry. The
+// package does not depend on any Kafka client library. Instead, the Publisher
+// uses a Producer, which is a small interface easily implemented on top of the
+// client library of choice.
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/text"
+)
+
+// DefInterval is the default interval between two publications of
+// Publisher.Run.
+const DefInterval = time.Minute
+
+// Producer produces messages to Kafka. Implementations wrap the producer of a
+// Kafka client library. Produce may return before the message is acknowledged
+// by the broker (i.e. it may be asynchronous), in which case errors during
+// delivery have to be handled by the implementation.
+type Producer interface {
+	Produce(topic string, key, value []byte) error
+}
+
+// Format is the serialization format of a snapshot.
+type Format int
+
+// Possible values for Format.
+const (
+	// FormatProtobuf serializes a snapshot as a sequence of
+	// length-delimited MetricFamily protobufs, like the delimited protobuf
+	// exposition format (see prometheus.DelimitedTelemetryContentType).
+	FormatProtobuf Format = iota
+	// FormatJSON serializes a snapshot as a JSON object as created by
+	// prometheus.Snapshot.
+	FormatJSON
+)
+
+// PublisherOpts bundles the options for creating a Publisher. It is mandatory
+// to set Producer and Topic. All other fields are optional and can safely be
+// left at their zero value.
+type PublisherOpts struct {
+	// Producer is used to produce the messages. Mandatory!
+	Producer Producer
+
+	// Topic is the Kafka topic the snapshots are produced to. Mandatory!
+	Topic string
+
+	// Key is the key of the produced messages, e.g. the name of the
+	// instance, which makes Kafka assign all snapshots of the same
+	// instance to the same partition. The default is no key.
+	Key []byte
+
+	// Format is the serialization format of the snapshots. The default
+	// value is FormatProtobuf.
+	Format Format
+
+	// Gatherer provides the metrics to publish. The default value is
+	// prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+
+	// Interval is the interval between two publications when the
+	// Publisher is running (see Run). The default value is DefInterval.
+	Interval time.Duration
+
+	// ErrorHandler is called with every error encountered by Run. Run
+	// continues with the next interval after an error. If nil, errors are
+	// silently dropped.
+	ErrorHandler func(error)
+}
+
+// Publisher produces snapshots of the metrics of a Gatherer to a Kafka topic.
+// Create instances with NewPublisher.
+type Publisher struct {
+	producer     Producer
+	topic        string
+	key          []byte
+	format       Format
+	gatherer     prometheus.Gatherer
+	interval     time.Duration
+	errorHandler func(error)
+}
+
+// NewPublisher creates a new Publisher based on the provided PublisherOpts.
+func NewPublisher(opts PublisherOpts) *Publisher {
+	p := &Publisher{
+		producer:     opts.Producer,
+		topic:        opts.Topic,
+		key:          opts.Key,
+		format:       opts.Format,
+		gatherer:     opts.Gatherer,
+		interval:     opts.Interval,
+		errorHandler: opts.ErrorHandler,
+	}
+	if p.gatherer == nil {
+		p.gatherer = prometheus.DefaultGatherer
+	}
+	if p.interval <= 0 {
+		p.interval = DefInterval
+	}
+	return p
+}
+
+// Publish gathers all metrics once and produces them as one message. All
+// metrics without an explicit timestamp are stamped with the time of
+// gathering, so that the snapshot is self-contained.
+func (p *Publisher) Publish() error {
+	if p.producer == nil {
+		return errors.New("no Kafka producer")
+	}
+	if p.topic == "" {
+		return errors.New("empty Kafka topic")
+	}
+	mfs, err := p.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			if m.TimestampMs == nil {
+				m.TimestampMs = proto.Int64(nowMs)
+			}
+		}
+	}
+
+	var value []byte
+	switch p.format {
+	case FormatJSON:
+		if value, err = json.Marshal(prometheus.Snapshot(mfs)); err != nil {
+			return err
+		}
+	default:
+		buf := &bytes.Buffer{}
+		for _, mf := range mfs {
+			if _, err := text.WriteProtoDelimited(buf, mf); err != nil {
+				return err
+			}
+		}
+		value = buf.Bytes()
+	}
+	return p.producer.Produce(p.topic, p.key, value)
+}
+
+// Run calls Publish once per configured interval until ctx is done. Errors are
+// passed to the configured ErrorHandler.
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Publish(); err != nil && p.errorHandler != nil {
+				p.errorHandler(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/matttproud/golang_protobuf_extensions/ext"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type message struct {
+	topic      string
+	key, value []byte
+}
+
+type fakeProducer struct {
+	messages []message
+	err      error
+}
+
+func (p *fakeProducer) Produce(topic string, key, value []byte) error {
+	p.messages = append(p.messages, message{topic, key, value})
+	return p.err
+}
+
+func newTestRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "events_total",
+		Help: "docstring",
+	})
+	counter.Add(4)
+	reg.MustRegister(counter)
+	return reg
+}
+
+func TestPublishProtobuf(t *testing.T) {
+	producer := &fakeProducer{}
+	p := NewPublisher(PublisherOpts{
+		Producer: producer,
+		Topic:    "telemetry",
+		Key:      []byte("host1"),
+		Gatherer: newTestRegistry(),
+	})
+	if err := p.Publish(); err != nil {
+		t.Fatal(err)
+	}
+	if len(producer.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(producer.messages))
+	}
+	msg := producer.messages[0]
+	if msg.topic != "telemetry" || string(msg.key) != "host1" {
+		t.Errorf("got topic %q and key %q", msg.topic, msg.key)
+	}
+	mf := &dto.MetricFamily{}
+	if _, err := ext.ReadDelimited(bytes.NewReader(msg.value), mf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mf.GetName(), "events_total"; got != want {
+		t.Errorf("got name %q, want %q", got, want)
+	}
+	if got, want := mf.Metric[0].GetCounter().GetValue(), 4.; got != want {
+		t.Errorf("got value %v, want %v", got, want)
+	}
+	if mf.Metric[0].GetTimestampMs() == 0 {
+		t.Error("timestamp not set")
+	}
+}
+
+func TestPublishJSON(t *testing.T) {
+	producer := &fakeProducer{}
+	p := NewPublisher(PublisherOpts{
+		Producer: producer,
+		Topic:    "telemetry",
+		Format:   FormatJSON,
+		Gatherer: newTestRegistry(),
+	})
+	if err := p.Publish(); err != nil {
+		t.Fatal(err)
+	}
+	var snapshot map[string]struct {
+		Type    string
+		Metrics []struct {
+			Value       float64
+			TimestampMs int64 `json:"timestamp_ms"`
+		}
+	}
+	if err := json.Unmarshal(producer.messages[0].value, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	mf := snapshot["events_total"]
+	if mf.Type != "counter" || len(mf.Metrics) != 1 || mf.Metrics[0].Value != 4 || mf.Metrics[0].TimestampMs == 0 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+}
+
+func TestPublishErrors(t *testing.T) {
+	if err := NewPublisher(PublisherOpts{Topic: "t"}).Publish(); err == nil {
+		t.Error("expected error for missing producer, got none")
+	}
+	if err := NewPublisher(PublisherOpts{Producer: &fakeProducer{}}).Publish(); err == nil {
+		t.Error("expected error for empty topic, got none")
+	}
+	producer := &fakeProducer{err: errors.New("broker down")}
+	p := NewPublisher(PublisherOpts{Producer: producer, Topic: "t", Gatherer: newTestRegistry()})
+	if err := p.Publish(); err != producer.err {
+		t.Errorf("got error %v, want %v", err, producer.err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"sync"
+)
+
+// OverflowLabelValue is the label value reported instead of the actual value
+// once a LabelValueLimit has been reached.
+const OverflowLabelValue = "other"
+
+// LabelValueLimit caps the number of distinct values of a label. This protects
+// metric vectors partitioned by values derived from untrusted input (like
+// request headers) against unbounded growth. A LabelValueLimit is safe for
+// concurrent use.
+type LabelValueLimit struct {
+	max int
+
+	mtx  sync.Mutex
+	seen map[string]struct{}
+}
+
+// NewLabelValueLimit returns a LabelValueLimit allowing max distinct values. A
+// max of 0 or less means no limit.
+func NewLabelValueLimit(max int) *LabelValueLimit {
+	return &LabelValueLimit{max: max, seen: map[string]struct{}{}}
+}
+
+// Limit returns value if it has been seen before or if fewer than the maximum
+// number of distinct values have been seen so far. Otherwise, it returns
+// OverflowLabelValue.
+func (l *LabelValueLimit) Limit(value string) string {
+	if l.max <= 0 {
+		return value
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if _, ok := l.seen[value]; ok {
+		return value
+	}
+	if len(l.seen) >= l.max {
+		return OverflowLabelValue
+	}
+	l.seen[value] = struct{}{}
+	return value
+}
+
+// LabelExtractor derives the values of additional labels from an HTTP
+// request, e.g. the route template or a tenant ID from a header. LabelExtractors
+// can be passed to the InstrumentHandler... and InstrumentRoundTripper...
+// middlewares, which then accept collectors partitioned by the labels in
+// Names. Create instances with NewLabelExtractor.
+type LabelExtractor struct {
+	// Names are the names of the derived labels.
+	Names []string
+	// Extract returns the label values for the request, in the same order
+	// as Names. Missing values are treated as empty strings.
+	Extract func(*http.Request) []string
+
+	limits []*LabelValueLimit
+}
+
+// NewLabelExtractor returns a LabelExtractor for the provided label names. If
+// maxValues is positive, each label is limited to maxValues distinct values
+// (see LabelValueLimit).
+func NewLabelExtractor(names []string, maxValues int, extract func(*http.Request) []string) *LabelExtractor {
+	limits := make([]*LabelValueLimit, len(names))
+	for i := range limits {
+		limits[i] = NewLabelValueLimit(maxValues)
+	}
+	return &LabelExtractor{
+		Names:   names,
+		Extract: extract,
+		limits:  limits,
+	}
+}
+
+// labelValues returns the limited label values for the request, exactly one
+// for each of Names.
+func (e *LabelExtractor) labelValues(r *http.Request) []string {
+	lvs := make([]string, len(e.Names))
+	copy(lvs, e.Extract(r))
+	for i, l := range e.limits {
+		lvs[i] = l.Limit(lvs[i])
+	}
+	return lvs
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// PathIDPlaceholder replaces the ID-like segments of a URL path in
+// NormalizePathIDs.
+const PathIDPlaceholder = ":id"
+
+// TruncateLabelValue returns a label value normalizer (see
+// Opts.LabelValueNormalizers) that truncates values to at most n runes.
+func TruncateLabelValue(n int) func(string) string {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) <= n {
+			return value
+		}
+		i := 0
+		for pos := range value {
+			if i == n {
+				return value[:pos]
+			}
+			i++
+		}
+		return value
+	}
+}
+
+// NormalizePathIDs is a label value normalizer (see Opts.LabelValueNormalizers)
+// for URL paths. It replaces each path segment that looks like an ID, i.e. that
+// consists of decimal digits only or is a UUID, with PathIDPlaceholder, so that
+// e.g. "/users/123/orders" becomes "/users/:id/orders".
+func NormalizePathIDs(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if isDecimal(s) || isUUID(s) {
+			segments[i] = PathIDPlaceholder
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isDecimal(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, r := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return false
+			}
+		}
+	}
+	return true
+}
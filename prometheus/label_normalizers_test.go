@@ -0,0 +1,54 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelValueNormalizers(t *testing.T) {
+	if got, want := TruncateLabelValue(3)("größer"), "grö"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := TruncateLabelValue(10)("short"), "short"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := NormalizePathIDs("/users/123/orders/0b9a7c4e-6f2d-4c1e-9a3b-1f2e3d4c5b6a"), "/users/:id/orders/:id"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := NormalizePathIDs("/v2/users/"), "/v2/users/"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	vec := NewCounterVec(
+		CounterOpts{
+			Name: "test",
+			Help: "helpless",
+			LabelValueNormalizers: map[string]func(string) string{
+				"method": strings.ToLower,
+				"path":   NormalizePathIDs,
+			},
+		},
+		[]string{"method", "path"},
+	)
+	vec.WithLabelValues("GET", "/users/1").Inc()
+	vec.With(Labels{"method": "get", "path": "/users/2"}).Inc()
+	if got, want := vec.numChildren, 1; got != want {
+		t.Fatalf("got %d children, want %d", got, want)
+	}
+	if !vec.DeleteLabelValues("Get", "/users/3") {
+		t.Error("expected normalized child to be deleted")
+	}
+}
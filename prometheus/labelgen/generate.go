@@ -0,0 +1,198 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+const prometheusPath = "github.com/prometheus/client_golang/prometheus"
+
+// metricTypes maps the constructors of metric vectors to the type of their
+// children.
+var metricTypes = map[string]string{
+	"NewCounterVec": "Counter",
+	"NewGaugeVec":   "Gauge",
+	"NewSummaryVec": "Summary",
+	"NewUntypedVec": "Untyped",
+}
+
+type vec struct {
+	Var, Type, MetricType string
+	Fields                []string
+}
+
+type file struct {
+	Source, Package, Import, Alias string
+	Vecs                           []vec
+}
+
+var fileTemplate = template.Must(template.New("labels").Parse(
+	`// Code generated by labelgen from {{.Source}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import {{.Import}} "` + prometheusPath + `"
+{{range .Vecs}}
+// {{.Type}} holds the label values of {{.Var}}.
+type {{.Type}} struct {
+{{- range .Fields}}
+	{{.}} string
+{{- end}}
+}
+
+// {{.Var}}With returns the {{.MetricType}} of {{.Var}} for the provided label
+// values.
+func {{.Var}}With(l {{.Type}}) {{$.Alias}}.{{.MetricType}} {
+	return {{.Var}}.WithLabelValues({{range $i, $f := .Fields}}{{if $i}}, {{end}}l.{{$f}}{{end}})
+}
+{{end}}`))
+
+// generate returns the formatted source of the accessors for the metric
+// vectors declared in src.
+func generate(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	alias := ""
+	for _, imp := range f.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path == prometheusPath {
+			alias = "prometheus"
+			if imp.Name != nil {
+				alias = imp.Name.Name
+			}
+		}
+	}
+	if alias == "" {
+		return nil, fmt.Errorf("%s does not import %s", filename, prometheusPath)
+	}
+
+	data := file{
+		Source:  filename,
+		Package: f.Name.Name,
+		Alias:   alias,
+	}
+	if alias != "prometheus" {
+		data.Import = alias
+	}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if i >= len(vs.Values) {
+					break
+				}
+				v, ok, err := parseVec(alias, name.Name, vs.Values[i])
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", fset.Position(vs.Values[i].Pos()), err)
+				}
+				if ok {
+					data.Vecs = append(data.Vecs, v)
+				}
+			}
+		}
+	}
+	if len(data.Vecs) == 0 {
+		return nil, fmt.Errorf("no metric vectors declared in %s", filename)
+	}
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// parseVec returns the vec described by expr if expr is a call of a metric
+// vector constructor with a literal slice of label names.
+func parseVec(alias, name string, expr ast.Expr) (vec, bool, error) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) != 2 {
+		return vec{}, false, nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return vec{}, false, nil
+	}
+	if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != alias {
+		return vec{}, false, nil
+	}
+	metricType, ok := metricTypes[sel.Sel.Name]
+	if !ok {
+		return vec{}, false, nil
+	}
+	lit, ok := call.Args[1].(*ast.CompositeLit)
+	if !ok {
+		return vec{}, false, fmt.Errorf("label names of %s must be a literal []string", name)
+	}
+	v := vec{
+		Var:        name,
+		Type:       exported(name) + "Labels",
+		MetricType: metricType,
+	}
+	seen := map[string]bool{}
+	for _, elt := range lit.Elts {
+		bl, ok := elt.(*ast.BasicLit)
+		if !ok || bl.Kind != token.STRING {
+			return vec{}, false, fmt.Errorf("label names of %s must be string literals", name)
+		}
+		label, err := strconv.Unquote(bl.Value)
+		if err != nil {
+			return vec{}, false, err
+		}
+		field := fieldName(label)
+		if seen[field] {
+			return vec{}, false, fmt.Errorf("label %q of %s results in duplicate field %s", label, name, field)
+		}
+		seen[field] = true
+		v.Fields = append(v.Fields, field)
+	}
+	return v, true, nil
+}
+
+// fieldName converts a label name like "http_code" into an exported field name
+// like "HttpCode".
+func fieldName(label string) string {
+	var parts []string
+	for _, p := range strings.Split(label, "_") {
+		if p != "" {
+			parts = append(parts, exported(p))
+		}
+	}
+	name := strings.Join(parts, "")
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "L" + name
+	}
+	return name
+}
+
+func exported(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSource = `package metrics
+
+import prom "github.com/prometheus/client_golang/prometheus"
+
+var (
+	requestsTotal = prom.NewCounterVec(
+		prom.CounterOpts{Name: "requests_total", Help: "Requests."},
+		[]string{"method", "http_code"},
+	)
+	QueueLength = prom.NewGauge(prom.GaugeOpts{Name: "queue_length", Help: "Queue length."})
+	Latency     = prom.NewSummaryVec(prom.SummaryOpts{Name: "latency_seconds", Help: "Latency."}, []string{"handler"})
+)
+`
+
+func TestGenerate(t *testing.T) {
+	out, err := generate("metrics.go", []byte(testSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+	for _, want := range []string{
+		"// Code generated by labelgen from metrics.go. DO NOT EDIT.",
+		"package metrics",
+		`import prom "github.com/prometheus/client_golang/prometheus"`,
+		"type RequestsTotalLabels struct {\n\tMethod   string\n\tHttpCode string\n}",
+		"func requestsTotalWith(l RequestsTotalLabels) prom.Counter {\n\treturn requestsTotal.WithLabelValues(l.Method, l.HttpCode)\n}",
+		"func LatencyWith(l LatencyLabels) prom.Summary {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "QueueLength") {
+		t.Errorf("output contains accessor for non-vector:\n%s", got)
+	}
+
+	if _, err := generate("empty.go", []byte("package metrics\n")); err == nil {
+		t.Error("expected error for file not importing prometheus")
+	}
+	bad := strings.Replace(testSource, `[]string{"handler"}`, `labelNames`, 1)
+	if _, err := generate("bad.go", []byte(bad)); err == nil {
+		t.Error("expected error for non-literal label names")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// labelgen generates type-safe accessors for the metric vectors declared in a
+// Go source file, so that the label order and arity are checked by the
+// compiler rather than at runtime. It is meant to be run by go generate:
+//
+//     //go:generate labelgen metrics.go
+//
+// For each package-level variable initialized with one of NewCounterVec,
+// NewGaugeVec, NewSummaryVec, or NewUntypedVec of the prometheus package and a
+// literal slice of label names, e.g.
+//
+//     var requestsTotal = prometheus.NewCounterVec(
+//         prometheus.CounterOpts{Name: "requests_total", Help: "..."},
+//         []string{"method", "code"},
+//     )
+//
+// labelgen writes a struct type with one field per label and a function
+// returning the child for such a struct to the output file (metrics_labels.go
+// by default):
+//
+//     requestsTotalWith(RequestsTotalLabels{Method: "GET", Code: "200"}).Inc()
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var output = flag.String("output", "", "Output file name; default <input>_labels.go.")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: labelgen [-output file] input.go")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	input := flag.Arg(0)
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(input, ".go") + "_labels.go"
+	}
+
+	src, err := ioutil.ReadFile(input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "labelgen:", err)
+		os.Exit(1)
+	}
+	generated, err := generate(input, src)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "labelgen:", err)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(out, generated, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "labelgen:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package legacy provides a facade with the call shape of the registry API of
+// client_golang versions before 0.1, backed by the current prometheus
+// package. It allows programs instrumented with the old API to upgrade the
+// dependency without rewriting their instrumentation right away:
+//
+//     requests := legacy.NewCounter()
+//     legacy.Register("requests_total", "Requests handled.", map[string]string{"service": "api"}, requests)
+//     requests.Increment(map[string]string{"code": "200"})
+//
+// The metrics are exposed by the Registry they are registered with (the
+// default registry of the prometheus package for Register). Unlike with the
+// current API, the label names of legacy metrics are only known once values
+// are set, so legacy metrics cannot be checked by the registry in advance, and
+// collect checks (prometheus.EnableCollectChecks) must not be enabled. Only
+// counters and gauges are supported. New code should use the prometheus
+// package directly.
+package legacy
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"code.google.com/p/goprotobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/model"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric is a metric of the legacy API that is only named once it is
+// registered. It is implemented by Counter and Gauge.
+type Metric interface {
+	// ResetAll deletes all values of the metric.
+	ResetAll()
+
+	// bind returns a Collector for the metric with the provided
+	// descriptor. It fails if the metric has been bound already.
+	bind(desc *prometheus.Desc) (prometheus.Collector, error)
+	// unbind reverts bind after a failed registration.
+	unbind()
+}
+
+// Registry is a facade with the Register method of the legacy API. Create
+// instances with NewRegistry.
+type Registry struct {
+	register func(prometheus.Collector) error
+}
+
+// NewRegistry returns a Registry that registers metrics with the provided
+// function, e.g. the Register method of a prometheus.Registry.
+func NewRegistry(register func(prometheus.Collector) error) *Registry {
+	return &Registry{register: register}
+}
+
+// DefaultRegistry registers metrics with the default registry of the
+// prometheus package.
+var DefaultRegistry = NewRegistry(prometheus.Register)
+
+// Register registers metric with the DefaultRegistry.
+func Register(name, docstring string, baseLabels map[string]string, metric Metric) error {
+	return DefaultRegistry.Register(name, docstring, baseLabels, metric)
+}
+
+// MustRegister works like Register but panics where Register would have
+// returned an error.
+func MustRegister(name, docstring string, baseLabels map[string]string, metric Metric) {
+	if err := Register(name, docstring, baseLabels, metric); err != nil {
+		panic(err)
+	}
+}
+
+// Register names metric, attaches baseLabels to all its values, and registers
+// it. A metric can only be registered once.
+func (r *Registry) Register(name, docstring string, baseLabels map[string]string, metric Metric) error {
+	desc := prometheus.NewDesc(name, docstring, nil, baseLabels)
+	c, err := metric.bind(desc)
+	if err != nil {
+		return err
+	}
+	if err := r.register(c); err != nil {
+		metric.unbind()
+		return err
+	}
+	return nil
+}
+
+// Counter is a metric of the legacy API whose values are mostly increased.
+// Create instances with NewCounter.
+type Counter interface {
+	Metric
+
+	Increment(labels map[string]string) float64
+	IncrementBy(labels map[string]string, value float64) float64
+	Decrement(labels map[string]string) float64
+	DecrementBy(labels map[string]string, value float64) float64
+	Set(labels map[string]string, value float64) float64
+}
+
+// Gauge is a metric of the legacy API whose values are set arbitrarily. Create
+// instances with NewGauge.
+type Gauge interface {
+	Metric
+
+	Set(labels map[string]string, value float64) float64
+}
+
+// NewCounter returns a new Counter that has to be registered to be exposed.
+func NewCounter() Counter {
+	return &counter{values{valueType: prometheus.CounterValue}}
+}
+
+// NewGauge returns a new Gauge that has to be registered to be exposed.
+func NewGauge() Gauge {
+	return &values{valueType: prometheus.GaugeValue}
+}
+
+type counter struct {
+	values
+}
+
+func (c *counter) Increment(labels map[string]string) float64 {
+	return c.add(labels, 1)
+}
+
+func (c *counter) IncrementBy(labels map[string]string, value float64) float64 {
+	return c.add(labels, value)
+}
+
+func (c *counter) Decrement(labels map[string]string) float64 {
+	return c.add(labels, -1)
+}
+
+func (c *counter) DecrementBy(labels map[string]string, value float64) float64 {
+	return c.add(labels, -value)
+}
+
+// values holds the values of a legacy metric by label set. It implements Gauge
+// and the Collector of a registered metric.
+type values struct {
+	valueType prometheus.ValueType
+
+	mtx    sync.Mutex // Protects the fields below.
+	desc   *prometheus.Desc
+	values map[uint64]*labeledValue // By label signature.
+}
+
+type labeledValue struct {
+	labels []*dto.LabelPair
+	value  float64
+}
+
+func (v *values) bind(desc *prometheus.Desc) (prometheus.Collector, error) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if v.desc != nil {
+		return nil, errors.New("legacy metric registered already")
+	}
+	v.desc = desc
+	return v, nil
+}
+
+func (v *values) unbind() {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.desc = nil
+}
+
+func (v *values) Set(labels map[string]string, value float64) float64 {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.get(labels).value = value
+	return value
+}
+
+func (v *values) ResetAll() {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.values = nil
+}
+
+func (v *values) add(labels map[string]string, value float64) float64 {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	lv := v.get(labels)
+	lv.value += value
+	return lv.value
+}
+
+// get returns the value for the provided labels, creating it if needed. The
+// caller must hold v.mtx.
+func (v *values) get(labels map[string]string) *labeledValue {
+	signature := model.LabelsToSignature(labels)
+	if lv, ok := v.values[signature]; ok {
+		return lv
+	}
+	lv := &labeledValue{}
+	for name, value := range labels {
+		lv.labels = append(lv.labels, &dto.LabelPair{
+			Name:  proto.String(name),
+			Value: proto.String(value),
+		})
+	}
+	if v.values == nil {
+		v.values = map[uint64]*labeledValue{}
+	}
+	v.values[signature] = lv
+	return lv
+}
+
+// Describe implements prometheus.Collector.
+func (v *values) Describe(ch chan<- *prometheus.Desc) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	ch <- v.desc
+}
+
+// Collect implements prometheus.Collector.
+func (v *values) Collect(ch chan<- prometheus.Metric) {
+	v.mtx.Lock()
+	metrics := make([]prometheus.Metric, 0, len(v.values))
+	for _, lv := range v.values {
+		metrics = append(metrics, &legacyMetric{
+			desc:      v.desc,
+			valueType: v.valueType,
+			labels:    lv.labels,
+			value:     lv.value,
+		})
+	}
+	v.mtx.Unlock()
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// legacyMetric is a prometheus.Metric whose labels are not declared by its
+// descriptor.
+type legacyMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	labels    []*dto.LabelPair
+	value     float64
+}
+
+func (m *legacyMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *legacyMetric) Write(out *dto.Metric) error {
+	// The const labels of the descriptor, i.e. the base labels, are
+	// exposed through a const metric.
+	base := prometheus.MustNewConstMetric(m.desc, m.valueType, m.value)
+	if err := base.Write(out); err != nil {
+		return err
+	}
+	// The label pairs of the const metric must not be modified.
+	out.Label = append(append([]*dto.LabelPair(nil), out.Label...), m.labels...)
+	sort.Sort(prometheus.LabelPairSorter(out.Label))
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package legacy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegister(t *testing.T) {
+	r := prometheus.NewRegistry()
+	lr := NewRegistry(r.Register)
+
+	requests := NewCounter()
+	if err := lr.Register("requests_total", "Requests handled.", map[string]string{"service": "api"}, requests); err != nil {
+		t.Fatal(err)
+	}
+	temperature := NewGauge()
+	if err := lr.Register("temperature_celsius", "Temperature.", nil, temperature); err != nil {
+		t.Fatal(err)
+	}
+	if err := lr.Register("requests_again_total", "Requests.", nil, requests); err == nil {
+		t.Error("registering a metric twice succeeded")
+	}
+	invalid := NewGauge()
+	if err := lr.Register("invalid-name", "Invalid.", nil, invalid); err == nil {
+		t.Error("registering an invalid name succeeded")
+	}
+	if err := lr.Register("valid_name", "Valid.", nil, invalid); err != nil {
+		t.Errorf("registering after a failed registration failed: %s", err)
+	}
+
+	requests.Increment(map[string]string{"code": "200"})
+	if got := requests.IncrementBy(map[string]string{"code": "200"}, 2); got != 3 {
+		t.Errorf("got %v after incrementing, want 3", got)
+	}
+	requests.Decrement(map[string]string{"code": "500"})
+	temperature.Set(map[string]string{"room": "a", "floor": "1"}, 21.5)
+	temperature.Set(map[string]string{"room": "b", "floor": "1"}, 19)
+	temperature.Set(map[string]string{"room": "b", "floor": "1"}, 20)
+
+	out := scrape(t, r)
+	for _, want := range []string{
+		"# HELP requests_total Requests handled.\n# TYPE requests_total counter\n",
+		`requests_total{code="200",service="api"} 3` + "\n",
+		`requests_total{code="500",service="api"} -1` + "\n",
+		"# TYPE temperature_celsius gauge\n",
+		`temperature_celsius{floor="1",room="a"} 21.5` + "\n",
+		`temperature_celsius{floor="1",room="b"} 20` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+
+	temperature.ResetAll()
+	if out := scrape(t, r); strings.Contains(out, "temperature_celsius{") {
+		t.Errorf("output contains values after ResetAll:\n%s", out)
+	}
+}
+
+func scrape(t *testing.T, h http.Handler) string {
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Body.String()
+}
@@ -0,0 +1,146 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "sync"
+
+// childHook is a hook registered with MetricVec.OnCreate or MetricVec.OnForget.
+// It is only called for children matching the curried label values of the
+// vector it has been registered with.
+type childHook struct {
+	curry []curriedLabelValue
+	fn    func(Labels)
+}
+
+// childEvent is the creation or deletion of a child of a MetricVec whose hooks
+// have not been called yet.
+type childEvent struct {
+	created     bool
+	labelValues []string
+}
+
+// globalForgetHooks are the hooks registered with the package-level OnForget.
+var globalForgetHooks struct {
+	mtx   sync.RWMutex
+	hooks []func(string, Labels)
+}
+
+// OnForget registers a function that is called whenever a child of any metric
+// vector of the process is deleted, be it by Delete, DeleteLabelValues, Reset,
+// or by eviction because of Opts.MaxChildren. It is called with the
+// fully-qualified name of the vector and the variable labels of the deleted
+// child. Applications can use it to clean up caches keyed by the same labels
+// in lockstep with the metrics. Use MetricVec.OnForget to only get notified
+// about a single vector.
+//
+// Hooks are called after the deletion, outside of any lock of the vector, so
+// they may use the vector. They are called synchronously by the goroutine
+// deleting the child and must be callable concurrently. They must not modify
+// the provided Labels.
+func OnForget(hook func(family string, labels Labels)) {
+	globalForgetHooks.mtx.Lock()
+	defer globalForgetHooks.mtx.Unlock()
+	globalForgetHooks.hooks = append(globalForgetHooks.hooks, hook)
+}
+
+// OnCreate registers a function that is called whenever a child of the vector
+// is created, with the variable labels of the new child, e.g. for audit
+// logging or quota accounting. The overflow child of OverflowCollapse counts,
+// too. For a curried vector (see CurryWith), the hook is only called for
+// children matching the curried label values, and the provided labels include
+// the curried ones. Hooks are called after the creation under the same
+// conditions as the hooks registered with the package-level OnForget.
+func (m *MetricVec) OnCreate(hook func(labels Labels)) {
+	target := m
+	if m.parent != nil {
+		target = m.parent
+	}
+	target.mtx.Lock()
+	defer target.mtx.Unlock()
+	target.createHooks = append(target.createHooks, childHook{curry: m.curry, fn: hook})
+}
+
+// OnForget registers a function that is called whenever a child of the vector
+// is deleted, with the variable labels of the deleted child. Together with
+// OnCreate, it allows to mirror the lifecycle of the children into external
+// systems. Curried vectors are handled as described for OnCreate. See the
+// package-level OnForget for details.
+func (m *MetricVec) OnForget(hook func(labels Labels)) {
+	target := m
+	if m.parent != nil {
+		target = m.parent
+	}
+	target.mtx.Lock()
+	defer target.mtx.Unlock()
+	target.forgetHooks = append(target.forgetHooks, childHook{curry: m.curry, fn: hook})
+}
+
+// queueCreate queues the notification of the create hooks about the new child
+// with the provided label values, if there are any hooks. The caller must hold
+// the mtx of the MetricVec and release it with unlockAndNotify.
+func (m *MetricVec) queueCreate(labelValues []string) {
+	if len(m.createHooks) > 0 {
+		m.childEvents = append(m.childEvents, childEvent{created: true, labelValues: labelValues})
+	}
+}
+
+// queueForget works like queueCreate for the forget hooks and the deleted
+// child with the provided label values.
+func (m *MetricVec) queueForget(labelValues []string) {
+	if len(m.forgetHooks) == 0 {
+		globalForgetHooks.mtx.RLock()
+		n := len(globalForgetHooks.hooks)
+		globalForgetHooks.mtx.RUnlock()
+		if n == 0 {
+			return
+		}
+	}
+	m.childEvents = append(m.childEvents, childEvent{labelValues: labelValues})
+}
+
+// unlockAndNotify releases the mtx of the MetricVec and then calls the hooks
+// for the events queued by queueCreate and queueForget.
+func (m *MetricVec) unlockAndNotify() {
+	events, createHooks, forgetHooks := m.childEvents, m.createHooks, m.forgetHooks
+	m.childEvents = nil
+	m.mtx.Unlock()
+	if len(events) == 0 {
+		return
+	}
+
+	globalForgetHooks.mtx.RLock()
+	globalHooks := globalForgetHooks.hooks
+	globalForgetHooks.mtx.RUnlock()
+	for _, e := range events {
+		labels := make(Labels, len(e.labelValues))
+		for i, name := range m.desc.variableLabels {
+			labels[name] = e.labelValues[i]
+		}
+		hooks := forgetHooks
+		if e.created {
+			hooks = createHooks
+		}
+		for _, hook := range hooks {
+			if matchesCurry(e.labelValues, hook.curry) {
+				hook.fn(labels)
+			}
+		}
+		if e.created {
+			continue
+		}
+		for _, hook := range globalHooks {
+			hook(m.desc.fqName, labels)
+		}
+	}
+}
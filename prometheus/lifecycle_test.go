@@ -0,0 +1,128 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOnForget(t *testing.T) {
+	globalForgetHooks.mtx.Lock()
+	saved := globalForgetHooks.hooks
+	globalForgetHooks.hooks = nil
+	globalForgetHooks.mtx.Unlock()
+	defer func() {
+		globalForgetHooks.mtx.Lock()
+		globalForgetHooks.hooks = saved
+		globalForgetHooks.mtx.Unlock()
+	}()
+
+	vec := NewCounterVec(
+		CounterOpts{Name: "test", Help: "helpless", MaxChildren: 3, OverflowPolicy: OverflowEvictOldest},
+		[]string{"method", "code"},
+	)
+	var (
+		forgotten, curriedForgotten []Labels
+		families                    []string
+	)
+	vec.OnForget(func(labels Labels) {
+		forgotten = append(forgotten, labels)
+		// The vector is not locked anymore.
+		vec.DeleteLabelValues("HEAD", "200")
+	})
+	vec.MustCurryWith(Labels{"method": "GET"}).OnForget(func(labels Labels) {
+		curriedForgotten = append(curriedForgotten, labels)
+	})
+	OnForget(func(family string, labels Labels) {
+		families = append(families, family)
+	})
+
+	vec.WithLabelValues("GET", "200").Inc()
+	vec.WithLabelValues("POST", "500").Inc()
+	vec.DeleteLabelValues("POST", "500")
+	vec.DeleteLabelValues("POST", "500") // Not present anymore.
+	vec.Delete(Labels{"method": "GET", "code": "200"})
+
+	want := []Labels{
+		{"method": "POST", "code": "500"},
+		{"method": "GET", "code": "200"},
+	}
+	if !reflect.DeepEqual(forgotten, want) {
+		t.Errorf("got forgotten %v, want %v", forgotten, want)
+	}
+	if want := want[1:]; !reflect.DeepEqual(curriedForgotten, want) {
+		t.Errorf("got forgotten by curried vector %v, want %v", curriedForgotten, want)
+	}
+	if want := []string{"test", "test"}; !reflect.DeepEqual(families, want) {
+		t.Errorf("got forgotten families %v, want %v", families, want)
+	}
+
+	// Evictions and Reset notify, too.
+	forgotten = nil
+	vec.WithLabelValues("GET", "1")
+	vec.WithLabelValues("GET", "2")
+	vec.WithLabelValues("GET", "3")
+	vec.WithLabelValues("GET", "4") // Evicts GET 1.
+	if want := []Labels{{"method": "GET", "code": "1"}}; !reflect.DeepEqual(forgotten, want) {
+		t.Errorf("got forgotten by eviction %v, want %v", forgotten, want)
+	}
+	forgotten = nil
+	vec.Reset()
+	if len(forgotten) != 3 {
+		t.Errorf("got %d children forgotten by Reset, want 3", len(forgotten))
+	}
+}
+
+func TestOnCreate(t *testing.T) {
+	vec := NewGaugeVec(
+		GaugeOpts{Name: "test", Help: "helpless", MaxChildren: 1, OverflowPolicy: OverflowCollapse},
+		[]string{"tenant", "queue"},
+	)
+	var created, curriedCreated []Labels
+	vec.OnCreate(func(labels Labels) {
+		created = append(created, labels)
+		// The vector is not locked anymore.
+		vec.DeleteLabelValues("none", "none")
+	})
+	vec.MustCurryWith(Labels{"tenant": "b"}).OnCreate(func(labels Labels) {
+		curriedCreated = append(curriedCreated, labels)
+	})
+
+	vec.WithLabelValues("a", "q1").Inc()
+	vec.WithLabelValues("a", "q1").Inc() // Exists already.
+	vec.WithLabelValues("b", "q2").Inc() // Collapsed into the overflow child.
+	vec.WithLabelValues("b", "q3").Inc()
+
+	want := []Labels{
+		{"tenant": "a", "queue": "q1"},
+		{"tenant": OverflowLabelValue, "queue": OverflowLabelValue},
+	}
+	if !reflect.DeepEqual(created, want) {
+		t.Errorf("got created %v, want %v", created, want)
+	}
+	if len(curriedCreated) != 0 {
+		t.Errorf("got created by curried vector %v, want none", curriedCreated)
+	}
+
+	vec = NewGaugeVec(GaugeOpts{Name: "test", Help: "helpless"}, []string{"tenant", "queue"})
+	vec.MustCurryWith(Labels{"tenant": "b"}).OnCreate(func(labels Labels) {
+		curriedCreated = append(curriedCreated, labels)
+	})
+	vec.WithLabelValues("a", "q1").Inc()
+	vec.WithLabelValues("b", "q2").Inc()
+	if want := []Labels{{"tenant": "b", "queue": "q2"}}; !reflect.DeepEqual(curriedCreated, want) {
+		t.Errorf("got created by curried vector %v, want %v", curriedCreated, want)
+	}
+}
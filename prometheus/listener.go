@@ -0,0 +1,128 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// InstrumentListener wraps the given net.Listener for instrumentation. It
+// registers four metric collectors (if not already done) and reports connection
+// metrics to the (newly or already) registered collectors:
+// net_connections_open (Gauge), net_connections_accepted_total (Counter),
+// net_connections_closed_total (Counter), and net_connection_errors_total
+// (Counter). Each has a constant label named "listener" with the provided
+// listenerName as value. net_connection_errors_total counts failed calls of
+// Accept and connections on which a Read or Write failed (other than with
+// io.EOF), each connection at most once.
+//
+// The returned net.Listener can be used wherever the wrapped one would have
+// been used, e.g. with http.Server.Serve.
+func InstrumentListener(listenerName string, l net.Listener) net.Listener {
+	return InstrumentListenerWithOpts(
+		Opts{
+			Subsystem:   "net",
+			ConstLabels: Labels{"listener": listenerName},
+		},
+		l,
+	)
+}
+
+// InstrumentListenerWithOpts works like InstrumentListener but provides more
+// flexibility (at the cost of a more complex call syntax). As
+// InstrumentListener, this function registers four metric collectors, but it
+// uses the provided Opts to create them. However, the fields "Name" and "Help"
+// in the Opts are ignored. "Name" is replaced by "connections_open",
+// "connections_accepted_total", "connections_closed_total", and
+// "connection_errors_total", respectively. "Help" is replaced by an appropriate
+// help string.
+func InstrumentListenerWithOpts(opts Opts, l net.Listener) net.Listener {
+	opts.Name = "connections_open"
+	opts.Help = "Number of currently open connections."
+	open := NewGauge(GaugeOpts(opts))
+
+	opts.Name = "connections_accepted_total"
+	opts.Help = "Total number of accepted connections."
+	accepted := NewCounter(CounterOpts(opts))
+
+	opts.Name = "connections_closed_total"
+	opts.Help = "Total number of closed connections."
+	closed := NewCounter(CounterOpts(opts))
+
+	opts.Name = "connection_errors_total"
+	opts.Help = "Total number of failed accepts and of connections with read or write errors."
+	errs := NewCounter(CounterOpts(opts))
+
+	return &instrumentedListener{
+		Listener: l,
+		open:     MustRegisterOrGet(open).(Gauge),
+		accepted: MustRegisterOrGet(accepted).(Counter),
+		closed:   MustRegisterOrGet(closed).(Counter),
+		errs:     MustRegisterOrGet(errs).(Counter),
+	}
+}
+
+type instrumentedListener struct {
+	net.Listener
+	open                   Gauge
+	accepted, closed, errs Counter
+}
+
+func (l *instrumentedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		l.errs.Inc()
+		return nil, err
+	}
+	l.accepted.Inc()
+	l.open.Inc()
+	return &instrumentedConn{Conn: c, listener: l}, nil
+}
+
+type instrumentedConn struct {
+	net.Conn
+	listener  *instrumentedListener
+	closeOnce sync.Once
+	errOnce   sync.Once
+}
+
+func (c *instrumentedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.reportError(err)
+	return n, err
+}
+
+func (c *instrumentedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.reportError(err)
+	return n, err
+}
+
+func (c *instrumentedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.listener.open.Dec()
+		c.listener.closed.Inc()
+	})
+	return err
+}
+
+func (c *instrumentedConn) reportError(err error) {
+	if err == nil || err == io.EOF {
+		return
+	}
+	c.errOnce.Do(c.listener.errs.Inc)
+}
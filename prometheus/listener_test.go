@@ -0,0 +1,74 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func metricValue(t *testing.T, m Metric) float64 {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		t.Fatal(err)
+	}
+	if pb.Counter != nil {
+		return pb.GetCounter().GetValue()
+	}
+	return pb.GetGauge().GetValue()
+}
+
+func TestInstrumentListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := InstrumentListener("test_listener", inner).(*instrumentedListener)
+
+	for i := 0; i < 2; i++ {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			conn.Close()
+			conn.Close() // Closing twice must be counted once.
+		}
+	}
+	l.Close()
+	if _, err := l.Accept(); err == nil {
+		t.Fatal("expected error accepting on closed listener")
+	}
+
+	for name, s := range map[string]struct {
+		m    Metric
+		want float64
+	}{
+		"open":     {l.open, 1},
+		"accepted": {l.accepted, 2},
+		"closed":   {l.closed, 1},
+		"errors":   {l.errs, 1},
+	} {
+		if got := metricValue(t, s.m); got != s.want {
+			t.Errorf("%s: got %v, want %v", name, got, s.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// FamilyMetadata describes a metric family registered with a Registry without
+// any of its samples.
+type FamilyMetadata struct {
+	Name string `json:"name"`
+	Help string `json:"help"`
+	// Type is "counter", "gauge", "summary", or "untyped", or empty if
+	// unknown, i.e. if the family is described by a Desc created with
+	// NewDesc rather than from Opts.
+	Type string `json:"type,omitempty"`
+	// Labels are the names of the constant labels in lexicographical
+	// order followed by the names of the variable labels.
+	Labels    []string `json:"labels"`
+	Stability string   `json:"stability"`
+	Debug     bool     `json:"debug,omitempty"`
+	// Deprecation is set for deprecated families, see Opts.Deprecation.
+	Deprecation *Deprecation `json:"deprecation,omitempty"`
+}
+
+// Metadata returns the metadata of all metric families registered with the
+// default registry. See Registry.Metadata.
+func Metadata() []FamilyMetadata {
+	return defRegistry.Metadata()
+}
+
+// Metadata returns the metadata of all metric families registered with this
+// Registry, sorted by name. It only asks the registered Collectors to describe
+// their metrics, nothing is collected, which makes it cheap enough to be
+// called by documentation and discovery tooling at any time. Metric families
+// injected with SetMetricFamilyInjectionHook are not included.
+func (r *Registry) Metadata() []FamilyMetadata {
+	r.mtx.RLock()
+	collectors := make([]Collector, 0, len(r.collectorsByID))
+	for _, c := range r.collectorsByID {
+		collectors = append(collectors, c)
+	}
+	r.mtx.RUnlock()
+
+	descs := map[string]*Desc{}
+	descChan := make(chan *Desc, capDescChan)
+	go func() {
+		for _, c := range collectors {
+			c.Describe(descChan)
+		}
+		close(descChan)
+	}()
+	for desc := range descChan {
+		// Prefer a Desc with known type among those of the same name.
+		if existing, ok := descs[desc.fqName]; !ok || existing.metricType == nil {
+			descs[desc.fqName] = desc
+		}
+	}
+
+	names := make([]string, 0, len(descs))
+	for name := range descs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	result := make([]FamilyMetadata, 0, len(names))
+	for _, name := range names {
+		desc := descs[name]
+		md := FamilyMetadata{
+			Name:      name,
+			Help:      desc.help,
+			Labels:    make([]string, 0, len(desc.constLabelPairs)+len(desc.variableLabels)),
+			Stability: desc.meta.stability.String(),
+			Debug:     desc.meta.debug,
+		}
+		if help, ok := r.helpByName[name]; ok {
+			md.Help = help
+		}
+		if desc.meta.deprecated {
+			deprecation := desc.meta.deprecation
+			md.Deprecation = &deprecation
+		}
+		if desc.metricType != nil {
+			md.Type = strings.ToLower(desc.metricType.String())
+		}
+		for _, lp := range desc.constLabelPairs {
+			md.Labels = append(md.Labels, lp.GetName())
+		}
+		md.Labels = append(md.Labels, desc.variableLabels...)
+		result = append(result, md)
+	}
+	return result
+}
+
+// MetadataHandler returns an http.Handler that serves the metadata of all
+// metric families registered with the provided Registry (see
+// Registry.Metadata) as a JSON array.
+func MetadataHandler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(contentTypeHeader, "application/json")
+		if err := json.NewEncoder(w).Encode(r.Metadata()); err != nil {
+			http.Error(w, "An error has occurred:\n\n"+err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
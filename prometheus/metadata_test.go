@@ -0,0 +1,61 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	r := NewRegistry()
+	vec := NewCounterVec(CounterOpts{
+		Name:        "requests_total",
+		Help:        "Requests.",
+		ConstLabels: Labels{"service": "users"},
+		Stability:   StabilityStable,
+	}, []string{"code", "method"})
+	vec.WithLabelValues("200", "GET").Inc()
+	r.MustRegister(vec)
+	r.MustRegister(NewSummary(SummaryOpts{Name: "latency_seconds", Help: "Latency.", Debug: true}))
+	r.MustRegister(NewCounterVec(CounterOpts{Name: "unused_total", Help: "Never used."}, []string{"a"}))
+	r.MustRegister(panickingCollector{NewDesc("custom", "Custom.", []string{"x"}, nil)})
+	r.SetHelp("custom", "Custom collector.")
+
+	want := []FamilyMetadata{
+		{Name: "custom", Help: "Custom collector.", Labels: []string{"x"}, Stability: "alpha"},
+		{Name: "latency_seconds", Help: "Latency.", Type: "summary", Labels: []string{}, Stability: "alpha", Debug: true},
+		{Name: "requests_total", Help: "Requests.", Type: "counter", Labels: []string{"service", "code", "method"}, Stability: "stable"},
+		{Name: "unused_total", Help: "Never used.", Type: "counter", Labels: []string{"a"}, Stability: "alpha"},
+	}
+	if got := r.Metadata(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got metadata %+v, want %+v", got, want)
+	}
+
+	resp := httptest.NewRecorder()
+	MetadataHandler(r).ServeHTTP(resp, &http.Request{Method: "GET", Header: http.Header{}})
+	if got, want := resp.Header().Get(contentTypeHeader), "application/json"; got != want {
+		t.Errorf("got content type %q, want %q", got, want)
+	}
+	var served []FamilyMetadata
+	if err := json.Unmarshal(resp.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(served, want) {
+		t.Errorf("got served metadata %+v, want %+v", served, want)
+	}
+}
@@ -51,6 +51,13 @@ type Metric interface {
 	Write(*dto.Metric) error
 }
 
+// scrapeResetter is implemented by metrics supporting Opts.ResetOnScrape.
+type scrapeResetter interface {
+	// writeForReset works like Write, but also returns a function that
+	// decreases the metric by the written value.
+	writeForReset(*dto.Metric) (func(), error)
+}
+
 // Opts bundles the options for creating most Metric types. Each metric
 // implementation XXX has its own XXXOpts type, but in most cases, it is just be
 // an alias of this type (which might change when the requirement arises.)
@@ -67,12 +74,73 @@ type Opts struct {
 	Subsystem string
 	Name      string
 
+	// FQName, if set, is used as the fully-qualified name of the Metric
+	// exactly as provided, for exporters that have to reproduce externally
+	// mandated metric names. Namespace, Subsystem, and Name must be empty
+	// then, and the Unit is not appended (but still validated).
+	FQName string
+
 	// Help provides information about this metric. Mandatory!
 	//
 	// Metrics with the same fully-qualified name must have the same Help
 	// string.
 	Help string
 
+	// HelpExposure overrides the setting of the Registry (see OmitHelp)
+	// for the metric, e.g. to always include the help string of a metric
+	// that is hard to understand without it, or to never include the
+	// lengthy help string of a verbose metric. Metrics with the same
+	// fully-qualified name must agree on HelpExposure.
+	HelpExposure HelpExposure
+
+	// Debug marks the metric as internal, i.e. only of interest while
+	// debugging. Debug metrics are collected as usual and returned by
+	// Gather, but they are only exposed via HTTP by a DebugHandler, so that
+	// a single Registry can back a lean production endpoint and a verbose
+	// debugging endpoint. Metrics with the same fully-qualified name must
+	// agree on Debug.
+	Debug bool
+
+	// Stability declares how stable the metric is, i.e. whether consumers
+	// may build alerts and dashboards on it. The default is
+	// StabilityAlpha. See StabilityHandler to expose only metrics of a
+	// minimum stability. Metrics with the same fully-qualified name must
+	// agree on Stability.
+	Stability Stability
+
+	// Deprecation, if not nil, marks the metric as deprecated. Metadata
+	// (see Registry.Metadata) includes it, and the uses of the metric are
+	// counted by the ClientCollector and logged (see
+	// SetDeprecationLogger) to guide the cleanup. Metrics with the same
+	// fully-qualified name must agree on Deprecation.
+	Deprecation *Deprecation
+
+	// ResetOnScrape makes each successful collection (a scrape, a push, or
+	// a call of Gather) reset the metric after it has been written, so
+	// that it reports what happened since the previous collection, as
+	// needed for delta-style or windowed metrics. Rather than being set to
+	// zero, the metric is decreased by the value written, so increments
+	// that happen in the meantime are reported by the next collection.
+	// Collections of a Registry with such metrics are serialized. The
+	// children of metric vectors are reset, not deleted. Only counters,
+	// gauges, and untyped metrics support it. Metrics with the same
+	// fully-qualified name must agree on ResetOnScrape.
+	ResetOnScrape bool
+
+	// ValueStorage determines how counters and gauges (including the
+	// children of their vectors) store their value. The default
+	// StorageFloat64 is right for almost all uses. StorageInt64 restricts
+	// values to integers in return for speed, see there. Other metrics
+	// ignore it.
+	ValueStorage ValueStorage
+
+	// Unit is the base unit of the metric, e.g. UnitSeconds. If set, it is
+	// appended to the fully-qualified name unless the name already ends
+	// with it (before a "_total" suffix, which stays last). An unknown unit
+	// makes the metric invalid, i.e. registration fails. The empty default
+	// means no unit.
+	Unit Unit
+
 	// ConstLabels are used to attach fixed labels to this metric. Metrics
 	// with the same fully-qualified name must have the same label names in
 	// their ConstLabels.
@@ -92,8 +160,57 @@ type Opts struct {
 	// that label most likely should not be a label at all (but part of the
 	// metric name).
 	ConstLabels Labels
+
+	// SanitizeLabelValues, if true, makes metric vectors replace invalid
+	// UTF-8 sequences in variable label values with the Unicode replacement
+	// character rather than returning an error. Set it if label values are
+	// derived from user input, e.g. from URLs or filenames.
+	SanitizeLabelValues bool
+
+	// MaxChildren limits the number of children of a metric vector, i.e.
+	// the number of distinct label value combinations it tracks, to
+	// protect against label values from unbounded sets like user IDs. Zero
+	// means no limit. OverflowPolicy determines what happens to a label
+	// value combination that would exceed the limit. Both fields are
+	// ignored by metrics that are not vectors.
+	MaxChildren    int
+	OverflowPolicy OverflowPolicy
+
+	// DefaultLabelValues provides values for variable labels of a metric
+	// vector that are missing in the Labels passed to GetMetricWith and
+	// With, e.g. Labels{"code": "unknown"}. Names that are not variable
+	// labels of the vector are ignored. GetMetricWithLabelValues and
+	// WithLabelValues still require all label values.
+	DefaultLabelValues Labels
+
+	// LabelValueNormalizers maps variable label names of a metric vector to
+	// functions that are applied to each value of the label before the
+	// child is looked up, e.g. strings.ToLower, TruncateLabelValue(64), or
+	// NormalizePathIDs. This way, values are cleaned consistently instead
+	// of at each call site.
+	LabelValueNormalizers map[string]func(string) string
+
+	// ExpectedChildren is the number of children a metric vector is
+	// expected to hold, e.g. the number of endpoints or queues. It is only
+	// a capacity hint to avoid repeatedly growing the internal maps while
+	// the vector fills up. Zero means no hint.
+	ExpectedChildren int
 }
 
+// HelpExposure determines whether the help string of a metric family is
+// exposed, see Opts.HelpExposure.
+type HelpExposure int
+
+// Possible values for HelpExposure.
+const (
+	// HelpDefault follows the setting of the Registry, see OmitHelp.
+	HelpDefault HelpExposure = iota
+	// HelpAlways exposes the help string in any case.
+	HelpAlways
+	// HelpNever never exposes the help string.
+	HelpNever
+)
+
 // BuildFQName joins the given three name components by "_". Empty name
 // components are ignored. If the name parameter itself is empty, an empty
 // string is returned, no matter what. Metric implementations included in this
@@ -0,0 +1,81 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MultiHandler is an http.Handler that serves different sets of metrics under
+// different paths. It maps URL paths to handlers, which are usually Registries
+// or filtered views created with FilteredHandler. Requests for paths not in the
+// map are answered with 404. A trailing slash of the request path is ignored.
+//
+// With a MultiHandler, a single entry in a ServeMux can cover several exposure
+// policies:
+//
+//     internal := prometheus.NewRegistry()
+//     // Register collectors with internal...
+//     mh := prometheus.MultiHandler{
+//         "/metrics":          prometheus.Handler(),
+//         "/metrics/internal": internal,
+//         "/metrics/debug":    prometheus.DebugHandler(internal),
+//     }
+//     http.Handle("/metrics", mh)
+//     http.Handle("/metrics/", mh)
+type MultiHandler map[string]http.Handler
+
+// ServeHTTP implements http.Handler.
+func (m MultiHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	h, ok := m[path]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	h.ServeHTTP(w, req)
+}
+
+// FilteredHandler returns an http.Handler that serves the metrics of the
+// provided Registry in the same way as the Registry itself, but restricted to
+// the metric families whose name is accepted by the keep function. Note that
+// all registered Collectors are still collected from on each request.
+func FilteredHandler(r *Registry, keep func(name string) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.serveHTTP(w, req, keepByName(keep), false)
+	})
+}
+
+// DebugHandler returns an http.Handler that serves all metrics of the provided
+// Registry including the debug metrics (see Opts.Debug), which are left out by
+// the Registry itself and all other handlers.
+func DebugHandler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.serveHTTP(w, req, nil, true)
+	})
+}
+
+// StabilityHandler returns an http.Handler that serves the metrics of the
+// provided Registry in the same way as the Registry itself, but restricted to
+// the metrics with a Stability of at least min (see Opts.Stability), e.g. to
+// offer downstream consumers an endpoint with only StabilityStable metrics.
+func StabilityHandler(r *Registry, min Stability) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.serveHTTP(w, req, r.keepStability(min), false)
+	})
+}
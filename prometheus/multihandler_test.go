@@ -0,0 +1,193 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMultiHandler(t *testing.T) {
+	public := NewRegistry()
+	public.MustRegister(NewCounter(CounterOpts{
+		Name: "public_total",
+		Help: "A public counter.",
+	}))
+	internal := NewRegistry()
+	internal.MustRegister(NewCounter(CounterOpts{
+		Name: "internal_total",
+		Help: "An internal counter.",
+	}))
+	internal.MustRegister(NewGauge(GaugeOpts{
+		Name: "debug_gauge",
+		Help: "A gauge for debugging.",
+	}))
+
+	mh := MultiHandler{
+		"/metrics":          public,
+		"/metrics/internal": internal,
+		"/metrics/debug": FilteredHandler(internal, func(name string) bool {
+			return strings.HasPrefix(name, "debug_")
+		}),
+	}
+
+	scenarios := []struct {
+		path            string
+		code            int
+		contains, lacks []string
+	}{
+		{
+			path:     "/metrics",
+			code:     http.StatusOK,
+			contains: []string{"public_total 0"},
+			lacks:    []string{"internal_total", "debug_gauge"},
+		},
+		{
+			path:     "/metrics/internal/",
+			code:     http.StatusOK,
+			contains: []string{"internal_total 0", "debug_gauge 0"},
+			lacks:    []string{"public_total"},
+		},
+		{
+			path:     "/metrics/debug",
+			code:     http.StatusOK,
+			contains: []string{"debug_gauge 0"},
+			lacks:    []string{"internal_total", "public_total"},
+		},
+		{
+			path: "/metrics/unknown",
+			code: http.StatusNotFound,
+		},
+	}
+
+	for i, s := range scenarios {
+		resp := httptest.NewRecorder()
+		req := &http.Request{
+			Method: "GET",
+			URL:    &url.URL{Path: s.path},
+			Header: http.Header{},
+		}
+		mh.ServeHTTP(resp, req)
+		if resp.Code != s.code {
+			t.Errorf("%d. got code %d, want %d", i, resp.Code, s.code)
+		}
+		body := resp.Body.String()
+		for _, c := range s.contains {
+			if !strings.Contains(body, c) {
+				t.Errorf("%d. body does not contain %q:\n%s", i, c, body)
+			}
+		}
+		for _, l := range s.lacks {
+			if strings.Contains(body, l) {
+				t.Errorf("%d. body unexpectedly contains %q:\n%s", i, l, body)
+			}
+		}
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(NewCounter(CounterOpts{Name: "requests_total", Help: "Requests."}))
+	r.MustRegister(NewGaugeVec(GaugeOpts{Name: "queue_depth", Help: "Queue depth.", Debug: true}, []string{"queue"}))
+	r.MustRegister(NewSummary(SummaryOpts{Name: "lock_wait_seconds", Help: "Lock waits.", Debug: true}))
+
+	if err := r.Register(NewGauge(GaugeOpts{
+		Name:        "queue_depth",
+		Help:        "Queue depth.",
+		ConstLabels: Labels{"queue": "x"},
+	})); err == nil {
+		t.Error("expected error for descriptor disagreeing on Debug")
+	}
+
+	for _, s := range []struct {
+		handler         http.Handler
+		contains, lacks []string
+	}{
+		{
+			handler:  r,
+			contains: []string{"requests_total 0"},
+			lacks:    []string{"lock_wait_seconds"},
+		},
+		{
+			handler:  DebugHandler(r),
+			contains: []string{"requests_total 0", "lock_wait_seconds_count 0"},
+		},
+	} {
+		resp := httptest.NewRecorder()
+		s.handler.ServeHTTP(resp, &http.Request{Method: "GET", Header: http.Header{}})
+		body := resp.Body.String()
+		for _, c := range s.contains {
+			if !strings.Contains(body, c) {
+				t.Errorf("body does not contain %q:\n%s", c, body)
+			}
+		}
+		for _, l := range s.lacks {
+			if strings.Contains(body, l) {
+				t.Errorf("body unexpectedly contains %q:\n%s", l, body)
+			}
+		}
+	}
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs), 2; got != want {
+		t.Errorf("got %d gathered metric families, want %d", got, want)
+	}
+}
+
+func TestStabilityHandler(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(NewCounter(CounterOpts{Name: "alpha_total", Help: "Alpha."}))
+	r.MustRegister(NewCounter(CounterOpts{Name: "beta_total", Help: "Beta.", Stability: StabilityBeta}))
+	r.MustRegister(NewSummary(SummaryOpts{Name: "stable_seconds", Help: "Stable.", Stability: StabilityStable}))
+
+	if err := r.Register(NewCounter(CounterOpts{
+		Name:        "beta_total",
+		Help:        "Beta.",
+		ConstLabels: Labels{"a": "b"},
+	})); err == nil {
+		t.Error("expected error for descriptor with different stability")
+	}
+	if err := r.Register(NewCounter(CounterOpts{Name: "x", Help: "x", Stability: 42})); err == nil {
+		t.Error("expected error for unknown stability")
+	}
+
+	for _, s := range []struct {
+		min             Stability
+		contains, lacks []string
+	}{
+		{StabilityAlpha, []string{"alpha_total", "beta_total", "stable_seconds"}, nil},
+		{StabilityBeta, []string{"beta_total", "stable_seconds"}, []string{"alpha_total"}},
+		{StabilityStable, []string{"stable_seconds"}, []string{"alpha_total", "beta_total"}},
+	} {
+		resp := httptest.NewRecorder()
+		StabilityHandler(r, s.min).ServeHTTP(resp, &http.Request{Method: "GET", Header: http.Header{}})
+		body := resp.Body.String()
+		for _, c := range s.contains {
+			if !strings.Contains(body, c) {
+				t.Errorf("%s: body does not contain %q:\n%s", s.min, c, body)
+			}
+		}
+		for _, l := range s.lacks {
+			if strings.Contains(body, l) {
+				t.Errorf("%s: body unexpectedly contains %q:\n%s", s.min, l, body)
+			}
+		}
+	}
+}
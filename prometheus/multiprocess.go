@@ -0,0 +1,334 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/matttproud/golang_protobuf_extensions/ext"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// processFileSuffix is the suffix of the files written by WriteProcessFile.
+const processFileSuffix = ".metrics"
+
+// WorkerLabel is the name of the label a MultiProcessCollector uses to tell
+// apart the metrics of different workers, see GaugePerWorker.
+const WorkerLabel = "worker"
+
+// DefaultLiveTimeout is the default value of
+// MultiProcessCollectorOpts.LiveTimeout.
+const DefaultLiveTimeout = time.Minute
+
+// workerID identifies this process in the name of its process file. The start
+// time makes it unique even if the ID of the process is recycled by the
+// operating system after the process has exited.
+var workerID = fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+
+// WriteProcessFile writes the current values of all metrics registered with
+// the default registry to a file in dir, replacing the file written previously
+// by this process. It is the worker side of the multi-process mode for
+// pre-fork servers and other deployments with several worker processes, each
+// with its own registry, that should appear as a single exposition: every
+// worker calls WriteProcessFile regularly, e.g. every few seconds and on exit,
+// and the process serving the metrics registers a MultiProcessCollector for
+// the same directory.
+//
+//     go func() {
+//         for range time.Tick(5 * time.Second) {
+//             if err := prometheus.WriteProcessFile(dir); err != nil {
+//                 log.Println(err)
+//             }
+//         }
+//     }()
+//
+// The file is named after the ID of the process and its start time, so that a
+// new worker never overwrites the file of an exited one, even if it got the
+// same process ID. Quantiles of summaries are not written, as they cannot be
+// aggregated. The file is replaced atomically, so a concurrent
+// MultiProcessCollector never reads a partially written file. Writing the file
+// neither runs the hooks registered with OnBeforeGather and OnAfterGather nor
+// resets metrics with Opts.ResetOnScrape.
+func WriteProcessFile(dir string) error {
+	return defRegistry.WriteProcessFile(dir)
+}
+
+// WriteProcessFile works like the package-level function of the same name, but
+// writes the metrics registered with this Registry.
+func (r *Registry) WriteProcessFile(dir string) error {
+	return r.writeProcessFile(dir, workerID)
+}
+
+func (r *Registry) writeProcessFile(dir, name string) error {
+	f, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // Fails harmlessly once renamed.
+	err = r.writeState(
+		f, true,
+		dto.MetricType_COUNTER, dto.MetricType_GAUGE,
+		dto.MetricType_SUMMARY, dto.MetricType_UNTYPED,
+	)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, name+processFileSuffix))
+}
+
+// GaugeAggregation specifies how a MultiProcessCollector aggregates the values
+// a gauge (or an untyped metric) has in the different workers.
+type GaugeAggregation int
+
+// Possible values for GaugeAggregation. All of them except GaugeSum only take
+// into account live workers, see MultiProcessCollectorOpts.LiveTimeout.
+const (
+	// GaugeLiveSum sums up the values of the live workers, which suits
+	// gauges like the number of requests in progress.
+	GaugeLiveSum GaugeAggregation = iota
+	// GaugeSum sums up the values of all workers, including the exited
+	// ones.
+	GaugeSum
+	// GaugeMax uses the highest value of the live workers.
+	GaugeMax
+	// GaugeMin uses the lowest value of the live workers.
+	GaugeMin
+	// GaugePerWorker keeps the value of each live worker as a metric of its
+	// own, with the label WorkerLabel set to the worker. Only use it for
+	// gauges without a label of that name.
+	GaugePerWorker
+)
+
+// MultiProcessCollectorOpts bundles the options for creating a
+// MultiProcessCollector. It is mandatory to set Dir to a non-empty string. All
+// other fields are optional and can safely be left at their zero value.
+type MultiProcessCollectorOpts struct {
+	// Dir is the directory the workers write their files to with
+	// WriteProcessFile. Mandatory!
+	Dir string
+
+	// GaugeAggregations maps the names of gauges and untyped metrics to
+	// the way their values are aggregated. Metrics not listed are
+	// aggregated with GaugeLiveSum.
+	GaugeAggregations map[string]GaugeAggregation
+
+	// LiveTimeout is the time after which a worker that has not written its
+	// file anymore is considered exited. It has to be well above the
+	// interval at which the workers call WriteProcessFile. The default
+	// value is DefaultLiveTimeout.
+	LiveTimeout time.Duration
+}
+
+// MultiProcessCollector is a Collector that aggregates the metrics written by
+// the worker processes of a multi-process deployment with WriteProcessFile.
+// On each collection, it reads all files in its directory and aggregates the
+// metrics with the same name and labels, so that all workers appear as one
+// coherent exposition. Create instances with NewMultiProcessCollector.
+//
+// The values of counters and the counts and sums of summaries are summed up
+// over all workers. The files of exited workers are kept, so their counters do
+// not go backwards. Clear the directory when the whole deployment starts,
+// before any worker writes to it. Gauges and untyped metrics are aggregated as
+// configured in MultiProcessCollectorOpts.GaugeAggregations. Metric families
+// whose names start with "process_" or "go_", like those collected by the
+// collectors from NewProcessCollector and NewGoCollector, describe a single process and are
+// therefore not aggregated at all. Instead, those of live workers are
+// collected with the label WorkerLabel set to the worker.
+//
+// Additionally, a gauge multiprocess_files is collected, the number of files
+// that were read successfully. Files that cannot be read are skipped. As with
+// the FederationCollector, the aggregated metrics cannot be described by
+// Describe, so a registry with collect checks enabled (see
+// EnableCollectChecks) will report an error when collecting them.
+type MultiProcessCollector struct {
+	dir               string
+	gaugeAggregations map[string]GaugeAggregation
+	liveTimeout       time.Duration
+	filesDesc         *Desc
+}
+
+// NewMultiProcessCollector returns a newly allocated MultiProcessCollector
+// based on the provided MultiProcessCollectorOpts. It still has to be
+// registered, typically with the registry of the process serving the metrics,
+// which must not be registered with the registries whose metrics the workers
+// write.
+func NewMultiProcessCollector(opts MultiProcessCollectorOpts) *MultiProcessCollector {
+	c := &MultiProcessCollector{
+		dir:               opts.Dir,
+		gaugeAggregations: opts.GaugeAggregations,
+		liveTimeout:       opts.LiveTimeout,
+		filesDesc: NewDesc(
+			"multiprocess_files",
+			"Number of process files aggregated in the last collection.",
+			nil, nil,
+		),
+	}
+	if c.liveTimeout == 0 {
+		c.liveTimeout = DefaultLiveTimeout
+	}
+	return c
+}
+
+// Describe implements Collector. Only the descriptor of the
+// multiprocess_files metric is sent.
+func (c *MultiProcessCollector) Describe(ch chan<- *Desc) {
+	ch <- c.filesDesc
+}
+
+// Collect implements Collector.
+func (c *MultiProcessCollector) Collect(ch chan<- Metric) {
+	paths, _ := filepath.Glob(filepath.Join(c.dir, "*"+processFileSuffix))
+	var (
+		files          int
+		familiesByName = map[string]*dto.MetricFamily{}
+		metricsByKey   = map[string]*dto.Metric{}
+		now            = time.Now()
+	)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		mfs, err := readProcessFile(path)
+		if err != nil {
+			continue
+		}
+		files++
+		worker := strings.TrimSuffix(filepath.Base(path), processFileSuffix)
+		live := now.Sub(info.ModTime()) < c.liveTimeout
+		for _, mf := range mfs {
+			name := mf.GetName()
+			family, ok := familiesByName[name]
+			if !ok {
+				family = &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type}
+				familiesByName[name] = family
+			} else if family.GetType() != mf.GetType() {
+				continue
+			}
+			agg := c.aggregation(mf)
+			if !live && agg != GaugeSum {
+				continue
+			}
+			for _, m := range mf.Metric {
+				if agg == GaugePerWorker {
+					m.Label = append(m.Label, &dto.LabelPair{
+						Name:  proto.String(WorkerLabel),
+						Value: proto.String(worker),
+					})
+					sort.Sort(LabelPairSorter(m.Label))
+				}
+				key := stateKey(name, m.Label)
+				if prev, ok := metricsByKey[key]; ok {
+					aggregateMetric(prev, m, agg)
+					continue
+				}
+				metricsByKey[key] = m
+				family.Metric = append(family.Metric, m)
+			}
+		}
+	}
+
+	ch <- MustNewConstMetric(c.filesDesc, GaugeValue, float64(files))
+	names := make([]string, 0, len(familiesByName))
+	for name := range familiesByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family := familiesByName[name]
+		desc := NewDesc(name, family.GetHelp(), nil, nil)
+		for _, m := range family.Metric {
+			ch <- &federatedMetric{desc: desc, metric: m}
+		}
+	}
+}
+
+// aggregation returns how the metrics of the provided family are aggregated.
+// Counters and summaries are always summed up with GaugeSum.
+func (c *MultiProcessCollector) aggregation(mf *dto.MetricFamily) GaugeAggregation {
+	name := mf.GetName()
+	if strings.HasPrefix(name, "process_") || strings.HasPrefix(name, "go_") {
+		return GaugePerWorker
+	}
+	switch mf.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		return c.gaugeAggregations[name]
+	}
+	return GaugeSum
+}
+
+// readProcessFile reads all metric families from the file at path.
+func readProcessFile(path string) ([]*dto.MetricFamily, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mfs []*dto.MetricFamily
+	for {
+		mf := &dto.MetricFamily{}
+		if _, err := ext.ReadDelimited(f, mf); err != nil {
+			if err == io.EOF {
+				return mfs, nil
+			}
+			return nil, err
+		}
+		mfs = append(mfs, mf)
+	}
+}
+
+// aggregateMetric aggregates the values of m into agg, which is a metric of
+// the same type, as specified by the provided GaugeAggregation.
+func aggregateMetric(agg, m *dto.Metric, how GaugeAggregation) {
+	switch {
+	case agg.Counter != nil:
+		agg.Counter.Value = proto.Float64(agg.Counter.GetValue() + m.GetCounter().GetValue())
+	case agg.Gauge != nil:
+		agg.Gauge.Value = proto.Float64(aggregateValue(agg.Gauge.GetValue(), m.GetGauge().GetValue(), how))
+	case agg.Untyped != nil:
+		agg.Untyped.Value = proto.Float64(aggregateValue(agg.Untyped.GetValue(), m.GetUntyped().GetValue(), how))
+	case agg.Summary != nil:
+		agg.Summary.SampleCount = proto.Uint64(agg.Summary.GetSampleCount() + m.GetSummary().GetSampleCount())
+		agg.Summary.SampleSum = proto.Float64(agg.Summary.GetSampleSum() + m.GetSummary().GetSampleSum())
+	}
+}
+
+func aggregateValue(a, b float64, how GaugeAggregation) float64 {
+	switch how {
+	case GaugeMax:
+		if b > a {
+			return b
+		}
+		return a
+	case GaugeMin:
+		if b < a {
+			return b
+		}
+		return a
+	}
+	return a + b
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMultiProcessCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multiprocess_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, worker := range []string{"100", "200", "300"} {
+		r := newRegistry()
+		requests := NewCounterVec(CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"code"})
+		inFlight := NewGauge(GaugeOpts{Name: "in_flight", Help: "In flight."})
+		peak := NewGauge(GaugeOpts{Name: "peak", Help: "Peak."})
+		low := NewGauge(GaugeOpts{Name: "low", Help: "Low."})
+		allTime := NewGauge(GaugeOpts{Name: "all_time", Help: "All time."})
+		goroutines := NewGauge(GaugeOpts{Name: "go_goroutines", Help: "Goroutines."})
+		latency := NewSummary(SummaryOpts{Name: "latency_seconds", Help: "Latency."})
+		r.MustRegister(requests)
+		r.MustRegister(inFlight)
+		r.MustRegister(peak)
+		r.MustRegister(low)
+		r.MustRegister(allTime)
+		r.MustRegister(goroutines)
+		r.MustRegister(latency)
+		requests.WithLabelValues("200").Add(float64(i + 1))
+		requests.WithLabelValues(worker).Inc()
+		inFlight.Set(2)
+		peak.Set(float64(i + 1))
+		low.Set(float64(i + 1))
+		allTime.Set(1)
+		goroutines.Set(float64(10 * (i + 1)))
+		latency.Observe(float64(i + 1))
+		if err := r.writeProcessFile(dir, worker); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Worker 300 has exited a while ago.
+	old := time.Now().Add(-2 * DefaultLiveTimeout)
+	if err := os.Chtimes(filepath.Join(dir, "300"+processFileSuffix), old, old); err != nil {
+		t.Fatal(err)
+	}
+	// Unreadable files are skipped.
+	if err := ioutil.WriteFile(filepath.Join(dir, "400"+processFileSuffix), []byte{5, 1}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRegistry()
+	r.MustRegister(NewMultiProcessCollector(MultiProcessCollectorOpts{
+		Dir: dir,
+		GaugeAggregations: map[string]GaugeAggregation{
+			"peak":     GaugeMax,
+			"low":      GaugeMin,
+			"all_time": GaugeSum,
+		},
+	}))
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, lp := range m.Label {
+				key += "/" + lp.GetValue()
+			}
+			switch {
+			case m.Counter != nil:
+				got[key] = m.Counter.GetValue()
+			case m.Gauge != nil:
+				got[key] = m.Gauge.GetValue()
+			case m.Summary != nil:
+				got[key+"_count"] = float64(m.Summary.GetSampleCount())
+				got[key+"_sum"] = m.Summary.GetSampleSum()
+			}
+		}
+	}
+	want := map[string]float64{
+		"multiprocess_files":    3,
+		"requests_total/200":    7,
+		"requests_total/100":    1,
+		"requests_total/300":    1,
+		"in_flight":             4,
+		"peak":                  2,
+		"low":                   1,
+		"all_time":              3,
+		"go_goroutines/100":     10,
+		"go_goroutines/200":     20,
+		"latency_seconds_count": 3,
+		"latency_seconds_sum":   6,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %v, want %v", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// noopDesc is the descriptor of all no-op metrics. It is invalid so that
+// registering a no-op metric or vector fails instead of silently exporting
+// nothing.
+var noopDesc = NewInvalidDesc(errors.New("no-op metrics cannot be registered"))
+
+// No-op implementations of the metric interfaces. They discard all updates and
+// cannot be registered. Libraries can accept a Counter, Gauge, or Summary and
+// use these as the default if the caller does not provide a real metric, and
+// tests can pass them to code that requires a metric but is not tested for its
+// instrumentation. Calling their methods costs no more than an interface call.
+var (
+	NoopCounter Counter = noopCounter{}
+	NoopGauge   Gauge   = noopGauge{}
+	NoopSummary Summary = noopSummary{}
+)
+
+// NewNoopCounterVec returns a CounterVec with the provided variable labels that
+// returns NoopCounter for all label values. Label values are still checked as
+// for a regular CounterVec, so that mistakes show up in tests, but no children
+// are created. Like all no-op metrics, the vector cannot be registered.
+func NewNoopCounterVec(labelNames []string) *CounterVec {
+	return &CounterVec{
+		MetricVec: MetricVec{
+			desc: newNoopVecDesc(labelNames),
+			noop: NoopCounter,
+		},
+	}
+}
+
+// NewNoopGaugeVec works like NewNoopCounterVec, but for a GaugeVec returning
+// NoopGauge.
+func NewNoopGaugeVec(labelNames []string) *GaugeVec {
+	return &GaugeVec{
+		MetricVec: MetricVec{
+			desc: newNoopVecDesc(labelNames),
+			noop: NoopGauge,
+		},
+	}
+}
+
+// NewNoopSummaryVec works like NewNoopCounterVec, but for a SummaryVec
+// returning NoopSummary.
+func NewNoopSummaryVec(labelNames []string) *SummaryVec {
+	return &SummaryVec{
+		MetricVec: MetricVec{
+			desc: newNoopVecDesc(labelNames),
+			noop: NoopSummary,
+		},
+	}
+}
+
+// newNoopVecDesc returns the descriptor used by no-op vectors to check label
+// values. It is never exposed by Describe.
+func newNoopVecDesc(labelNames []string) *Desc {
+	return NewDesc("noop", "No-op metric.", labelNames, nil)
+}
+
+type noopMetric struct{}
+
+func (noopMetric) Desc() *Desc              { return noopDesc }
+func (noopMetric) Write(*dto.Metric) error  { return nil }
+func (noopMetric) Describe(ch chan<- *Desc) { ch <- noopDesc }
+func (noopMetric) Collect(ch chan<- Metric) {}
+
+type noopCounter struct{ noopMetric }
+
+func (noopCounter) Set(float64)       {}
+func (noopCounter) Inc()              {}
+func (noopCounter) Add(float64)       {}
+func (noopCounter) AddMany([]float64) {}
+
+type noopGauge struct{ noopMetric }
+
+func (noopGauge) Set(float64) {}
+func (noopGauge) Inc()        {}
+func (noopGauge) Dec()        {}
+func (noopGauge) Add(float64) {}
+func (noopGauge) Sub(float64) {}
+
+type noopSummary struct{ noopMetric }
+
+func (noopSummary) Observe(float64)       {}
+func (noopSummary) ObserveMany([]float64) {}
@@ -0,0 +1,46 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "testing"
+
+func TestNoopMetrics(t *testing.T) {
+	NoopCounter.Inc()
+	NoopGauge.Sub(42)
+	NoopSummary.Observe(42)
+
+	vec := NewNoopCounterVec([]string{"code", "method"})
+	if got := vec.WithLabelValues("200", "GET"); got != NoopCounter {
+		t.Errorf("got %v, want NoopCounter", got)
+	}
+	if got := vec.With(Labels{"code": "404", "method": "GET"}); got != NoopCounter {
+		t.Errorf("got %v, want NoopCounter", got)
+	}
+	if _, err := vec.GetMetricWithLabelValues("200"); err == nil {
+		t.Error("expected error for inconsistent label cardinality")
+	}
+	if got := vec.MustCurryWith(Labels{"code": "200"}).WithLabelValues("GET"); got != NoopCounter {
+		t.Errorf("got %v from curried vector, want NoopCounter", got)
+	}
+	if got := vec.numChildren; got != 0 {
+		t.Errorf("got %d children, want 0", got)
+	}
+
+	r := newRegistry()
+	for _, c := range []Collector{NoopGauge, NewNoopSummaryVec([]string{"l"})} {
+		if err := r.Register(c); err == nil {
+			t.Errorf("registering %T succeeded, want error", c)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+// ResultLabel is the name of the label by which an OutcomeCounter partitions
+// the counted outcomes.
+const ResultLabel = "result"
+
+// Values of ResultLabel for successes and for failures not matched by any
+// ErrorClass of an OutcomeCounter.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// OutcomeCounter counts the outcomes of operations in a CounterVec partitioned
+// by ResultLabel, which is ResultSuccess for successful operations and the type
+// of the first matching ErrorClass (or ResultFailure) for failed ones. This
+// standardizes the most common counting pattern, from which both the
+// throughput and the error ratio of operations can be derived. Create
+// instances with NewOutcomeCounter.
+type OutcomeCounter struct {
+	classCounter
+}
+
+// NewOutcomeCounter returns an OutcomeCounter incrementing the children of
+// vec, which must have ResultLabel as one of its variable labels. Errors are
+// matched against the classes in the given order. If ResultLabel is the only
+// variable label of vec, the children for all outcomes are initialized to zero
+// so that they are exported before the first operation completes.
+//
+// Usage example:
+//
+//     uploads := prometheus.NewCounterVec(prometheus.CounterOpts{
+//         Name: "uploads_total",
+//         Help: "Uploads by result.",
+//     }, []string{prometheus.ResultLabel})
+//     prometheus.MustRegister(uploads)
+//     outcomes := prometheus.NewOutcomeCounter(uploads, prometheus.ErrorIs(context.DeadlineExceeded, "timeout"))
+//     // ...
+//     outcomes.RecordOutcome(upload(ctx, file))
+func NewOutcomeCounter(vec *CounterVec, classes ...ErrorClass) *OutcomeCounter {
+	return &OutcomeCounter{newClassCounter(vec, ResultLabel, ResultFailure, classes, ResultSuccess)}
+}
+
+// RecordOutcome increments the child for the outcome of an operation that
+// returned err. It is a shortcut for RecordOutcomeWith with nil labels.
+func (o *OutcomeCounter) RecordOutcome(err error) {
+	o.RecordOutcomeWith(err, nil)
+}
+
+// RecordOutcomeWith increments the child for the outcome of an operation that
+// returned err and the provided values of the other variable labels. Invalid
+// labels are handled as by CounterVec.With.
+func (o *OutcomeCounter) RecordOutcomeWith(err error, labels Labels) {
+	o.inc(o.Result(err), labels)
+}
+
+// Result returns the value of ResultLabel for the outcome of an operation that
+// returned err.
+func (o *OutcomeCounter) Result(err error) string {
+	if err == nil {
+		return ResultSuccess
+	}
+	return o.classify(err)
+}
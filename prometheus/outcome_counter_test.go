@@ -0,0 +1,71 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestOutcomeCounter(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{Name: "uploads_total", Help: "Uploads."},
+		[]string{ResultLabel},
+	)
+	outcomes := NewOutcomeCounter(vec, ErrorIs(context.DeadlineExceeded, "timeout"))
+	if got, want := vec.numChildren, 3; got != want {
+		t.Errorf("got %d initialized children, want %d", got, want)
+	}
+
+	outcomes.RecordOutcome(nil)
+	outcomes.RecordOutcome(nil)
+	outcomes.RecordOutcome(wrappedError{"uploading", context.DeadlineExceeded})
+	outcomes.RecordOutcome(errors.New("boom"))
+
+	for result, want := range map[string]float64{
+		ResultSuccess: 2,
+		"timeout":     1,
+		ResultFailure: 1,
+	} {
+		m := &dto.Metric{}
+		vec.WithLabelValues(result).Write(m)
+		if got := m.GetCounter().GetValue(); got != want {
+			t.Errorf("%s %q: got %v, want %v", ResultLabel, result, got, want)
+		}
+	}
+
+	withOp := NewCounterVec(
+		CounterOpts{Name: "ops_total", Help: "Operations."},
+		[]string{"op", ResultLabel},
+	)
+	NewOutcomeCounter(withOp).RecordOutcomeWith(nil, Labels{"op": "read"})
+	m := &dto.Metric{}
+	withOp.WithLabelValues("read", ResultSuccess).Write(m)
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("got %v, want 1", got)
+	}
+	if got, want := withOp.numChildren, 1; got != want {
+		t.Errorf("got %d children, want %d", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for vector without result label")
+		}
+	}()
+	NewOutcomeCounter(NewCounterVec(CounterOpts{Name: "x", Help: "x"}, []string{"op"}))
+}
@@ -26,6 +26,8 @@ type processCollector struct {
 // NewProcessCollector returns a collector which exports the current state of
 // process metrics including cpu, memory and file descriptor usage as well as
 // the process start time for the given process id under the given namespace.
+// The metrics are available on platforms with a procfs and on Windows, where
+// the handle count is reported as the number of open file descriptors.
 func NewProcessCollector(pid int, namespace string) *processCollector {
 	return NewProcessCollectorPIDFn(
 		func() (int, error) { return pid, nil },
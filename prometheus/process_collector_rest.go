@@ -12,6 +12,7 @@
 // limitations under the License.
 
 // +build !linux,!plan9,!solaris !cgo
+// +build !windows
 
 package prometheus
 
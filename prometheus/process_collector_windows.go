@@ -0,0 +1,123 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build windows
+
+package prometheus
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modpsapi    = syscall.NewLazyDLL("psapi.dll")
+	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procGetProcessMemoryInfo  = modpsapi.NewProc("GetProcessMemoryInfo")
+	procGetProcessHandleCount = modkernel32.NewProc("GetProcessHandleCount")
+)
+
+const (
+	processQueryLimitedInformation = 0x1000
+
+	// Windows has no limit for open files, but a hard-coded limit of
+	// handles per process.
+	maxHandles = 16 * 1024 * 1024
+)
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS_EX.
+type processMemoryCounters struct {
+	cb                         uint32
+	pageFaultCount             uint32
+	peakWorkingSetSize         uintptr
+	workingSetSize             uintptr
+	quotaPeakPagedPoolUsage    uintptr
+	quotaPagedPoolUsage        uintptr
+	quotaPeakNonPagedPoolUsage uintptr
+	quotaNonPagedPoolUsage     uintptr
+	pagefileUsage              uintptr
+	peakPagefileUsage          uintptr
+	privateUsage               uintptr
+}
+
+func processCollectSupported() bool {
+	return procGetProcessMemoryInfo.Find() == nil && procGetProcessHandleCount.Find() == nil
+}
+
+// processCollect collects the metrics of a process on Windows. The working set
+// is reported as resident memory, the private bytes (commit charge) as virtual
+// memory, and the handle count as open file descriptors.
+func (c *processCollector) processCollect(ch chan<- Metric) {
+	pid, err := c.pidFn()
+	if err != nil {
+		c.reportCollectErrors(ch, err)
+		return
+	}
+
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		c.reportCollectErrors(ch, err)
+		return
+	}
+	defer syscall.CloseHandle(h)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		ch <- NewInvalidMetric(c.startTime.Desc(), err)
+		ch <- NewInvalidMetric(c.cpuTotal.Desc(), err)
+	} else {
+		c.cpuTotal.Set(fileTimeSeconds(kernel) + fileTimeSeconds(user))
+		ch <- c.cpuTotal
+		c.startTime.Set(float64(creation.Nanoseconds()) / 1e9)
+		ch <- c.startTime
+	}
+
+	mem := processMemoryCounters{}
+	mem.cb = uint32(unsafe.Sizeof(mem))
+	if r, _, err := procGetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&mem)), uintptr(mem.cb)); r == 0 {
+		ch <- NewInvalidMetric(c.vsize.Desc(), err)
+		ch <- NewInvalidMetric(c.rss.Desc(), err)
+	} else {
+		c.vsize.Set(float64(mem.privateUsage))
+		ch <- c.vsize
+		c.rss.Set(float64(mem.workingSetSize))
+		ch <- c.rss
+	}
+
+	var handles uint32
+	if r, _, err := procGetProcessHandleCount.Call(uintptr(h), uintptr(unsafe.Pointer(&handles))); r == 0 {
+		ch <- NewInvalidMetric(c.openFDs.Desc(), err)
+	} else {
+		c.openFDs.Set(float64(handles))
+		ch <- c.openFDs
+	}
+
+	c.maxFDs.Set(maxHandles)
+	ch <- c.maxFDs
+}
+
+func (c *processCollector) reportCollectErrors(ch chan<- Metric, err error) {
+	ch <- NewInvalidMetric(c.cpuTotal.Desc(), err)
+	ch <- NewInvalidMetric(c.openFDs.Desc(), err)
+	ch <- NewInvalidMetric(c.maxFDs.Desc(), err)
+	ch <- NewInvalidMetric(c.vsize.Desc(), err)
+	ch <- NewInvalidMetric(c.rss.Desc(), err)
+	ch <- NewInvalidMetric(c.startTime.Desc(), err)
+}
+
+// fileTimeSeconds converts a duration in the 100ns units of a Filetime to
+// seconds.
+func fileTimeSeconds(ft syscall.Filetime) float64 {
+	return float64(uint64(ft.HighDateTime)<<32|uint64(ft.LowDateTime)) / 1e7
+}
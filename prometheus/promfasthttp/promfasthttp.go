@@ -0,0 +1,56 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promfasthttp serves metrics collected by the prometheus package with
+// the fasthttp server (github.com/valyala/fasthttp). Negotiation of the
+// exposition format and compression works in the same way as for the standard
+// net/http handler.
+//
+//     fasthttp.ListenAndServe(":8080", func(ctx *fasthttp.RequestCtx) {
+//         switch string(ctx.Path()) {
+//         case "/metrics":
+//             promfasthttp.Handler()(ctx)
+//         default:
+//             ctx.NotFound()
+//         }
+//     })
+package promfasthttp
+
+import (
+	"github.com/valyala/fasthttp"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Handler returns a fasthttp.RequestHandler for the default Prometheus
+// registry. The metrics are encoded directly into the response body without
+// intermediate copying. Unlike prometheus.Handler, the returned handler is not
+// instrumented.
+func Handler() fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		contentType, encoding, err := prometheus.WriteNegotiated(
+			ctx,
+			string(ctx.Request.Header.Peek("Accept")),
+			string(ctx.Request.Header.Peek("Accept-Encoding")),
+		)
+		if err != nil {
+			ctx.Response.ResetBody()
+			ctx.Error("An error has occurred:\n\n"+err.Error(), fasthttp.StatusInternalServerError)
+			return
+		}
+		ctx.SetContentType(contentType)
+		if encoding != "" {
+			ctx.Response.Header.Set("Content-Encoding", encoding)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promfasthttp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandler(t *testing.T) {
+	prometheus.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "promfasthttp_test_total",
+		Help: "A counter for testing.",
+	}))
+
+	scenarios := []struct {
+		accept, acceptEncoding string
+		contentType, encoding  string
+		bodyContains           []byte
+	}{
+		{
+			contentType:  prometheus.TextTelemetryContentType,
+			bodyContains: []byte("promfasthttp_test_total 0"),
+		},
+		{
+			accept:      "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited",
+			contentType: prometheus.DelimitedTelemetryContentType,
+			// Not checking the binary body here.
+		},
+		{
+			acceptEncoding: "gzip",
+			contentType:    prometheus.TextTelemetryContentType,
+			encoding:       "gzip",
+		},
+	}
+
+	for i, s := range scenarios {
+		var ctx fasthttp.RequestCtx
+		if s.accept != "" {
+			ctx.Request.Header.Set("Accept", s.accept)
+		}
+		if s.acceptEncoding != "" {
+			ctx.Request.Header.Set("Accept-Encoding", s.acceptEncoding)
+		}
+		Handler()(&ctx)
+
+		if got := ctx.Response.StatusCode(); got != fasthttp.StatusOK {
+			t.Errorf("%d. got status %d, want %d", i, got, fasthttp.StatusOK)
+		}
+		if got := string(ctx.Response.Header.ContentType()); got != s.contentType {
+			t.Errorf("%d. got content type %q, want %q", i, got, s.contentType)
+		}
+		if got := string(ctx.Response.Header.Peek("Content-Encoding")); got != s.encoding {
+			t.Errorf("%d. got content encoding %q, want %q", i, got, s.encoding)
+		}
+		if !bytes.Contains(ctx.Response.Body(), s.bodyContains) {
+			t.Errorf("%d. body does not contain %q:\n%s", i, s.bodyContains, ctx.Response.Body())
+		}
+	}
+}
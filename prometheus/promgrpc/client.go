@@ -0,0 +1,116 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.21
+
+package promgrpc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ClientMetrics is a Collector bundling the metrics of a gRPC client. It is the
+// client-side counterpart of ServerMetrics. Its interceptors record the RPCs
+// issued by the client.
+type ClientMetrics struct {
+	metrics
+}
+
+// NewClientMetrics returns a ClientMetrics based on the provided SummaryOpts
+// and LabelExtractors. The metrics are named and partitioned in the same way as
+// those created by NewServerMetrics, but the default subsystem is "grpc_client". The
+// handling_seconds summary observes the time until an RPC has completed, as
+// seen by the client.
+func NewClientMetrics(opts prometheus.SummaryOpts, extractors ...*LabelExtractor) *ClientMetrics {
+	return &ClientMetrics{newMetrics(
+		opts, "client",
+		"Time in seconds until an RPC was completed, as seen by the client.",
+		extractors,
+	)}
+}
+
+// UnaryClientInterceptor returns an interceptor for unary RPCs recording the
+// metrics of the ClientMetrics.
+func (m *ClientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, fullMethod string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		lvs := m.labelValues(ctx, unary, fullMethod)
+		begin := time.Now()
+		m.started.WithLabelValues(lvs...).Inc()
+		err := invoker(ctx, fullMethod, req, reply, cc, opts...)
+		m.observeHandled(lvs, err, begin)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor for streaming RPCs recording
+// the metrics of the ClientMetrics, including the number of messages sent and
+// received. A streaming RPC is considered completed once receiving a message
+// returns an error (io.EOF for a successful RPC) or once the stream could not
+// be created at all.
+func (m *ClientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, fullMethod string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		lvs := m.labelValues(ctx, streamType(desc.ClientStreams, desc.ServerStreams), fullMethod)
+		begin := time.Now()
+		m.started.WithLabelValues(lvs...).Inc()
+		cs, err := streamer(ctx, desc, cc, fullMethod, opts...)
+		if err != nil {
+			m.observeHandled(lvs, err, begin)
+			return nil, err
+		}
+		return &monitoredClientStream{
+			ClientStream: cs,
+			received:     m.msgReceived.WithLabelValues(lvs...),
+			sent:         m.msgSent.WithLabelValues(lvs...),
+			handled: func(err error) {
+				m.observeHandled(lvs, err, begin)
+			},
+		}, nil
+	}
+}
+
+// monitoredClientStream wraps a grpc.ClientStream to count the messages sent
+// and received and to detect the completion of the RPC.
+type monitoredClientStream struct {
+	grpc.ClientStream
+	received, sent prometheus.Counter
+	handled        func(error)
+	once           sync.Once
+}
+
+func (s *monitoredClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *monitoredClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch err {
+	case nil:
+		s.received.Inc()
+	case io.EOF:
+		s.once.Do(func() { s.handled(nil) })
+	default:
+		s.once.Do(func() { s.handled(err) })
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.21
+
+package promgrpc
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeClientStream receives n messages before returning io.EOF.
+type fakeClientStream struct {
+	grpc.ClientStream
+	n int
+}
+
+func (s *fakeClientStream) SendMsg(interface{}) error { return nil }
+
+func (s *fakeClientStream) RecvMsg(interface{}) error {
+	if s.n == 0 {
+		return io.EOF
+	}
+	s.n--
+	return nil
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	m := NewClientMetrics(prometheus.SummaryOpts{})
+	interceptor := m.UnaryClientInterceptor()
+
+	interceptor(context.Background(), "/test.Greeter/SayHello", nil, nil, nil,
+		func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			return status.Error(codes.Unavailable, "unavailable")
+		},
+	)
+
+	if want, got := 1., counterValue(t, m.started.WithLabelValues("unary", "test.Greeter", "SayHello")); want != got {
+		t.Errorf("want %f started RPCs, got %f", want, got)
+	}
+	if want, got := 1., counterValue(t, m.handled.WithLabelValues("unary", "test.Greeter", "SayHello", "Unavailable")); want != got {
+		t.Errorf("want %f handled RPCs, got %f", want, got)
+	}
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	m := NewClientMetrics(prometheus.SummaryOpts{})
+	interceptor := m.StreamClientInterceptor()
+	desc := &grpc.StreamDesc{ServerStreams: true}
+
+	cs, err := interceptor(context.Background(), desc, nil, "/test.Greeter/List",
+		func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{n: 2}, nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.SendMsg(nil); err != nil {
+		t.Fatal(err)
+	}
+	for cs.RecvMsg(nil) == nil {
+	}
+	// Another call after the end of the stream must not count again.
+	cs.RecvMsg(nil)
+
+	if want, got := 2., counterValue(t, m.msgReceived.WithLabelValues("server_stream", "test.Greeter", "List")); want != got {
+		t.Errorf("want %f received messages, got %f", want, got)
+	}
+	if want, got := 1., counterValue(t, m.msgSent.WithLabelValues("server_stream", "test.Greeter", "List")); want != got {
+		t.Errorf("want %f sent messages, got %f", want, got)
+	}
+	if want, got := 1., counterValue(t, m.handled.WithLabelValues("server_stream", "test.Greeter", "List", "OK")); want != got {
+		t.Errorf("want %f handled RPCs, got %f", want, got)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.21
+
+// Package promgrpc provides interceptors to instrument gRPC servers and clients
+// (google.golang.org/grpc) with metrics of the prometheus package. The
+// interceptors record the started and handled RPCs partitioned by service,
+// method, and status code, the handling time, and the messages sent and
+// received on streams.
+//
+//     m := promgrpc.NewServerMetrics(prometheus.SummaryOpts{})
+//     prometheus.MustRegister(m)
+//     server := grpc.NewServer(
+//         grpc.UnaryInterceptor(m.UnaryServerInterceptor()),
+//         grpc.StreamInterceptor(m.StreamServerInterceptor()),
+//     )
+//
+// Clients are instrumented in the same way with ClientMetrics:
+//
+//     m := promgrpc.NewClientMetrics(prometheus.SummaryOpts{})
+//     prometheus.MustRegister(m)
+//     conn, err := grpc.Dial(addr,
+//         grpc.WithUnaryInterceptor(m.UnaryClientInterceptor()),
+//         grpc.WithStreamInterceptor(m.StreamClientInterceptor()),
+//     )
+//
+// The package is only built with Go 1.21 or later, as current versions of gRPC
+// do not support the older Go versions the rest of this repository is tested
+// with. For the same reason, "make dependencies" does not fetch gRPC.
+package promgrpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The possible values of the "grpc_type" label.
+const (
+	unary        = "unary"
+	clientStream = "client_stream"
+	serverStream = "server_stream"
+	bidiStream   = "bidi_stream"
+)
+
+// LabelExtractor derives the values of additional labels from an RPC, e.g. a
+// tenant ID from the request metadata. LabelExtractors can be passed to
+// NewServerMetrics and NewClientMetrics, which then partition all their metrics
+// by the labels in Names. Create instances with NewLabelExtractor.
+type LabelExtractor struct {
+	// Names are the names of the derived labels.
+	Names []string
+	// Extract returns the label values for the RPC with the provided
+	// context and full method name, in the same order as Names. Missing
+	// values are treated as empty strings.
+	Extract func(ctx context.Context, fullMethod string) []string
+
+	limits []*prometheus.LabelValueLimit
+}
+
+// NewLabelExtractor returns a LabelExtractor for the provided label names. If
+// maxValues is positive, each label is limited to maxValues distinct values
+// (see prometheus.LabelValueLimit).
+func NewLabelExtractor(names []string, maxValues int, extract func(ctx context.Context, fullMethod string) []string) *LabelExtractor {
+	limits := make([]*prometheus.LabelValueLimit, len(names))
+	for i := range limits {
+		limits[i] = prometheus.NewLabelValueLimit(maxValues)
+	}
+	return &LabelExtractor{
+		Names:   names,
+		Extract: extract,
+		limits:  limits,
+	}
+}
+
+// labelValues returns the limited label values for the RPC, exactly one for
+// each of Names.
+func (e *LabelExtractor) labelValues(ctx context.Context, fullMethod string) []string {
+	lvs := make([]string, len(e.Names))
+	copy(lvs, e.Extract(ctx, fullMethod))
+	for i, l := range e.limits {
+		lvs[i] = l.Limit(lvs[i])
+	}
+	return lvs
+}
+
+// metrics are the metrics shared by ServerMetrics and ClientMetrics.
+type metrics struct {
+	started, handled     *prometheus.CounterVec
+	msgReceived, msgSent *prometheus.CounterVec
+	handlingSeconds      *prometheus.SummaryVec
+
+	extractors []*LabelExtractor
+}
+
+// newMetrics creates the metrics for the given side ("server" or "client"). See
+// NewServerMetrics for how opts is used.
+func newMetrics(opts prometheus.SummaryOpts, side, handlingHelp string, extractors []*LabelExtractor) metrics {
+	if opts.Subsystem == "" {
+		opts.Subsystem = "grpc_" + side
+	}
+	startedLabels := []string{"grpc_type", "grpc_service", "grpc_method"}
+	for _, e := range extractors {
+		startedLabels = append(startedLabels, e.Names...)
+	}
+	handledLabels := append(startedLabels[:len(startedLabels):len(startedLabels)], "grpc_code")
+
+	counter := func(name, help string, labels []string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   opts.Subsystem,
+				Name:        name,
+				Help:        help,
+				ConstLabels: opts.ConstLabels,
+			},
+			labels,
+		)
+	}
+	opts.Name = "handling_seconds"
+	opts.Help = handlingHelp
+	return metrics{
+		started: counter(
+			"started_total", "Total number of RPCs started on the "+side+".",
+			startedLabels,
+		),
+		handled: counter(
+			"handled_total", "Total number of RPCs completed on the "+side+", regardless of success or failure.",
+			handledLabels,
+		),
+		msgReceived: counter(
+			"msg_received_total", "Total number of stream messages received by the "+side+".",
+			startedLabels,
+		),
+		msgSent: counter(
+			"msg_sent_total", "Total number of stream messages sent by the "+side+".",
+			startedLabels,
+		),
+		handlingSeconds: prometheus.NewSummaryVec(opts, handledLabels),
+		extractors:      extractors,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.started.Describe(ch)
+	m.handled.Describe(ch)
+	m.msgReceived.Describe(ch)
+	m.msgSent.Describe(ch)
+	m.handlingSeconds.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *metrics) Collect(ch chan<- prometheus.Metric) {
+	m.started.Collect(ch)
+	m.handled.Collect(ch)
+	m.msgReceived.Collect(ch)
+	m.msgSent.Collect(ch)
+	m.handlingSeconds.Collect(ch)
+}
+
+// labelValues returns the values of the labels of the started_total,
+// msg_received_total, and msg_sent_total metrics for an RPC.
+func (m *metrics) labelValues(ctx context.Context, typ, fullMethod string) []string {
+	service, method := splitMethodName(fullMethod)
+	lvs := []string{typ, service, method}
+	for _, e := range m.extractors {
+		lvs = append(lvs, e.labelValues(ctx, fullMethod)...)
+	}
+	return lvs
+}
+
+// observeHandled records a completed RPC that was started at begin. lvs are
+// the label values as returned by labelValues.
+func (m *metrics) observeHandled(lvs []string, err error, begin time.Time) {
+	lvs = append(lvs[:len(lvs):len(lvs)], status.Code(err).String())
+	m.handled.WithLabelValues(lvs...).Inc()
+	m.handlingSeconds.WithLabelValues(lvs...).Observe(time.Since(begin).Seconds())
+}
+
+// splitMethodName splits a full method name of the form
+// "/package.Service/Method" into service and method.
+func splitMethodName(fullMethod string) (service, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
+
+func streamType(clientStreams, serverStreams bool) string {
+	switch {
+	case clientStreams && serverStreams:
+		return bidiStream
+	case clientStreams:
+		return clientStream
+	case serverStreams:
+		return serverStream
+	}
+	return unary
+}
+
+func streamTypeFromServerInfo(info *grpc.StreamServerInfo) string {
+	return streamType(info.IsClientStream, info.IsServerStream)
+}
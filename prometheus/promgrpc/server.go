@@ -0,0 +1,106 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.21
+
+package promgrpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ServerMetrics is a Collector bundling the metrics of a gRPC server. Its
+// interceptors record the RPCs handled by the server. Like any Collector, it
+// has to be registered with a registry (the default one or any other) to
+// expose the metrics.
+type ServerMetrics struct {
+	metrics
+}
+
+// NewServerMetrics returns a ServerMetrics based on the provided
+// SummaryOpts. Similar to prometheus.InstrumentHandlerWithOpts, the fields
+// "Name" and "Help" in the SummaryOpts are ignored. If "Subsystem" is empty, it
+// is set to "grpc_server". The created metrics are named "started_total",
+// "handled_total", "msg_received_total", "msg_sent_total", and
+// "handling_seconds" within the namespace and subsystem. Namespace, Subsystem,
+// and ConstLabels are applied to all of them, while the remaining fields of
+// the SummaryOpts only apply to the handling_seconds summary. All metrics are
+// partitioned by "grpc_type", "grpc_service", and "grpc_method", followed by
+// the labels of the optional LabelExtractors. The handled_total and
+// handling_seconds metrics are additionally partitioned by "grpc_code".
+func NewServerMetrics(opts prometheus.SummaryOpts, extractors ...*LabelExtractor) *ServerMetrics {
+	return &ServerMetrics{newMetrics(
+		opts, "server",
+		"Time in seconds taken to handle an RPC until the handler returned.",
+		extractors,
+	)}
+}
+
+// UnaryServerInterceptor returns an interceptor for unary RPCs recording the
+// metrics of the ServerMetrics.
+func (m *ServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		lvs := m.labelValues(ctx, unary, info.FullMethod)
+		begin := time.Now()
+		m.started.WithLabelValues(lvs...).Inc()
+		resp, err := handler(ctx, req)
+		m.observeHandled(lvs, err, begin)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor for streaming RPCs recording
+// the metrics of the ServerMetrics, including the number of messages sent and
+// received.
+func (m *ServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		lvs := m.labelValues(ss.Context(), streamTypeFromServerInfo(info), info.FullMethod)
+		begin := time.Now()
+		m.started.WithLabelValues(lvs...).Inc()
+		err := handler(srv, &monitoredServerStream{
+			ServerStream: ss,
+			received:     m.msgReceived.WithLabelValues(lvs...),
+			sent:         m.msgSent.WithLabelValues(lvs...),
+		})
+		m.observeHandled(lvs, err, begin)
+		return err
+	}
+}
+
+// monitoredServerStream wraps a grpc.ServerStream to count the messages sent
+// and received.
+type monitoredServerStream struct {
+	grpc.ServerStream
+	received, sent prometheus.Counter
+}
+
+func (s *monitoredServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *monitoredServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Inc()
+	}
+	return err
+}
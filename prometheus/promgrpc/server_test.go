@@ -0,0 +1,130 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.21
+
+package promgrpc
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeServerStream receives n messages before returning io.EOF.
+type fakeServerStream struct {
+	grpc.ServerStream
+	n int
+}
+
+func (s *fakeServerStream) Context() context.Context { return context.Background() }
+
+func (s *fakeServerStream) SendMsg(interface{}) error { return nil }
+
+func (s *fakeServerStream) RecvMsg(interface{}) error {
+	if s.n == 0 {
+		return io.EOF
+	}
+	s.n--
+	return nil
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	out := &dto.Metric{}
+	if err := c.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	return out.GetCounter().GetValue()
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m := NewServerMetrics(prometheus.SummaryOpts{})
+	interceptor := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Greeter/SayHello"}
+
+	interceptor(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return "hello", nil
+	})
+	interceptor(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+
+	if want, got := 2., counterValue(t, m.started.WithLabelValues("unary", "test.Greeter", "SayHello")); want != got {
+		t.Errorf("want %f started RPCs, got %f", want, got)
+	}
+	for _, code := range []string{"OK", "NotFound"} {
+		if want, got := 1., counterValue(t, m.handled.WithLabelValues("unary", "test.Greeter", "SayHello", code)); want != got {
+			t.Errorf("want %f handled RPCs with code %s, got %f", want, code, got)
+		}
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	m := NewServerMetrics(prometheus.SummaryOpts{})
+	interceptor := m.StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Greeter/Chat", IsClientStream: true, IsServerStream: true}
+
+	err := interceptor(nil, &fakeServerStream{n: 3}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		for ss.RecvMsg(nil) == nil {
+			if err := ss.SendMsg(nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 3., counterValue(t, m.msgReceived.WithLabelValues("bidi_stream", "test.Greeter", "Chat")); want != got {
+		t.Errorf("want %f received messages, got %f", want, got)
+	}
+	if want, got := 3., counterValue(t, m.msgSent.WithLabelValues("bidi_stream", "test.Greeter", "Chat")); want != got {
+		t.Errorf("want %f sent messages, got %f", want, got)
+	}
+	if want, got := 1., counterValue(t, m.handled.WithLabelValues("bidi_stream", "test.Greeter", "Chat", "OK")); want != got {
+		t.Errorf("want %f handled RPCs, got %f", want, got)
+	}
+}
+
+func TestServerMetricsLabelExtractor(t *testing.T) {
+	type tenantKey struct{}
+	m := NewServerMetrics(prometheus.SummaryOpts{}, NewLabelExtractor(
+		[]string{"tenant"}, 1,
+		func(ctx context.Context, fullMethod string) []string {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return []string{tenant}
+		},
+	))
+	interceptor := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Greeter/SayHello"}
+	handler := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+
+	for _, tenant := range []string{"a", "b", "a"} {
+		interceptor(context.WithValue(context.Background(), tenantKey{}, tenant), nil, info, handler)
+	}
+
+	if want, got := 2., counterValue(t, m.started.WithLabelValues("unary", "test.Greeter", "SayHello", "a")); want != got {
+		t.Errorf("want %f started RPCs for tenant a, got %f", want, got)
+	}
+	if want, got := 1., counterValue(t, m.handled.WithLabelValues("unary", "test.Greeter", "SayHello", prometheus.OverflowLabelValue, "OK")); want != got {
+		t.Errorf("want %f handled RPCs for overflowing tenants, got %f", want, got)
+	}
+}
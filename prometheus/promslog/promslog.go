@@ -0,0 +1,158 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.21
+
+// Package promslog counts log records of the log/slog package with metrics of
+// the prometheus package. A wrapped slog.Handler increments a counter
+// partitioned by level (and optionally by logger name) for every record it
+// handles, so that log volume and error rates are exposed wherever structured
+// logging is already in place:
+//
+//     m := promslog.NewMetrics(prometheus.CounterOpts{}, "")
+//     prometheus.MustRegister(m)
+//     logger := slog.New(m.WrapHandler(slog.NewJSONHandler(os.Stderr, nil)))
+package promslog
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics is a Collector bundling the counter of log records handled by
+// wrapped handlers. Like any Collector, it has to be registered with a registry
+// to expose the metrics.
+type Metrics struct {
+	records   *prometheus.CounterVec
+	loggerKey string
+}
+
+// NewMetrics returns a Metrics based on the provided CounterOpts. Similar to
+// promsql.NewMetrics, the fields "Name" and "Help" in the CounterOpts are
+// ignored. If "Subsystem" is empty, it is set to "log". The created counter is
+// named "records_total" within the namespace and subsystem and partitioned by
+// the label "level", the lower-cased name of the level of the record
+// (e.g. "info" or "error").
+//
+// If loggerKey is not empty, the counter is also partitioned by the label
+// "logger". Its value is the string value of the top-level attribute with the
+// key loggerKey, added with slog.Logger.With or to the record itself, or empty
+// if there is no such attribute. As every distinct value creates a time
+// series, the attribute should name components (e.g. "http" or "db"), not
+// individual requests.
+//
+// Without loggerKey, the counters for the standard levels are initialized at
+// zero, so that error rates can be computed before the first error is logged.
+func NewMetrics(opts prometheus.CounterOpts, loggerKey string) *Metrics {
+	if opts.Subsystem == "" {
+		opts.Subsystem = "log"
+	}
+	opts.Name = "records_total"
+	opts.Help = "Total number of log records handled, partitioned by level."
+	labels := []string{"level"}
+	if loggerKey != "" {
+		labels = append(labels, "logger")
+	}
+	m := &Metrics{
+		records:   prometheus.NewCounterVec(opts, labels),
+		loggerKey: loggerKey,
+	}
+	if loggerKey == "" {
+		for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+			m.records.WithLabelValues(levelName(level))
+		}
+	}
+	return m
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.records.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.records.Collect(ch)
+}
+
+// WrapHandler returns a slog.Handler that counts every record before passing
+// it on to the provided Handler. Records dropped because the provided Handler
+// is not enabled for their level are not counted.
+func (m *Metrics) WrapHandler(h slog.Handler) slog.Handler {
+	return &handler{next: h, metrics: m}
+}
+
+// levelName returns the value of the "level" label for level.
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// handler is the slog.Handler returned by WrapHandler.
+type handler struct {
+	next    slog.Handler
+	metrics *Metrics
+	// logger is the value of the attribute named loggerKey added with
+	// WithAttrs. grouped is set once WithGroup has been called, as
+	// attributes added afterwards are not top-level anymore.
+	logger  string
+	grouped bool
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if h.metrics.loggerKey == "" {
+		h.metrics.records.WithLabelValues(levelName(r.Level)).Inc()
+		return h.next.Handle(ctx, r)
+	}
+	logger := h.logger
+	if !h.grouped {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == h.metrics.loggerKey {
+				logger = a.Value.String()
+				return false
+			}
+			return true
+		})
+	}
+	h.metrics.records.WithLabelValues(levelName(r.Level), logger).Inc()
+	return h.next.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	result := *h
+	result.next = h.next.WithAttrs(attrs)
+	if h.metrics.loggerKey != "" && !h.grouped {
+		for _, a := range attrs {
+			if a.Key == h.metrics.loggerKey {
+				result.logger = a.Value.String()
+			}
+		}
+	}
+	return &result
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	result := *h
+	result.next = h.next.WithGroup(name)
+	result.grouped = true
+	return &result
+}
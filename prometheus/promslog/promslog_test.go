@@ -0,0 +1,75 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.21
+
+package promslog
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(prometheus.CounterOpts{Namespace: "app"}, "")
+	var buf bytes.Buffer
+	logger := slog.New(m.WrapHandler(slog.NewTextHandler(&buf, nil)))
+
+	logger.Info("starting")
+	logger.Debug("not enabled, not counted")
+	logger.With("component", "db").WithGroup("query").Error("failed", "err", "timeout")
+	logger.Error("failed again")
+
+	if !strings.Contains(buf.String(), "query.err=timeout") {
+		t.Errorf("record not passed on:\n%s", buf.String())
+	}
+	expected := `# HELP app_log_records_total Total number of log records handled, partitioned by level.
+# TYPE app_log_records_total counter
+app_log_records_total{level="debug"} 0
+app_log_records_total{level="error"} 2
+app_log_records_total{level="info"} 1
+app_log_records_total{level="warn"} 0
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetricsLoggerKey(t *testing.T) {
+	m := NewMetrics(prometheus.CounterOpts{}, "logger")
+	logger := slog.New(m.WrapHandler(slog.NewTextHandler(io.Discard, nil)))
+
+	logger.Info("untagged")
+	db := logger.With("logger", "db")
+	db.Warn("slow query")
+	db.Warn("slow query", "logger", "db.replica")
+	// Attributes within a group are not top-level.
+	db.WithGroup("request").With("logger", "ignored").Error("failed")
+
+	expected := `# HELP log_records_total Total number of log records handled, partitioned by level.
+# TYPE log_records_total counter
+log_records_total{level="error",logger="db"} 1
+log_records_total{level="info",logger=""} 1
+log_records_total{level="warn",logger="db"} 1
+log_records_total{level="warn",logger="db.replica"} 1
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promsql instruments database/sql drivers with metrics of the
+// prometheus package. A wrapped driver.Connector records the duration and the
+// errors of queries, executions, and transactions, partitioned by operation and
+// by a name derived from the query text:
+//
+//     m := promsql.NewMetrics(prometheus.SummaryOpts{}, nil)
+//     prometheus.MustRegister(m)
+//     db := sql.OpenDB(m.WrapDriver(&pq.Driver{}, dsn))
+//
+// All calls of the resulting *sql.DB are instrumented without changing the call
+// sites.
+package promsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The possible values of the "operation" label.
+const (
+	opQuery    = "query"
+	opExec     = "exec"
+	opPrepare  = "prepare"
+	opBegin    = "begin"
+	opCommit   = "commit"
+	opRollback = "rollback"
+)
+
+// Metrics is a Collector bundling the metrics of instrumented database
+// connections. Like any Collector, it has to be registered with a registry to
+// expose the metrics.
+type Metrics struct {
+	duration  *prometheus.SummaryVec
+	errors    *prometheus.CounterVec
+	queryName func(string) string
+}
+
+// NewMetrics returns a Metrics based on the provided SummaryOpts. Similar to
+// prometheus.InstrumentHandlerWithOpts, the fields "Name" and "Help" in the
+// SummaryOpts are ignored. If "Subsystem" is empty, it is set to "sql". The
+// created metrics are named "duration_seconds" (a summary) and "errors_total"
+// within the namespace and subsystem. Both are partitioned by the labels
+// "operation" (one of "query", "exec", "prepare", "begin", "commit", and
+// "rollback") and "query".
+//
+// The value of the "query" label is determined by calling queryName with the
+// query text. To keep the number of time series bounded, queryName must map
+// the possible queries to a limited set of names, e.g. by looking up the query
+// in a map of known statements. If queryName is nil, DefaultQueryName is
+// used. The "query" label is empty for transaction operations.
+func NewMetrics(opts prometheus.SummaryOpts, queryName func(string) string) *Metrics {
+	if opts.Subsystem == "" {
+		opts.Subsystem = "sql"
+	}
+	if queryName == nil {
+		queryName = DefaultQueryName
+	}
+	labels := []string{"operation", "query"}
+	errs := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "errors_total",
+			Help:        "Total number of failed database operations.",
+			ConstLabels: opts.ConstLabels,
+		},
+		labels,
+	)
+	opts.Name = "duration_seconds"
+	opts.Help = "Duration of database operations in seconds."
+	return &Metrics{
+		duration:  prometheus.NewSummaryVec(opts, labels),
+		errors:    errs,
+		queryName: queryName,
+	}
+}
+
+// DefaultQueryName returns the lower-cased first word of the query, e.g.
+// "select" or "insert".
+func DefaultQueryName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.duration.Describe(ch)
+	m.errors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.duration.Collect(ch)
+	m.errors.Collect(ch)
+}
+
+// WrapConnector returns a driver.Connector that creates instrumented
+// connections with the provided Connector.
+func (m *Metrics) WrapConnector(c driver.Connector) driver.Connector {
+	return &connector{Connector: c, metrics: m}
+}
+
+// WrapDriver returns a driver.Connector that creates instrumented connections
+// to the provided data source name with the provided Driver. It is meant for
+// drivers that do not provide a driver.Connector themselves.
+func (m *Metrics) WrapDriver(d driver.Driver, dsn string) driver.Connector {
+	return m.WrapConnector(dsnConnector{driver: d, dsn: dsn})
+}
+
+// observe records the outcome of an operation started at begin. Skipped
+// operations (driver.ErrSkip) are not recorded, as database/sql retries them in
+// a different way.
+func (m *Metrics) observe(op, query string, begin time.Time, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+	name := ""
+	if query != "" {
+		name = m.queryName(query)
+	}
+	m.duration.WithLabelValues(op, name).Observe(time.Since(begin).Seconds())
+	if err != nil && err != driver.ErrBadConn {
+		m.errors.WithLabelValues(op, name).Inc()
+	}
+}
+
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type connector struct {
+	driver.Connector
+	metrics *Metrics
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dc, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: dc, metrics: c.metrics}, nil
+}
+
+// conn wraps a driver.Conn. It implements the optional context-aware
+// interfaces and falls back to the legacy methods of the wrapped connection
+// where needed.
+type conn struct {
+	driver.Conn
+	metrics *Metrics
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	begin := time.Now()
+	var (
+		s   driver.Stmt
+		err error
+	)
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = pc.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	c.metrics.observe(opPrepare, query, begin, err)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: s, conn: c.Conn, query: query, metrics: c.metrics}, nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx rejects non-default options if the wrapped connection does not
+// implement driver.ConnBeginTx, as database/sql would do without the wrapper.
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	bt, ok := c.Conn.(driver.ConnBeginTx)
+	if !ok {
+		if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+			return nil, errors.New("promsql: driver does not support non-default isolation level")
+		}
+		if opts.ReadOnly {
+			return nil, errors.New("promsql: driver does not support read-only transactions")
+		}
+	}
+	begin := time.Now()
+	var (
+		t   driver.Tx
+		err error
+	)
+	if ok {
+		t, err = bt.BeginTx(ctx, opts)
+	} else {
+		t, err = c.Conn.Begin()
+	}
+	c.metrics.observe(opBegin, "", begin, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, metrics: c.metrics}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		// database/sql falls back to a prepared statement.
+		return nil, driver.ErrSkip
+	}
+	begin := time.Now()
+	res, err := ec.ExecContext(ctx, query, args)
+	c.metrics.observe(opExec, query, begin, err)
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		// database/sql falls back to a prepared statement.
+		return nil, driver.ErrSkip
+	}
+	begin := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	c.metrics.observe(opQuery, query, begin, err)
+	return rows, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// CheckNamedValue forwards to the wrapped connection if it implements
+// driver.NamedValueChecker. Otherwise, driver.ErrSkip makes database/sql fall
+// back to its default conversion.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	return checkNamedValue(c.Conn, nv)
+}
+
+// stmt wraps a driver.Stmt. Like conn, it forwards the optional interfaces for
+// argument conversion to the wrapped statement (or its connection) so that
+// drivers with custom argument types keep working.
+type stmt struct {
+	driver.Stmt
+	conn    driver.Conn // The wrapped connection that prepared Stmt.
+	query   string
+	metrics *Metrics
+}
+
+// CheckNamedValue implements driver.NamedValueChecker. As database/sql would
+// do, it prefers the checker of the statement over the one of the connection.
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checkNamedValue(s.Stmt, nv)
+	}
+	return checkNamedValue(s.conn, nv)
+}
+
+// ColumnConverter implements driver.ColumnConverter. Without a converter of the
+// wrapped statement, database/sql's default conversion applies.
+func (s *stmt) ColumnConverter(idx int) driver.ValueConverter {
+	if cc, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return cc.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	begin := time.Now()
+	var (
+		res driver.Result
+		err error
+	)
+	if ec, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = ec.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(args); err == nil {
+			res, err = s.Stmt.Exec(values)
+		}
+	}
+	s.metrics.observe(opExec, s.query, begin, err)
+	return res, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	begin := time.Now()
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if qc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+	s.metrics.observe(opQuery, s.query, begin, err)
+	return rows, err
+}
+
+type tx struct {
+	driver.Tx
+	metrics *Metrics
+}
+
+func (t *tx) Commit() error {
+	begin := time.Now()
+	err := t.Tx.Commit()
+	t.metrics.observe(opCommit, "", begin, err)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	begin := time.Now()
+	err := t.Tx.Rollback()
+	t.metrics.observe(opRollback, "", begin, err)
+	return err
+}
+
+// checkNamedValue calls the CheckNamedValue method of v if it implements
+// driver.NamedValueChecker and returns driver.ErrSkip otherwise.
+func checkNamedValue(v interface{}, nv *driver.NamedValue) error {
+	if nvc, ok := v.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValuesToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, nv := range named {
+		if nv.Name != "" {
+			return nil, errors.New("promsql: driver does not support named parameters")
+		}
+		values[i] = nv.Value
+	}
+	return values, nil
+}
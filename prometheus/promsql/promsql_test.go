@@ -0,0 +1,171 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeDriver implements only the legacy (pre-context) driver interfaces.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt(query), nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeStmt string
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if strings.Contains(string(s), "fail") {
+		return nil, errors.New("failed")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) { return fakeRows{}, nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return []string{"x"} }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(prometheus.SummaryOpts{}, nil)
+	db := sql.OpenDB(m.WrapDriver(fakeDriver{}, ""))
+	defer db.Close()
+
+	if _, err := db.Exec("INSERT INTO t VALUES (?)", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE fail"); err == nil {
+		t.Error("expected error")
+	}
+	rows, err := db.Query("SELECT x FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(op, query string) uint64 {
+		out := &dto.Metric{}
+		m.duration.WithLabelValues(op, query).Write(out)
+		return out.GetSummary().GetSampleCount()
+	}
+	for _, s := range []struct {
+		op, query string
+		want      uint64
+	}{
+		{"exec", "insert", 1},
+		{"exec", "update", 1},
+		{"query", "select", 1},
+		{"prepare", "insert", 1},
+		{"begin", "", 1},
+		{"commit", "", 1},
+	} {
+		if got := count(s.op, s.query); got != s.want {
+			t.Errorf("want %d observations for %s/%s, got %d", s.want, s.op, s.query, got)
+		}
+	}
+
+	out := &dto.Metric{}
+	m.errors.WithLabelValues("exec", "update").Write(out)
+	if want, got := 1., out.GetCounter().GetValue(); want != got {
+		t.Errorf("want %f errors, got %f", want, got)
+	}
+}
+
+func TestBeginTxOptions(t *testing.T) {
+	m := NewMetrics(prometheus.SummaryOpts{}, nil)
+	db := sql.OpenDB(m.WrapDriver(fakeDriver{}, ""))
+	defer db.Close()
+
+	for _, opts := range []*sql.TxOptions{
+		{ReadOnly: true},
+		{Isolation: sql.LevelSerializable},
+	} {
+		if _, err := db.BeginTx(context.Background(), opts); err == nil {
+			t.Errorf("expected error for options %+v of a driver without BeginTx", opts)
+		}
+	}
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+}
+
+// point is an argument type only supported by checkingConn.
+type point struct{ x, y int }
+
+// checkingDriver opens connections that convert points to strings.
+type checkingDriver struct{}
+
+func (checkingDriver) Open(string) (driver.Conn, error) { return checkingConn{}, nil }
+
+type checkingConn struct{ fakeConn }
+
+func (checkingConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if p, ok := nv.Value.(point); ok {
+		nv.Value = fmt.Sprintf("(%d,%d)", p.x, p.y)
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func TestNamedValueChecker(t *testing.T) {
+	m := NewMetrics(prometheus.SummaryOpts{}, nil)
+
+	db := sql.OpenDB(m.WrapDriver(checkingDriver{}, ""))
+	defer db.Close()
+	if _, err := db.Exec("INSERT INTO t VALUES (?, ?)", point{1, 2}, 3); err != nil {
+		t.Errorf("custom argument type rejected: %s", err)
+	}
+
+	plain := sql.OpenDB(m.WrapDriver(fakeDriver{}, ""))
+	defer plain.Close()
+	if _, err := plain.Exec("INSERT INTO t VALUES (?)", point{1, 2}); err == nil {
+		t.Error("expected error for unsupported argument type")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"sync"
+)
+
+// FinalPush is a push scheduled to happen once when a job exits. Create
+// instances with Pusher.PushOnExit.
+type FinalPush struct {
+	pusher    *Pusher
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error // Set before done is closed.
+}
+
+// PushOnExit schedules a final push (with the semantics of Push) that is
+// performed once ctx is done or Close is called on the returned FinalPush,
+// whichever happens first. It makes sure that metrics updated right before a
+// batch job exits are not lost. The push itself is not bound to ctx, i.e. it is
+// still performed if ctx has been canceled.
+//
+// Usage example:
+//
+//     final := pusher.PushOnExit(ctx)
+//     defer final.Close()
+func (p *Pusher) PushOnExit(ctx context.Context) *FinalPush {
+	f := &FinalPush{
+		pusher:  p,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(f.done)
+		select {
+		case <-ctx.Done():
+		case <-f.closing:
+		}
+		f.err = p.Push()
+	}()
+	return f
+}
+
+// Close triggers the final push if it has not happened yet, waits for it to
+// complete, and returns its error. It is safe to call Close multiple times.
+func (f *FinalPush) Close() error {
+	f.closeOnce.Do(func() { close(f.closing) })
+	<-f.done
+	return f.err
+}
+
+// Done returns a channel that is closed once the final push has completed.
+func (f *FinalPush) Done() <-chan struct{} {
+	return f.done
+}
@@ -0,0 +1,356 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package push provides a Pusher to push metrics to a Pushgateway. Pushing is
+// meant for short-lived batch jobs that cannot be scraped. A typical use is:
+//
+//     pusher := push.NewPusher(push.PusherOpts{
+//         URL:      "http://pushgateway:9091",
+//         Job:      "db_backup",
+//         Grouping: prometheus.Labels{"db": "customers"},
+//     })
+//     // Do the actual work...
+//     if err := pusher.Push(); err != nil {
+//         log.Println("Could not push to Pushgateway:", err)
+//     }
+//
+// See the documentation of the Pushgateway for the implications of the job
+// name and the grouping labels.
+package push
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/text"
+)
+
+const (
+	contentTypeHeader   = "Content-Type"
+	authorizationHeader = "Authorization"
+)
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// PusherOpts bundles the options for creating a Pusher. It is mandatory to set
+// URL and Job to a non-empty string. All other fields are optional and can
+// safely be left at their zero value.
+type PusherOpts struct {
+	// URL is the URL of the Pushgateway, e.g. "http://pushgateway:9091".
+	// "http://" is prepended if no scheme is given. Any path is kept as a
+	// prefix, which is useful if the Pushgateway runs behind a reverse
+	// proxy. Mandatory!
+	URL string
+
+	// Job is the name of the job the pushed metrics are grouped by.
+	// Mandatory!
+	Job string
+
+	// Grouping contains additional labels to group the pushed metrics by
+	// (together with the job name), e.g. "instance". The label names must
+	// be valid Prometheus label names, and neither the names nor the
+	// values may contain a "/".
+	Grouping prometheus.Labels
+
+	// Gatherer provides the metrics to push. The default value is
+	// prometheus.DefaultGatherer, i.e. all metrics registered with the
+	// default registry are pushed. To push only a certain set of metrics,
+	// register them with a separate prometheus.Registry and use that as
+	// the Gatherer.
+	Gatherer prometheus.Gatherer
+
+	// BasicAuth, if not nil, is used to authenticate with the Pushgateway
+	// (or a proxy in front of it) via HTTP basic authentication. It must
+	// not be set together with BearerToken.
+	BasicAuth *BasicAuth
+
+	// BearerToken, if not empty, is sent in the "Authorization" header of
+	// each request as "Bearer <token>". It must not be set together with
+	// BasicAuth.
+	BearerToken string
+
+	// TLSConfig, if not nil, is used for HTTPS connections to the
+	// Pushgateway, e.g. to trust a private CA (RootCAs) or to present a
+	// client certificate (Certificates).
+	TLSConfig *tls.Config
+
+	// Client is the HTTP client used for all requests to the Pushgateway.
+	// Set it to route pushes through a proxy, to wrap the transport (e.g.
+	// for tracing), or to mock the Pushgateway in tests. If Client is set,
+	// TLSConfig is ignored and has to be configured in the transport of
+	// the provided client instead. The default value is
+	// http.DefaultClient, or a client using TLSConfig if that is set.
+	Client *http.Client
+
+	// MaxRetries is the maximum number of times a request failing with a
+	// transient error (a network error, a 5xx status code, or status code
+	// 429) is retried. Other errors are never retried. The default value
+	// of 0 disables retries.
+	MaxRetries int
+
+	// RetryBackoff is the time to wait before the first retry. The time is
+	// doubled for each subsequent retry. The default value is
+	// DefRetryBackoff.
+	RetryBackoff time.Duration
+}
+
+// DefRetryBackoff is the default value for PusherOpts.RetryBackoff.
+const DefRetryBackoff = 500 * time.Millisecond
+
+// BasicAuth contains the credentials for HTTP basic authentication.
+type BasicAuth struct {
+	Username, Password string
+}
+
+// Pusher pushes the metrics of a Gatherer to a Pushgateway. Create instances
+// with NewPusher. A Pusher is safe to be used concurrently.
+//
+// A Pusher is also a prometheus.Collector that exposes metrics about its own
+// operation: push_attempts_total and push_failures_total (both partitioned by
+// the HTTP method, where each retry counts as a separate attempt) and
+// push_last_success_timestamp_seconds. Register the Pusher to alert on pushes
+// that silently stopped working. As all Pushers share the same metric names,
+// only one Pusher can be registered with the same registry.
+type Pusher struct {
+	url          string // Fully constructed URL including the grouping key.
+	gatherer     prometheus.Gatherer
+	client       *http.Client
+	basicAuth    *BasicAuth
+	bearerToken  string
+	maxRetries   int
+	retryBackoff time.Duration
+	err          error // Error during construction, reported on each push.
+
+	attempts, failures *prometheus.CounterVec
+	lastSuccess        prometheus.Gauge
+}
+
+// NewPusher creates a new Pusher based on the provided PusherOpts. Errors in the
+// options (like an empty Job or invalid grouping labels) are recorded and
+// returned by every call of the Pusher's methods.
+func NewPusher(opts PusherOpts) *Pusher {
+	p := &Pusher{
+		gatherer:     opts.Gatherer,
+		client:       http.DefaultClient,
+		basicAuth:    opts.BasicAuth,
+		bearerToken:  opts.BearerToken,
+		maxRetries:   opts.MaxRetries,
+		retryBackoff: opts.RetryBackoff,
+
+		attempts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "push_attempts_total",
+				Help: "Total number of requests sent to the Pushgateway.",
+			},
+			[]string{"method"},
+		),
+		failures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "push_failures_total",
+				Help: "Total number of failed requests sent to the Pushgateway.",
+			},
+			[]string{"method"},
+		),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "push_last_success_timestamp_seconds",
+			Help: "Unix timestamp of the last successful request sent to the Pushgateway.",
+		}),
+	}
+	if p.gatherer == nil {
+		p.gatherer = prometheus.DefaultGatherer
+	}
+	if p.retryBackoff <= 0 {
+		p.retryBackoff = DefRetryBackoff
+	}
+	switch {
+	case opts.Client != nil:
+		p.client = opts.Client
+	case opts.TLSConfig != nil:
+		p.client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: opts.TLSConfig,
+			},
+		}
+	}
+	if opts.BasicAuth != nil && opts.BearerToken != "" {
+		p.err = errors.New("basic authentication and bearer token must not be set at the same time")
+		return p
+	}
+	p.url, p.err = buildURL(opts)
+	return p
+}
+
+// Push collects all metrics from the Gatherer and pushes them to the
+// Pushgateway, using the HTTP method PUT. All metrics previously pushed with
+// the same job and grouping labels are replaced by the pushed metrics.
+func (p *Pusher) Push() error {
+	return p.push("PUT")
+}
+
+// PushAdd works like Push, but uses the HTTP method POST. Only previously pushed
+// metrics with the same name (and the same job and grouping labels) are
+// replaced.
+func (p *Pusher) PushAdd() error {
+	return p.push("POST")
+}
+
+// Delete deletes all metrics previously pushed with the same job and grouping
+// labels from the Pushgateway. It is meant to be called when a job has
+// completed for good or is being decommissioned, so that its metrics do not
+// linger on the Pushgateway. The Gatherer is not used by Delete.
+func (p *Pusher) Delete() error {
+	if p.err != nil {
+		return p.err
+	}
+	return p.send("DELETE", nil)
+}
+
+func (p *Pusher) push(method string) error {
+	if p.err != nil {
+		return p.err
+	}
+	mfs, err := p.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	for _, mf := range mfs {
+		if _, err := text.WriteProtoDelimited(buf, mf); err != nil {
+			return err
+		}
+	}
+	return p.send(method, buf.Bytes())
+}
+
+// Describe implements prometheus.Collector.
+func (p *Pusher) Describe(ch chan<- *prometheus.Desc) {
+	p.attempts.Describe(ch)
+	p.failures.Describe(ch)
+	p.lastSuccess.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (p *Pusher) Collect(ch chan<- prometheus.Metric) {
+	p.attempts.Collect(ch)
+	p.failures.Collect(ch)
+	p.lastSuccess.Collect(ch)
+}
+
+// send sends a request with the provided method to the URL of the Pusher and
+// retries it with exponential backoff on transient errors as configured. If
+// body is not nil, it is sent as delimited protobuf.
+func (p *Pusher) send(method string, body []byte) error {
+	backoff := p.retryBackoff
+	for retries := 0; ; retries++ {
+		transient, err := p.sendOnce(method, body)
+		if err == nil {
+			p.lastSuccess.Set(float64(time.Now().UnixNano()) / 1e9)
+			return nil
+		}
+		if !transient || retries >= p.maxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// sendOnce sends a single request. It returns whether a returned error is
+// transient, i.e. whether the request should be retried.
+func (p *Pusher) sendOnce(method string, body []byte) (transient bool, err error) {
+	lowerMethod := strings.ToLower(method)
+	p.attempts.WithLabelValues(lowerMethod).Inc()
+	defer func() {
+		if err != nil {
+			p.failures.WithLabelValues(lowerMethod).Inc()
+		}
+	}()
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, p.url, bodyReader)
+	if err != nil {
+		return false, err
+	}
+	if body != nil {
+		req.Header.Set(contentTypeHeader, prometheus.DelimitedTelemetryContentType)
+	}
+	if p.basicAuth != nil {
+		req.SetBasicAuth(p.basicAuth.Username, p.basicAuth.Password)
+	}
+	if p.bearerToken != "" {
+		req.Header.Set(authorizationHeader, "Bearer "+p.bearerToken)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests,
+			fmt.Errorf("unexpected status code %d from %s request to %s", resp.StatusCode, method, p.url)
+	}
+	return false, nil
+}
+
+// buildURL constructs the URL to push to from the Pushgateway URL, the job
+// name, and the grouping labels (in the order of their sorted names).
+func buildURL(opts PusherOpts) (string, error) {
+	if opts.URL == "" {
+		return "", errors.New("empty Pushgateway URL")
+	}
+	if opts.Job == "" {
+		return "", errors.New("empty job name")
+	}
+	if strings.Contains(opts.Job, "/") {
+		return "", fmt.Errorf("job name %q contains '/'", opts.Job)
+	}
+	u := opts.URL
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+	u = strings.TrimSuffix(u, "/") + "/metrics/job/" + url.PathEscape(opts.Job)
+
+	names := make([]string, 0, len(opts.Grouping))
+	for name := range opts.Grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := opts.Grouping[name]
+		if !labelNameRE.MatchString(name) {
+			return "", fmt.Errorf("grouping label name %q is invalid", name)
+		}
+		if name == "job" {
+			return "", errors.New("grouping labels must not contain the label name \"job\"")
+		}
+		if strings.Contains(value, "/") {
+			return "", fmt.Errorf("value of grouping label %q contains '/': %q", name, value)
+		}
+		u += "/" + name + "/" + url.PathEscape(value)
+	}
+	return u, nil
+}
@@ -0,0 +1,343 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matttproud/golang_protobuf_extensions/ext"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPush(t *testing.T) {
+	var (
+		lastMethod string
+		lastPath   string
+		lastBody   []byte
+	)
+	pgw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastMethod = r.Method
+		lastPath = r.URL.EscapedPath()
+		var err error
+		lastBody, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := r.Header.Get("Content-Type"), prometheus.DelimitedTelemetryContentType; r.Method != "DELETE" && got != want {
+			t.Errorf("got content type %q, want %q", got, want)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer pgw.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname1",
+		Help: "docstring1",
+	}))
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "testname2",
+		Help: "docstring2",
+	}))
+
+	pusher := NewPusher(PusherOpts{
+		URL:      pgw.URL,
+		Job:      "testjob",
+		Grouping: prometheus.Labels{"instance": "inst 1", "a": "x"},
+		Gatherer: reg,
+	})
+
+	if err := pusher.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lastMethod, "PUT"; got != want {
+		t.Errorf("got method %q, want %q", got, want)
+	}
+	if got, want := lastPath, "/metrics/job/testjob/a/x/instance/inst%201"; got != want {
+		t.Errorf("got path %q, want %q", got, want)
+	}
+	var names []string
+	for r := bytes.NewReader(lastBody); r.Len() > 0; {
+		mf := &dto.MetricFamily{}
+		if _, err := ext.ReadDelimited(r, mf); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, mf.GetName())
+	}
+	if len(names) != 2 || names[0] != "testname1" || names[1] != "testname2" {
+		t.Errorf("got pushed metric families %v, want [testname1 testname2]", names)
+	}
+
+	if err := pusher.PushAdd(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lastMethod, "POST"; got != want {
+		t.Errorf("got method %q, want %q", got, want)
+	}
+
+	if err := pusher.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lastMethod, "DELETE"; got != want {
+		t.Errorf("got method %q, want %q", got, want)
+	}
+	if got, want := lastPath, "/metrics/job/testjob/a/x/instance/inst%201"; got != want {
+		t.Errorf("got path %q, want %q", got, want)
+	}
+	if len(lastBody) != 0 {
+		t.Errorf("got non-empty body for DELETE: %q", lastBody)
+	}
+}
+
+func TestPushErrors(t *testing.T) {
+	pgw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "fake error", http.StatusInternalServerError)
+	}))
+	defer pgw.Close()
+
+	reg := prometheus.NewRegistry()
+	scenarios := []PusherOpts{
+		{URL: pgw.URL},
+		{Job: "testjob"},
+		{URL: pgw.URL, Job: "test/job"},
+		{URL: pgw.URL, Job: "testjob", Grouping: prometheus.Labels{"in-valid": "x"}},
+		{URL: pgw.URL, Job: "testjob", Grouping: prometheus.Labels{"job": "x"}},
+		{URL: pgw.URL, Job: "testjob", Grouping: prometheus.Labels{"a": "x/y"}},
+		{URL: pgw.URL, Job: "testjob"}, // Server error.
+	}
+	for i, opts := range scenarios {
+		opts.Gatherer = reg
+		pusher := NewPusher(opts)
+		if err := pusher.Push(); err == nil {
+			t.Errorf("%d. expected error from Push, got none", i)
+		}
+		if err := pusher.Delete(); err == nil {
+			t.Errorf("%d. expected error from Delete, got none", i)
+		}
+	}
+}
+
+func TestPushAuthAndTLS(t *testing.T) {
+	var lastAuth string
+	pgw := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer pgw.Close()
+
+	cert, err := x509.ParseCertificate(pgw.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPool := x509.NewCertPool()
+	certPool.AddCert(cert)
+	tlsConfig := &tls.Config{RootCAs: certPool}
+	reg := prometheus.NewRegistry()
+
+	scenarios := []struct {
+		opts PusherOpts
+		auth string
+	}{
+		{
+			opts: PusherOpts{BasicAuth: &BasicAuth{Username: "user", Password: "secret"}},
+			auth: "Basic dXNlcjpzZWNyZXQ=",
+		},
+		{
+			opts: PusherOpts{BearerToken: "token"},
+			auth: "Bearer token",
+		},
+		{
+			opts: PusherOpts{},
+			auth: "",
+		},
+	}
+	for i, s := range scenarios {
+		s.opts.URL = pgw.URL
+		s.opts.Job = "testjob"
+		s.opts.Gatherer = reg
+		s.opts.TLSConfig = tlsConfig
+		if err := NewPusher(s.opts).Push(); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if lastAuth != s.auth {
+			t.Errorf("%d. got authorization %q, want %q", i, lastAuth, s.auth)
+		}
+	}
+
+	// Without the TLS config, the certificate of the test server is not
+	// trusted.
+	if err := NewPusher(PusherOpts{URL: pgw.URL, Job: "testjob", Gatherer: reg}).Push(); err == nil {
+		t.Error("expected error without TLS config, got none")
+	}
+	// Basic auth and bearer token are mutually exclusive.
+	if err := NewPusher(PusherOpts{
+		URL:         pgw.URL,
+		Job:         "testjob",
+		Gatherer:    reg,
+		TLSConfig:   tlsConfig,
+		BasicAuth:   &BasicAuth{Username: "user"},
+		BearerToken: "token",
+	}).Push(); err == nil {
+		t.Error("expected error with basic auth and bearer token, got none")
+	}
+}
+
+func TestPushOnExit(t *testing.T) {
+	pushes := make(chan string, 10)
+	pgw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes <- r.Method
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer pgw.Close()
+
+	pusher := NewPusher(PusherOpts{URL: pgw.URL, Job: "testjob", Gatherer: prometheus.NewRegistry()})
+
+	// Triggered by Close.
+	final := pusher.PushOnExit(context.Background())
+	if len(pushes) != 0 {
+		t.Fatal("pushed before Close")
+	}
+	if err := final.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := final.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(pushes); got != 1 {
+		t.Fatalf("got %d pushes, want 1", got)
+	}
+	if got, want := <-pushes, "PUT"; got != want {
+		t.Errorf("got method %q, want %q", got, want)
+	}
+
+	// Triggered by the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	final = pusher.PushOnExit(ctx)
+	cancel()
+	<-final.Done()
+	if got := len(pushes); got != 1 {
+		t.Fatalf("got %d pushes, want 1", got)
+	}
+	if err := final.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(pushes); got != 1 {
+		t.Fatalf("got %d pushes after Close, want 1", got)
+	}
+}
+
+func TestPushRetries(t *testing.T) {
+	var requests int
+	codes := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusAccepted, http.StatusBadRequest}
+	pgw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(codes[requests])
+		requests++
+	}))
+	defer pgw.Close()
+
+	pusher := NewPusher(PusherOpts{
+		URL:          pgw.URL,
+		Job:          "testjob",
+		Gatherer:     prometheus.NewRegistry(),
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(pusher)
+
+	// Succeeds with the 2nd retry.
+	if err := pusher.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3", requests)
+	}
+	// 400 is not retried.
+	if err := pusher.Push(); err == nil {
+		t.Error("expected error, got none")
+	}
+	if requests != 4 {
+		t.Errorf("got %d requests, want 4", requests)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			switch mf.GetName() {
+			case "push_attempts_total", "push_failures_total":
+				values[mf.GetName()] += m.GetCounter().GetValue()
+			case "push_last_success_timestamp_seconds":
+				values[mf.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	if got, want := values["push_attempts_total"], 4.; got != want {
+		t.Errorf("got %v attempts, want %v", got, want)
+	}
+	if got, want := values["push_failures_total"], 3.; got != want {
+		t.Errorf("got %v failures, want %v", got, want)
+	}
+	if values["push_last_success_timestamp_seconds"] <= 0 {
+		t.Error("last success timestamp not set")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestPushCustomClient(t *testing.T) {
+	var lastURL string
+	client := &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			lastURL = req.URL.String()
+			return &http.Response{
+				StatusCode: http.StatusAccepted,
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+				Request:    req,
+			}, nil
+		}),
+	}
+	pusher := NewPusher(PusherOpts{
+		URL:       "pushgateway.invalid:9091",
+		Job:       "testjob",
+		Gatherer:  prometheus.NewRegistry(),
+		Client:    client,
+		TLSConfig: &tls.Config{}, // Ignored.
+	})
+	if err := pusher.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://pushgateway.invalid:9091/metrics/job/testjob"; lastURL != want {
+		t.Errorf("got URL %q, want %q", lastURL, want)
+	}
+}
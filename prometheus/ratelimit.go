@@ -0,0 +1,105 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// scrapeLimiter is a token bucket per client address.
+type scrapeLimiter struct {
+	rate  float64
+	burst float64
+	clock Clock
+
+	mtx       sync.Mutex // Protects the fields below.
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limitScrapeRate returns an http.Handler that passes requests on to h only
+// if their client has not exceeded the scrape rate configured in opts.
+func limitScrapeRate(h http.Handler, opts HandlerOpts) http.Handler {
+	if opts.ScrapeRate <= 0 {
+		return h
+	}
+	if opts.ScrapeBurst <= 0 {
+		opts.ScrapeBurst = 1
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	l := &scrapeLimiter{
+		rate:    opts.ScrapeRate,
+		burst:   float64(opts.ScrapeBurst),
+		clock:   opts.Clock,
+		buckets: map[string]*tokenBucket{},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var client string
+		if ip := clientIP(req, opts.TrustedProxyHeader); ip != nil {
+			client = ip.String()
+		}
+		if wait := l.take(client); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// take takes a token from the bucket of the provided client. If the bucket is
+// empty, it returns how long the client has to wait for the next token.
+func (l *scrapeLimiter) take(client string) time.Duration {
+	now := l.clock.Now()
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	// Buckets that have filled up again are indistinguishable from new
+	// ones and can be dropped, so that clients from ever changing
+	// addresses do not pile up.
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) > refill {
+		for c, b := range l.buckets {
+			if now.Sub(b.last) > refill {
+				delete(l.buckets, c)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"regexp"
+
+	"code.google.com/p/goprotobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// RedactedValue replaces redacted label values, see Redact.
+const RedactedValue = "[redacted]"
+
+// Redact masks label values in everything served via HTTP, pushed, or written
+// with WriteNegotiated from now on, e.g. e-mail addresses or tokens that ended
+// up in label values by accident. The metrics themselves keep the original
+// values, and Gather returns them unchanged, so that the exposition can be
+// shared safely without losing fidelity internally.
+//
+// If labelName is not empty, only the values of labels with that name are
+// redacted, otherwise the values of all labels. If pattern is nil, the whole
+// values are replaced by RedactedValue, otherwise only the parts matching
+// pattern. Redact can be called multiple times, the redactions are applied in
+// order.
+//
+// Usage example:
+//
+//     prometheus.Redact("user", nil)
+//     prometheus.Redact("", regexp.MustCompile(`[^@\s]+@[^@\s]+`))
+func Redact(labelName string, pattern *regexp.Regexp) {
+	defRegistry.Redact(labelName, pattern)
+}
+
+// redactor is a redaction configured with Redact.
+type redactor struct {
+	labelName string
+	pattern   *regexp.Regexp
+}
+
+// apply returns the redacted value of the label with the provided name and
+// value.
+func (rd redactor) apply(name, value string) string {
+	if rd.labelName != "" && rd.labelName != name {
+		return value
+	}
+	if rd.pattern == nil {
+		return RedactedValue
+	}
+	return rd.pattern.ReplaceAllLiteralString(value, RedactedValue)
+}
+
+// Redact works like the package-level function of the same name, but for this
+// Registry.
+func (r *Registry) Redact(labelName string, pattern *regexp.Regexp) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.redactors = append(r.redactors, redactor{labelName: labelName, pattern: pattern})
+}
+
+// redact returns mf with all redactions applied. As the label pairs and
+// metrics of mf might be shared with the collected metrics or with the
+// metric family injection hook, mf is left untouched and a copy is returned if
+// any label value has to be changed. The caller must hold a read lock of r.
+func (r *Registry) redact(mf *dto.MetricFamily) *dto.MetricFamily {
+	if len(r.redactors) == 0 {
+		return mf
+	}
+	var redacted *dto.MetricFamily
+	for i, m := range mf.Metric {
+		var labels []*dto.LabelPair
+		for j, lp := range m.Label {
+			value := lp.GetValue()
+			for _, rd := range r.redactors {
+				value = rd.apply(lp.GetName(), value)
+			}
+			if value == lp.GetValue() {
+				continue
+			}
+			if labels == nil {
+				labels = append([]*dto.LabelPair(nil), m.Label...)
+			}
+			labels[j] = &dto.LabelPair{Name: lp.Name, Value: proto.String(value)}
+		}
+		if labels == nil {
+			continue
+		}
+		if redacted == nil {
+			redacted = &dto.MetricFamily{
+				Name:   mf.Name,
+				Help:   mf.Help,
+				Type:   mf.Type,
+				Metric: append([]*dto.Metric(nil), mf.Metric...),
+			}
+		}
+		rm := *m
+		rm.Label = labels
+		redacted.Metric[i] = &rm
+	}
+	if redacted == nil {
+		return mf
+	}
+	return redacted
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r := newRegistry()
+	logins := NewCounterVec(CounterOpts{
+		Name:        "logins_total",
+		Help:        "Logins.",
+		ConstLabels: Labels{"realm": "ops@example.org"},
+	}, []string{"user", "client"})
+	r.MustRegister(logins)
+	logins.WithLabelValues("alice", "mail from bob@example.org").Inc()
+
+	r.Redact("user", nil)
+	r.Redact("", regexp.MustCompile(`[^@\s]+@[^@\s]+`))
+
+	var buf bytes.Buffer
+	if _, _, err := r.writeNegotiated(context.Background(), &buf, "", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `logins_total{client="mail from [redacted]",realm="[redacted]",user="[redacted]"} 1`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("output does not contain %q:\n%s", want, buf.String())
+	}
+
+	// Gathering returns the original values, also after serializing.
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, lp := range mfs[0].Metric[0].Label {
+		got[lp.GetName()] = lp.GetValue()
+	}
+	if got["user"] != "alice" || got["client"] != "mail from bob@example.org" || got["realm"] != "ops@example.org" {
+		t.Errorf("gathered labels modified: %v", got)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+// The following functions create a metric or metric vector and register it
+// with the default registry in one go, e.g.:
+//
+//     var requests = prometheus.NewRegisteredCounterVec(prometheus.CounterOpts{
+//         Name: "http_requests_total",
+//         Help: "HTTP requests processed.",
+//     }, "code", "method")
+//
+// They use MustRegisterOrGet, i.e. they panic if registration fails, and if an
+// equal metric has been registered before, that one is returned. The latter
+// allows libraries to create their metrics lazily without coordinating
+// registration. Use the regular constructors and a Registry to register
+// elsewhere.
+
+// NewRegisteredCounter creates a Counter with NewCounter and registers it with
+// the default registry.
+func NewRegisteredCounter(opts CounterOpts) Counter {
+	return MustRegisterOrGet(NewCounter(opts)).(Counter)
+}
+
+// NewRegisteredCounterVec creates a CounterVec with NewCounterVec and registers
+// it with the default registry.
+func NewRegisteredCounterVec(opts CounterOpts, labelNames ...string) *CounterVec {
+	return MustRegisterOrGet(NewCounterVec(opts, labelNames)).(*CounterVec)
+}
+
+// NewRegisteredGauge creates a Gauge with NewGauge and registers it with the
+// default registry.
+func NewRegisteredGauge(opts GaugeOpts) Gauge {
+	return MustRegisterOrGet(NewGauge(opts)).(Gauge)
+}
+
+// NewRegisteredGaugeVec creates a GaugeVec with NewGaugeVec and registers it
+// with the default registry.
+func NewRegisteredGaugeVec(opts GaugeOpts, labelNames ...string) *GaugeVec {
+	return MustRegisterOrGet(NewGaugeVec(opts, labelNames)).(*GaugeVec)
+}
+
+// NewRegisteredSummary creates a Summary with NewSummary and registers it with
+// the default registry.
+func NewRegisteredSummary(opts SummaryOpts) Summary {
+	return MustRegisterOrGet(NewSummary(opts)).(Summary)
+}
+
+// NewRegisteredSummaryVec creates a SummaryVec with NewSummaryVec and registers
+// it with the default registry.
+func NewRegisteredSummaryVec(opts SummaryOpts, labelNames ...string) *SummaryVec {
+	return MustRegisterOrGet(NewSummaryVec(opts, labelNames)).(*SummaryVec)
+}
@@ -0,0 +1,39 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "testing"
+
+func TestNewRegisteredCounterVec(t *testing.T) {
+	opts := CounterOpts{
+		Name: "test_registered_total",
+		Help: "Registered in one go.",
+	}
+	vec := NewRegisteredCounterVec(opts, "code")
+	defer Unregister(vec)
+	vec.WithLabelValues("200").Inc()
+
+	// Creating the same vector again returns the registered one.
+	if again := NewRegisteredCounterVec(opts, "code"); again != vec {
+		t.Error("got a different vector for equal options")
+	}
+
+	// A conflicting registration panics.
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for conflicting label names")
+		}
+	}()
+	NewRegisteredCounterVec(opts, "method")
+}
@@ -22,6 +22,7 @@ package prometheus
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"hash/fnv"
@@ -32,6 +33,8 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 
@@ -67,9 +70,14 @@ const (
 	// telemetry data responses in protobuf compact text format.  (Only used
 	// for debugging.)
 	ProtoCompactTextTelemetryContentType = `application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=compact-text`
+	// JSONTelemetryContentType is the content type set on telemetry data
+	// responses in the legacy JSON format (version 0.0.2), which is only
+	// served to scrapers asking for it explicitly.
+	JSONTelemetryContentType = `application/json; schema="prometheus/telemetry"; version=0.0.2`
 
 	// Constants for object pools.
 	numBufs           = 4
+	numGzipWriters    = 4
 	numMetricFamilies = 1000
 	numMetrics        = 10000
 
@@ -111,8 +119,7 @@ func UninstrumentedHandler() http.Handler {
 // the same Collector twice would result in an error anyway, but on top of that,
 // it is not safe to do so concurrently.)
 func Register(m Collector) error {
-	_, err := defRegistry.Register(m)
-	return err
+	return defRegistry.Register(m)
 }
 
 // MustRegister works like Register but panics where Register would have
@@ -167,14 +174,14 @@ func Unregister(c Collector) bool {
 // performed on the returned protobufs (besides the name checks described
 // above). The function must be callable at any time and concurrently.
 func SetMetricFamilyInjectionHook(hook func() []*dto.MetricFamily) {
-	defRegistry.metricFamilyInjectionHook = hook
+	defRegistry.SetMetricFamilyInjectionHook(hook)
 }
 
 // PanicOnCollectError sets the behavior whether a panic is caused upon an error
 // while metrics are collected and served to the http endpoint. By default, an
 // internal server error (status code 500) is served with an error message.
 func PanicOnCollectError(b bool) {
-	defRegistry.panicOnCollectError = b
+	defRegistry.PanicOnCollectError(b)
 }
 
 // EnableCollectChecks enables (or disables) additional consistency checks
@@ -184,7 +191,120 @@ func PanicOnCollectError(b bool) {
 // errors. It can be helpful to enable these checks while working with custom
 // Collectors or Metrics whose correctness is not well established yet.
 func EnableCollectChecks(b bool) {
-	defRegistry.collectChecksEnabled = b
+	defRegistry.EnableCollectChecks(b)
+}
+
+// SetFormatPreference sets the exposition formats served via HTTP, identified
+// by their content types (like TextTelemetryContentType), in order of
+// preference. Of the formats a scraper accepts with the highest quality, the
+// most preferred one is served. If a scraper accepts none of the formats, the
+// first one is served. Formats not in the list are never served. By default,
+// all formats are served, preferring TextTelemetryContentType, then
+// DelimitedTelemetryContentType, ProtoTextTelemetryContentType,
+// ProtoCompactTextTelemetryContentType, and JSONTelemetryContentType.
+//
+// Independent of the preference, scrapers are served the best format they can
+// parse: Old scrapers asking for the protobuf format without the encoding
+// parameter are served the delimited protobuf format, and scrapers asking for
+// JSON with the schema "prometheus/telemetry" are served the legacy JSON
+// format. SetFormatPreference returns an error for unknown content types.
+func SetFormatPreference(contentTypes ...string) error {
+	return defRegistry.SetFormatPreference(contentTypes...)
+}
+
+// SetSerializationWorkers sets the number of goroutines that encode metric
+// families concurrently for a scrape or push. The encoded metric families are
+// still written in sorted order. Concurrent encoding bounds the scrape latency
+// on multi-core hosts exposing thousands of metric families, but it costs a
+// buffer per metric family. With n < 2 (the default), metric families are
+// encoded one after the other.
+func SetSerializationWorkers(n int) {
+	defRegistry.SetSerializationWorkers(n)
+}
+
+// CacheEncoding marks the metric families with the provided names as mostly
+// static. Their encoded form is kept between scrapes and only created anew once
+// anything in the family has changed, which saves the encoding work for
+// info-style metrics, constant metrics, and rarely changing gauges. Do not use
+// it for families that change with nearly every scrape, as checking for
+// changes is not free.
+func CacheEncoding(familyNames ...string) {
+	defRegistry.CacheEncoding(familyNames...)
+}
+
+// UncacheEncoding reverts CacheEncoding for the metric families with the
+// provided names and drops their cached encodings.
+func UncacheEncoding(familyNames ...string) {
+	defRegistry.UncacheEncoding(familyNames...)
+}
+
+// OmitHelp sets whether the help strings of metric families are left out when
+// serving metrics via HTTP, pushing them, or writing them with WriteNegotiated,
+// which reduces the size of the exposition considerably for metric families
+// with many metrics. By default, help strings are included. Metric families
+// can override the setting, see Opts.HelpExposure.
+func OmitHelp(b bool) {
+	defRegistry.OmitHelp(b)
+}
+
+// SetHelp replaces the help string of the metric family with the provided name
+// in everything gathered and served from now on. Exporters can use it to
+// provide better descriptions learned at runtime, e.g. from the
+// self-description of a device. The help string the metrics were registered
+// with is still used to check the consistency of registrations. An empty help
+// string reverts to the registered one.
+func SetHelp(familyName, help string) {
+	defRegistry.SetHelp(familyName, help)
+}
+
+// OnBeforeGather registers a function that is called at the start of every
+// collection, i.e. whenever metrics are served via HTTP, pushed, written with
+// WriteNegotiated, or gathered with Gather, before any Collector is called.
+// Applications can use it to refresh cached values right before they are
+// exposed, e.g. to flush asynchronous aggregations into gauges. The provided
+// context is the one of the collection, e.g. of the HTTP request. Hooks are
+// called in the order of their registration and must be callable
+// concurrently. A slow hook delays the collection.
+func OnBeforeGather(hook func(ctx context.Context)) {
+	defRegistry.OnBeforeGather(hook)
+}
+
+// OnAfterGather registers a function that is called at the end of every
+// collection (see OnBeforeGather), after the metrics have been written or, for
+// Gather, returned. err is the error the collection failed with, or nil.
+// Applications can use it to record the completion of scrapes without wrapping
+// the HTTP handler. Hooks are called in the order of their registration and
+// must be callable concurrently.
+func OnAfterGather(hook func(ctx context.Context, err error)) {
+	defRegistry.OnAfterGather(hook)
+}
+
+// Pause excludes the metric family with the provided name from everything
+// gathered and served from now on until Resume is called with the same name.
+// The metrics stay registered and keep their state. Collectors all of whose
+// metrics are paused are not called at all, so Pause can be used to
+// temporarily switch off expensive collections, e.g. of a GaugeFunc, during an
+// incident. Pausing a name that is not registered has no effect apart from
+// pausing metrics registered with that name later.
+func Pause(familyName string) {
+	defRegistry.Pause(familyName)
+}
+
+// Resume includes the metric family paused with Pause again.
+func Resume(familyName string) {
+	defRegistry.Resume(familyName)
+}
+
+// Replace replaces the registered Collector old by the Collector new in the
+// default registry, e.g. a metric vector by one with other label names after a
+// reload of the configuration. Every collection sees either the old or the new
+// Collector, so the metrics are never missing, and no restart is needed.
+// Metric names only used by old may change their label names, help string,
+// and metadata from Opts, unlike after Unregister. If old is not registered or
+// new cannot be registered, an error is returned and old stays registered.
+// The state of old is not carried over.
+func Replace(old, new Collector) error {
+	return defRegistry.Replace(old, new)
 }
 
 // Push triggers a metric collection and pushes all collected metrics to the
@@ -196,58 +316,207 @@ func EnableCollectChecks(b bool) {
 // Note that all previously pushed metrics with the same job and instance will
 // be replaced with the metrics pushed by this call. (It uses HTTP method 'PUT'
 // to push to the Pushgateway.)
+//
+// The Pusher in the push package offers more flexibility, e.g. arbitrary
+// grouping labels and pushing of any Gatherer.
 func Push(job, instance, addr string) error {
-	return defRegistry.Push(job, instance, addr, "PUT")
+	return defRegistry.Push(job, instance, addr)
 }
 
 // PushAdd works like Push, but only previously pushed metrics with the same
 // name (and the same job and instance) will be replaced. (It uses HTTP method
 // 'POST' to push to the Pushgateway.)
 func PushAdd(job, instance, addr string) error {
-	return defRegistry.Push(job, instance, addr, "POST")
+	return defRegistry.PushAdd(job, instance, addr)
+}
+
+// WriteNegotiated collects all metrics registered with the default registry and
+// writes them to w. The exposition format and compression are negotiated in the
+// same way as by Handler, based on the provided values of the HTTP headers
+// "Accept" and "Accept-Encoding" (either of which may be empty). The returned
+// contentType and encoding are meant to be set as "Content-Type" and
+// "Content-Encoding" header of the response, where an empty encoding means that
+// no compression has been applied.
+//
+// WriteNegotiated is a building block for serving metrics with HTTP server
+// implementations other than net/http. If an error is returned, w may have
+// received partial output. An error causes a panic instead if
+// PanicOnCollectError has been set to true.
+func WriteNegotiated(w io.Writer, accept, acceptEncoding string) (contentType, encoding string, err error) {
+	return defRegistry.writeNegotiated(context.Background(), w, accept, acceptEncoding, nil, false)
 }
 
+// WriteNegotiatedContext works like WriteNegotiated, but aborts collection and
+// serialization once ctx is done, e.g. because the client has disconnected. In
+// that case, the error of ctx is returned (without causing a panic).
+func WriteNegotiatedContext(ctx context.Context, w io.Writer, accept, acceptEncoding string) (contentType, encoding string, err error) {
+	return defRegistry.writeNegotiated(ctx, w, accept, acceptEncoding, nil, false)
+}
+
+// Gatherer is the interface for anything that can collect metrics and return
+// them as MetricFamily protobufs. A Registry is a Gatherer. Gatherers are used
+// to pass sets of metrics to consumers other than the HTTP handler, e.g. to the
+// Pusher in the push package.
+type Gatherer interface {
+	// Gather collects metrics and returns them as MetricFamilies sorted by
+	// name. The returned protobufs are owned by the caller. If an error is
+	// returned, the returned MetricFamilies should be ignored.
+	Gather() ([]*dto.MetricFamily, error)
+}
+
+// DefaultGatherer is the Gatherer of the default registry, i.e. the registry
+// used by the package-level functions like Register and Handler.
+var DefaultGatherer Gatherer = defRegistry
+
 // encoder is a function that writes a dto.MetricFamily to an io.Writer in a
 // certain encoding. It returns the number of bytes written and any error
 // encountered.  Note that ext.WriteDelimited and text.MetricFamilyToText are
 // encoders.
 type encoder func(io.Writer, *dto.MetricFamily) (int, error)
 
-type registry struct {
+// Registry registers Collectors, collects their metrics, and exposes them via
+// HTTP. Most users will only ever need the default registry, which is used by
+// the package-level functions like Register and Handler. Additional registries
+// are useful to expose different sets of metrics on different endpoints (see
+// MultiHandler) or to push a certain set of metrics to a Pushgateway.
+//
+// Create instances with NewRegistry. A Registry is an http.Handler serving its
+// metrics (uninstrumented, similar to UninstrumentedHandler).
+type Registry struct {
+	// collectorPanics is accessed atomically and must therefore stay
+	// 64-bit aligned as the first field.
+	collectorPanics uint64
+
 	mtx                       sync.RWMutex
 	collectorsByID            map[uint64]Collector // ID is a hash of the descIDs.
 	descIDs                   map[uint64]struct{}
 	dimHashesByName           map[string]uint64
+	metaByName                map[string]familyMeta
+	descsByName               map[string]int // Number of registered descs per name.
 	bufPool                   chan *bytes.Buffer
+	gzipPool                  chan *gzip.Writer
 	metricFamilyPool          chan *dto.MetricFamily
 	metricPool                chan *dto.Metric
 	metricFamilyInjectionHook func() []*dto.MetricFamily
+	encodingCache             encodingCache
+	helpByName                map[string]string // Set by SetHelp.
+	counterDeltas             counterDeltas
+	deprecatedWrites          deprecatedWrites
+	redactors                 []redactor      // Set by Redact.
+	derived                   []derivedFamily // Set by Derive.
+	beforeGatherHooks         []func(context.Context)
+	afterGatherHooks          []func(context.Context, error)
+	scrapeHooks               []func(ScrapeInfo)
+
+	panicOnCollectError, collectChecksEnabled, omitHelp bool
+	serializationWorkers                                int
+	formatPreference                                    []string // Set by SetFormatPreference.
+
+	// resetMtx serializes collections once a metric with
+	// Opts.ResetOnScrape has been registered, see hasResetOnScrape.
+	resetMtx      sync.Mutex
+	resetOnScrape bool
+
+	// pausedNames is set by Pause and copied on write. namesByCollectorID
+	// holds the metric names of each registered collector.
+	pausedNames        map[string]struct{}
+	namesByCollectorID map[uint64][]string
+
+	// closed is set by Close, which calls closeHooks.
+	closed     bool
+	closeHooks []func(context.Context) error
+
+	// Self-instrumentation of the serialization, reported by a
+	// ClientCollector.
+	serializeDuration, serializeSize Summary
+}
+
+// Register works like the package-level function of the same name, but for
+// this Registry.
+func (r *Registry) Register(c Collector) error {
+	_, err := r.register(c)
+	return err
+}
+
+// MustRegister works like Register but panics where Register would have
+// returned an error.
+func (r *Registry) MustRegister(c Collector) {
+	if err := r.Register(c); err != nil {
+		panic(err)
+	}
+}
+
+func (r *Registry) register(c Collector) (Collector, error) {
+	r.mtx.RLock()
+	closed := r.closed
+	r.mtx.RUnlock()
+	if closed {
+		return nil, ErrRegistryClosed
+	}
+	descs := describe(c)
 
-	panicOnCollectError, collectChecksEnabled bool
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	// The registry might have been closed while c was describing itself.
+	if r.closed {
+		return nil, ErrRegistryClosed
+	}
+	return r.registerLocked(c, descs)
 }
 
-func (r *registry) Register(c Collector) (Collector, error) {
+// describe returns the descriptors the provided Collector describes itself
+// with.
+func describe(c Collector) []*Desc {
 	descChan := make(chan *Desc, capDescChan)
 	go func() {
 		c.Describe(descChan)
 		close(descChan)
 	}()
+	var descs []*Desc
+	for desc := range descChan {
+		descs = append(descs, desc)
+	}
+	return descs
+}
 
+// collectorID returns the ID of a collector with the provided descriptors,
+// which is just a sum of the IDs of the distinct descriptors, and the set of
+// the latter.
+func collectorID(descs []*Desc) (uint64, map[uint64]struct{}) {
+	var id uint64
+	descIDs := map[uint64]struct{}{}
+	for _, desc := range descs {
+		if _, exists := descIDs[desc.id]; !exists {
+			id += desc.id
+			descIDs[desc.id] = struct{}{}
+		}
+	}
+	return id, descIDs
+}
+
+// registerLocked registers c with the provided descriptors. The caller must
+// hold the write lock of r.
+func (r *Registry) registerLocked(c Collector, descs []*Desc) (Collector, error) {
 	newDescIDs := map[uint64]struct{}{}
 	newDimHashesByName := map[string]uint64{}
+	newMetaByName := map[string]familyMeta{}
+	newDescsByName := map[string]int{}
 	var collectorID uint64 // Just a sum of all desc IDs.
 	var duplicateDescErr error
 
-	r.mtx.Lock()
-	defer r.mtx.Unlock()
 	// Coduct various tests...
-	for desc := range descChan {
+	for _, desc := range descs {
 
 		// Is the descriptor valid at all?
 		if desc.err != nil {
 			return c, fmt.Errorf("descriptor %s is invalid: %s", desc, desc.err)
 		}
 
+		// Is the name taken by a derived metric family?
+		if r.isDerived(desc.fqName) {
+			return nil, fmt.Errorf("descriptor %s has the same fully-qualified name as a derived metric family", desc)
+		}
+
 		// Is the descID unique?
 		// (In other words: Is the fqName + constLabel combination unique?)
 		if _, exists := r.descIDs[desc.id]; exists {
@@ -259,6 +528,7 @@ func (r *registry) Register(c Collector) (Collector, error) {
 		if _, exists := newDescIDs[desc.id]; !exists {
 			newDescIDs[desc.id] = struct{}{}
 			collectorID += desc.id
+			newDescsByName[desc.fqName]++
 		}
 
 		// Are all the label names and the help string consistent with
@@ -278,6 +548,17 @@ func (r *registry) Register(c Collector) (Collector, error) {
 				newDimHashesByName[desc.fqName] = desc.dimHash
 			}
 		}
+
+		// Do all descriptors of the same name agree on the metadata
+		// from Opts?
+		meta, exists := r.metaByName[desc.fqName]
+		if !exists {
+			meta, exists = newMetaByName[desc.fqName]
+		}
+		if exists && meta != desc.meta {
+			return nil, fmt.Errorf("descriptors with the same fully-qualified name as %s have different metadata (e.g. debug flag, stability, or deprecation)", desc)
+		}
+		newMetaByName[desc.fqName] = desc.meta
 	}
 	// Did anything happen at all?
 	if len(newDescIDs) == 0 {
@@ -300,60 +581,301 @@ func (r *registry) Register(c Collector) (Collector, error) {
 	for name, dimHash := range newDimHashesByName {
 		r.dimHashesByName[name] = dimHash
 	}
+	for name, meta := range newMetaByName {
+		r.metaByName[name] = meta
+		if meta.resetOnScrape {
+			r.resetOnScrape = true
+		}
+	}
+	names := make([]string, 0, len(newDescsByName))
+	for name, n := range newDescsByName {
+		r.descsByName[name] += n
+		names = append(names, name)
+	}
+	r.namesByCollectorID[collectorID] = names
 	return c, nil
 }
 
-func (r *registry) RegisterOrGet(m Collector) (Collector, error) {
-	existing, err := r.Register(m)
+// RegisterOrGet works like the package-level function of the same name, but for
+// this Registry.
+func (r *Registry) RegisterOrGet(m Collector) (Collector, error) {
+	existing, err := r.register(m)
 	if err != nil && err != errAlreadyReg {
 		return nil, err
 	}
 	return existing, nil
 }
 
-func (r *registry) Unregister(c Collector) bool {
-	descChan := make(chan *Desc, capDescChan)
-	go func() {
-		c.Describe(descChan)
-		close(descChan)
-	}()
+// MustRegisterOrGet works like RegisterOrGet but panics where RegisterOrGet
+// would have returned an error.
+func (r *Registry) MustRegisterOrGet(m Collector) Collector {
+	existing, err := r.RegisterOrGet(m)
+	if err != nil {
+		panic(err)
+	}
+	return existing
+}
 
-	descIDs := map[uint64]struct{}{}
-	var collectorID uint64 // Just a sum of the desc IDs.
-	for desc := range descChan {
-		if _, exists := descIDs[desc.id]; !exists {
-			collectorID += desc.id
-			descIDs[desc.id] = struct{}{}
+// Unregister works like the package-level function of the same name, but for
+// this Registry.
+func (r *Registry) Unregister(c Collector) bool {
+	descs := describe(c)
+	id, _ := collectorID(descs)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, exists := r.collectorsByID[id]; !exists {
+		return false
+	}
+	// dimHashesByName and metaByName are left untouched as those must
+	// be consistent throughout the lifetime of a program.
+	r.unregisterLocked(id, descs)
+	return true
+}
+
+// unregisterLocked removes the registered collector with the provided ID and
+// descriptors. It returns the names of the descriptors not used by any other
+// registered collector anymore. The caller must hold the write lock of r.
+func (r *Registry) unregisterLocked(id uint64, descs []*Desc) []string {
+	delete(r.collectorsByID, id)
+	delete(r.namesByCollectorID, id)
+	var unused []string
+	_, descIDs := collectorID(descs)
+	for _, desc := range descs {
+		if _, ok := descIDs[desc.id]; !ok {
+			continue // Duplicate within the collector.
+		}
+		delete(descIDs, desc.id)
+		delete(r.descIDs, desc.id)
+		if r.descsByName[desc.fqName]--; r.descsByName[desc.fqName] <= 0 {
+			delete(r.descsByName, desc.fqName)
+			unused = append(unused, desc.fqName)
 		}
 	}
+	return unused
+}
 
-	r.mtx.RLock()
-	if _, exists := r.collectorsByID[collectorID]; !exists {
-		r.mtx.RUnlock()
-		return false
+// Replace works like the package-level function of the same name, but for
+// this Registry.
+func (r *Registry) Replace(old, new Collector) error {
+	oldDescs, newDescs := describe(old), describe(new)
+	oldID, _ := collectorID(oldDescs)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.closed {
+		return ErrRegistryClosed
 	}
-	r.mtx.RUnlock()
+	if _, exists := r.collectorsByID[oldID]; !exists {
+		return errors.New("collector to replace is not registered")
+	}
+	// Names only used by the old collector may change their label names,
+	// help string, and metadata.
+	unused := r.unregisterLocked(oldID, oldDescs)
+	releasedDimHashes := make(map[string]uint64, len(unused))
+	releasedMeta := make(map[string]familyMeta, len(unused))
+	for _, name := range unused {
+		releasedDimHashes[name] = r.dimHashesByName[name]
+		releasedMeta[name] = r.metaByName[name]
+		delete(r.dimHashesByName, name)
+		delete(r.metaByName, name)
+	}
+	if _, err := r.registerLocked(new, newDescs); err != nil {
+		if err == errAlreadyReg {
+			err = errors.New("replacing collector is registered already")
+		}
+		for name, dimHash := range releasedDimHashes {
+			r.dimHashesByName[name] = dimHash
+			r.metaByName[name] = releasedMeta[name]
+		}
+		// The old collector was valid before, so it can be registered
+		// again.
+		r.registerLocked(old, oldDescs)
+		return err
+	}
+	return nil
+}
+
+// SetMetricFamilyInjectionHook works like the package-level function of the
+// same name, but for this Registry.
+func (r *Registry) SetMetricFamilyInjectionHook(hook func() []*dto.MetricFamily) {
+	r.metricFamilyInjectionHook = hook
+}
+
+// PanicOnCollectError works like the package-level function of the same name,
+// but for this Registry.
+func (r *Registry) PanicOnCollectError(b bool) {
+	r.panicOnCollectError = b
+}
+
+// EnableCollectChecks works like the package-level function of the same name,
+// but for this Registry.
+func (r *Registry) EnableCollectChecks(b bool) {
+	r.collectChecksEnabled = b
+}
+
+// SetSerializationWorkers works like the package-level function of the same
+// name, but for this Registry.
+func (r *Registry) SetSerializationWorkers(n int) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.serializationWorkers = n
+}
+
+// SetFormatPreference works like the package-level function of the same name,
+// but for this Registry.
+func (r *Registry) SetFormatPreference(contentTypes ...string) error {
+	if len(contentTypes) == 0 {
+		return errors.New("no exposition format provided")
+	}
+	for _, contentType := range contentTypes {
+		if _, ok := encoders[contentType]; !ok {
+			return fmt.Errorf("unknown exposition format %q", contentType)
+		}
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.formatPreference = append([]string(nil), contentTypes...)
+	return nil
+}
+
+// OmitHelp works like the package-level function of the same name, but for
+// this Registry.
+func (r *Registry) OmitHelp(b bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.omitHelp = b
+}
+
+// SetHelp works like the package-level function of the same name, but for
+// this Registry.
+func (r *Registry) SetHelp(familyName, help string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if help == "" {
+		delete(r.helpByName, familyName)
+		return
+	}
+	if r.helpByName == nil {
+		r.helpByName = map[string]string{}
+	}
+	r.helpByName[familyName] = help
+}
+
+// Pause works like the package-level function of the same name, but for this
+// Registry.
+func (r *Registry) Pause(familyName string) {
+	r.setPaused(familyName, true)
+}
+
+// Resume works like the package-level function of the same name, but for this
+// Registry.
+func (r *Registry) Resume(familyName string) {
+	r.setPaused(familyName, false)
+}
 
+func (r *Registry) setPaused(familyName string, paused bool) {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
+	if _, ok := r.pausedNames[familyName]; ok == paused {
+		return
+	}
+	// Copy on write so that a running collection can keep using the
+	// previous map without locking.
+	pausedNames := make(map[string]struct{}, len(r.pausedNames)+1)
+	for name := range r.pausedNames {
+		pausedNames[name] = struct{}{}
+	}
+	if paused {
+		pausedNames[familyName] = struct{}{}
+	} else {
+		delete(pausedNames, familyName)
+	}
+	r.pausedNames = pausedNames
+}
 
-	delete(r.collectorsByID, collectorID)
-	for id := range descIDs {
-		delete(r.descIDs, id)
+// isPaused returns whether all metric families of the registered collector
+// with the provided ID are paused. The caller must hold a read lock of r.
+func (r *Registry) isPaused(id uint64) bool {
+	if len(r.pausedNames) == 0 {
+		return false
+	}
+	for _, name := range r.namesByCollectorID[id] {
+		if _, ok := r.pausedNames[name]; !ok {
+			return false
+		}
 	}
-	// dimHashesByName is left untouched as those must be consistent
-	// throughout the lifetime of a program.
 	return true
 }
 
-func (r *registry) Push(job, instance, addr, method string) error {
+// OnBeforeGather works like the package-level function of the same name, but
+// for this Registry.
+func (r *Registry) OnBeforeGather(hook func(ctx context.Context)) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.beforeGatherHooks = append(r.beforeGatherHooks, hook)
+}
+
+// OnAfterGather works like the package-level function of the same name, but
+// for this Registry.
+func (r *Registry) OnAfterGather(hook func(ctx context.Context, err error)) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.afterGatherHooks = append(r.afterGatherHooks, hook)
+}
+
+// hasResetOnScrape reports whether a metric with Opts.ResetOnScrape has ever
+// been registered.
+func (r *Registry) hasResetOnScrape() bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.resetOnScrape
+}
+
+// runBeforeGatherHooks calls the hooks registered with OnBeforeGather. The
+// hooks are called without holding the lock so that they may use the Registry.
+func (r *Registry) runBeforeGatherHooks(ctx context.Context) {
+	r.mtx.RLock()
+	hooks := r.beforeGatherHooks
+	r.mtx.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx)
+	}
+}
+
+// runAfterGatherHooks calls the hooks registered with OnAfterGather, see
+// runBeforeGatherHooks.
+func (r *Registry) runAfterGatherHooks(ctx context.Context, err error) {
+	r.mtx.RLock()
+	hooks := r.afterGatherHooks
+	r.mtx.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, err)
+	}
+}
+
+// Push works like the package-level function of the same name, but pushes the
+// metrics collected by this Registry.
+func (r *Registry) Push(job, instance, addr string) error {
+	return r.push(job, instance, addr, "PUT")
+}
+
+// PushAdd works like the package-level function of the same name, but pushes
+// the metrics collected by this Registry.
+func (r *Registry) PushAdd(job, instance, addr string) error {
+	return r.push(job, instance, addr, "POST")
+}
+
+func (r *Registry) push(job, instance, addr, method string) error {
 	u := fmt.Sprintf("http://%s/metrics/jobs/%s", addr, url.QueryEscape(job))
 	if instance != "" {
 		u += "/instances/" + url.QueryEscape(instance)
 	}
 	buf := r.getBuf()
 	defer r.giveBuf(buf)
-	if _, err := r.writePB(buf, text.WriteProtoDelimited); err != nil {
+	if _, err := r.writePB(context.Background(), buf, text.WriteProtoDelimited, DelimitedTelemetryContentType, nil, false); err != nil {
 		if r.panicOnCollectError {
 			panic(err)
 		}
@@ -375,20 +897,38 @@ func (r *registry) Push(job, instance, addr, method string) error {
 	return nil
 }
 
-func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	enc, contentType := chooseEncoder(req)
+// ServeHTTP implements http.Handler. It serves all metrics collected by this
+// Registry. Collection and serialization are aborted if the request is
+// cancelled, e.g. because the client has disconnected.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.serveHTTP(w, req, nil, false)
+}
+
+// serveHTTP serves the metrics passed through filter (unless it is nil). Debug
+// metrics (see Opts.Debug) are only included if debug is true.
+func (r *Registry) serveHTTP(w http.ResponseWriter, req *http.Request, filter familyFilter, debug bool) {
+	info := ScrapeInfo{RemoteAddr: req.RemoteAddr}
+	begin := time.Now()
+	defer func() {
+		info.Duration = time.Since(begin)
+		r.runScrapeHooks(info)
+	}()
+
 	buf := r.getBuf()
 	defer r.giveBuf(buf)
-	writer, encoding := decorateWriter(req, buf)
-	if _, err := r.writePB(writer, enc); err != nil {
-		if r.panicOnCollectError {
-			panic(err)
-		}
-		http.Error(w, "An error has occurred:\n\n"+err.Error(), http.StatusInternalServerError)
+	contentType, encoding, err := r.writeNegotiated(
+		req.Context(), buf,
+		req.Header.Get(acceptHeader), req.Header.Get(acceptEncodingHeader), filter, debug,
+	)
+	info.Err = err
+	if err != nil && err == req.Context().Err() {
+		// Nobody is waiting for the response anymore.
 		return
 	}
-	if closer, ok := writer.(io.Closer); ok {
-		closer.Close()
+	if err != nil {
+		info.Status = http.StatusInternalServerError
+		http.Error(w, "An error has occurred:\n\n"+err.Error(), http.StatusInternalServerError)
+		return
 	}
 	header := w.Header()
 	header.Set(contentTypeHeader, contentType)
@@ -396,19 +936,318 @@ func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if encoding != "" {
 		header.Set(contentEncodingHeader, encoding)
 	}
-	w.Write(buf.Bytes())
+	info.ContentType, info.Encoding, info.Status = contentType, encoding, http.StatusOK
+	info.BytesWritten, info.Err = w.Write(buf.Bytes())
+}
+
+// familyFilter is applied to each gathered metric family before it is written.
+// It returns the metric family to write, which may be a modified copy, or nil
+// to skip the metric family. It must not modify the provided metric family.
+type familyFilter func(*dto.MetricFamily) *dto.MetricFamily
+
+// includeHelp returns whether the help string of a metric family with the
+// provided metadata is to be written. The caller must hold at least the read
+// lock of r.mtx.
+func (r *Registry) includeHelp(meta familyMeta) bool {
+	switch meta.helpExposure {
+	case HelpAlways:
+		return true
+	case HelpNever:
+		return false
+	}
+	return !r.omitHelp
+}
+
+// keepStability returns a familyFilter that skips all metric families with a
+// stability below min. Metric families not registered via Opts (e.g. injected
+// ones) are considered StabilityAlpha.
+func (r *Registry) keepStability(min Stability) familyFilter {
+	return func(mf *dto.MetricFamily) *dto.MetricFamily {
+		r.mtx.RLock()
+		stability := r.metaByName[mf.GetName()].stability
+		r.mtx.RUnlock()
+		if stability < min {
+			return nil
+		}
+		return mf
+	}
+}
+
+// keepByName returns a familyFilter that skips all metric families whose name
+// is not accepted by keep.
+func keepByName(keep func(name string) bool) familyFilter {
+	return func(mf *dto.MetricFamily) *dto.MetricFamily {
+		if !keep(mf.GetName()) {
+			return nil
+		}
+		return mf
+	}
+}
+
+// writeNegotiated collects all metrics and writes them to w in the format and
+// compression negotiated from the provided values of the Accept and
+// Accept-Encoding headers. Metric families are passed through filter (unless it
+// is nil) before being written. Debug metrics are only written if debug is
+// true. It returns the content type and the content encoding (empty if
+// uncompressed) of what has been written. Once ctx is done, the work is aborted
+// and the error of ctx is returned.
+func (r *Registry) writeNegotiated(ctx context.Context, w io.Writer, accept, acceptEncoding string, filter familyFilter, debug bool) (contentType, encoding string, err error) {
+	enc, contentType := r.chooseEncoder(accept)
+	writer, encoding := r.decorateWriter(acceptEncoding, w)
+	if gz, ok := writer.(*gzip.Writer); ok {
+		defer r.giveGzipWriter(gz)
+	}
+	write := r.writePB
+	if contentType == JSONTelemetryContentType {
+		write = r.writeJSON
+	}
+	if _, err := write(ctx, writer, enc, contentType, filter, debug); err != nil {
+		if r.panicOnCollectError && err != ctx.Err() {
+			panic(err)
+		}
+		return "", "", err
+	}
+	if closer, ok := writer.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return "", "", err
+		}
+	}
+	return contentType, encoding, nil
+}
+
+// writePB collects all metrics and writes them with the provided encoder after
+// passing each metric family through filter (unless it is nil). format
+// identifies the encoding for the encoding cache, which is bypassed if a filter
+// is set. Debug metrics are skipped unless debug is true, and help strings are
+// left out as configured (see OmitHelp). Once ctx is done, the work is aborted
+// and the error of ctx is returned.
+func (r *Registry) writePB(ctx context.Context, w io.Writer, writeEncoded encoder, format string, filter familyFilter, debug bool) (written int, err error) {
+	r.runBeforeGatherHooks(ctx)
+	begin := time.Now()
+	defer func() {
+		r.runAfterGatherHooks(ctx, err)
+		if err == nil {
+			r.serializeDuration.Observe(time.Since(begin).Seconds())
+			r.serializeSize.Observe(float64(written))
+		}
+	}()
+	var (
+		pooledMetricFamilies []*dto.MetricFamily
+		pooledMetrics        []*dto.Metric
+	)
+	defer func() {
+		for _, mf := range pooledMetricFamilies {
+			r.giveMetricFamily(mf)
+		}
+		for _, m := range pooledMetrics {
+			r.giveMetric(m)
+		}
+	}()
+	if r.hasResetOnScrape() {
+		r.resetMtx.Lock()
+		defer r.resetMtx.Unlock()
+	}
+	metricFamilies, resets, err := r.gather(
+		ctx,
+		func() *dto.MetricFamily {
+			mf := r.getMetricFamily()
+			pooledMetricFamilies = append(pooledMetricFamilies, mf)
+			return mf
+		},
+		func() *dto.Metric {
+			m := r.getMetric()
+			pooledMetrics = append(pooledMetrics, m)
+			return m
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err == nil {
+			for _, reset := range resets {
+				reset()
+			}
+		}
+	}()
+
+	r.mtx.RLock()
+	visible := metricFamilies[:0]
+	for _, mf := range metricFamilies {
+		meta, registered := r.metaByName[mf.GetName()]
+		if meta.debug && !debug {
+			continue
+		}
+		// Only registered metric families are owned by us, injected
+		// ones must not be modified.
+		if registered && !r.includeHelp(meta) {
+			mf.Help = nil
+		}
+		visible = append(visible, r.redact(mf))
+	}
+	r.mtx.RUnlock()
+	metricFamilies = visible
+	if filter != nil {
+		filtered := metricFamilies[:0]
+		for _, mf := range metricFamilies {
+			if mf = filter(mf); mf != nil {
+				filtered = append(filtered, mf)
+			}
+		}
+		metricFamilies = filtered
+	}
+	// Filtered metric families bypass the encoding cache as the filter
+	// might be different for the next call.
+	writeFamily := func(w io.Writer, mf *dto.MetricFamily) (int, error) {
+		if filter != nil {
+			return writeEncoded(w, mf)
+		}
+		return r.writeCached(w, mf, format, writeEncoded)
+	}
+
+	r.mtx.RLock()
+	workers := r.serializationWorkers
+	r.mtx.RUnlock()
+	if workers > 1 && len(metricFamilies) > 1 {
+		return r.writeParallel(ctx, w, metricFamilies, writeFamily, workers)
+	}
+	for _, mf := range metricFamilies {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, err := writeFamily(w, mf)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
 }
 
-func (r *registry) writePB(w io.Writer, writeEncoded encoder) (int, error) {
-	var metricHashes map[uint64]struct{}
+// writeParallel encodes the provided metric families concurrently with the
+// given number of workers, each metric family into its own buffer, and then
+// writes the buffers to w in the original order.
+func (r *Registry) writeParallel(
+	ctx context.Context,
+	w io.Writer,
+	metricFamilies []*dto.MetricFamily,
+	writeFamily encoder,
+	workers int,
+) (written int, err error) {
+	if workers > len(metricFamilies) {
+		workers = len(metricFamilies)
+	}
+	bufs := make([]*bytes.Buffer, len(metricFamilies))
+	errs := make([]error, len(metricFamilies))
+	defer func() {
+		for _, buf := range bufs {
+			r.giveBuf(buf)
+		}
+	}()
+	for i := range bufs {
+		bufs[i] = r.getBuf()
+	}
+
+	indexes := make(chan int, len(metricFamilies))
+	for i := range metricFamilies {
+		indexes <- i
+	}
+	close(indexes)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if errs[i] = ctx.Err(); errs[i] != nil {
+					continue
+				}
+				_, errs[i] = writeFamily(bufs[i], metricFamilies[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, buf := range bufs {
+		if errs[i] != nil {
+			return written, errs[i]
+		}
+		n, err := w.Write(buf.Bytes())
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Gather implements Gatherer. It collects all metrics registered with this
+// Registry and returns them as MetricFamily protobufs sorted by name, with the
+// Metrics within each MetricFamily sorted by their label values. The returned
+// protobufs are owned by the caller.
+func (r *Registry) Gather() ([]*dto.MetricFamily, error) {
+	return r.GatherContext(context.Background())
+}
+
+// GatherContext works like Gather, but stops waiting for Collectors and
+// returns the error of ctx once ctx is done. Collectors already running are
+// not interrupted, but their metrics are discarded, and Collectors not started
+// yet are skipped.
+func (r *Registry) GatherContext(ctx context.Context) ([]*dto.MetricFamily, error) {
+	r.runBeforeGatherHooks(ctx)
+	if r.hasResetOnScrape() {
+		r.resetMtx.Lock()
+		defer r.resetMtx.Unlock()
+	}
+	metricFamilies, resets, err := r.gather(
+		ctx,
+		func() *dto.MetricFamily { return &dto.MetricFamily{} },
+		func() *dto.Metric { return &dto.Metric{} },
+	)
+	if err == nil {
+		for _, reset := range resets {
+			reset()
+		}
+	}
+	r.runAfterGatherHooks(ctx, err)
+	if err != nil && r.panicOnCollectError && err != ctx.Err() {
+		panic(err)
+	}
+	return metricFamilies, err
+}
+
+// gather does the actual work for GatherContext and writePB. The protobufs are
+// allocated with the provided functions. The returned functions reset the
+// metrics with Opts.ResetOnScrape by the values gathered. The caller has to
+// call them once the gathered metrics have been delivered successfully.
+func (r *Registry) gather(
+	ctx context.Context,
+	newMetricFamily func() *dto.MetricFamily,
+	newMetric func() *dto.Metric,
+) ([]*dto.MetricFamily, []func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	var (
+		metricHashes map[uint64]struct{}
+		resets       []func()
+	)
 	if r.collectChecksEnabled {
 		metricHashes = make(map[uint64]struct{})
 	}
 	metricChan := make(chan Metric, capMetricChan)
 	wg := sync.WaitGroup{}
 
+	// A panicking Collector must not crash the program. The panic is
+	// recovered and reported as a collection error instead.
+	var (
+		panicMtx sync.Mutex
+		panicErr error
+	)
+
 	r.mtx.RLock()
 	metricFamiliesByName := make(map[string]*dto.MetricFamily, len(r.dimHashesByName))
+	pausedNames := r.pausedNames
 
 	// Scatter.
 	// (Collectors could be complex and slow, so we call them all at once.)
@@ -417,41 +1256,80 @@ func (r *registry) writePB(w io.Writer, writeEncoded encoder) (int, error) {
 		wg.Wait()
 		close(metricChan)
 	}()
-	for _, collector := range r.collectorsByID {
+	for id, collector := range r.collectorsByID {
+		if r.isPaused(id) {
+			wg.Done()
+			continue
+		}
 		go func(collector Collector) {
 			defer wg.Done()
+			defer func() {
+				if p := recover(); p != nil {
+					atomic.AddUint64(&r.collectorPanics, 1)
+					panicMtx.Lock()
+					panicErr = fmt.Errorf("collector panicked: %v", p)
+					panicMtx.Unlock()
+				}
+			}()
+			if ctx.Err() != nil {
+				return
+			}
 			collector.Collect(metricChan)
 		}(collector)
 	}
 	r.mtx.RUnlock()
 
-	// Drain metricChan in case of premature return.
+	// Drain metricChan in case of premature return. This happens in the
+	// background so that a cancelled ctx does not wait for slow Collectors.
 	defer func() {
-		for _ = range metricChan {
-		}
+		go func() {
+			for _ = range metricChan {
+			}
+		}()
 	}()
 
 	// Gather.
-	for metric := range metricChan {
+gatherLoop:
+	for {
+		var metric Metric
+		select {
+		case m, ok := <-metricChan:
+			if !ok {
+				break gatherLoop
+			}
+			metric = m
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
 		// This could be done concurrently, too, but it required locking
 		// of metricFamiliesByName (and of metricHashes if checks are
 		// enabled). Most likely not worth it.
 		desc := metric.Desc()
+		if _, ok := pausedNames[desc.fqName]; ok {
+			continue
+		}
 		metricFamily, ok := metricFamiliesByName[desc.fqName]
 		if !ok {
-			metricFamily = r.getMetricFamily()
-			defer r.giveMetricFamily(metricFamily)
+			metricFamily = newMetricFamily()
 			metricFamily.Name = proto.String(desc.fqName)
 			metricFamily.Help = proto.String(desc.help)
 			metricFamiliesByName[desc.fqName] = metricFamily
 		}
-		dtoMetric := r.getMetric()
-		defer r.giveMetric(dtoMetric)
-		if err := metric.Write(dtoMetric); err != nil {
+		dtoMetric := newMetric()
+		var err error
+		if resetter, ok := metric.(scrapeResetter); ok && desc.meta.resetOnScrape {
+			var reset func()
+			if reset, err = resetter.writeForReset(dtoMetric); err == nil {
+				resets = append(resets, reset)
+			}
+		} else {
+			err = metric.Write(dtoMetric)
+		}
+		if err != nil {
 			// TODO: Consider different means of error reporting so
 			// that a single erroneous metric could be skipped
 			// instead of blowing up the whole collection.
-			return 0, fmt.Errorf("error collecting metric %v: %s", desc, err)
+			return nil, nil, fmt.Errorf("error collecting metric %v: %s", desc, err)
 		}
 		switch {
 		case metricFamily.Type != nil:
@@ -465,50 +1343,65 @@ func (r *registry) writePB(w io.Writer, writeEncoded encoder) (int, error) {
 		case dtoMetric.Untyped != nil:
 			metricFamily.Type = dto.MetricType_UNTYPED.Enum()
 		default:
-			return 0, fmt.Errorf("empty metric collected: %s", dtoMetric)
+			return nil, nil, fmt.Errorf("empty metric collected: %s", dtoMetric)
 		}
 		if r.collectChecksEnabled {
 			if err := r.checkConsistency(metricFamily, dtoMetric, desc, metricHashes); err != nil {
-				return 0, err
+				return nil, nil, err
 			}
 		}
 		metricFamily.Metric = append(metricFamily.Metric, dtoMetric)
 	}
+	// All collectors have returned now that metricChan is closed.
+	if panicErr != nil {
+		return nil, nil, panicErr
+	}
+
+	r.mtx.RLock()
+	for name, help := range r.helpByName {
+		if mf, ok := metricFamiliesByName[name]; ok {
+			mf.Help = proto.String(help)
+		}
+	}
+	r.mtx.RUnlock()
+
+	r.reportDeprecatedWrites(metricFamiliesByName)
+	r.applyCounterDeltas(metricFamiliesByName)
 
 	if r.metricFamilyInjectionHook != nil {
 		for _, mf := range r.metricFamilyInjectionHook() {
 			if _, exists := metricFamiliesByName[mf.GetName()]; exists {
-				return 0, fmt.Errorf("metric family with duplicate name injected: %s", mf)
+				return nil, nil, fmt.Errorf("metric family with duplicate name injected: %s", mf)
 			}
 			metricFamiliesByName[mf.GetName()] = mf
 		}
 	}
 
+	if err := r.deriveFamilies(metricFamiliesByName, pausedNames, newMetricFamily, newMetric); err != nil {
+		return nil, nil, err
+	}
+
 	// Now that MetricFamilies are all set, sort their Metrics
 	// lexicographically by their label values.
 	for _, mf := range metricFamiliesByName {
 		sort.Sort(metricSorter(mf.Metric))
 	}
 
-	// Write out MetricFamilies sorted by their name.
+	// Return MetricFamilies sorted by their name.
 	names := make([]string, 0, len(metricFamiliesByName))
 	for name := range metricFamiliesByName {
 		names = append(names, name)
 	}
 	sort.Strings(names)
 
-	var written int
+	metricFamilies := make([]*dto.MetricFamily, 0, len(names))
 	for _, name := range names {
-		w, err := writeEncoded(w, metricFamiliesByName[name])
-		written += w
-		if err != nil {
-			return written, err
-		}
+		metricFamilies = append(metricFamilies, metricFamiliesByName[name])
 	}
-	return written, nil
+	return metricFamilies, resets, nil
 }
 
-func (r *registry) checkConsistency(metricFamily *dto.MetricFamily, dtoMetric *dto.Metric, desc *Desc, metricHashes map[uint64]struct{}) error {
+func (r *Registry) checkConsistency(metricFamily *dto.MetricFamily, dtoMetric *dto.Metric, desc *Desc, metricHashes map[uint64]struct{}) error {
 
 	// Type consistency with metric family.
 	if metricFamily.GetType() == dto.MetricType_GAUGE && dtoMetric.Gauge == nil ||
@@ -587,7 +1480,7 @@ func (r *registry) checkConsistency(metricFamily *dto.MetricFamily, dtoMetric *d
 	return nil
 }
 
-func (r *registry) getBuf() *bytes.Buffer {
+func (r *Registry) getBuf() *bytes.Buffer {
 	select {
 	case buf := <-r.bufPool:
 		return buf
@@ -596,7 +1489,7 @@ func (r *registry) getBuf() *bytes.Buffer {
 	}
 }
 
-func (r *registry) giveBuf(buf *bytes.Buffer) {
+func (r *Registry) giveBuf(buf *bytes.Buffer) {
 	buf.Reset()
 	select {
 	case r.bufPool <- buf:
@@ -604,7 +1497,27 @@ func (r *registry) giveBuf(buf *bytes.Buffer) {
 	}
 }
 
-func (r *registry) getMetricFamily() *dto.MetricFamily {
+// getGzipWriter returns a gzip.Writer writing to w. Compressors are expensive
+// to allocate, so they are recycled between scrapes.
+func (r *Registry) getGzipWriter(w io.Writer) *gzip.Writer {
+	select {
+	case gz := <-r.gzipPool:
+		gz.Reset(w)
+		return gz
+	default:
+		return gzip.NewWriter(w)
+	}
+}
+
+func (r *Registry) giveGzipWriter(gz *gzip.Writer) {
+	gz.Reset(nil)
+	select {
+	case r.gzipPool <- gz:
+	default:
+	}
+}
+
+func (r *Registry) getMetricFamily() *dto.MetricFamily {
 	select {
 	case mf := <-r.metricFamilyPool:
 		return mf
@@ -613,7 +1526,7 @@ func (r *registry) getMetricFamily() *dto.MetricFamily {
 	}
 }
 
-func (r *registry) giveMetricFamily(mf *dto.MetricFamily) {
+func (r *Registry) giveMetricFamily(mf *dto.MetricFamily) {
 	mf.Reset()
 	select {
 	case r.metricFamilyPool <- mf:
@@ -621,7 +1534,7 @@ func (r *registry) giveMetricFamily(mf *dto.MetricFamily) {
 	}
 }
 
-func (r *registry) getMetric() *dto.Metric {
+func (r *Registry) getMetric() *dto.Metric {
 	select {
 	case m := <-r.metricPool:
 		return m
@@ -630,7 +1543,7 @@ func (r *registry) getMetric() *dto.Metric {
 	}
 }
 
-func (r *registry) giveMetric(m *dto.Metric) {
+func (r *Registry) giveMetric(m *dto.Metric) {
 	m.Reset()
 	select {
 	case r.metricPool <- m:
@@ -638,62 +1551,134 @@ func (r *registry) giveMetric(m *dto.Metric) {
 	}
 }
 
-func newRegistry() *registry {
-	return &registry{
-		collectorsByID:   map[uint64]Collector{},
-		descIDs:          map[uint64]struct{}{},
-		dimHashesByName:  map[string]uint64{},
-		bufPool:          make(chan *bytes.Buffer, numBufs),
-		metricFamilyPool: make(chan *dto.MetricFamily, numMetricFamilies),
-		metricPool:       make(chan *dto.Metric, numMetrics),
+// NewRegistry returns a new and empty Registry. Unlike the default registry, it
+// does not have a process collector or a Go collector registered.
+func NewRegistry() *Registry {
+	return newRegistry()
+}
+
+func newRegistry() *Registry {
+	return &Registry{
+		collectorsByID:     map[uint64]Collector{},
+		descIDs:            map[uint64]struct{}{},
+		dimHashesByName:    map[string]uint64{},
+		metaByName:         map[string]familyMeta{},
+		descsByName:        map[string]int{},
+		namesByCollectorID: map[uint64][]string{},
+		bufPool:            make(chan *bytes.Buffer, numBufs),
+		gzipPool:           make(chan *gzip.Writer, numGzipWriters),
+		metricFamilyPool:   make(chan *dto.MetricFamily, numMetricFamilies),
+		metricPool:         make(chan *dto.Metric, numMetrics),
+		serializeDuration: NewSummary(SummaryOpts{
+			Namespace: clientNamespace,
+			Name:      "serialization_duration_seconds",
+			Help:      "Time spent collecting and serializing metrics for a scrape or push.",
+		}),
+		serializeSize: NewSummary(SummaryOpts{
+			Namespace: clientNamespace,
+			Name:      "serialization_size_bytes",
+			Help:      "Size of the serialized metrics of a scrape or push (before compression).",
+		}),
 	}
 }
 
-func newDefaultRegistry() *registry {
+func newDefaultRegistry() *Registry {
 	r := newRegistry()
-	r.Register(NewProcessCollector(os.Getpid(), ""))
-	r.Register(NewGoCollector())
+	r.register(NewProcessCollector(os.Getpid(), ""))
+	r.register(NewGoCollector())
 	return r
 }
 
-func chooseEncoder(req *http.Request) (encoder, string) {
-	accepts := goautoneg.ParseAccept(req.Header.Get(acceptHeader))
-	for _, accept := range accepts {
-		switch {
-		case accept.Type == "application" &&
-			accept.SubType == "vnd.google.protobuf" &&
-			accept.Params["proto"] == "io.prometheus.client.MetricFamily":
-			switch accept.Params["encoding"] {
-			case "delimited":
-				return text.WriteProtoDelimited, DelimitedTelemetryContentType
-			case "text":
-				return text.WriteProtoText, ProtoTextTelemetryContentType
-			case "compact-text":
-				return text.WriteProtoCompactText, ProtoCompactTextTelemetryContentType
-			default:
-				continue
+// encoders are the encoders of the exposition formats by content type.
+var encoders = map[string]encoder{
+	TextTelemetryContentType:             text.MetricFamilyToText,
+	DelimitedTelemetryContentType:        text.WriteProtoDelimited,
+	ProtoTextTelemetryContentType:        text.WriteProtoText,
+	ProtoCompactTextTelemetryContentType: text.WriteProtoCompactText,
+	JSONTelemetryContentType:             writeJSONEntity,
+}
+
+// defFormatPreference is the default for SetFormatPreference.
+var defFormatPreference = []string{
+	TextTelemetryContentType,
+	DelimitedTelemetryContentType,
+	ProtoTextTelemetryContentType,
+	ProtoCompactTextTelemetryContentType,
+	JSONTelemetryContentType,
+}
+
+// chooseEncoder returns the encoder and content type of the exposition format
+// negotiated from the provided value of the Accept header, see
+// SetFormatPreference.
+func (r *Registry) chooseEncoder(accept string) (encoder, string) {
+	r.mtx.RLock()
+	preference := r.formatPreference
+	r.mtx.RUnlock()
+	if preference == nil {
+		preference = defFormatPreference
+	}
+
+	accepts := goautoneg.ParseAccept(accept)
+	best, bestQ := preference[0], 0.
+	for _, contentType := range preference {
+		for _, a := range accepts {
+			if a.Q > bestQ && acceptsFormat(a, contentType) {
+				best, bestQ = contentType, a.Q
 			}
-		case accept.Type == "text" &&
-			accept.SubType == "plain" &&
-			(accept.Params["version"] == "0.0.4" || accept.Params["version"] == ""):
-			return text.MetricFamilyToText, TextTelemetryContentType
-		default:
-			continue
 		}
 	}
-	return text.MetricFamilyToText, TextTelemetryContentType
+	return encoders[best], best
+}
+
+// acceptsFormat returns whether the provided clause of an Accept header
+// accepts the exposition format with the provided content type.
+func acceptsFormat(a goautoneg.Accept, contentType string) bool {
+	if a.Type == "*" {
+		return true
+	}
+	switch contentType {
+	case TextTelemetryContentType:
+		return a.Type == "text" &&
+			(a.SubType == "*" ||
+				a.SubType == "plain" && (a.Params["version"] == APIVersion || a.Params["version"] == ""))
+	case JSONTelemetryContentType:
+		return a.Type == "application" &&
+			(a.SubType == "*" ||
+				a.SubType == "json" && strings.Trim(a.Params["schema"], `"`) == "prometheus/telemetry" &&
+					(a.Params["version"] == "0.0.2" || a.Params["version"] == ""))
+	}
+	if a.Type != "application" {
+		return false
+	}
+	if a.SubType == "*" {
+		return true
+	}
+	if a.SubType != "vnd.google.protobuf" ||
+		a.Params["proto"] != "io.prometheus.client.MetricFamily" && a.Params["proto"] != "" {
+		return false
+	}
+	switch a.Params["encoding"] {
+	case "delimited", "":
+		// Old scrapers did not specify the encoding.
+		return contentType == DelimitedTelemetryContentType
+	case "text":
+		return contentType == ProtoTextTelemetryContentType
+	case "compact-text":
+		return contentType == ProtoCompactTextTelemetryContentType
+	}
+	return false
 }
 
-// decorateWriter wraps a writer to handle gzip compression if requested.  It
-// returns the decorated writer and the appropriate "Content-Encoding" header
-// (which is empty if no compression is enabled).
-func decorateWriter(request *http.Request, writer io.Writer) (io.Writer, string) {
-	header := request.Header.Get(acceptEncodingHeader)
-	parts := strings.Split(header, ",")
+// decorateWriter wraps a writer to handle gzip compression if requested by the
+// provided value of the Accept-Encoding header.  It returns the decorated writer
+// and the appropriate "Content-Encoding" header (which is empty if no
+// compression is enabled).
+func (r *Registry) decorateWriter(acceptEncoding string, writer io.Writer) (io.Writer, string) {
+	parts := strings.Split(acceptEncoding, ",")
 	for _, part := range parts {
 		part := strings.TrimSpace(part)
 		if part == "gzip" || strings.HasPrefix(part, "gzip;") {
-			return gzip.NewWriter(writer), "gzip"
+			return r.getGzipWriter(writer), "gzip"
 		}
 	}
 	return writer, ""
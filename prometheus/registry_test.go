@@ -21,9 +21,14 @@ package prometheus
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/binary"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"code.google.com/p/goprotobuf/proto"
 	dto "github.com/prometheus/client_model/go"
@@ -487,3 +492,400 @@ func BenchmarkHandler(b *testing.B) {
 		testHandler(b)
 	}
 }
+
+func TestGzipWriterReuse(t *testing.T) {
+	r := newRegistry()
+	r.MustRegister(NewCounter(CounterOpts{Name: "test_total", Help: "Test."}))
+
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		_, encoding, err := r.writeNegotiated(context.Background(), &buf, "", "gzip", nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoding != "gzip" {
+			t.Fatalf("got encoding %q, want gzip", encoding)
+		}
+		gz, err := gzip.NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(body), "test_total 0") {
+			t.Errorf("%d. unexpected body: %s", i, body)
+		}
+		if got, want := len(r.gzipPool), 1; got != want {
+			t.Errorf("%d. got %d pooled gzip writers, want %d", i, got, want)
+		}
+	}
+}
+
+func TestParallelSerialization(t *testing.T) {
+	r := newRegistry()
+	for i := 0; i < 50; i++ {
+		c := NewCounterVec(CounterOpts{
+			Name: "test_total_" + strings.Repeat("x", i),
+			Help: "Test.",
+		}, []string{"l"})
+		c.WithLabelValues("a").Add(float64(i))
+		c.WithLabelValues("b").Inc()
+		r.MustRegister(c)
+	}
+
+	for _, accept := range []string{"", "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited"} {
+		var sequential bytes.Buffer
+		if _, _, err := r.writeNegotiated(context.Background(), &sequential, accept, "", nil, false); err != nil {
+			t.Fatal(err)
+		}
+		r.SetSerializationWorkers(4)
+		var parallel bytes.Buffer
+		if _, _, err := r.writeNegotiated(context.Background(), &parallel, accept, "", nil, false); err != nil {
+			t.Fatal(err)
+		}
+		r.SetSerializationWorkers(0)
+		if !bytes.Equal(sequential.Bytes(), parallel.Bytes()) {
+			t.Errorf("accept %q: parallel serialization differs:\n%s\nwant:\n%s", accept, parallel.Bytes(), sequential.Bytes())
+		}
+	}
+}
+
+type blockingCollector struct {
+	desc    *Desc
+	release chan struct{}
+}
+
+func (c blockingCollector) Describe(ch chan<- *Desc) { ch <- c.desc }
+
+func (c blockingCollector) Collect(ch chan<- Metric) {
+	<-c.release
+	ch <- MustNewConstMetric(c.desc, GaugeValue, 1)
+}
+
+func TestGatherContextCancellation(t *testing.T) {
+	r := newRegistry()
+	r.PanicOnCollectError(true)
+	c := blockingCollector{
+		desc:    NewDesc("blocking", "Blocks until released.", nil, nil),
+		release: make(chan struct{}),
+	}
+	r.MustRegister(c)
+	defer close(c.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.GatherContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	var buf bytes.Buffer
+	if _, _, err := r.writeNegotiated(ctx, &buf, "", "", nil, false); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %d bytes written after cancellation, want 0", buf.Len())
+	}
+}
+
+func TestGatherHooks(t *testing.T) {
+	r := newRegistry()
+	pending := NewGauge(GaugeOpts{Name: "pending", Help: "Pending items."})
+	r.MustRegister(pending)
+
+	var (
+		calls []string
+		errs  []error
+	)
+	r.OnBeforeGather(func(context.Context) {
+		calls = append(calls, "before")
+		pending.Set(42) // Refreshed right before collection.
+	})
+	r.OnAfterGather(func(_ context.Context, err error) {
+		calls = append(calls, "after")
+		errs = append(errs, err)
+	})
+
+	var buf bytes.Buffer
+	if _, _, err := r.writeNegotiated(context.Background(), &buf, "", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "pending 42") {
+		t.Errorf("before hook not applied to the output:\n%s", buf.String())
+	}
+	if _, err := r.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.GatherContext(ctx)
+
+	if got, want := strings.Join(calls, ","), "before,after,before,after,before,after"; got != want {
+		t.Errorf("got hook calls %s, want %s", got, want)
+	}
+	if len(errs) != 3 || errs[0] != nil || errs[1] != nil || errs[2] != context.Canceled {
+		t.Errorf("got errors %v passed to the after hook, want [<nil> <nil> %v]", errs, context.Canceled)
+	}
+}
+
+func TestResetOnScrape(t *testing.T) {
+	r := newRegistry()
+	requests := NewCounterVec(CounterOpts{Name: "requests_total", Help: "Requests.", ResetOnScrape: true}, []string{"code"})
+	bytesSent := NewCounter(CounterOpts{Name: "bytes_total", Help: "Bytes.", ResetOnScrape: true})
+	queue := NewGauge(GaugeOpts{Name: "queue_length", Help: "Queue length."})
+	r.MustRegister(requests)
+	r.MustRegister(bytesSent)
+	r.MustRegister(queue)
+
+	scrape := func() string {
+		var buf bytes.Buffer
+		if _, _, err := r.writeNegotiated(context.Background(), &buf, "", "", nil, false); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	expect := func(out string, want ...string) {
+		for _, w := range want {
+			if !strings.Contains(out, w+"\n") {
+				t.Errorf("output does not contain %q:\n%s", w, out)
+			}
+		}
+	}
+
+	requests.WithLabelValues("200").Add(3)
+	bytesSent.Add(1.5)
+	bytesSent.Add(2)
+	queue.Set(4)
+	expect(scrape(), `requests_total{code="200"} 3`, "bytes_total 3.5", "queue_length 4")
+	expect(scrape(), `requests_total{code="200"} 0`, "bytes_total 0", "queue_length 4")
+
+	// Increments after the collection are reported by the next one.
+	requests.WithLabelValues("200").Inc()
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mfs[2].Metric[0].GetCounter().GetValue(); got != 1 {
+		t.Errorf("got gathered value %v, want 1", got)
+	}
+	expect(scrape(), `requests_total{code="200"} 0`)
+
+	// A failed collection does not reset.
+	requests.WithLabelValues("200").Inc()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.GatherContext(ctx)
+	expect(scrape(), `requests_total{code="200"} 1`)
+
+	// Metrics of the same name must agree.
+	if err := r.Register(NewCounter(CounterOpts{
+		Name:        "requests_total",
+		Help:        "Requests.",
+		ConstLabels: Labels{"code": "500"},
+	})); err == nil {
+		t.Error("registering a metric disagreeing on ResetOnScrape succeeded")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	r := newRegistry()
+	requests := NewCounterVec(CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"code"})
+	other := NewCounter(CounterOpts{Name: "other_total", Help: "Other."})
+	r.MustRegister(requests)
+	r.MustRegister(other)
+	requests.WithLabelValues("200").Inc()
+
+	// Label names may change for names only used by the replaced collector.
+	reconfigured := NewCounterVec(CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"code", "method"})
+	if err := r.Replace(requests, reconfigured); err != nil {
+		t.Fatal(err)
+	}
+	reconfigured.WithLabelValues("200", "GET").Inc()
+	var buf bytes.Buffer
+	if _, _, err := r.writeNegotiated(context.Background(), &buf, "", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := `requests_total{code="200",method="GET"} 1`; !strings.Contains(buf.String(), want) {
+		t.Errorf("output does not contain %q:\n%s", want, buf.String())
+	}
+
+	// Failed replacements keep the old collector.
+	unregistered := NewGauge(GaugeOpts{Name: "unregistered", Help: "Unregistered."})
+	if err := r.Replace(unregistered, reconfigured); err == nil {
+		t.Error("replacing an unregistered collector succeeded")
+	}
+	if err := r.Replace(reconfigured, other); err == nil {
+		t.Error("replacing by a registered collector succeeded")
+	}
+	clash := NewCounter(CounterOpts{Name: "other_total", Help: "Different help."})
+	if err := r.Replace(reconfigured, clash); err == nil {
+		t.Error("replacing by an inconsistent collector succeeded")
+	}
+	if !r.Unregister(reconfigured) {
+		t.Error("collector not registered anymore after failed replacements")
+	}
+	if !r.Unregister(other) {
+		t.Error("unrelated collector not registered anymore")
+	}
+}
+
+func TestPause(t *testing.T) {
+	r := newRegistry()
+	calls := 0
+	expensive := NewGaugeFunc(GaugeOpts{Name: "expensive", Help: "Expensive."}, func() float64 {
+		calls++
+		return 1
+	})
+	cheap := NewGauge(GaugeOpts{Name: "cheap", Help: "Cheap."})
+	r.MustRegister(expensive)
+	r.MustRegister(cheap)
+
+	names := func() string {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, mf := range mfs {
+			names = append(names, mf.GetName())
+		}
+		return strings.Join(names, ",")
+	}
+
+	r.Pause("expensive")
+	r.Pause("expensive")
+	if got := names(); got != "cheap" {
+		t.Errorf("got families %s, want cheap", got)
+	}
+	if calls != 0 {
+		t.Errorf("paused collector called %d times", calls)
+	}
+	r.Resume("expensive")
+	if got := names(); got != "cheap,expensive" {
+		t.Errorf("got families %s, want cheap,expensive", got)
+	}
+	if calls != 1 {
+		t.Errorf("resumed collector called %d times, want 1", calls)
+	}
+}
+
+func TestChooseEncoder(t *testing.T) {
+	const protoPrefix = "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily"
+	scenarios := []struct {
+		preference []string
+		accept     string
+		want       string
+	}{
+		{accept: "", want: TextTelemetryContentType},
+		{accept: "*/*", want: TextTelemetryContentType},
+		{accept: "application/*", want: DelimitedTelemetryContentType},
+		{accept: "application/json", want: TextTelemetryContentType},
+		{accept: "application/vnd.google.protobuf", want: DelimitedTelemetryContentType},
+		{accept: protoPrefix + ";encoding=text", want: ProtoTextTelemetryContentType},
+		{accept: `application/json; schema="prometheus/telemetry"; version=0.0.2`, want: JSONTelemetryContentType},
+		{accept: `application/json; schema="prometheus/telemetry"; version=0.0.1`, want: TextTelemetryContentType},
+		{accept: `application/json;schema="prometheus/telemetry";q=0.9,text/plain;q=0.5`, want: JSONTelemetryContentType},
+		{
+			preference: []string{DelimitedTelemetryContentType, TextTelemetryContentType},
+			accept:     "text/plain,*/*",
+			want:       DelimitedTelemetryContentType,
+		},
+		{
+			preference: []string{DelimitedTelemetryContentType, TextTelemetryContentType},
+			accept:     "text/plain;q=0.5,*/*;q=0.1",
+			want:       TextTelemetryContentType,
+		},
+		{
+			preference: []string{DelimitedTelemetryContentType},
+			accept:     protoPrefix + ";encoding=text",
+			want:       DelimitedTelemetryContentType,
+		},
+	}
+	for i, s := range scenarios {
+		r := newRegistry()
+		if s.preference != nil {
+			if err := r.SetFormatPreference(s.preference...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, got := r.chooseEncoder(s.accept); got != s.want {
+			t.Errorf("%d. got %q for Accept %q, want %q", i, got, s.accept, s.want)
+		}
+	}
+	if err := newRegistry().SetFormatPreference("application/xml"); err == nil {
+		t.Error("setting an unknown format succeeded")
+	}
+}
+
+func TestSetHelp(t *testing.T) {
+	r := newRegistry()
+	r.EnableCollectChecks(true)
+	c := NewCounter(CounterOpts{Name: "test_total", Help: "Registered help."})
+	r.MustRegister(c)
+
+	help := func() string {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mfs[0].GetHelp()
+	}
+	r.SetHelp("test_total", "Better help.")
+	r.SetHelp("missing_total", "Ignored.")
+	if got, want := help(), "Better help."; got != want {
+		t.Errorf("got help %q, want %q", got, want)
+	}
+	var buf bytes.Buffer
+	if _, _, err := r.writeNegotiated(context.Background(), &buf, "", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "# HELP test_total Better help.") {
+		t.Errorf("updated help missing in output:\n%s", buf.String())
+	}
+	r.SetHelp("test_total", "")
+	if got, want := help(), "Registered help."; got != want {
+		t.Errorf("got help %q, want %q", got, want)
+	}
+}
+
+func TestOmitHelp(t *testing.T) {
+	r := newRegistry()
+	r.MustRegister(NewCounter(CounterOpts{Name: "default_total", Help: "Default."}))
+	r.MustRegister(NewCounter(CounterOpts{Name: "always_total", Help: "Always.", HelpExposure: HelpAlways}))
+	r.MustRegister(NewSummary(SummaryOpts{Name: "never_seconds", Help: "Never.", HelpExposure: HelpNever}))
+
+	for _, s := range []struct {
+		omit            bool
+		contains, lacks []string
+	}{
+		{false, []string{"# HELP default_total", "# HELP always_total"}, []string{"# HELP never_seconds"}},
+		{true, []string{"# HELP always_total"}, []string{"# HELP default_total", "# HELP never_seconds"}},
+	} {
+		r.OmitHelp(s.omit)
+		var buf bytes.Buffer
+		if _, _, err := r.writeNegotiated(context.Background(), &buf, "", "", nil, false); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range s.contains {
+			if !strings.Contains(buf.String(), c) {
+				t.Errorf("omit %t: output does not contain %q:\n%s", s.omit, c, buf.String())
+			}
+		}
+		for _, l := range s.lacks {
+			if strings.Contains(buf.String(), l) {
+				t.Errorf("omit %t: output unexpectedly contains %q:\n%s", s.omit, l, buf.String())
+			}
+		}
+	}
+
+	// Gather is not affected.
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.Help == nil {
+			t.Errorf("gathered %s without help", mf.GetName())
+		}
+	}
+}
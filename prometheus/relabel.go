@@ -0,0 +1,188 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	"github.com/prometheus/client_golang/model"
+)
+
+// RelabelConfig describes how the labels of the metrics served by a
+// RelabeledHandler are rewritten. The rules are applied in the order of the
+// fields below. Only the served output is affected, the Registry and its
+// Collectors are not.
+type RelabelConfig struct {
+	// KeepLabels, if not empty, is the allow-list of label names. All
+	// other labels are dropped.
+	KeepLabels []string
+	// DropLabels are the names of the labels to drop.
+	DropLabels []string
+	// RenameLabels maps label names to the names they are renamed to. A
+	// renamed label replaces a label that already has the new name.
+	RenameLabels map[string]string
+}
+
+// RelabeledHandler returns an http.Handler that serves the metrics of the
+// provided Registry in the same way as the Registry itself, but with the labels
+// rewritten according to cfg. This way, one Registry can serve a detailed
+// endpoint for internal use and a low-cardinality one for external consumers:
+//
+//     http.Handle("/metrics/internal", r)
+//     http.Handle("/metrics", prometheus.RelabeledHandler(r, prometheus.RelabelConfig{
+//         DropLabels: []string{"path", "user"},
+//     }))
+//
+// Metrics of a family that end up with identical labels are merged: The values
+// of counters, gauges and untyped metrics are added up, and so are the sample
+// counts and sums of summaries. As quantiles cannot be merged, they are dropped
+// from merged summaries.
+//
+// RelabeledHandler panics if a new name in RenameLabels is not a valid label
+// name.
+func RelabeledHandler(r *Registry, cfg RelabelConfig) http.Handler {
+	for _, to := range cfg.RenameLabels {
+		if !checkLabelName(to) {
+			panic(fmt.Errorf("%q is not a valid label name", to))
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.serveHTTP(w, req, cfg.relabel, false)
+	})
+}
+
+// relabel is a familyFilter. It returns a copy of mf with the labels of its
+// metrics rewritten and colliding metrics merged.
+func (cfg RelabelConfig) relabel(mf *dto.MetricFamily) *dto.MetricFamily {
+	result := &dto.MetricFamily{
+		Name: mf.Name,
+		Help: mf.Help,
+		Type: mf.Type,
+	}
+	byKey := make(map[string]*dto.Metric, len(mf.Metric))
+	keys := make([]string, 0, len(mf.Metric))
+	var b bytes.Buffer
+	for _, m := range mf.Metric {
+		labels := cfg.relabelPairs(m.Label)
+		b.Reset()
+		for _, lp := range labels {
+			b.WriteString(lp.GetName())
+			b.WriteByte(model.SeparatorByte)
+			b.WriteString(lp.GetValue())
+			b.WriteByte(model.SeparatorByte)
+		}
+		key := b.String()
+		if merged, ok := byKey[key]; ok {
+			mergeMetric(merged, m)
+			continue
+		}
+		byKey[key] = copyMetric(m, labels)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result.Metric = make([]*dto.Metric, 0, len(keys))
+	for _, key := range keys {
+		result.Metric = append(result.Metric, byKey[key])
+	}
+	return result
+}
+
+// relabelPairs returns the rewritten label pairs sorted by name. The provided
+// label pairs are not modified.
+func (cfg RelabelConfig) relabelPairs(in []*dto.LabelPair) []*dto.LabelPair {
+	byName := make(map[string]string, len(in))
+	for _, lp := range in {
+		byName[lp.GetName()] = lp.GetValue()
+	}
+	if len(cfg.KeepLabels) > 0 {
+		kept := make(map[string]string, len(cfg.KeepLabels))
+		for _, name := range cfg.KeepLabels {
+			if value, ok := byName[name]; ok {
+				kept[name] = value
+			}
+		}
+		byName = kept
+	}
+	for _, name := range cfg.DropLabels {
+		delete(byName, name)
+	}
+	renamed := make(map[string]string, len(byName))
+	for name, value := range byName {
+		if _, ok := cfg.RenameLabels[name]; !ok {
+			renamed[name] = value
+		}
+	}
+	for from, to := range cfg.RenameLabels {
+		if value, ok := byName[from]; ok {
+			renamed[to] = value
+		}
+	}
+	out := make([]*dto.LabelPair, 0, len(renamed))
+	for name, value := range renamed {
+		out = append(out, &dto.LabelPair{
+			Name:  proto.String(name),
+			Value: proto.String(value),
+		})
+	}
+	sort.Sort(LabelPairSorter(out))
+	return out
+}
+
+// copyMetric returns a copy of m with the provided labels. The values are
+// copied deeply so that they can be modified by mergeMetric.
+func copyMetric(m *dto.Metric, labels []*dto.LabelPair) *dto.Metric {
+	c := &dto.Metric{
+		Label:       labels,
+		TimestampMs: m.TimestampMs,
+	}
+	switch {
+	case m.Counter != nil:
+		c.Counter = &dto.Counter{Value: proto.Float64(m.Counter.GetValue())}
+	case m.Gauge != nil:
+		c.Gauge = &dto.Gauge{Value: proto.Float64(m.Gauge.GetValue())}
+	case m.Untyped != nil:
+		c.Untyped = &dto.Untyped{Value: proto.Float64(m.Untyped.GetValue())}
+	case m.Summary != nil:
+		c.Summary = &dto.Summary{
+			SampleCount: proto.Uint64(m.Summary.GetSampleCount()),
+			SampleSum:   proto.Float64(m.Summary.GetSampleSum()),
+			Quantile:    m.Summary.Quantile,
+		}
+	}
+	return c
+}
+
+// mergeMetric adds the values of src to dst, which must have been created by
+// copyMetric.
+func mergeMetric(dst, src *dto.Metric) {
+	switch {
+	case dst.Counter != nil:
+		*dst.Counter.Value += src.Counter.GetValue()
+	case dst.Gauge != nil:
+		*dst.Gauge.Value += src.Gauge.GetValue()
+	case dst.Untyped != nil:
+		*dst.Untyped.Value += src.Untyped.GetValue()
+	case dst.Summary != nil:
+		*dst.Summary.SampleCount += src.Summary.GetSampleCount()
+		*dst.Summary.SampleSum += src.Summary.GetSampleSum()
+		dst.Summary.Quantile = nil
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRelabeledHandler(t *testing.T) {
+	r := NewRegistry()
+	requests := NewCounterVec(
+		CounterOpts{Name: "requests_total", Help: "Requests."},
+		[]string{"path", "code", "host"},
+	)
+	r.MustRegister(requests)
+	requests.WithLabelValues("/a", "200", "h1").Add(1)
+	requests.WithLabelValues("/b", "200", "h1").Add(2)
+	requests.WithLabelValues("/b", "500", "h1").Add(4)
+	latency := NewSummaryVec(
+		SummaryOpts{Name: "latency_seconds", Help: "Latency."},
+		[]string{"path"},
+	)
+	r.MustRegister(latency)
+	latency.WithLabelValues("/a").Observe(1)
+	latency.WithLabelValues("/b").Observe(2)
+
+	h := RelabeledHandler(r, RelabelConfig{
+		DropLabels:   []string{"path"},
+		RenameLabels: map[string]string{"code": "status"},
+	})
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, &http.Request{URL: &url.URL{Path: "/metrics"}, Header: http.Header{}})
+	body := resp.Body.String()
+
+	for _, want := range []string{
+		`requests_total{host="h1",status="200"} 3`,
+		`requests_total{host="h1",status="500"} 4`,
+		`latency_seconds_sum 3`,
+		`latency_seconds_count 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q:\n%s", want, body)
+		}
+	}
+	for _, lack := range []string{"path=", "code=", "quantile="} {
+		if strings.Contains(body, lack) {
+			t.Errorf("body unexpectedly contains %q:\n%s", lack, body)
+		}
+	}
+
+	// The registry itself is unaffected.
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, &http.Request{URL: &url.URL{Path: "/metrics"}, Header: http.Header{}})
+	if body := resp.Body.String(); !strings.Contains(body, `path="/a"`) {
+		t.Errorf("registry output lacks original labels:\n%s", body)
+	}
+
+	h = RelabeledHandler(r, RelabelConfig{KeepLabels: []string{"code"}})
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, &http.Request{URL: &url.URL{Path: "/metrics"}, Header: http.Header{}})
+	if body := resp.Body.String(); !strings.Contains(body, `requests_total{code="200"} 3`) {
+		t.Errorf("body lacks aggregated counter:\n%s", body)
+	}
+}
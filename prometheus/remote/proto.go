@@ -0,0 +1,162 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/model"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Protobuf wire types and field tags of the remote write protocol:
+//
+//     message WriteRequest { repeated TimeSeries timeseries = 1; }
+//     message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//     message Label        { string name = 1; string value = 2; }
+//     message Sample       { double value = 1; int64 timestamp = 2; }
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+
+	tagWriteRequestTimeSeries = 1<<3 | wireBytes
+	tagTimeSeriesLabels       = 1<<3 | wireBytes
+	tagTimeSeriesSamples      = 2<<3 | wireBytes
+	tagLabelName              = 1<<3 | wireBytes
+	tagLabelValue             = 2<<3 | wireBytes
+	tagSampleValue            = 1<<3 | wireFixed64
+	tagSampleTimestamp        = 2<<3 | wireVarint
+
+	quantileLabel = "quantile"
+)
+
+// timeSeries is a single series with a single sample. Its labels include the
+// metric name (as label "__name__") and are sorted by label name.
+type timeSeries struct {
+	labels      []*dto.LabelPair
+	value       float64
+	timestampMs int64
+}
+
+// toTimeSeries converts the provided MetricFamilies into time series as
+// understood by the remote write protocol. Summaries are split into one series
+// per quantile plus a _sum and a _count series. Metrics without a timestamp get
+// the timestamp nowMs. externalLabels are added to each series unless a series
+// has a label of the same name already.
+func toTimeSeries(mfs []*dto.MetricFamily, externalLabels prometheus.Labels, nowMs int64) []timeSeries {
+	var result []timeSeries
+	add := func(name string, m *dto.Metric, extraName, extraValue string, v float64) {
+		ts := timeSeries{
+			labels:      make([]*dto.LabelPair, 0, len(m.Label)+len(externalLabels)+2),
+			value:       v,
+			timestampMs: nowMs,
+		}
+		if m.TimestampMs != nil {
+			ts.timestampMs = m.GetTimestampMs()
+		}
+		seen := make(map[string]struct{}, len(m.Label)+2)
+		ts.labels = append(ts.labels, &dto.LabelPair{
+			Name:  proto.String(string(model.MetricNameLabel)),
+			Value: proto.String(name),
+		})
+		seen[string(model.MetricNameLabel)] = struct{}{}
+		if extraName != "" {
+			ts.labels = append(ts.labels, &dto.LabelPair{
+				Name:  proto.String(extraName),
+				Value: proto.String(extraValue),
+			})
+			seen[extraName] = struct{}{}
+		}
+		for _, lp := range m.Label {
+			ts.labels = append(ts.labels, lp)
+			seen[lp.GetName()] = struct{}{}
+		}
+		for ln, lv := range externalLabels {
+			if _, ok := seen[ln]; ok {
+				continue
+			}
+			ts.labels = append(ts.labels, &dto.LabelPair{
+				Name:  proto.String(ln),
+				Value: proto.String(lv),
+			})
+		}
+		sort.Sort(prometheus.LabelPairSorter(ts.labels))
+		result = append(result, ts)
+	}
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m, "", "", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m, "", "", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m, "", "", m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.GetSummary().Quantile {
+					add(
+						name, m,
+						quantileLabel, fmt.Sprint(q.GetQuantile()),
+						q.GetValue(),
+					)
+				}
+				add(name+"_sum", m, "", "", m.GetSummary().GetSampleSum())
+				add(name+"_count", m, "", "", float64(m.GetSummary().GetSampleCount()))
+			}
+		}
+	}
+	return result
+}
+
+// marshalWriteRequest encodes the provided time series as a WriteRequest
+// protobuf message.
+func marshalWriteRequest(series []timeSeries) []byte {
+	var (
+		req    = proto.NewBuffer(nil)
+		ts     = proto.NewBuffer(nil)
+		nested = proto.NewBuffer(nil)
+	)
+	for _, s := range series {
+		ts.Reset()
+		for _, lp := range s.labels {
+			nested.Reset()
+			nested.EncodeVarint(tagLabelName)
+			nested.EncodeStringBytes(lp.GetName())
+			nested.EncodeVarint(tagLabelValue)
+			nested.EncodeStringBytes(lp.GetValue())
+			ts.EncodeVarint(tagTimeSeriesLabels)
+			ts.EncodeRawBytes(nested.Bytes())
+		}
+		nested.Reset()
+		nested.EncodeVarint(tagSampleValue)
+		nested.EncodeFixed64(math.Float64bits(s.value))
+		nested.EncodeVarint(tagSampleTimestamp)
+		nested.EncodeVarint(uint64(s.timestampMs))
+		ts.EncodeVarint(tagTimeSeriesSamples)
+		ts.EncodeRawBytes(nested.Bytes())
+
+		req.EncodeVarint(tagWriteRequestTimeSeries)
+		req.EncodeRawBytes(ts.Bytes())
+	}
+	return req.Bytes()
+}
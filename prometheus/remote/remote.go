@@ -0,0 +1,156 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote provides an Exporter that sends metrics directly to a
+// Prometheus-compatible backend via the remote write protocol (snappy-compressed
+// protobuf over HTTP), without the need for a Pushgateway or for being scraped.
+//
+//     e := remote.NewExporter(remote.ExporterOpts{
+//         URL: "http://cortex:9009/api/prom/push",
+//     })
+//     go e.Run(ctx)
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefInterval is the default interval between two writes of Exporter.Run.
+const DefInterval = 15 * time.Second
+
+// ExporterOpts bundles the options for creating an Exporter. It is mandatory to
+// set URL to a non-empty string. All other fields are optional and can safely
+// be left at their zero value.
+type ExporterOpts struct {
+	// URL is the remote write endpoint of the backend. Mandatory!
+	URL string
+
+	// Gatherer provides the metrics to send. The default value is
+	// prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+
+	// Interval is the interval between two writes when the Exporter is
+	// running (see Run). The default value is DefInterval.
+	Interval time.Duration
+
+	// ExternalLabels are added to all sent series (unless a series already
+	// has a label of the same name). As the series are not scraped, there
+	// is no target to attach labels like "job" or "instance" to them, so
+	// they usually have to be provided here.
+	ExternalLabels prometheus.Labels
+
+	// Client is the HTTP client used for sending. The default value is
+	// http.DefaultClient.
+	Client *http.Client
+
+	// ErrorHandler is called with every error encountered by Run. Run
+	// continues with the next interval after an error. If nil, errors are
+	// silently dropped.
+	ErrorHandler func(error)
+}
+
+// Exporter sends metrics of a Gatherer to a remote write endpoint. Create
+// instances with NewExporter.
+type Exporter struct {
+	url            string
+	gatherer       prometheus.Gatherer
+	interval       time.Duration
+	externalLabels prometheus.Labels
+	client         *http.Client
+	errorHandler   func(error)
+}
+
+// NewExporter creates a new Exporter based on the provided ExporterOpts.
+func NewExporter(opts ExporterOpts) *Exporter {
+	e := &Exporter{
+		url:            opts.URL,
+		gatherer:       opts.Gatherer,
+		interval:       opts.Interval,
+		externalLabels: opts.ExternalLabels,
+		client:         opts.Client,
+		errorHandler:   opts.ErrorHandler,
+	}
+	if e.gatherer == nil {
+		e.gatherer = prometheus.DefaultGatherer
+	}
+	if e.interval <= 0 {
+		e.interval = DefInterval
+	}
+	if e.client == nil {
+		e.client = http.DefaultClient
+	}
+	return e
+}
+
+// Write gathers all metrics once and sends them to the remote write endpoint.
+func (e *Exporter) Write(ctx context.Context) error {
+	if e.url == "" {
+		return errors.New("empty remote write URL")
+	}
+	mfs, err := e.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	series := toTimeSeries(mfs, e.externalLabels, time.Now().UnixNano()/int64(time.Millisecond))
+	if len(series) == 0 {
+		return nil
+	}
+	body := snappy.Encode(nil, marshalWriteRequest(series))
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d while writing to %s: %s", resp.StatusCode, e.url, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Run calls Write once per configured interval until ctx is done. Errors are
+// passed to the configured ErrorHandler.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Write(ctx); err != nil && e.errorHandler != nil {
+				e.errorHandler(err)
+			}
+		}
+	}
+}
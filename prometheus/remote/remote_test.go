@@ -0,0 +1,170 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/golang/snappy"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func labelsToMap(lps []*dto.LabelPair) map[string]string {
+	m := map[string]string{}
+	for _, lp := range lps {
+		m[lp.GetName()] = lp.GetValue()
+	}
+	return m
+}
+
+func TestToTimeSeries(t *testing.T) {
+	mfs := []*dto.MetricFamily{
+		{
+			Name: proto.String("requests_total"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{
+				{
+					Label: []*dto.LabelPair{
+						{Name: proto.String("code"), Value: proto.String("200")},
+						{Name: proto.String("job"), Value: proto.String("own")},
+					},
+					Counter:     &dto.Counter{Value: proto.Float64(42)},
+					TimestampMs: proto.Int64(1000),
+				},
+			},
+		},
+		{
+			Name: proto.String("latency"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{
+				{
+					Summary: &dto.Summary{
+						SampleCount: proto.Uint64(3),
+						SampleSum:   proto.Float64(1.5),
+						Quantile: []*dto.Quantile{
+							{Quantile: proto.Float64(0.5), Value: proto.Float64(0.4)},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	series := toTimeSeries(mfs, prometheus.Labels{"job": "ext", "A": "a"}, 2000)
+
+	expected := []struct {
+		labels map[string]string
+		value  float64
+		ts     int64
+	}{
+		{map[string]string{"__name__": "requests_total", "code": "200", "job": "own", "A": "a"}, 42, 1000},
+		{map[string]string{"__name__": "latency", "quantile": "0.5", "job": "ext", "A": "a"}, 0.4, 2000},
+		{map[string]string{"__name__": "latency_sum", "job": "ext", "A": "a"}, 1.5, 2000},
+		{map[string]string{"__name__": "latency_count", "job": "ext", "A": "a"}, 3, 2000},
+	}
+	if len(series) != len(expected) {
+		t.Fatalf("got %d series, want %d", len(series), len(expected))
+	}
+	for i, e := range expected {
+		s := series[i]
+		if got := labelsToMap(s.labels); !reflect.DeepEqual(got, e.labels) {
+			t.Errorf("%d. got labels %v, want %v", i, got, e.labels)
+		}
+		for j := 1; j < len(s.labels); j++ {
+			if s.labels[j-1].GetName() >= s.labels[j].GetName() {
+				t.Errorf("%d. labels not sorted: %v", i, s.labels)
+			}
+		}
+		if s.value != e.value {
+			t.Errorf("%d. got value %v, want %v", i, s.value, e.value)
+		}
+		if s.timestampMs != e.ts {
+			t.Errorf("%d. got timestamp %d, want %d", i, s.timestampMs, e.ts)
+		}
+	}
+}
+
+func TestMarshalWriteRequest(t *testing.T) {
+	got := marshalWriteRequest([]timeSeries{{
+		labels: []*dto.LabelPair{
+			{Name: proto.String("a"), Value: proto.String("b")},
+		},
+		value:       1,
+		timestampMs: 5,
+	}})
+	want := []byte{
+		0x0a, 0x15, // WriteRequest.timeseries, 21 bytes.
+		0x0a, 0x06, // TimeSeries.labels, 6 bytes.
+		0x0a, 0x01, 'a', // Label.name.
+		0x12, 0x01, 'b', // Label.value.
+		0x12, 0x0b, // TimeSeries.samples, 11 bytes.
+		0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // Sample.value (1.0).
+		0x10, 0x05, // Sample.timestamp.
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got\n% x\nwant\n% x", got, want)
+	}
+}
+
+func TestExporterWrite(t *testing.T) {
+	var (
+		lastHeader http.Header
+		lastBody   []byte
+	)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastHeader = r.Header
+		compressed, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastBody, err = snappy.Decode(nil, compressed); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname",
+		Help: "docstring",
+	}))
+	e := NewExporter(ExporterOpts{URL: backend.URL, Gatherer: reg})
+	if err := e.Write(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lastHeader.Get("Content-Encoding"), "snappy"; got != want {
+		t.Errorf("got content encoding %q, want %q", got, want)
+	}
+	if got, want := lastHeader.Get("Content-Type"), "application/x-protobuf"; got != want {
+		t.Errorf("got content type %q, want %q", got, want)
+	}
+	if !bytes.Contains(lastBody, []byte("testname")) {
+		t.Errorf("metric name not found in written request: % x", lastBody)
+	}
+
+	if err := NewExporter(ExporterOpts{Gatherer: reg}).Write(context.Background()); err == nil {
+		t.Error("expected error for empty URL, got none")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.16
+
+package prometheus
+
+import (
+	"math"
+	"runtime/metrics"
+	"strings"
+	"sync"
+)
+
+// runtimeMetricsObjectives are the quantiles reported for histograms of the
+// runtime/metrics package, which are converted to summaries.
+var runtimeMetricsObjectives = []float64{0, 0.5, 0.9, 0.99, 1}
+
+type runtimeMetricsCollector struct {
+	mtx     sync.Mutex // Protects samples.
+	samples []metrics.Sample
+	descs   []*Desc
+	valType []ValueType
+}
+
+// NewRuntimeMetricsCollector returns a collector which exports all metrics
+// supported by the runtime/metrics package of the running Go version, like
+// scheduler latencies, GC cycles by cause, and memory classes. It is
+// available from Go 1.16 on and has to be registered explicitly. It can be
+// registered alongside the collector returned by NewGoCollector, as the
+// metric names do not overlap.
+//
+// The runtime/metrics names are translated into Prometheus metric names: The
+// path and the unit are joined with "_" (with characters not allowed in metric
+// names replaced by "_") and prefixed with "go_". Cumulative metrics become
+// counters with the suffix "_total", all others become gauges. For example,
+// "/gc/cycles/automatic:gc-cycles" becomes
+// "go_gc_cycles_automatic_gc_cycles_total". As this package does not support
+// histograms, runtime/metrics histograms are converted to summaries with the
+// quantiles 0, 0.5, 0.9, 0.99, and 1, which are estimated using the upper
+// bounds of the histogram buckets. The sample sum is estimated using the
+// midpoints of the buckets.
+func NewRuntimeMetricsCollector() *runtimeMetricsCollector {
+	c := &runtimeMetricsCollector{}
+	for _, d := range metrics.All() {
+		var valType ValueType
+		switch d.Kind {
+		case metrics.KindUint64, metrics.KindFloat64:
+			valType = GaugeValue
+			if d.Cumulative {
+				valType = CounterValue
+			}
+		case metrics.KindFloat64Histogram:
+			// Converted to a summary, valType is not used.
+		default:
+			continue
+		}
+		name, ok := runtimeMetricName(d.Name, d.Cumulative && d.Kind != metrics.KindFloat64Histogram)
+		if !ok {
+			continue
+		}
+		c.samples = append(c.samples, metrics.Sample{Name: d.Name})
+		c.descs = append(c.descs, NewDesc(name, d.Description, nil, nil))
+		c.valType = append(c.valType, valType)
+	}
+	return c
+}
+
+// runtimeMetricName translates a runtime/metrics name into a Prometheus metric
+// name. It returns false if the name cannot be translated.
+func runtimeMetricName(name string, counter bool) (string, bool) {
+	i := strings.LastIndex(name, ":")
+	if i < 1 {
+		return "", false
+	}
+	path, unit := name[1:i], name[i+1:]
+	fqName := "go_" + sanitizeRuntimeMetricName(path) + "_" + sanitizeRuntimeMetricName(unit)
+	if counter {
+		fqName += "_total"
+	}
+	return fqName, true
+}
+
+func sanitizeRuntimeMetricName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// Describe returns all descriptions of the collector.
+func (c *runtimeMetricsCollector) Describe(ch chan<- *Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *runtimeMetricsCollector) Collect(ch chan<- Metric) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	metrics.Read(c.samples)
+	for i, s := range c.samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			ch <- MustNewConstMetric(c.descs[i], c.valType[i], float64(s.Value.Uint64()))
+		case metrics.KindFloat64:
+			ch <- MustNewConstMetric(c.descs[i], c.valType[i], s.Value.Float64())
+		case metrics.KindFloat64Histogram:
+			count, sum, quantiles := histogramToSummary(s.Value.Float64Histogram())
+			ch <- MustNewConstSummary(c.descs[i], count, sum, quantiles)
+		}
+	}
+}
+
+// histogramToSummary estimates the count, sum, and the quantiles in
+// runtimeMetricsObjectives of a runtime/metrics histogram.
+func histogramToSummary(h *metrics.Float64Histogram) (uint64, float64, map[float64]float64) {
+	var (
+		count     uint64
+		sum       float64
+		quantiles = make(map[float64]float64, len(runtimeMetricsObjectives))
+	)
+	for i, n := range h.Counts {
+		count += n
+		if n > 0 {
+			sum += float64(n) * bucketMidpoint(h.Buckets[i], h.Buckets[i+1])
+		}
+	}
+	for _, q := range runtimeMetricsObjectives {
+		if count == 0 {
+			quantiles[q] = math.NaN()
+			continue
+		}
+		rank := uint64(math.Ceil(q * float64(count)))
+		if rank == 0 {
+			rank = 1
+		}
+		var cumulative uint64
+		for i, n := range h.Counts {
+			cumulative += n
+			if cumulative >= rank {
+				upper := h.Buckets[i+1]
+				if math.IsInf(upper, 1) {
+					upper = h.Buckets[i]
+				}
+				quantiles[q] = upper
+				break
+			}
+		}
+	}
+	return count, sum, quantiles
+}
+
+// bucketMidpoint returns the midpoint of a bucket, or its finite boundary if
+// the bucket is unbounded on one side.
+func bucketMidpoint(lower, upper float64) float64 {
+	switch {
+	case math.IsInf(lower, -1):
+		return upper
+	case math.IsInf(upper, 1):
+		return lower
+	default:
+		return (lower + upper) / 2
+	}
+}
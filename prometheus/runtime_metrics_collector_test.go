@@ -0,0 +1,86 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.16
+
+package prometheus
+
+import (
+	"math"
+	"reflect"
+	"runtime/metrics"
+	"testing"
+)
+
+func TestRuntimeMetricName(t *testing.T) {
+	scenarios := []struct {
+		in      string
+		counter bool
+		out     string
+	}{
+		{"/gc/cycles/automatic:gc-cycles", true, "go_gc_cycles_automatic_gc_cycles_total"},
+		{"/memory/classes/heap/free:bytes", false, "go_memory_classes_heap_free_bytes"},
+		{"/sched/latencies:seconds", false, "go_sched_latencies_seconds"},
+	}
+	for i, s := range scenarios {
+		got, ok := runtimeMetricName(s.in, s.counter)
+		if !ok || got != s.out {
+			t.Errorf("%d. got %q (ok=%v), want %q", i, got, ok, s.out)
+		}
+	}
+	if _, ok := runtimeMetricName("no-unit", false); ok {
+		t.Error("expected name without unit to be rejected")
+	}
+}
+
+func TestHistogramToSummary(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{1, 8, 0, 1},
+		Buckets: []float64{math.Inf(-1), 1, 2, 4, math.Inf(1)},
+	}
+	count, sum, quantiles := histogramToSummary(h)
+	if count != 10 {
+		t.Errorf("got count %d, want 10", count)
+	}
+	if want := 1*1. + 8*1.5 + 1*4; sum != want {
+		t.Errorf("got sum %v, want %v", sum, want)
+	}
+	wantQuantiles := map[float64]float64{0: 1, 0.5: 2, 0.9: 2, 0.99: 4, 1: 4}
+	if !reflect.DeepEqual(quantiles, wantQuantiles) {
+		t.Errorf("got quantiles %v, want %v", quantiles, wantQuantiles)
+	}
+}
+
+func TestRuntimeMetricsCollector(t *testing.T) {
+	reg := NewRegistry()
+	reg.EnableCollectChecks(true)
+	reg.MustRegister(NewRuntimeMetricsCollector())
+	reg.MustRegister(NewGoCollector())
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]bool{}
+	for _, mf := range mfs {
+		byName[mf.GetName()] = true
+	}
+	for _, name := range []string{
+		"go_gc_cycles_automatic_gc_cycles_total",
+		"go_sched_goroutines_goroutines",
+	} {
+		if !byName[name] {
+			t.Errorf("metric %s not collected", name)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default values for TelemetryServerOpts.
+const (
+	// DefTelemetryPath is the default path the metrics handler is mounted
+	// at.
+	DefTelemetryPath = "/metrics"
+	// DefShutdownTimeout is the default duration Close waits for in-flight
+	// scrapes to complete.
+	DefShutdownTimeout = 5 * time.Second
+)
+
+// TelemetryServerOpts bundles the options for StartTelemetryServer. All fields
+// are optional and can safely be left at their zero value.
+type TelemetryServerOpts struct {
+	// Path is the URL path the metrics handler is mounted at. The default
+	// value is DefTelemetryPath. Requests to any other path are answered
+	// with 404.
+	Path string
+
+	// Handler serves the metrics. The default value is Handler(), i.e. the
+	// instrumented handler of the default registry.
+	Handler http.Handler
+
+	// TLSConfig, if not nil, makes the server serve HTTPS instead of plain
+	// HTTP. The config must provide at least one certificate (either via
+	// Certificates, GetCertificate, or GetConfigForClient). Scrapers are
+	// authenticated mutually if ClientAuth is set to
+	// tls.RequireAndVerifyClientCert. Use a TLSReloader to create a config
+	// from certificate files that can be replaced at runtime.
+	TLSConfig *tls.Config
+
+	// ShutdownTimeout is the duration Close waits for in-flight scrapes to
+	// complete before connections are closed forcefully. The default value
+	// is DefShutdownTimeout.
+	ShutdownTimeout time.Duration
+}
+
+// TelemetryServer is an HTTP server exposing metrics. It is meant for daemons
+// that have no HTTP server of their own. Create instances with
+// StartTelemetryServer.
+type TelemetryServer struct {
+	server          *http.Server
+	listener        net.Listener
+	shutdownTimeout time.Duration
+	done            chan struct{}
+	err             error // Set before done is closed.
+}
+
+// StartTelemetryServer listens on the TCP network address addr and serves
+// metrics in a separate goroutine as configured by opts. It returns once the
+// listener is set up, so that errors like an address already in use are
+// reported right away. Use ":0" as addr to listen on an arbitrary free port
+// (which can be retrieved with the Addr method afterwards).
+//
+// Usage example:
+//
+//     srv, err := prometheus.StartTelemetryServer(":9100", prometheus.TelemetryServerOpts{})
+//     if err != nil {
+//         log.Fatal(err)
+//     }
+//     defer srv.Close()
+func StartTelemetryServer(addr string, opts TelemetryServerOpts) (*TelemetryServer, error) {
+	if opts.Path == "" {
+		opts.Path = DefTelemetryPath
+	}
+	if opts.Handler == nil {
+		opts.Handler = Handler()
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = DefShutdownTimeout
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TLSConfig != nil {
+		listener = tls.NewListener(listener, opts.TLSConfig)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(opts.Path, opts.Handler)
+	s := &TelemetryServer{
+		server: &http.Server{
+			Handler:   mux,
+			TLSConfig: opts.TLSConfig,
+		},
+		listener:        listener,
+		shutdownTimeout: opts.ShutdownTimeout,
+		done:            make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		if err := s.server.Serve(listener); err != http.ErrServerClosed {
+			s.err = err
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns the network address the server is listening on.
+func (s *TelemetryServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Shutdown stops the server gracefully. It stops accepting new connections and
+// waits for in-flight scrapes to complete or for ctx to be done, whichever
+// happens first. It returns the error that made the server stop serving, if
+// any, or the error of ctx if in-flight scrapes could not complete in time.
+func (s *TelemetryServer) Shutdown(ctx context.Context) error {
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.server.Close()
+		return err
+	}
+	<-s.done
+	return s.err
+}
+
+// Close works like Shutdown, but waits for at most the ShutdownTimeout
+// configured in the TelemetryServerOpts.
+func (s *TelemetryServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// TLSReloader loads the certificate of a TelemetryServer and, optionally, the
+// CA certificates to verify the client certificates of scrapers with from PEM
+// files. The files are read again by Reload, e.g. after a certificate has been
+// renewed, without restarting the server. Create instances with
+// NewTLSReloader.
+type TLSReloader struct {
+	certFile, keyFile, clientCAFile string
+
+	mtx    sync.RWMutex
+	config *tls.Config
+}
+
+// NewTLSReloader returns a TLSReloader for the provided files, which are read
+// right away. If clientCAFile is not empty, the config returned by TLSConfig
+// requires and verifies client certificates (mutual TLS).
+//
+// Usage example:
+//
+//     tr, err := prometheus.NewTLSReloader("server.crt", "server.key", "scrapers-ca.crt")
+//     if err != nil {
+//         log.Fatal(err)
+//     }
+//     srv, err := prometheus.StartTelemetryServer(":9100", prometheus.TelemetryServerOpts{
+//         TLSConfig: tr.TLSConfig(),
+//     })
+//     // On SIGHUP:
+//     if err := tr.Reload(); err != nil {
+//         log.Print(err)
+//     }
+func NewTLSReloader(certFile, keyFile, clientCAFile string) (*TLSReloader, error) {
+	r := &TLSReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. Connections established afterwards use the
+// new certificates. If an error is returned, the previous certificates stay in
+// use.
+func (r *TLSReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if r.clientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.clientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.config = config
+	return nil
+}
+
+// TLSConfig returns a config for TelemetryServerOpts.TLSConfig (or any other
+// TLS server) that always uses the most recently loaded certificates.
+func (r *TLSReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mtx.RLock()
+			defer r.mtx.RUnlock()
+			return r.config, nil
+		},
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTelemetryServer(t *testing.T) {
+	srv, err := StartTelemetryServer("127.0.0.1:0", TelemetryServerOpts{
+		Path:    "/telemetry",
+		Handler: respBody("Howdy there!"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + srv.Addr().String()
+
+	resp, err := http.Get(url + "/telemetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.StatusCode, http.StatusTeapot; got != want {
+		t.Errorf("got status %d, want %d", got, want)
+	}
+	if got, want := string(body), "Howdy there!"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+
+	resp, err = http.Get(url + "/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("got status %d, want %d", got, want)
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(url + "/telemetry"); err == nil {
+		t.Error("expected error after Close, got none")
+	}
+}
+
+// testCert creates a certificate for 127.0.0.1 signed by parent (self-signed
+// if parent is nil) and returns it with its key and the PEM encoding of both.
+func testCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestTelemetryServerMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prometheus_tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	ca, caKey, caPEM, _ := testCert(t, nil, nil, true)
+	_, _, serverPEM, serverKeyPEM := testCert(t, ca, caKey, false)
+	_, _, clientPEM, clientKeyPEM := testCert(t, ca, caKey, false)
+	certFile := write("server.crt", serverPEM)
+	keyFile := write("server.key", serverKeyPEM)
+	caFile := write("ca.crt", caPEM)
+
+	tr, err := NewTLSReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := StartTelemetryServer("127.0.0.1:0", TelemetryServerOpts{
+		Handler:   respBody("Howdy there!"),
+		TLSConfig: tr.TLSConfig(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	url := "https://" + srv.Addr().String() + DefTelemetryPath
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(certs ...tls.Certificate) error {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusTeapot; got != want {
+			t.Errorf("got status %d, want %d", got, want)
+		}
+		return nil
+	}
+
+	if err := get(clientCert); err != nil {
+		t.Errorf("scrape with client certificate failed: %s", err)
+	}
+	if err := get(); err == nil {
+		t.Error("scrape without client certificate succeeded")
+	}
+
+	// A failed reload keeps the previous certificates.
+	write("ca.crt", []byte("garbage"))
+	if err := tr.Reload(); err == nil {
+		t.Error("reloading invalid CA file succeeded")
+	}
+	if err := get(clientCert); err != nil {
+		t.Errorf("scrape after failed reload failed: %s", err)
+	}
+
+	// Client certificates of another CA are rejected after a reload.
+	_, _, otherCAPEM, _ := testCert(t, nil, nil, true)
+	write("ca.crt", otherCAPEM)
+	if err := tr.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(clientCert); err == nil {
+		t.Error("scrape with client certificate of replaced CA succeeded")
+	}
+}
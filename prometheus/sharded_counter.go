@@ -0,0 +1,141 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterShard is one stripe of a sharded counter. It is padded to the size of
+// a typical cache line so that shards updated by different CPUs do not share
+// a cache line.
+type counterShard struct {
+	valInt  uint64
+	valBits uint64
+	_       [48]byte
+}
+
+// addFloat atomically adds v to the float part of the shard.
+func (s *counterShard) addFloat(v float64) {
+	for {
+		oldBits := atomic.LoadUint64(&s.valBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
+		if atomic.CompareAndSwapUint64(&s.valBits, oldBits, newBits) {
+			return
+		}
+	}
+}
+
+type shardedCounter struct {
+	SelfCollector
+
+	desc       *Desc
+	labelPairs []*dto.LabelPair
+	shards     []counterShard
+
+	// next assigns shards to the entries of indexes, which hands out shard
+	// indexes with little contention as sync.Pool keeps per-P caches.
+	next    uint32
+	indexes sync.Pool
+}
+
+// NewShardedCounter creates a new Counter based on the provided CounterOpts
+// that spreads its value over the given number of shards, which are added up
+// on collection. If shards is 0 or less, GOMAXPROCS shards are used.
+//
+// A sharded counter is meant for single counters that are incremented from
+// many goroutines in parallel, where even the atomic operations of a regular
+// Counter lead to contention on the cache line holding the value. It uses more
+// memory and is slower to collect than a regular Counter, so only use it where
+// contention has been observed.
+func NewShardedCounter(opts CounterOpts, shards int) Counter {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	desc := newOptsDesc(Opts(opts), nil, dto.MetricType_COUNTER)
+	result := &shardedCounter{
+		desc:       desc,
+		labelPairs: desc.constLabelPairs,
+		shards:     make([]counterShard, shards),
+	}
+	result.indexes.New = func() interface{} {
+		i := int(atomic.AddUint32(&result.next, 1)-1) % len(result.shards)
+		return &i
+	}
+	result.Init(result) // Init self-collection.
+	return result
+}
+
+func (c *shardedCounter) Desc() *Desc {
+	return c.desc
+}
+
+func (c *shardedCounter) shard() *counterShard {
+	i := c.indexes.Get().(*int)
+	s := &c.shards[*i]
+	c.indexes.Put(i)
+	return s
+}
+
+func (c *shardedCounter) Set(v float64) {
+	for i := range c.shards {
+		atomic.StoreUint64(&c.shards[i].valInt, 0)
+		atomic.StoreUint64(&c.shards[i].valBits, 0)
+	}
+	atomic.StoreUint64(&c.shards[0].valBits, math.Float64bits(v))
+}
+
+func (c *shardedCounter) Inc() {
+	if s := c.shard(); !addUint64(&s.valInt, 1) {
+		s.addFloat(1)
+	}
+}
+
+func (c *shardedCounter) Add(v float64) {
+	if v < 0 {
+		handleInstrumentationError(errors.New("counter cannot decrease in value"))
+		return
+	}
+	s := c.shard()
+	if v <= maxExactFloat && v == math.Trunc(v) && addUint64(&s.valInt, uint64(v)) {
+		return
+	}
+	s.addFloat(v)
+}
+
+func (c *shardedCounter) AddMany(vs []float64) {
+	valInt, valFloat := sumCounterValues(vs, handleInstrumentationError)
+	s := c.shard()
+	if valInt != 0 && !addUint64(&s.valInt, valInt) {
+		valFloat += float64(valInt)
+	}
+	if valFloat != 0 {
+		s.addFloat(valFloat)
+	}
+}
+
+func (c *shardedCounter) Write(out *dto.Metric) error {
+	var val float64
+	for i := range c.shards {
+		val += math.Float64frombits(atomic.LoadUint64(&c.shards[i].valBits)) +
+			float64(atomic.LoadUint64(&c.shards[i].valInt))
+	}
+	return populateMetric(CounterValue, val, c.labelPairs, out)
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestShardedCounter(t *testing.T) {
+	c := NewShardedCounter(CounterOpts{
+		Name:        "test",
+		Help:        "test help",
+		ConstLabels: Labels{"a": "1"},
+	}, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Inc()
+				c.Add(0.25)
+				AddMany(c, []float64{2, 0.75})
+			}
+		}()
+	}
+	wg.Wait()
+
+	m := &dto.Metric{}
+	c.Write(m)
+	if expected, got := `label:<name:"a" value:"1" > counter:<value:64000 > `, m.String(); expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	c.Set(3)
+	m.Reset()
+	c.Write(m)
+	if expected, got := 3., m.GetCounter().GetValue(); expected != got {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	func() {
+		PanicOnInstrumentationError(false)
+		defer PanicOnInstrumentationError(true)
+		before := atomic.LoadUint64(&instrumentationErrors)
+		c.Add(-1)
+		AddMany(c, []float64{1, -1})
+		if got, want := atomic.LoadUint64(&instrumentationErrors)-before, uint64(2); got != want {
+			t.Errorf("got %d instrumentation errors, want %d", got, want)
+		}
+		m.Reset()
+		c.Write(m)
+		if expected, got := 4., m.GetCounter().GetValue(); expected != got {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	}()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic when decreasing counter")
+		}
+	}()
+	c.Add(-1)
+}
+
+func TestShardedCounterAddLarge(t *testing.T) {
+	c := NewShardedCounter(CounterOpts{Name: "test", Help: "test help"}, 1)
+	c.Add(1e19)
+	c.Add(1e19)
+	AddMany(c, []float64{1e19, 1e19})
+	m := &dto.Metric{}
+	c.Write(m)
+	if expected, got := 4e19, m.GetCounter().GetValue(); expected != got {
+		t.Errorf("expected %g, got %g", expected, got)
+	}
+}
+
+func BenchmarkShardedCounterInc(b *testing.B) {
+	c := NewShardedCounter(CounterOpts{Name: "test", Help: "test help"}, 0)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc()
+		}
+	})
+}
+
+func BenchmarkCounterIncParallel(b *testing.B) {
+	c := NewCounter(CounterOpts{Name: "test", Help: "test help"})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc()
+		}
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "fmt"
+
+// Stability is the stability level of a metric, see Opts.Stability. Levels are
+// ordered, i.e. StabilityStable > StabilityBeta > StabilityAlpha.
+type Stability int
+
+// Supported stability levels.
+const (
+	// StabilityAlpha metrics may change or disappear at any time. It is
+	// the default.
+	StabilityAlpha Stability = iota
+	// StabilityBeta metrics are not expected to change, but they might
+	// still be changed in an incompatible way with notice.
+	StabilityBeta
+	// StabilityStable metrics only change in a backwards compatible way,
+	// so that it is safe to build alerts on them.
+	StabilityStable
+)
+
+func (s Stability) String() string {
+	switch s {
+	case StabilityAlpha:
+		return "alpha"
+	case StabilityBeta:
+		return "beta"
+	case StabilityStable:
+		return "stable"
+	}
+	return fmt.Sprintf("Stability(%d)", int(s))
+}
@@ -0,0 +1,288 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/matttproud/golang_protobuf_extensions/ext"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// stateRestorer is implemented by metrics whose state can be restored by
+// LoadState.
+type stateRestorer interface {
+	// restoreState adds the values of the provided metric, as written by
+	// SaveState, to the metric.
+	restoreState(*dto.Metric) error
+}
+
+// SaveState writes the values of all counters and the sums and counts of all
+// summaries registered with the default registry to w, so that they can be
+// restored with LoadState after a restart. It is meant for long-lived business
+// counters in single-instance daemons, which should not start from zero after
+// each restart. Call it on shutdown, after the instrumented code has stopped.
+// Gauges, untyped metrics, and metrics injected with
+// SetMetricFamilyInjectionHook are not saved.
+//
+// The state is written as length-delimited MetricFamily protobufs, the format
+// of DelimitedTelemetryContentType.
+func SaveState(w io.Writer) error {
+	return defRegistry.SaveState(w)
+}
+
+// LoadState reads the state written by SaveState from r and adds the saved
+// values to the matching counters and summaries registered with the default
+// registry, creating the children of metric vectors as needed. Call it at
+// startup, after registration and before the instrumented code runs.
+//
+// Quantiles of summaries cannot be restored, they start out empty. Saved
+// metrics that are not registered anymore are skipped, so that metrics can be
+// removed between restarts. A saved metric whose type does not match the
+// registered metric is skipped and reported in the returned error, which is a
+// MultiError if there are several of them.
+func LoadState(r io.Reader) error {
+	return defRegistry.LoadState(r)
+}
+
+// SaveState works like the package-level function of the same name, but for
+// this Registry.
+func (r *Registry) SaveState(w io.Writer) error {
+	return r.writeState(w, false, restorableTypes...)
+}
+
+// restorableTypes are the types of the metrics saved by SaveState.
+var restorableTypes = []dto.MetricType{dto.MetricType_COUNTER, dto.MetricType_SUMMARY}
+
+// writeState writes the registered metric families of the provided types to w
+// as length-delimited protobufs. Quantiles of summaries are left out, and so
+// are help strings unless withHelp is true. The metrics are collected directly
+// rather than with Gather, so that neither the gather hooks run nor metrics
+// with Opts.ResetOnScrape are reset.
+func (r *Registry) writeState(w io.Writer, withHelp bool, types ...dto.MetricType) error {
+	metricFamilies, _, err := r.gather(
+		context.Background(),
+		func() *dto.MetricFamily { return &dto.MetricFamily{} },
+		func() *dto.Metric { return &dto.Metric{} },
+	)
+	if err != nil {
+		return err
+	}
+	for _, mf := range metricFamilies {
+		r.mtx.RLock()
+		_, registered := r.metaByName[mf.GetName()]
+		r.mtx.RUnlock()
+		if !registered || !containsType(types, mf.GetType()) {
+			continue
+		}
+		if mf.GetType() == dto.MetricType_SUMMARY {
+			for _, m := range mf.Metric {
+				m.Summary.Quantile = nil
+			}
+		}
+		if !withHelp {
+			mf.Help = nil
+		}
+		if _, err := ext.WriteDelimited(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsType(types []dto.MetricType, t dto.MetricType) bool {
+	for _, tt := range types {
+		if tt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadState works like the package-level function of the same name, but for
+// this Registry.
+func (r *Registry) LoadState(rd io.Reader) error {
+	// Index the registered metrics by name and labels, and the registered
+	// metric vectors by name. Vectors with the same name are told apart by
+	// their const labels, see stateVec.matches.
+	metrics := map[string]stateRestorer{}
+	vecs := map[string][]stateVec{}
+	r.mtx.RLock()
+	for _, c := range r.collectorsByID {
+		switch c := c.(type) {
+		case interface {
+			Metric
+			stateRestorer
+		}:
+			desc := c.Desc()
+			metrics[stateKey(desc.fqName, desc.constLabelPairs)] = c
+		case interface{ metricVec() *MetricVec }:
+			typ, ok := vecType(c)
+			if !ok {
+				continue
+			}
+			vec := c.metricVec()
+			vecs[vec.desc.fqName] = append(vecs[vec.desc.fqName], stateVec{vec, typ})
+		}
+	}
+	r.mtx.RUnlock()
+
+	var errs MultiError
+	for {
+		mf := &dto.MetricFamily{}
+		if _, err := ext.ReadDelimited(rd, mf); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		name := mf.GetName()
+		mismatched := map[*MetricVec]bool{}
+		for _, m := range mf.Metric {
+			restorer := metrics[stateKey(name, m.Label)]
+			if restorer == nil {
+				sv, ok := findStateVec(vecs[name], m)
+				if !ok {
+					continue
+				}
+				if sv.typ != mf.GetType() {
+					if !mismatched[sv.vec] {
+						mismatched[sv.vec] = true
+						errs = append(errs, fmt.Errorf(
+							"cannot restore state of %s: saved metric family is a %s, registered one is a %s",
+							name, mf.GetType(), sv.typ,
+						))
+					}
+					continue
+				}
+				if !containsType(restorableTypes, sv.typ) {
+					continue
+				}
+				child, err := sv.vec.GetMetricWith(sv.vec.variableLabels(m))
+				if err != nil {
+					errs = append(errs, fmt.Errorf("cannot restore state of %s: %s", name, err))
+					continue
+				}
+				restorer = child.(stateRestorer)
+			}
+			if err := restorer.restoreState(m); err != nil {
+				errs = append(errs, fmt.Errorf("cannot restore state of %s: %s", name, err))
+			}
+		}
+	}
+	return errs.MaybeUnwrap()
+}
+
+// stateVec is a registered metric vector together with the type of its
+// metrics.
+type stateVec struct {
+	vec *MetricVec
+	typ dto.MetricType
+}
+
+// matches returns whether the provided saved metric has all the const labels
+// of the vector.
+func (sv stateVec) matches(m *dto.Metric) bool {
+	for _, clp := range sv.vec.desc.constLabelPairs {
+		found := false
+		for _, lp := range m.Label {
+			if lp.GetName() == clp.GetName() {
+				found = lp.GetValue() == clp.GetValue()
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// findStateVec returns the vector in svs the provided saved metric belongs to.
+func findStateVec(svs []stateVec, m *dto.Metric) (stateVec, bool) {
+	for _, sv := range svs {
+		if sv.matches(m) {
+			return sv, true
+		}
+	}
+	return stateVec{}, false
+}
+
+// vecType returns the type of the metrics in the provided metric vector. It
+// returns false for vectors whose type is unknown.
+func vecType(c interface{}) (dto.MetricType, bool) {
+	switch c.(type) {
+	case *CounterVec:
+		return dto.MetricType_COUNTER, true
+	case *SummaryVec:
+		return dto.MetricType_SUMMARY, true
+	case *GaugeVec:
+		return dto.MetricType_GAUGE, true
+	case *UntypedVec:
+		return dto.MetricType_UNTYPED, true
+	}
+	return 0, false
+}
+
+// stateKey returns a key identifying a metric by its name and label pairs.
+func stateKey(name string, labelPairs []*dto.LabelPair) string {
+	key := name
+	for _, lp := range labelPairs {
+		key += "\xff" + lp.GetName() + "\xff" + lp.GetValue()
+	}
+	return key
+}
+
+// metricVec returns m. It allows to get hold of the MetricVec embedded in the
+// typed metric vectors.
+func (m *MetricVec) metricVec() *MetricVec {
+	return m
+}
+
+// variableLabels returns the labels of the provided metric that are not const
+// labels of m.
+func (m *MetricVec) variableLabels(metric *dto.Metric) Labels {
+	labels := make(Labels, len(metric.Label))
+	for _, lp := range metric.Label {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	for _, lp := range m.desc.constLabelPairs {
+		delete(labels, lp.GetName())
+	}
+	return labels
+}
+
+func (c *counter) restoreState(m *dto.Metric) error {
+	if m.Counter == nil {
+		return fmt.Errorf("saved metric %s is not a counter", m)
+	}
+	if v := m.Counter.GetValue(); v > 0 {
+		c.Add(v)
+	}
+	return nil
+}
+
+func (s *summary) restoreState(m *dto.Metric) error {
+	if m.Summary == nil {
+		return fmt.Errorf("saved metric %s is not a summary", m)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.sum += m.Summary.GetSampleSum()
+	s.cnt += m.Summary.GetSampleCount()
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSaveAndLoadState(t *testing.T) {
+	newMetrics := func() (*Registry, Counter, *CounterVec, *SummaryVec, Gauge) {
+		r := newRegistry()
+		c := NewCounter(CounterOpts{
+			Name:        "orders_total",
+			Help:        "Orders.",
+			ConstLabels: Labels{"shop": "main"},
+		})
+		cv := NewCounterVec(CounterOpts{
+			Name:        "payments_total",
+			Help:        "Payments.",
+			ConstLabels: Labels{"shop": "main"},
+		}, []string{"method"})
+		sv := NewSummaryVec(SummaryOpts{Name: "order_value", Help: "Order values."}, []string{"currency"})
+		g := NewGauge(GaugeOpts{Name: "open_orders", Help: "Open orders."})
+		r.MustRegister(c)
+		r.MustRegister(cv)
+		r.MustRegister(sv)
+		r.MustRegister(g)
+		return r, c, cv, sv, g
+	}
+
+	r, c, cv, sv, g := newMetrics()
+	c.Add(3)
+	cv.WithLabelValues("card").Add(2.5)
+	sv.WithLabelValues("EUR").Observe(10)
+	sv.WithLabelValues("EUR").Observe(20)
+	g.Set(7)
+	var state bytes.Buffer
+	if err := r.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	r, c, cv, sv, g = newMetrics()
+	c.Inc() // Counted before the state is loaded.
+	if err := r.LoadState(bytes.NewReader(state.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			values[mf.GetName()] = m.String()
+		}
+	}
+	for name, want := range map[string]string{
+		"orders_total":   "value:4",
+		"payments_total": "value:2.5",
+		"order_value":    "sample_count:2 sample_sum:30",
+		"open_orders":    "value:0",
+	} {
+		if !strings.Contains(values[name], want) {
+			t.Errorf("%s: got %s, want it to contain %q", name, values[name], want)
+		}
+	}
+}
+
+func TestLoadStateTypeMismatch(t *testing.T) {
+	r := newRegistry()
+	r.MustRegister(NewCounter(CounterOpts{Name: "things", Help: "Things."}))
+	var state bytes.Buffer
+	if err := r.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	r = newRegistry()
+	r.MustRegister(NewSummary(SummaryOpts{Name: "things", Help: "Things."}))
+	if err := r.LoadState(bytes.NewReader(state.Bytes())); err == nil {
+		t.Error("loading a counter into a summary succeeded")
+	}
+
+	// A vector of the wrong type reports the mismatch without getting any
+	// children.
+	r = newRegistry()
+	cv := NewCounterVec(CounterOpts{Name: "vec_things", Help: "Things."}, []string{"kind"})
+	r.MustRegister(cv)
+	cv.WithLabelValues("a").Inc()
+	state.Reset()
+	if err := r.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	r = newRegistry()
+	gv := NewGaugeVec(GaugeOpts{Name: "vec_things", Help: "Things."}, []string{"kind"})
+	r.MustRegister(gv)
+	if err := r.LoadState(bytes.NewReader(state.Bytes())); err == nil {
+		t.Error("loading a counter vector into a gauge vector succeeded")
+	}
+	if n := gv.numChildren; n != 0 {
+		t.Errorf("got %d children of the gauge vector, want 0", n)
+	}
+
+	// Metrics not registered anymore are skipped.
+	if err := newRegistry().LoadState(bytes.NewReader(state.Bytes())); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadStateConstLabels(t *testing.T) {
+	newVecs := func() (*Registry, *CounterVec, *CounterVec) {
+		r := newRegistry()
+		eu := NewCounterVec(CounterOpts{
+			Name:        "logins_total",
+			Help:        "Logins.",
+			ConstLabels: Labels{"region": "eu"},
+		}, []string{"method"})
+		us := NewCounterVec(CounterOpts{
+			Name:        "logins_total",
+			Help:        "Logins.",
+			ConstLabels: Labels{"region": "us"},
+		}, []string{"method"})
+		r.MustRegister(eu)
+		r.MustRegister(us)
+		return r, eu, us
+	}
+
+	r, eu, us := newVecs()
+	eu.WithLabelValues("password").Add(2)
+	us.WithLabelValues("password").Add(5)
+	var state bytes.Buffer
+	if err := r.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	r, eu, us = newVecs()
+	if err := r.LoadState(bytes.NewReader(state.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		vec  *CounterVec
+		want string
+	}{{eu, "value:2"}, {us, "value:5"}} {
+		m := &dto.Metric{}
+		if err := tc.vec.WithLabelValues("password").Write(m); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(m.String(), tc.want) {
+			t.Errorf("got %s, want it to contain %q", m, tc.want)
+		}
+	}
+}
+
+func TestSaveStateWithoutSideEffects(t *testing.T) {
+	r := newRegistry()
+	c := NewCounter(CounterOpts{Name: "jobs_total", Help: "Jobs.", ResetOnScrape: true})
+	r.MustRegister(c)
+	hooks := 0
+	r.OnBeforeGather(func(context.Context) { hooks++ })
+	r.OnAfterGather(func(context.Context, error) { hooks++ })
+	c.Add(3)
+
+	var state bytes.Buffer
+	if err := r.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	if hooks != 0 {
+		t.Errorf("got %d gather hook calls, want 0", hooks)
+	}
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Counter.GetValue(); got != 3 {
+		t.Errorf("got counter value %v after SaveState, want 3", got)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statsd provides a Bridge that accepts metrics in the StatsD line
+// format (via UDP or TCP) and exposes them as Prometheus metrics. It allows
+// legacy code instrumented with StatsD to be scraped without running a separate
+// exporter process:
+//
+//     b := statsd.NewBridge(statsd.BridgeOpts{})
+//     go func() {
+//         log.Fatal(b.ListenAndServeUDP(":8125"))
+//     }()
+//     http.Handle("/metrics", prometheus.Handler())
+//
+// StatsD counters ("c") are mapped to Prometheus counters, gauges ("g") to
+// gauges, and timers ("ms") and histograms ("h") to summaries. Timer values
+// are converted from milliseconds to seconds. StatsD sets ("s") are not
+// supported. Characters in StatsD metric names that are not allowed in
+// Prometheus metric names (like ".") are replaced by "_".
+package statsd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefHelp is the default help string of metrics created by the Bridge.
+const DefHelp = "Metric autogenerated by the StatsD bridge."
+
+const maxPacketSize = 65535
+
+// BridgeOpts bundles the options for creating a Bridge. All fields are optional
+// and can safely be left at their zero value.
+type BridgeOpts struct {
+	// Register is called to register each newly created metric. The
+	// default value is prometheus.Register, i.e. metrics are exposed via
+	// the default registry. Use the Register method of a
+	// prometheus.Registry to expose the metrics via that registry instead.
+	Register func(prometheus.Collector) error
+
+	// Namespace is prepended (separated by "_") to the names of all
+	// created metrics.
+	Namespace string
+
+	// Help is the help string of all created metrics. The default value
+	// is DefHelp.
+	Help string
+
+	// Objectives are the quantile objectives of the summaries created for
+	// timers and histograms. The default value is
+	// prometheus.DefObjectives.
+	Objectives map[float64]float64
+
+	// ErrorHandler is called with every error encountered while processing
+	// lines received by ServeUDP or ServeTCP, e.g. malformed lines. The
+	// processing continues with the next line. If nil, errors are silently
+	// dropped.
+	ErrorHandler func(error)
+}
+
+type metricKind int
+
+const (
+	counterKind metricKind = iota
+	gaugeKind
+	summaryKind
+)
+
+// metric is a metric created by the Bridge.
+type metric struct {
+	kind    metricKind
+	counter *prometheus.CounterVec
+	gauge   *prometheus.GaugeVec
+	summary *prometheus.SummaryVec
+}
+
+// Bridge maps StatsD lines onto Prometheus metrics. Create instances with
+// NewBridge. A Bridge is safe to be used concurrently.
+type Bridge struct {
+	opts BridgeOpts
+
+	mtx     sync.Mutex
+	metrics map[string]*metric
+}
+
+// NewBridge creates a new Bridge based on the provided BridgeOpts.
+func NewBridge(opts BridgeOpts) *Bridge {
+	if opts.Register == nil {
+		opts.Register = prometheus.Register
+	}
+	if opts.Help == "" {
+		opts.Help = DefHelp
+	}
+	return &Bridge{
+		opts:    opts,
+		metrics: map[string]*metric{},
+	}
+}
+
+// ListenAndServeUDP listens on the UDP network address addr and then calls
+// ServeUDP.
+func (b *Bridge) ListenAndServeUDP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return b.ServeUDP(conn)
+}
+
+// ServeUDP reads packets from conn and processes each line in them. It returns
+// only if reading from conn fails, e.g. because conn has been closed.
+func (b *Bridge) ServeUDP(conn net.PacketConn) error {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		b.handleLines(string(buf[:n]))
+	}
+}
+
+// ListenAndServeTCP listens on the TCP network address addr and then calls
+// ServeTCP.
+func (b *Bridge) ListenAndServeTCP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return b.ServeTCP(l)
+}
+
+// ServeTCP accepts connections on l and processes the newline-separated lines
+// received on each of them. It returns only if accepting fails, e.g. because l
+// has been closed.
+func (b *Bridge) ServeTCP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				b.handleLines(scanner.Text())
+			}
+			if err := scanner.Err(); err != nil {
+				b.handleError(err)
+			}
+		}()
+	}
+}
+
+func (b *Bridge) handleLines(lines string) {
+	for _, line := range strings.Split(lines, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := b.Handle(line); err != nil {
+			b.handleError(err)
+		}
+	}
+}
+
+func (b *Bridge) handleError(err error) {
+	if b.opts.ErrorHandler != nil {
+		b.opts.ErrorHandler(err)
+	}
+}
+
+// Handle processes a single StatsD line of the form
+//
+//     <name>:<value>|<type>[|@<sample rate>]
+//
+// The name ends at the first ":", so further fields (like the tags of the
+// DogStatsD extension, which are ignored) may contain colons. Counter
+// increments are divided by the sample rate. Gauge values with a leading "+"
+// or "-" are applied as a delta to the current value.
+func (b *Bridge) Handle(line string) error {
+	colon := strings.Index(line, ":")
+	if colon < 1 {
+		return fmt.Errorf("malformed StatsD line %q", line)
+	}
+	name := sanitizeName(line[:colon])
+	fields := strings.Split(line[colon+1:], "|")
+	if len(fields) < 2 {
+		return fmt.Errorf("malformed StatsD line %q", line)
+	}
+	valueStr, typ := fields[0], fields[1]
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		return fmt.Errorf("invalid value in StatsD line %q: %s", line, err)
+	}
+	rate := 1.
+	for _, f := range fields[2:] {
+		if strings.HasPrefix(f, "@") {
+			rate, err = strconv.ParseFloat(f[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return fmt.Errorf("invalid sample rate in StatsD line %q", line)
+			}
+		}
+	}
+
+	switch typ {
+	case "c":
+		if value < 0 {
+			return fmt.Errorf("negative counter increment in StatsD line %q", line)
+		}
+		m, err := b.getMetric(name, counterKind)
+		if err != nil {
+			return err
+		}
+		m.counter.WithLabelValues().Add(value / rate)
+	case "g":
+		m, err := b.getMetric(name, gaugeKind)
+		if err != nil {
+			return err
+		}
+		g := m.gauge.WithLabelValues()
+		if valueStr[0] == '+' || valueStr[0] == '-' {
+			g.Add(value)
+		} else {
+			g.Set(value)
+		}
+	case "ms", "h":
+		if typ == "ms" {
+			value /= 1000
+		}
+		m, err := b.getMetric(name, summaryKind)
+		if err != nil {
+			return err
+		}
+		m.summary.WithLabelValues().Observe(value)
+	default:
+		return fmt.Errorf("unsupported metric type %q in StatsD line %q", typ, line)
+	}
+	return nil
+}
+
+// getMetric returns the metric with the provided name, creating and
+// registering it if it does not exist yet.
+func (b *Bridge) getMetric(name string, kind metricKind) (*metric, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if m, ok := b.metrics[name]; ok {
+		if m.kind != kind {
+			return nil, fmt.Errorf("StatsD metric %q received with conflicting types", name)
+		}
+		return m, nil
+	}
+
+	m := &metric{kind: kind}
+	var c prometheus.Collector
+	switch kind {
+	case counterKind:
+		m.counter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: b.opts.Namespace,
+			Name:      name,
+			Help:      b.opts.Help,
+		}, nil)
+		c = m.counter
+	case gaugeKind:
+		m.gauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: b.opts.Namespace,
+			Name:      name,
+			Help:      b.opts.Help,
+		}, nil)
+		c = m.gauge
+	case summaryKind:
+		m.summary = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:  b.opts.Namespace,
+			Name:       name,
+			Help:       b.opts.Help,
+			Objectives: b.opts.Objectives,
+		}, nil)
+		c = m.summary
+	}
+	if err := b.opts.Register(c); err != nil {
+		return nil, fmt.Errorf("could not register StatsD metric %q: %s", name, err)
+	}
+	b.metrics[name] = m
+	return m, nil
+}
+
+// sanitizeName replaces all characters not allowed in a Prometheus metric name
+// by "_".
+func sanitizeName(name string) string {
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,165 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func gatherByName(t *testing.T, reg *prometheus.Registry) map[string]*dto.MetricFamily {
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]*dto.MetricFamily{}
+	for _, mf := range mfs {
+		byName[mf.GetName()] = mf
+	}
+	return byName
+}
+
+func TestHandle(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	b := NewBridge(BridgeOpts{Register: reg.Register, Namespace: "legacy"})
+
+	for _, line := range []string{
+		"api.requests:1|c",
+		"api.requests:2|c|@0.5",
+		"api.requests:1|c|#env:prod,region:eu",
+		"queue.size:10|g",
+		"queue.size:-3|g",
+		"queue.size:+1|g",
+		"db.query:250|ms",
+		"payload:42|h",
+	} {
+		if err := b.Handle(line); err != nil {
+			t.Errorf("line %q: unexpected error: %s", line, err)
+		}
+	}
+	for _, line := range []string{
+		"no_value",
+		"api.requests:x|c",
+		"api.requests:1",
+		"api.requests:-1|c",
+		"api.requests:1|c|@2",
+		"api.requests:1|g", // Conflicting type.
+		"users:42|s",
+	} {
+		if err := b.Handle(line); err == nil {
+			t.Errorf("line %q: expected error, got none", line)
+		}
+	}
+
+	mfs := gatherByName(t, reg)
+	if got, want := mfs["legacy_api_requests"].GetMetric()[0].GetCounter().GetValue(), 6.; got != want {
+		t.Errorf("got counter value %v, want %v", got, want)
+	}
+	if got, want := mfs["legacy_queue_size"].GetMetric()[0].GetGauge().GetValue(), 8.; got != want {
+		t.Errorf("got gauge value %v, want %v", got, want)
+	}
+	if got, want := mfs["legacy_db_query"].GetMetric()[0].GetSummary().GetSampleSum(), .25; got != want {
+		t.Errorf("got timer sum %v, want %v", got, want)
+	}
+	if got, want := mfs["legacy_payload"].GetMetric()[0].GetSummary().GetSampleSum(), 42.; got != want {
+		t.Errorf("got histogram sum %v, want %v", got, want)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	scenarios := []struct{ in, out string }{
+		{"foo.bar", "foo_bar"},
+		{"foo-bar baz", "foo_bar_baz"},
+		{"1st", "_1st"},
+		{"ok:name_42", "ok:name_42"},
+	}
+	for i, s := range scenarios {
+		if got := sanitizeName(s.in); got != s.out {
+			t.Errorf("%d. got %q, want %q", i, got, s.out)
+		}
+	}
+}
+
+func TestServeUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reg := prometheus.NewRegistry()
+	errs := make(chan error, 1)
+	b := NewBridge(BridgeOpts{
+		Register:     reg.Register,
+		ErrorHandler: func(err error) { errs <- err },
+	})
+	go b.ServeUDP(conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("hits:3|c\nbroken\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("malformed line not reported")
+	}
+	if got, want := gatherByName(t, reg)["hits"].GetMetric()[0].GetCounter().GetValue(), 3.; got != want {
+		t.Errorf("got counter value %v, want %v", got, want)
+	}
+}
+
+func TestServeTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	reg := prometheus.NewRegistry()
+	errs := make(chan error, 1)
+	b := NewBridge(BridgeOpts{
+		Register:     reg.Register,
+		ErrorHandler: func(err error) { errs <- err },
+	})
+	go b.ServeTCP(l)
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("temperature:21.5|g\nbroken\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("malformed line not reported")
+	}
+	if got, want := gatherByName(t, reg)["temperature"].GetMetric()[0].GetGauge().GetValue(), 21.5; got != want {
+		t.Errorf("got gauge value %v, want %v", got, want)
+	}
+}
@@ -14,8 +14,8 @@
 package prometheus
 
 import (
+	"context"
 	"fmt"
-	"hash/fnv"
 	"sort"
 	"sync"
 	"time"
@@ -25,6 +25,7 @@ import (
 	dto "github.com/prometheus/client_model/go"
 
 	"github.com/prometheus/client_golang/_vendor/perks/quantile"
+	"github.com/prometheus/client_golang/model"
 )
 
 // A Summary captures individual observations from an event or sample stream and
@@ -44,6 +45,32 @@ type Summary interface {
 	Observe(float64)
 }
 
+// BatchSummary is a Summary that can add many observations at once. All
+// Summaries created by this package implement it. Use the function
+// ObserveMany to add many observations to any Summary.
+type BatchSummary interface {
+	Summary
+
+	// ObserveMany adds all provided observations to the summary. It is
+	// equivalent to calling Observe for each of them, but much cheaper for
+	// producers that aggregate observations locally and flush them
+	// periodically, as locks are taken only once.
+	ObserveMany([]float64)
+}
+
+// ObserveMany adds all provided observations to s, with a single call of
+// ObserveMany if s is a BatchSummary, or else by calling Observe for each of
+// them.
+func ObserveMany(s Summary, vs []float64) {
+	if bs, ok := s.(BatchSummary); ok {
+		bs.ObserveMany(vs)
+		return
+	}
+	for _, v := range vs {
+		s.Observe(v)
+	}
+}
+
 // DefObjectives are the default Summary quantile values.
 var (
 	DefObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
@@ -74,12 +101,30 @@ type SummaryOpts struct {
 	Subsystem string
 	Name      string
 
+	// FQName has the same meaning as in Opts.
+	FQName string
+
 	// Help provides information about this Summary. Mandatory!
 	//
 	// Metrics with the same fully-qualified name must have the same Help
 	// string.
 	Help string
 
+	// HelpExposure has the same meaning as in Opts.
+	HelpExposure HelpExposure
+
+	// Debug has the same meaning as in Opts.
+	Debug bool
+
+	// Stability has the same meaning as in Opts.
+	Stability Stability
+
+	// Deprecation has the same meaning as in Opts.
+	Deprecation *Deprecation
+
+	// Unit has the same meaning as in Opts.
+	Unit Unit
+
 	// ConstLabels are used to attach fixed labels to this
 	// Summary. Summaries with the same fully-qualified name must have the
 	// same label names in their ConstLabels.
@@ -99,6 +144,22 @@ type SummaryOpts struct {
 	// metric name).
 	ConstLabels Labels
 
+	// SanitizeLabelValues has the same meaning as in Opts.
+	SanitizeLabelValues bool
+
+	// MaxChildren and OverflowPolicy have the same meaning as in Opts.
+	MaxChildren    int
+	OverflowPolicy OverflowPolicy
+
+	// DefaultLabelValues has the same meaning as in Opts.
+	DefaultLabelValues Labels
+
+	// LabelValueNormalizers has the same meaning as in Opts.
+	LabelValueNormalizers map[string]func(string) string
+
+	// ExpectedChildren has the same meaning as in Opts.
+	ExpectedChildren int
+
 	// Objectives defines the quantile rank estimates with their respective
 	// absolute error. The default value is DefObjectives.
 	Objectives map[float64]float64
@@ -123,6 +184,37 @@ type SummaryOpts struct {
 	// Epsilon is the error epsilon for the quantile rank estimate. Must be
 	// positive. The default is DefEpsilon.
 	Epsilon float64
+
+	// Clock provides the time for the sliding time window defined by
+	// MaxAge and AgeBuckets. The default is SystemClock.
+	Clock Clock
+
+	// SampleBuffer, if positive, makes each Summary remember the last
+	// SampleBuffer raw observations in a ring buffer. They are not
+	// exposed to Prometheus but can be retrieved with RecentSamples or
+	// served by a SamplesHandler, which helps to find out which
+	// observations are behind a suspicious quantile. The buffer costs
+	// some memory per child and a few instructions per observation, so
+	// it is disabled by default.
+	SampleBuffer int
+}
+
+// descOpts returns the fields of opts that determine the Desc of a Summary as
+// Opts.
+func (opts SummaryOpts) descOpts() Opts {
+	return Opts{
+		Namespace:    opts.Namespace,
+		Subsystem:    opts.Subsystem,
+		Name:         opts.Name,
+		FQName:       opts.FQName,
+		Help:         opts.Help,
+		HelpExposure: opts.HelpExposure,
+		Debug:        opts.Debug,
+		Stability:    opts.Stability,
+		Deprecation:  opts.Deprecation,
+		Unit:         opts.Unit,
+		ConstLabels:  opts.ConstLabels,
+	}
 }
 
 // TODO: Great fuck-up with the sliding-window decay algorithm... The Merge
@@ -140,17 +232,15 @@ type SummaryOpts struct {
 // on scrape time (see code up commit 6b9530d72ea715f0ba612c0120e6e09fbf1d49d0)
 // can't be used anymore.
 
-// NewSummary creates a new Summary based on the provided SummaryOpts.
+// NewSummary creates a new Summary based on the provided SummaryOpts. A
+// constant label named "quantile" is reserved for the exposition of the
+// quantiles and results in an invalid Summary, and so does one named "le",
+// which is reserved for the buckets of histograms.
 func NewSummary(opts SummaryOpts) Summary {
-	return newSummary(
-		NewDesc(
-			BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-			opts.Help,
-			nil,
-			opts.ConstLabels,
-		),
-		opts,
-	)
+	desc := newOptsDesc(opts.descOpts(), nil, dto.MetricType_SUMMARY)
+	desc.checkReservedLabelName(model.QuantileLabel)
+	desc.checkReservedLabelName(model.BucketLabel)
+	return newSummary(desc, opts)
 }
 
 func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
@@ -177,6 +267,10 @@ func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
 		opts.BufCap = DefBufCap
 	}
 
+	if opts.SampleBuffer < 0 {
+		panic(fmt.Errorf("illegal sample buffer size SampleBuffer=%d", opts.SampleBuffer))
+	}
+
 	s := &summary{
 		desc: desc,
 
@@ -189,7 +283,14 @@ func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
 		coldBuf:        make([]float64, 0, opts.BufCap),
 		streamDuration: opts.MaxAge / time.Duration(opts.AgeBuckets),
 	}
-	s.headStreamExpTime = time.Now().Add(s.streamDuration)
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	s.clock = opts.Clock
+	if opts.SampleBuffer > 0 {
+		s.samples = newSampleRing(opts.SampleBuffer)
+	}
+	s.headStreamExpTime = s.clock.Now().Add(s.streamDuration)
 	s.hotBufExpTime = s.headStreamExpTime
 
 	for i := uint32(0); i < opts.AgeBuckets; i++ {
@@ -209,7 +310,7 @@ func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
 type summary struct {
 	SelfCollector
 
-	bufMtx sync.Mutex // Protects hotBuf and hotBufExpTime.
+	bufMtx sync.Mutex // Protects hotBuf, hotBufExpTime, and samples.
 	mtx    sync.Mutex // Protects every other moving part.
 	// Lock bufMtx before mtx if both are needed.
 
@@ -230,6 +331,10 @@ type summary struct {
 	headStream                       *quantile.Stream
 	headStreamIdx                    int
 	headStreamExpTime, hotBufExpTime time.Time
+
+	samples *sampleRing // nil unless SampleBuffer is set.
+
+	clock Clock
 }
 
 func (s *summary) Desc() *Desc {
@@ -240,16 +345,48 @@ func (s *summary) Observe(v float64) {
 	s.bufMtx.Lock()
 	defer s.bufMtx.Unlock()
 
-	now := time.Now()
+	now := s.clock.Now()
 	if now.After(s.hotBufExpTime) {
 		s.asyncFlush(now)
 	}
 	s.hotBuf = append(s.hotBuf, v)
+	if s.samples != nil {
+		s.samples.add(v)
+	}
 	if len(s.hotBuf) == cap(s.hotBuf) {
 		s.asyncFlush(now)
 	}
 }
 
+func (s *summary) ObserveMany(vs []float64) {
+	if len(vs) == 0 {
+		return
+	}
+	s.bufMtx.Lock()
+	defer s.bufMtx.Unlock()
+
+	now := s.clock.Now()
+	if now.After(s.hotBufExpTime) {
+		s.asyncFlush(now)
+	}
+	if s.samples != nil {
+		for _, v := range vs {
+			s.samples.add(v)
+		}
+	}
+	for len(vs) > 0 {
+		n := cap(s.hotBuf) - len(s.hotBuf)
+		if n > len(vs) {
+			n = len(vs)
+		}
+		s.hotBuf = append(s.hotBuf, vs[:n]...)
+		vs = vs[n:]
+		if len(s.hotBuf) == cap(s.hotBuf) {
+			s.asyncFlush(now)
+		}
+	}
+}
+
 func (s *summary) Write(out *dto.Metric) error {
 	sum := &dto.Summary{}
 	qs := make([]*dto.Quantile, 0, len(s.objectives))
@@ -258,7 +395,7 @@ func (s *summary) Write(out *dto.Metric) error {
 	s.mtx.Lock()
 
 	if len(s.hotBuf) != 0 {
-		s.swapBufs(time.Now())
+		s.swapBufs(s.clock.Now())
 	}
 	s.bufMtx.Unlock()
 
@@ -366,19 +503,21 @@ type SummaryVec struct {
 
 // NewSummaryVec creates a new SummaryVec based on the provided SummaryOpts and
 // partitioned by the given label names. At least one label name must be
-// provided.
+// provided. The label names "quantile" and "le" are reserved (see
+// NewSummary).
 func NewSummaryVec(opts SummaryOpts, labelNames []string) *SummaryVec {
-	desc := NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		labelNames,
-		opts.ConstLabels,
-	)
+	desc := newOptsDesc(opts.descOpts(), labelNames, dto.MetricType_SUMMARY)
+	desc.checkReservedLabelName(model.QuantileLabel)
+	desc.checkReservedLabelName(model.BucketLabel)
 	return &SummaryVec{
 		MetricVec: MetricVec{
-			children: map[uint64]Metric{},
-			desc:     desc,
-			hash:     fnv.New64a(),
+			desc:             desc,
+			sanitize:         opts.SanitizeLabelValues,
+			maxChildren:      opts.MaxChildren,
+			overflow:         opts.OverflowPolicy,
+			defaults:         opts.DefaultLabelValues,
+			normalizers:      opts.LabelValueNormalizers,
+			expectedChildren: opts.ExpectedChildren,
 			newMetric: func(lvs ...string) Metric {
 				return newSummary(desc, opts, lvs...)
 			},
@@ -408,6 +547,28 @@ func (m *SummaryVec) GetMetricWith(labels Labels) (Summary, error) {
 	return nil, err
 }
 
+// GetOrCreateMetricWithLabelValues replaces the method of the same name in
+// MetricVec. The difference is that this method returns a Summary and not a
+// Metric so that no type conversion is required.
+func (m *SummaryVec) GetOrCreateMetricWithLabelValues(lvs ...string) (Summary, bool, error) {
+	metric, created, err := m.MetricVec.GetOrCreateMetricWithLabelValues(lvs...)
+	if metric != nil {
+		return metric.(Summary), created, err
+	}
+	return nil, false, err
+}
+
+// GetOrCreateMetricWith replaces the method of the same name in MetricVec. The
+// difference is that this method returns a Summary and not a Metric so that no
+// type conversion is required.
+func (m *SummaryVec) GetOrCreateMetricWith(labels Labels) (Summary, bool, error) {
+	metric, created, err := m.MetricVec.GetOrCreateMetricWith(labels)
+	if metric != nil {
+		return metric.(Summary), created, err
+	}
+	return nil, false, err
+}
+
 // WithLabelValues works as GetMetricWithLabelValues, but panics where
 // GetMetricWithLabelValues would have returned an error. By not returning an
 // error, WithLabelValues allows shortcuts like
@@ -422,3 +583,132 @@ func (m *SummaryVec) WithLabelValues(lvs ...string) Summary {
 func (m *SummaryVec) With(labels Labels) Summary {
 	return m.MetricVec.With(labels).(Summary)
 }
+
+// GetMetricWithContext replaces the method of the same name in MetricVec. The
+// difference is that this method returns a Summary and not a Metric so that no
+// type conversion is required.
+func (m *SummaryVec) GetMetricWithContext(ctx context.Context, labels Labels) (Summary, error) {
+	metric, err := m.MetricVec.GetMetricWithContext(ctx, labels)
+	if metric != nil {
+		return metric.(Summary), err
+	}
+	return nil, err
+}
+
+// WithContext works as GetMetricWithContext, but panics where
+// GetMetricWithContext would have returned an error.
+func (m *SummaryVec) WithContext(ctx context.Context, labels Labels) Summary {
+	return m.MetricVec.WithContext(ctx, labels).(Summary)
+}
+
+// CurryWith returns a SummaryVec curried with the provided labels. See
+// MetricVec.CurryWith for details.
+func (m *SummaryVec) CurryWith(labels Labels) (*SummaryVec, error) {
+	curried := &SummaryVec{}
+	if err := m.MetricVec.curryInto(labels, &curried.MetricVec); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *SummaryVec) MustCurryWith(labels Labels) *SummaryVec {
+	curried, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return curried
+}
+
+type constSummary struct {
+	desc       *Desc
+	count      uint64
+	sum        float64
+	quantiles  map[float64]float64
+	labelPairs []*dto.LabelPair
+}
+
+func (s *constSummary) Desc() *Desc {
+	return s.desc
+}
+
+func (s *constSummary) Write(out *dto.Metric) error {
+	sum := &dto.Summary{}
+	qs := make([]*dto.Quantile, 0, len(s.quantiles))
+
+	sum.SampleCount = proto.Uint64(s.count)
+	sum.SampleSum = proto.Float64(s.sum)
+
+	for rank, q := range s.quantiles {
+		qs = append(qs, &dto.Quantile{
+			Quantile: proto.Float64(rank),
+			Value:    proto.Float64(q),
+		})
+	}
+
+	if len(qs) > 0 {
+		sort.Sort(quantSort(qs))
+	}
+	sum.Quantile = qs
+
+	out.Summary = sum
+	out.Label = s.labelPairs
+
+	return nil
+}
+
+// NewConstSummary returns a metric representing a Prometheus summary with fixed
+// values for the count, sum, and quantiles. As those parameters cannot be
+// changed, the returned value does not implement the Summary interface (but
+// only the Metric interface). Users of this package will not have much use for
+// it in regular operations. However, when implementing custom Collectors, it is
+// useful as a throw-away metric that is generated on the fly to send it to
+// Prometheus in the Collect method.
+//
+// quantiles maps ranks to quantile values. For example, a median latency of
+// 0.23s and a 99th percentile latency of 0.56s would be expressed as:
+//     map[float64]float64{0.5: 0.23, 0.99: 0.56}
+//
+// NewConstSummary returns an error if the length of labelValues is not
+// consistent with the variable labels in Desc, if a label value is not valid
+// UTF-8, or if Desc has a label named "quantile" or "le" (see NewSummary).
+func NewConstSummary(
+	desc *Desc,
+	count uint64,
+	sum float64,
+	quantiles map[float64]float64,
+	labelValues ...string,
+) (Metric, error) {
+	if err := validateLabelValues(desc, labelValues); err != nil {
+		return nil, err
+	}
+	for _, name := range []model.LabelName{model.QuantileLabel, model.BucketLabel} {
+		if desc.hasLabel(string(name)) {
+			return nil, fmt.Errorf("%q is a reserved label name for %s", name, desc.fqName)
+		}
+	}
+	return &constSummary{
+		desc:       desc,
+		count:      count,
+		sum:        sum,
+		quantiles:  quantiles,
+		labelPairs: makeLabelPairs(desc, labelValues),
+	}, nil
+}
+
+// MustNewConstSummary is a version of NewConstSummary that panics where
+// NewConstMetric would have returned an error.
+func MustNewConstSummary(
+	desc *Desc,
+	count uint64,
+	sum float64,
+	quantiles map[float64]float64,
+	labelValues ...string,
+) Metric {
+	m, err := NewConstSummary(desc, count, sum, quantiles, labelValues...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// sampleRing remembers the most recent observations of a summary. It is not
+// safe for concurrent use, the summary protects it with its bufMtx.
+type sampleRing struct {
+	values []float64
+	next   int  // Index the next observation is written to.
+	full   bool // Whether values has wrapped around at least once.
+}
+
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{values: make([]float64, size)}
+}
+
+func (r *sampleRing) add(v float64) {
+	r.values[r.next] = v
+	r.next++
+	if r.next == len(r.values) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// snapshot returns a copy of the remembered observations, oldest first.
+func (r *sampleRing) snapshot() []float64 {
+	if !r.full {
+		return append([]float64(nil), r.values[:r.next]...)
+	}
+	vs := make([]float64, 0, len(r.values))
+	vs = append(vs, r.values[r.next:]...)
+	return append(vs, r.values[:r.next]...)
+}
+
+// RecentSamples returns the last raw observations of the provided Summary,
+// oldest first. At most SummaryOpts.SampleBuffer observations are returned. If
+// the Summary has not been created with a positive SampleBuffer (or has not
+// been created by this package at all), nil is returned.
+//
+// To inspect a child of a SummaryVec, retrieve it with WithLabelValues or
+// With first.
+func RecentSamples(s Summary) []float64 {
+	sum, ok := s.(*summary)
+	if !ok || sum.samples == nil {
+		return nil
+	}
+	sum.bufMtx.Lock()
+	defer sum.bufMtx.Unlock()
+	return sum.samples.snapshot()
+}
+
+// SamplesHandler returns an http.Handler that serves the raw observations
+// remembered by the Summaries collected from the provided Collectors (usually
+// Summaries and SummaryVecs created with a positive SampleBuffer). Each
+// Summary results in one line of plain text, consisting of the metric name,
+// its labels, and the observations, oldest first. Summaries without a sample
+// buffer are skipped. The handler is meant for debugging and should not be
+// exposed publicly.
+func SamplesHandler(cs ...Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var lines []string
+		for _, c := range cs {
+			metricChan := make(chan Metric)
+			go func() {
+				c.Collect(metricChan)
+				close(metricChan)
+			}()
+			for m := range metricChan {
+				s, ok := m.(*summary)
+				if !ok || s.samples == nil {
+					continue
+				}
+				lines = append(lines, formatSamples(s, RecentSamples(s)))
+			}
+		}
+		sort.Strings(lines)
+
+		var buf bytes.Buffer
+		for _, line := range lines {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+		w.Header().Set(contentTypeHeader, "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+// formatSamples renders the observations of s as a single line in the format
+// served by SamplesHandler.
+func formatSamples(s *summary, vs []float64) string {
+	var buf bytes.Buffer
+	buf.WriteString(s.desc.fqName)
+	if len(s.labelPairs) > 0 {
+		buf.WriteByte('{')
+		for i, lp := range s.labelPairs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, "%s=%q", lp.GetName(), lp.GetValue())
+		}
+		buf.WriteByte('}')
+	}
+	for _, v := range vs {
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return buf.String()
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRecentSamples(t *testing.T) {
+	s := NewSummary(SummaryOpts{
+		Name:         "test_summary",
+		Help:         "helpless",
+		SampleBuffer: 3,
+	})
+	if got := RecentSamples(s); len(got) != 0 {
+		t.Errorf("got %v, want no samples", got)
+	}
+	s.Observe(1)
+	s.Observe(2)
+	if got, want := RecentSamples(s), []float64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	ObserveMany(s, []float64{3, 4, 5, 6})
+	s.Observe(7)
+	if got, want := RecentSamples(s), []float64{5, 6, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	disabled := NewSummary(SummaryOpts{
+		Name: "test_summary",
+		Help: "helpless",
+	})
+	disabled.Observe(1)
+	if got := RecentSamples(disabled); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+}
+
+func TestSamplesHandler(t *testing.T) {
+	vec := NewSummaryVec(
+		SummaryOpts{
+			Name:         "test_summary",
+			Help:         "helpless",
+			ConstLabels:  Labels{"instance": "a"},
+			SampleBuffer: 2,
+		},
+		[]string{"code"},
+	)
+	vec.WithLabelValues("500").Observe(3)
+	ObserveMany(vec.WithLabelValues("200"), []float64{0.5, 1, 1.5})
+	other := NewSummary(SummaryOpts{
+		Name: "other_summary",
+		Help: "helpless",
+	})
+	other.Observe(1)
+
+	w := httptest.NewRecorder()
+	SamplesHandler(vec, other).ServeHTTP(w, httptest.NewRequest("GET", "/samples", nil))
+	body, err := ioutil.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `test_summary{code="200",instance="a"} 1 1.5
+test_summary{code="500",instance="a"} 3
+`
+	if got := string(body); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := w.Header().Get("Content-Type"), "text/plain; charset=utf-8"; got != want {
+		t.Errorf("got Content-Type %q, want %q", got, want)
+	}
+}
@@ -281,19 +281,19 @@ func TestSummaryVecConcurrency(t *testing.T) {
 }
 
 func TestSummaryDecay(t *testing.T) {
+	current := time.Unix(1000, 0)
 	sum := NewSummary(SummaryOpts{
 		Name:       "test_summary",
 		Help:       "helpless",
 		MaxAge:     100 * time.Millisecond,
 		Objectives: map[float64]float64{0.1: 0.001},
 		AgeBuckets: 10,
+		Clock:      ClockFunc(func() time.Time { return current }),
 	})
 
 	m := &dto.Metric{}
-	i := 0
-	tick := time.NewTicker(time.Millisecond)
-	for _ = range tick.C {
-		i++
+	for i := 1; i <= 1000; i++ {
+		current = current.Add(time.Millisecond)
 		sum.Observe(float64(i))
 		if i%10 == 0 {
 			sum.Write(m)
@@ -302,11 +302,44 @@ func TestSummaryDecay(t *testing.T) {
 			}
 			m.Reset()
 		}
-		if i >= 1000 {
-			break
+	}
+}
+
+func TestSummaryObserveMany(t *testing.T) {
+	single := NewSummary(SummaryOpts{Name: "single", Help: "helpless", BufCap: 7})
+	many := NewSummary(SummaryOpts{Name: "many", Help: "helpless", BufCap: 7})
+	var vs []float64
+	for i := 1; i <= 100; i++ {
+		vs = append(vs, float64(i))
+		single.Observe(float64(i))
+	}
+	ObserveMany(many, vs[:3])
+	ObserveMany(many, vs[3:])
+	ObserveMany(many, nil)
+	// Summaries that are not BatchSummaries get each observation on its
+	// own.
+	plain := struct{ Summary }{NewSummary(SummaryOpts{Name: "plain", Help: "helpless", BufCap: 7})}
+	ObserveMany(plain, vs)
+
+	mSingle, mMany := &dto.Metric{}, &dto.Metric{}
+	single.Write(mSingle)
+	many.Write(mMany)
+	if got, want := mMany.GetSummary().GetSampleCount(), uint64(100); got != want {
+		t.Errorf("got count %d, want %d", got, want)
+	}
+	if got, want := mMany.GetSummary().GetSampleSum(), 5050.; got != want {
+		t.Errorf("got sum %f, want %f", got, want)
+	}
+	for i, q := range mMany.GetSummary().Quantile {
+		if got, want := q.GetValue(), mSingle.GetSummary().Quantile[i].GetValue(); got != want {
+			t.Errorf("got %f for quantile %f, want %f", got, q.GetQuantile(), want)
 		}
 	}
-	tick.Stop()
+	mPlain := &dto.Metric{}
+	plain.Write(mPlain)
+	if got, want := mPlain.GetSummary().GetSampleCount(), uint64(100); got != want {
+		t.Errorf("got count %d for plain summary, want %d", got, want)
+	}
 }
 
 func getBounds(vars []float64, q, ε float64) (min, max float64) {
@@ -326,3 +359,21 @@ func getBounds(vars []float64, q, ε float64) (min, max float64) {
 	}
 	return
 }
+
+func TestConstSummary(t *testing.T) {
+	desc := NewDesc("latency", "docstring", []string{"code"}, Labels{"const": "x"})
+	if _, err := NewConstSummary(desc, 2, 3, nil); err == nil {
+		t.Error("expected error for inconsistent cardinality, got none")
+	}
+	if _, err := NewConstSummary(desc, 2, 3, nil, "\xff"); err == nil {
+		t.Error("expected error for invalid UTF-8 label value, got none")
+	}
+	m := MustNewConstSummary(desc, 2, 3, map[float64]float64{0.9: 2, 0.5: 1}, "200")
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pb.String(), `label:<name:"code" value:"200" > label:<name:"const" value:"x" > summary:<sample_count:2 sample_sum:3 quantile:<quantile:0.5 value:1 > quantile:<quantile:0.9 value:2 > > `; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
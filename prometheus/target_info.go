@@ -0,0 +1,103 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TargetInfoName is the name of the metric exported by the collector returned
+// by NewTargetInfoCollector.
+const TargetInfoName = "target_info"
+
+type targetInfoCollector struct {
+	desc *Desc
+}
+
+// NewTargetInfoCollector returns a collector which exports a single gauge
+// named target_info with a value of 1 and the provided resource attributes as
+// its labels, e.g. the service name and version or the deployment
+// environment. Attributes describing the process as a whole are thus exposed
+// once instead of being attached to every metric family, in line with the
+// OpenTelemetry resource semantics. Queries can join them onto other metrics
+// by the target labels where needed.
+//
+// Invalid attribute names are sanitized into valid label names by replacing
+// every invalid character with "_", so that OpenTelemetry attribute names like
+// "service.name" can be used as they are. With AllowUTF8Names, they are kept
+// unchanged. If two attribute names end up as the
+// same label name, or a name is reserved, the collector fails registration.
+//
+//     prometheus.MustRegister(prometheus.NewTargetInfoCollector(prometheus.Labels{
+//         "service.name":    "checkout",
+//         "service.version": version,
+//     }))
+func NewTargetInfoCollector(attributes Labels) Collector {
+	labels := make(Labels, len(attributes))
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	// Sort to report the same collision regardless of map order.
+	sort.Strings(names)
+	for _, name := range names {
+		labelName := name
+		if !checkLabelName(name) {
+			labelName = sanitizeLabelName(name)
+		}
+		if _, ok := labels[labelName]; ok {
+			return &targetInfoCollector{desc: NewInvalidDesc(fmt.Errorf(
+				"resource attribute %q collides with another attribute as label %q",
+				name, labelName,
+			))}
+		}
+		labels[labelName] = attributes[name]
+	}
+	return &targetInfoCollector{desc: NewDesc(
+		TargetInfoName,
+		"Target metadata.",
+		nil, labels,
+	)}
+}
+
+// Describe implements Collector.
+func (c *targetInfoCollector) Describe(ch chan<- *Desc) {
+	ch <- c.desc
+}
+
+// Collect implements Collector.
+func (c *targetInfoCollector) Collect(ch chan<- Metric) {
+	if c.desc.err != nil {
+		ch <- NewInvalidMetric(c.desc, c.desc.err)
+		return
+	}
+	ch <- MustNewConstMetric(c.desc, GaugeValue, 1)
+}
+
+// sanitizeLabelName returns name with every character that is invalid in a
+// label name replaced by "_" and with a "_" prepended if name starts with a
+// digit.
+func sanitizeLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
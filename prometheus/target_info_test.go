@@ -0,0 +1,66 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTargetInfoCollector(t *testing.T) {
+	r := newRegistry()
+	r.MustRegister(NewTargetInfoCollector(Labels{
+		"service.name":           "checkout",
+		"service.version":        "1.2.3",
+		"deployment.environment": "prod",
+	}))
+
+	var buf bytes.Buffer
+	if _, _, err := r.writeNegotiated(context.Background(), &buf, "", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `target_info{deployment_environment="prod",service_name="checkout",service_version="1.2.3"} 1`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("output does not contain %q:\n%s", want, buf.String())
+	}
+	if !strings.Contains(buf.String(), "# TYPE target_info gauge") {
+		t.Errorf("target_info not exposed as a gauge:\n%s", buf.String())
+	}
+}
+
+func TestTargetInfoCollectorInvalid(t *testing.T) {
+	for _, attributes := range []Labels{
+		{"service.name": "a", "service_name": "b"},
+		{"__reserved": "x"},
+	} {
+		if err := newRegistry().Register(NewTargetInfoCollector(attributes)); err == nil {
+			t.Errorf("registering target info with %v succeeded, want error", attributes)
+		}
+	}
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	for in, want := range map[string]string{
+		"service_name":  "service_name",
+		"service.name":  "service_name",
+		"k8s.pod:uid":   "k8s_pod_uid",
+		"1st.attribute": "_1st_attribute",
+	} {
+		if got := sanitizeLabelName(in); got != want {
+			t.Errorf("sanitizeLabelName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
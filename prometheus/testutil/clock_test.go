@@ -0,0 +1,67 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestManualClockSummaryMaxAge(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "now_seconds",
+		Help: "Current time.",
+	}, func() float64 { return float64(clock.Now().Unix()) }))
+	s := prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:       "latency_seconds",
+		Help:       "Latency.",
+		Objectives: map[float64]float64{0.5: 0.05},
+		MaxAge:     time.Minute,
+		AgeBuckets: 2,
+		Clock:      clock,
+	})
+	reg.MustRegister(s)
+	s.Observe(42)
+
+	before, err := TakeSnapshot(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := before[`latency_seconds{quantile="0.5"}`]; got != 42 {
+		t.Errorf("got median %v, want 42", got)
+	}
+
+	// Once MaxAge has passed, the old observation no longer counts
+	// towards the quantiles, while count and sum keep it.
+	clock.Add(2 * time.Minute)
+	s.Observe(1)
+	after, err := TakeSnapshot(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := Diff(before, after)
+	if got := changes["now_seconds"]; got != 120 {
+		t.Errorf("clock moved by %v seconds, want 120", got)
+	}
+	if got := after[`latency_seconds{quantile="0.5"}`]; got != 1 {
+		t.Errorf("got median %v after MaxAge, want 1", got)
+	}
+	if got := changes["latency_seconds_count"]; got != 1 {
+		t.Errorf("count changed by %v, want 1", got)
+	}
+}
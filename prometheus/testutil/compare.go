@@ -0,0 +1,124 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/text"
+)
+
+// CollectAndCompare registers the provided Collector with a newly created
+// registry and compares the gathered metrics with the expected metrics in the
+// text format read from expected, e.g. a fixture file. Only the metric families
+// with the provided names are compared, or all of them if no names are given.
+// The order of metric families, of metrics within a family, and of labels
+// within a metric does not matter. A non-nil error describing the difference is
+// returned if the metrics do not match.
+func CollectAndCompare(c prometheus.Collector, expected io.Reader, metricNames ...string) error {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		return fmt.Errorf("registering collector failed: %s", err)
+	}
+	return GatherAndCompare(reg, expected, metricNames...)
+}
+
+// GatherAndCompare works like CollectAndCompare but gathers the metrics from
+// the provided Gatherer, e.g. a Registry.
+func GatherAndCompare(g prometheus.Gatherer, expected io.Reader, metricNames ...string) error {
+	got, err := g.Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics failed: %s", err)
+	}
+	want, err := text.ParseText(expected)
+	if err != nil {
+		return fmt.Errorf("parsing expected metrics failed: %s", err)
+	}
+	if len(metricNames) > 0 {
+		got = filterMetrics(got, metricNames)
+		want = filterMetrics(want, metricNames)
+	}
+	return compare(got, want)
+}
+
+// compare encodes both slices of metric families in the canonical text format
+// and returns an error listing both if they differ.
+func compare(got, want []*dto.MetricFamily) error {
+	gotText, err := canonicalText(got)
+	if err != nil {
+		return fmt.Errorf("encoding gathered metrics failed: %s", err)
+	}
+	wantText, err := canonicalText(want)
+	if err != nil {
+		return fmt.Errorf("encoding expected metrics failed: %s", err)
+	}
+	if gotText != wantText {
+		return fmt.Errorf(
+			"metric output does not match expectation; want:\n\n%s\ngot:\n\n%s",
+			wantText, gotText,
+		)
+	}
+	return nil
+}
+
+// canonicalText sorts the metrics within each of the provided metric families
+// by their label pairs and returns the text format of all of them. The metric
+// families and the label pairs within each metric have to be sorted already,
+// as done by both the registry and text.ParseText.
+func canonicalText(mfs []*dto.MetricFamily) (string, error) {
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		sort.Sort(metricsByLabels(mf.Metric))
+		if _, err := text.MetricFamilyToText(&buf, mf); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+func filterMetrics(mfs []*dto.MetricFamily, names []string) []*dto.MetricFamily {
+	var filtered []*dto.MetricFamily
+	for _, mf := range mfs {
+		for _, name := range names {
+			if mf.GetName() == name {
+				filtered = append(filtered, mf)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+type metricsByLabels []*dto.Metric
+
+func (s metricsByLabels) Len() int      { return len(s) }
+func (s metricsByLabels) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s metricsByLabels) Less(i, j int) bool {
+	a, b := s[i].Label, s[j].Label
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k].GetName() != b[k].GetName() {
+			return a[k].GetName() < b[k].GetName()
+		}
+		if a[k].GetValue() != b[k].GetValue() {
+			return a[k].GetValue() < b[k].GetValue()
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectAndCompare(t *testing.T) {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "some_total",
+		Help: "A value that represents a counter.",
+		ConstLabels: prometheus.Labels{
+			"label1": "value1",
+		},
+	}, []string{"label2"})
+	c.WithLabelValues("b").Inc()
+	c.WithLabelValues("a").Add(2)
+
+	// Metrics and labels in a different order than gathered.
+	expected := `
+# HELP some_total A value that represents a counter.
+# TYPE some_total counter
+some_total{label2="b",label1="value1"} 1
+some_total{label1="value1",label2="a"} 2
+`
+	if err := CollectAndCompare(c, strings.NewReader(expected), "some_total"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	wrong := strings.Replace(expected, "} 2", "} 3", 1)
+	err := CollectAndCompare(c, strings.NewReader(wrong), "some_total")
+	if err == nil {
+		t.Fatal("expected error for mismatching metrics")
+	}
+	if !strings.Contains(err.Error(), `some_total{label1="value1",label2="a"} 3`) {
+		t.Errorf("error does not show the expected metrics: %s", err)
+	}
+}
+
+func TestGatherAndCompareNames(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "some_gauge", Help: "Some help."})
+	g.Set(42)
+	reg.MustRegister(g)
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "other_total", Help: "Other help."}))
+
+	expected := `
+# HELP some_gauge Some help.
+# TYPE some_gauge gauge
+some_gauge 42
+`
+	if err := GatherAndCompare(reg, strings.NewReader(expected), "some_gauge"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := GatherAndCompare(reg, strings.NewReader(expected)); err == nil {
+		t.Error("expected error as other_total is not expected")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/text"
+)
+
+// GatherAndCompareGolden compares the metrics gathered from the provided
+// Gatherer with the golden file at path, which holds the expected metrics in
+// the canonical text format. Timestamps are ignored, and the order of metric
+// families, metrics, and labels does not matter, so that golden files only
+// change with the exposition itself. As with GatherAndCompare, only the metric
+// families with the provided names are compared, or all of them if no names
+// are given.
+//
+// If update is true, the golden file (and its directory) is created or
+// overwritten with the gathered metrics instead. Tests usually wire it to a
+// flag of their own:
+//
+//     var update = flag.Bool("update", false, "update golden files")
+//
+//     func TestExposition(t *testing.T) {
+//         // Set up and exercise the metrics...
+//         err := testutil.GatherAndCompareGolden(reg, "testdata/exposition.golden", *update)
+//         if err != nil {
+//             t.Error(err)
+//         }
+//     }
+func GatherAndCompareGolden(g prometheus.Gatherer, path string, update bool, metricNames ...string) error {
+	got, err := g.Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics failed: %s", err)
+	}
+	if len(metricNames) > 0 {
+		got = filterMetrics(got, metricNames)
+	}
+	stripTimestamps(got)
+
+	if update {
+		gotText, err := canonicalText(got)
+		if err != nil {
+			return fmt.Errorf("encoding gathered metrics failed: %s", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, []byte(gotText), 0644)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening golden file failed (run with update to create it): %s", err)
+	}
+	defer f.Close()
+	want, err := text.ParseText(f)
+	if err != nil {
+		return fmt.Errorf("parsing golden file %s failed: %s", path, err)
+	}
+	if len(metricNames) > 0 {
+		want = filterMetrics(want, metricNames)
+	}
+	stripTimestamps(want)
+	if err := compare(got, want); err != nil {
+		return fmt.Errorf("golden file %s: %s", path, err)
+	}
+	return nil
+}
+
+func stripTimestamps(mfs []*dto.MetricFamily) {
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			m.TimestampMs = nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGatherAndCompareGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "testdata", "exposition.golden")
+
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "Requests.",
+	}, []string{"code"})
+	c.WithLabelValues("500").Inc()
+	c.WithLabelValues("200").Add(3)
+	reg.MustRegister(c)
+	timestamp := int64(1)
+	reg.SetMetricFamilyInjectionHook(func() []*dto.MetricFamily {
+		timestamp++
+		return []*dto.MetricFamily{{
+			Name: proto.String("injected"),
+			Help: proto.String("Injected with a changing timestamp."),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Gauge:       &dto.Gauge{Value: proto.Float64(1)},
+				TimestampMs: proto.Int64(timestamp),
+			}},
+		}}
+	})
+
+	if err := GatherAndCompareGolden(reg, path, false); err == nil {
+		t.Error("expected error for missing golden file")
+	}
+	if err := GatherAndCompareGolden(reg, path, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := GatherAndCompareGolden(reg, path, false); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.WithLabelValues("200").Inc()
+	err = GatherAndCompareGolden(reg, path, false)
+	if err == nil {
+		t.Fatal("expected error after the exposition changed")
+	}
+	if !strings.Contains(err.Error(), `requests_total{code="200"} 4`) {
+		t.Errorf("error does not show the changed exposition: %s", err)
+	}
+	if err := GatherAndCompareGolden(reg, path, false, "injected"); err != nil {
+		t.Errorf("unexpected error for unchanged metric family: %s", err)
+	}
+}
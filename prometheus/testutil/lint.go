@@ -0,0 +1,135 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Problem is an issue detected by the linter, i.e. a violation of the
+// conventions for metric and label naming and documentation.
+type Problem struct {
+	// Metric is the name of the metric family the Problem relates to.
+	Metric string
+	// Text is a human readable description of the Problem.
+	Text string
+}
+
+// nonBaseUnits maps units commonly found in metric names to the base unit that
+// should be used instead.
+var nonBaseUnits = map[string]string{
+	"nanoseconds":  "seconds",
+	"microseconds": "seconds",
+	"milliseconds": "seconds",
+	"minutes":      "seconds",
+	"hours":        "seconds",
+	"days":         "seconds",
+	"kilobytes":    "bytes",
+	"megabytes":    "bytes",
+	"gigabytes":    "bytes",
+	"bits":         "bytes",
+	"percent":      "ratio",
+	"millimeters":  "meters",
+	"kilometers":   "meters",
+	"kilograms":    "grams",
+}
+
+// CollectAndLint registers the provided Collector with a newly created registry
+// and lints the gathered metric families. Only the metric families with the
+// provided names are linted, or all of them if no names are given. The
+// detected problems are returned sorted by metric name. An error is only
+// returned if the metrics could not be gathered.
+func CollectAndLint(c prometheus.Collector, metricNames ...string) ([]Problem, error) {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return GatherAndLint(reg, metricNames...)
+}
+
+// GatherAndLint works like CollectAndLint but gathers the metric families from
+// the provided Gatherer, e.g. a Registry.
+func GatherAndLint(g prometheus.Gatherer, metricNames ...string) ([]Problem, error) {
+	mfs, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+	if len(metricNames) > 0 {
+		mfs = filterMetrics(mfs, metricNames)
+	}
+	var problems []Problem
+	for _, mf := range mfs {
+		problems = append(problems, lint(mf)...)
+	}
+	sort.Stable(problemsByMetric(problems))
+	return problems, nil
+}
+
+// lint returns the problems of a single metric family.
+func lint(mf *dto.MetricFamily) []Problem {
+	var (
+		name     = mf.GetName()
+		problems []Problem
+	)
+	report := func(text string) {
+		problems = append(problems, Problem{Metric: name, Text: text})
+	}
+
+	if mf.GetHelp() == "" {
+		report("no help text")
+	}
+	if hasUpper(name) {
+		report(`metric names should be written in "snake_case" not "camelCase"`)
+	}
+	switch isTotal := strings.HasSuffix(name, "_total"); {
+	case mf.GetType() == dto.MetricType_COUNTER && !isTotal:
+		report(`counter metrics should have "_total" suffix`)
+	case mf.GetType() != dto.MetricType_COUNTER && isTotal:
+		report(`non-counter metrics should not have "_total" suffix`)
+	}
+	for _, part := range strings.Split(name, "_") {
+		if base, ok := nonBaseUnits[part]; ok {
+			report(`use base unit "` + base + `" instead of "` + part + `"`)
+		}
+	}
+
+	reported := map[string]bool{}
+	for _, m := range mf.Metric {
+		for _, lp := range m.Label {
+			labelName := lp.GetName()
+			if reported[labelName] || !hasUpper(labelName) {
+				continue
+			}
+			reported[labelName] = true
+			report(`label names should be written in "snake_case" not "camelCase": ` + labelName)
+		}
+	}
+	return problems
+}
+
+func hasUpper(s string) bool {
+	return strings.IndexFunc(s, unicode.IsUpper) >= 0
+}
+
+type problemsByMetric []Problem
+
+func (s problemsByMetric) Len() int           { return len(s) }
+func (s problemsByMetric) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s problemsByMetric) Less(i, j int) bool { return s[i].Metric < s[j].Metric }
@@ -0,0 +1,94 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/text"
+)
+
+// textGatherer is a Gatherer returning the metric families parsed from text,
+// which may lack a help text unlike those gathered from a registry.
+type textGatherer string
+
+func (g textGatherer) Gather() ([]*dto.MetricFamily, error) {
+	return text.ParseText(strings.NewReader(string(g)))
+}
+
+func TestLint(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "good_requests_total",
+		Help: "Fine.",
+	}))
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "requests",
+		Help: "Missing suffix.",
+	}))
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "queue_total",
+		Help: "Not a counter.",
+	}))
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "latency_milliseconds",
+		Help: "Non-base unit.",
+	}))
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "diskUsage",
+		Help: "CamelCase.",
+	}, []string{"mountPoint"})
+	vec.WithLabelValues("/").Set(1)
+	vec.WithLabelValues("/home").Set(1)
+	reg.MustRegister(vec)
+
+	got, err := GatherAndLint(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Problem{
+		{Metric: "diskUsage", Text: `metric names should be written in "snake_case" not "camelCase"`},
+		{Metric: "diskUsage", Text: `label names should be written in "snake_case" not "camelCase": mountPoint`},
+		{Metric: "latency_milliseconds", Text: `use base unit "seconds" instead of "milliseconds"`},
+		{Metric: "queue_total", Text: `non-counter metrics should not have "_total" suffix`},
+		{Metric: "requests", Text: `counter metrics should have "_total" suffix`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got problems %v, want %v", got, want)
+	}
+
+	got, err = GatherAndLint(reg, "good_requests_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got problems %v for a good metric, want none", got)
+	}
+}
+
+func TestLintMissingHelp(t *testing.T) {
+	got, err := GatherAndLint(textGatherer("# TYPE federated_total counter\nfederated_total 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Problem{{Metric: "federated_total", Text: "no help text"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got problems %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loadgen populates a registry with synthetic metrics and drives
+// concurrent updates of them. It allows to benchmark scrape latency and memory
+// usage for an expected cardinality before deploying, e.g.:
+//
+//     reg := prometheus.NewRegistry()
+//     g, err := loadgen.New(reg, loadgen.Opts{Families: 100, Children: 1000})
+//     if err != nil {
+//         log.Fatal(err)
+//     }
+//     g.Start()
+//     stats, err := g.Scrape()
+//     updates := g.Stop()
+//
+// All metric families are named loadgen_<kind>_<index>, so they can be added
+// to a registry that already holds other metrics.
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kind is the type of the generated metrics.
+type Kind int
+
+// Possible values for Kind.
+const (
+	Counter Kind = iota
+	Gauge
+	Summary
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Counter:
+		return "counter"
+	case Gauge:
+		return "gauge"
+	case Summary:
+		return "summary"
+	}
+	return "kind_" + strconv.Itoa(int(k))
+}
+
+// Opts bundles the options for creating a Generator. All fields are optional.
+type Opts struct {
+	// Families is the number of metric families (i.e. metric vectors) to
+	// create. The default is 1.
+	Families int
+	// Children is the number of children created in each family up front.
+	// The default is 1.
+	Children int
+	// Labels is the number of variable labels of each family. The default
+	// is 1.
+	Labels int
+	// Kind is the type of all generated metrics. The default is Counter.
+	Kind Kind
+	// Workers is the number of goroutines updating random children while
+	// the Generator is running. The default is 1.
+	Workers int
+	// Seed seeds the random choice of children to update. Workers use
+	// consecutive seeds starting with Seed.
+	Seed int64
+}
+
+// Generator holds the generated metrics and drives updates of them. Create
+// instances with New.
+type Generator struct {
+	opts        Opts
+	registry    *prometheus.Registry
+	families    []func(lvs []string, v float64)
+	labelValues [][]string
+
+	updates uint64 // Accessed atomically.
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// ScrapeStats describes a single scrape, see Generator.Scrape.
+type ScrapeStats struct {
+	Duration time.Duration
+	Bytes    int
+}
+
+// New creates the metric families described by opts, registers them with
+// reg, and creates all their children. It returns an error if registration
+// fails.
+func New(reg *prometheus.Registry, opts Opts) (*Generator, error) {
+	if opts.Families <= 0 {
+		opts.Families = 1
+	}
+	if opts.Children <= 0 {
+		opts.Children = 1
+	}
+	if opts.Labels <= 0 {
+		opts.Labels = 1
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+
+	g := &Generator{
+		opts:        opts,
+		registry:    reg,
+		labelValues: make([][]string, opts.Children),
+	}
+	labelNames := make([]string, opts.Labels)
+	for i := range labelNames {
+		labelNames[i] = "label_" + strconv.Itoa(i)
+	}
+	for c := range g.labelValues {
+		lvs := make([]string, opts.Labels)
+		for i := range lvs {
+			lvs[i] = "value_" + strconv.Itoa(i) + "_" + strconv.Itoa(c)
+		}
+		g.labelValues[c] = lvs
+	}
+
+	for f := 0; f < opts.Families; f++ {
+		name := "loadgen_" + opts.Kind.String() + "_" + strconv.Itoa(f)
+		help := "Synthetic " + opts.Kind.String() + " created by loadgen."
+		var (
+			vec    *prometheus.MetricVec
+			update func(lvs []string, v float64)
+		)
+		switch opts.Kind {
+		case Counter:
+			cv := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labelNames)
+			vec = &cv.MetricVec
+			update = func(lvs []string, v float64) { cv.WithLabelValues(lvs...).Add(v) }
+		case Gauge:
+			gv := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labelNames)
+			vec = &gv.MetricVec
+			update = func(lvs []string, v float64) { gv.WithLabelValues(lvs...).Set(v) }
+		case Summary:
+			sv := prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: name, Help: help}, labelNames)
+			vec = &sv.MetricVec
+			update = func(lvs []string, v float64) { sv.WithLabelValues(lvs...).Observe(v) }
+		default:
+			return nil, fmt.Errorf("unknown kind %d", opts.Kind)
+		}
+		if err := reg.Register(vec); err != nil {
+			return nil, err
+		}
+		for _, lvs := range g.labelValues {
+			vec.WithLabelValues(lvs...)
+		}
+		g.families = append(g.families, update)
+	}
+	return g, nil
+}
+
+// Start starts the workers updating random children of random families until
+// Stop is called. Calling Start on a running Generator has no effect.
+func (g *Generator) Start() {
+	if g.stop != nil {
+		return
+	}
+	g.stop = make(chan struct{})
+	g.wg.Add(g.opts.Workers)
+	for w := 0; w < g.opts.Workers; w++ {
+		go g.work(rand.New(rand.NewSource(g.opts.Seed + int64(w))))
+	}
+}
+
+// Stop stops the workers and returns the total number of updates performed
+// since the Generator was created.
+func (g *Generator) Stop() uint64 {
+	if g.stop != nil {
+		close(g.stop)
+		g.wg.Wait()
+		g.stop = nil
+	}
+	return atomic.LoadUint64(&g.updates)
+}
+
+func (g *Generator) work(r *rand.Rand) {
+	defer g.wg.Done()
+	var n uint64
+	defer func() { atomic.AddUint64(&g.updates, n) }()
+	for {
+		select {
+		case <-g.stop:
+			return
+		default:
+		}
+		// Update in batches to keep the check for stop out of the way.
+		for i := 0; i < 100; i++ {
+			family := g.families[r.Intn(len(g.families))]
+			lvs := g.labelValues[r.Intn(len(g.labelValues))]
+			family(lvs, r.Float64())
+		}
+		n += 100
+	}
+}
+
+// Scrape performs an in-memory scrape of the registry in the text format and
+// reports how long it took and how large the response was. It can be called
+// while the Generator is running.
+func (g *Generator) Scrape() (ScrapeStats, error) {
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		return ScrapeStats{}, err
+	}
+	rec := httptest.NewRecorder()
+	begin := time.Now()
+	g.registry.ServeHTTP(rec, req)
+	stats := ScrapeStats{Duration: time.Since(begin), Bytes: rec.Body.Len()}
+	if rec.Code != http.StatusOK {
+		return stats, fmt.Errorf("unexpected status code %d: %s", rec.Code, rec.Body)
+	}
+	return stats, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGenerator(t *testing.T) {
+	for _, kind := range []Kind{Counter, Gauge, Summary} {
+		reg := prometheus.NewRegistry()
+		g, err := New(reg, Opts{Families: 3, Children: 5, Labels: 2, Kind: kind, Workers: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mfs) != 3 {
+			t.Fatalf("%s: got %d families, want 3", kind, len(mfs))
+		}
+		for _, mf := range mfs {
+			if len(mf.Metric) != 5 || len(mf.Metric[0].Label) != 2 {
+				t.Errorf("%s: unexpected family %v", kind, mf)
+			}
+		}
+
+		g.Start()
+		time.Sleep(10 * time.Millisecond)
+		stats, err := g.Scrape()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Bytes == 0 {
+			t.Errorf("%s: empty scrape", kind)
+		}
+		if updates := g.Stop(); updates == 0 {
+			t.Errorf("%s: no updates performed", kind)
+		}
+	}
+}
+
+func TestGeneratorCounterUpdates(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g, err := New(reg, Opts{Families: 1, Children: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := testutil.TakeSnapshot(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Start()
+	time.Sleep(5 * time.Millisecond)
+	g.Stop()
+	after, err := testutil.TakeSnapshot(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := testutil.Diff(before, after); len(changes) != 1 {
+		t.Errorf("got changes %v, want one changed counter", changes)
+	}
+}
+
+func BenchmarkScrape(b *testing.B) {
+	reg := prometheus.NewRegistry()
+	g, err := New(reg, Opts{Families: 10, Children: 100, Workers: 2})
+	if err != nil {
+		b.Fatal(err)
+	}
+	g.Start()
+	defer g.Stop()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := g.Scrape(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/matttproud/golang_protobuf_extensions/ext"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/text"
+)
+
+// ScrapeAndParse sends an in-memory scrape request to the provided metrics
+// handler, e.g. prometheus.Handler() or a Registry, and returns the decoded
+// metric families in the order they were exposed. The protobuf format is
+// requested, but a response in the text format is parsed as well. An error is
+// returned if the handler does not respond with status 200 or the response
+// cannot be decoded.
+func ScrapeAndParse(h http.Handler) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", prometheus.DelimitedTelemetryContentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d: %s", rec.Code, rec.Body)
+	}
+	var body io.Reader = rec.Body
+	if rec.Header().Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil || mediaType != "application/vnd.google.protobuf" ||
+		params["encoding"] != "delimited" ||
+		params["proto"] != "io.prometheus.client.MetricFamily" {
+		return text.ParseText(body)
+	}
+	var mfs []*dto.MetricFamily
+	for {
+		mf := &dto.MetricFamily{}
+		if _, err := ext.ReadDelimited(body, mf); err != nil {
+			if err == io.EOF {
+				return mfs, nil
+			}
+			return nil, err
+		}
+		mfs = append(mfs, mf)
+	}
+}
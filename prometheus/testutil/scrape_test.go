@@ -0,0 +1,62 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScrapeAndParse(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "Requests.",
+	}, []string{"code"})
+	c.WithLabelValues("200").Add(3)
+	reg.MustRegister(c)
+
+	mfs, err := ScrapeAndParse(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "requests_total" {
+		t.Fatalf("unexpected metric families %v", mfs)
+	}
+	if got := mfs[0].Metric[0].GetCounter().GetValue(); got != 3 {
+		t.Errorf("got %v, want 3", got)
+	}
+
+	textOnly := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", prometheus.TextTelemetryContentType)
+		io.WriteString(w, "# TYPE up gauge\nup 1\n")
+	})
+	mfs, err = ScrapeAndParse(textOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].Metric[0].GetGauge().GetValue() != 1 {
+		t.Errorf("unexpected metric families %v from text response", mfs)
+	}
+
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+	if _, err := ScrapeAndParse(failing); err == nil {
+		t.Error("expected error for status 500")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Snapshot holds the values of all samples gathered at one point in time. It
+// is keyed by the sample as it would appear in the text format, i.e. the metric
+// name followed by the label pairs sorted by label name, e.g.
+// `http_requests_total{code="200",method="get"}`. Summaries contribute one
+// sample per quantile plus their _sum and _count.
+type Snapshot map[string]float64
+
+// TakeSnapshot gathers all metrics from the provided Gatherer, e.g. a Registry,
+// and returns their current values.
+func TakeSnapshot(g prometheus.Gatherer) (Snapshot, error) {
+	mfs, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+	s := Snapshot{}
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			switch {
+			case m.Counter != nil:
+				s[sampleKey(name, m.Label, "", "")] = m.Counter.GetValue()
+			case m.Gauge != nil:
+				s[sampleKey(name, m.Label, "", "")] = m.Gauge.GetValue()
+			case m.Untyped != nil:
+				s[sampleKey(name, m.Label, "", "")] = m.Untyped.GetValue()
+			case m.Summary != nil:
+				for _, q := range m.Summary.Quantile {
+					quantile := strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)
+					s[sampleKey(name, m.Label, "quantile", quantile)] = q.GetValue()
+				}
+				s[sampleKey(name+"_sum", m.Label, "", "")] = m.Summary.GetSampleSum()
+				s[sampleKey(name+"_count", m.Label, "", "")] = float64(m.Summary.GetSampleCount())
+			}
+		}
+	}
+	return s, nil
+}
+
+// Diff returns the samples whose value differs between the two snapshots,
+// mapped to the change of their value, i.e. after minus before. Samples missing
+// in one of the snapshots are treated as having the value zero there, so that
+// children created between the snapshots show up with their full value. This
+// allows a test to take a snapshot, run a code path, take another snapshot, and
+// assert exactly which counters moved and by how much:
+//
+//     before, _ := testutil.TakeSnapshot(reg)
+//     handleRequest()
+//     after, _ := testutil.TakeSnapshot(reg)
+//     want := map[string]float64{`requests_total{code="200"}`: 1}
+//     if got := testutil.Diff(before, after); !reflect.DeepEqual(got, want) {
+//         t.Errorf("got changes %v, want %v", got, want)
+//     }
+//
+// Note that summary quantiles may change without a new observation as their
+// values decay over time.
+func Diff(before, after Snapshot) map[string]float64 {
+	changes := map[string]float64{}
+	for key, a := range after {
+		b := before[key]
+		if a == b || (math.IsNaN(a) && math.IsNaN(b)) {
+			continue
+		}
+		changes[key] = a - b
+	}
+	for key, b := range before {
+		if _, ok := after[key]; !ok && b != 0 {
+			changes[key] = -b
+		}
+	}
+	return changes
+}
+
+// labelValueEscaper escapes label values as the text format does.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// sampleKey returns the key of a sample in a Snapshot. The additional label
+// pair is added if its name is not empty.
+func sampleKey(name string, labels []*dto.LabelPair, additionalName, additionalValue string) string {
+	pairs := make([]string, 0, len(labels)+1)
+	for _, lp := range labels {
+		pairs = append(pairs, lp.GetName()+`="`+labelValueEscaper.Replace(lp.GetValue())+`"`)
+	}
+	if additionalName != "" {
+		pairs = append(pairs, additionalName+`="`+additionalValue+`"`)
+	}
+	if len(pairs) == 0 {
+		return name
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
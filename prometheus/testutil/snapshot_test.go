@@ -0,0 +1,87 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDiff(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "Requests.",
+	}, []string{"method", "code"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "in_flight",
+		Help: "In flight.",
+	})
+	reg.MustRegister(requests)
+	reg.MustRegister(inFlight)
+	requests.WithLabelValues("get", "200").Add(3)
+	requests.WithLabelValues("get", "404").Inc()
+	inFlight.Set(2)
+
+	before, err := TakeSnapshot(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests.WithLabelValues("get", "200").Inc()
+	requests.WithLabelValues("post", "500").Add(2)
+	requests.DeleteLabelValues("get", "404")
+	inFlight.Set(2)
+	after, err := TakeSnapshot(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]float64{
+		`requests_total{code="200",method="get"}`:  1,
+		`requests_total{code="500",method="post"}`: 2,
+		`requests_total{code="404",method="get"}`:  -1,
+	}
+	if got := Diff(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("got changes %v, want %v", got, want)
+	}
+	if got := Diff(after, after); len(got) != 0 {
+		t.Errorf("got changes %v between identical snapshots, want none", got)
+	}
+}
+
+func TestSnapshotSummary(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	s := prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:       "latency_seconds",
+		Help:       "Latency.",
+		Objectives: map[float64]float64{0.5: 0.05},
+	})
+	reg.MustRegister(s)
+	s.Observe(2)
+
+	got, err := TakeSnapshot(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Snapshot{
+		`latency_seconds{quantile="0.5"}`: 2,
+		"latency_seconds_sum":             2,
+		"latency_seconds_count":           1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got snapshot %v, want %v", got, want)
+	}
+}
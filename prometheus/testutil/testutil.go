@@ -0,0 +1,79 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil provides helpers to test code that uses the prometheus
+// package. They allow unit tests to assert on instrumentation without scraping
+// an HTTP endpoint, e.g.:
+//
+//     handleRequest()
+//     if got := testutil.ToFloat64(requestCounter); got != 1 {
+//         t.Errorf("got %v requests, want 1", got)
+//     }
+//
+// The helpers are meant for tests only. They are not optimized for speed, and
+// they panic on programming errors like ToFloat64 being called with a Collector
+// that collects more than one metric.
+package testutil
+
+import (
+	"fmt"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ToFloat64 collects all metrics from the provided Collector, which must be
+// exactly one, and returns its current value. The metric must be a Counter, a
+// Gauge, or an Untyped metric, which is the case for Counters, Gauges, and
+// Untyped metrics themselves, for their Func variants, and for a single child
+// of a metric vector. ToFloat64 panics in all other cases, in particular if c
+// collects no metric or more than one (as a metric vector with several
+// children does) or if the metric is a Summary.
+func ToFloat64(c prometheus.Collector) float64 {
+	var (
+		m      prometheus.Metric
+		mCount int
+		mChan  = make(chan prometheus.Metric)
+		done   = make(chan struct{})
+	)
+
+	go func() {
+		for m = range mChan {
+			mCount++
+		}
+		close(done)
+	}()
+
+	c.Collect(mChan)
+	close(mChan)
+	<-done
+
+	if mCount != 1 {
+		panic(fmt.Errorf("collected %d metrics instead of exactly 1", mCount))
+	}
+
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		panic(fmt.Errorf("error writing metric %s: %s", m.Desc(), err))
+	}
+	switch {
+	case pb.Gauge != nil:
+		return pb.Gauge.GetValue()
+	case pb.Counter != nil:
+		return pb.Counter.GetValue()
+	case pb.Untyped != nil:
+		return pb.Untyped.GetValue()
+	}
+	panic(fmt.Errorf("collected a non-gauge/counter/untyped metric: %s", pb))
+}
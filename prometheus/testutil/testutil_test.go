@@ -0,0 +1,100 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestToFloat64(t *testing.T) {
+	gaugeWithAValueSet := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "some_gauge",
+		Help: "Some help.",
+	})
+	gaugeWithAValueSet.Set(3.14)
+
+	counterVecWithOneElement := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "some_total",
+		Help: "Some help.",
+	}, []string{"foo"})
+	counterVecWithOneElement.WithLabelValues("bar").Inc()
+
+	counterVecWithTwoElements := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "another_total",
+		Help: "Some help.",
+	}, []string{"foo"})
+	counterVecWithTwoElements.WithLabelValues("bar").Add(42)
+	counterVecWithTwoElements.WithLabelValues("baz").Inc()
+
+	scenarios := []struct {
+		collector prometheus.Collector
+		panics    bool
+		want      float64
+	}{
+		{
+			collector: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "a_total",
+				Help: "No help.",
+			}),
+			want: 0,
+		},
+		{
+			collector: gaugeWithAValueSet,
+			want:      3.14,
+		},
+		{
+			collector: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "a_gauge_func",
+				Help: "No help.",
+			}, func() float64 { return 42 }),
+			want: 42,
+		},
+		{
+			collector: counterVecWithOneElement,
+			want:      1,
+		},
+		{
+			collector: counterVecWithTwoElements.WithLabelValues("bar"),
+			want:      42,
+		},
+		{
+			collector: counterVecWithTwoElements,
+			panics:    true,
+		},
+		{
+			collector: prometheus.NewSummary(prometheus.SummaryOpts{
+				Name: "a_summary",
+				Help: "No help.",
+			}),
+			panics: true,
+		},
+	}
+
+	for i, s := range scenarios {
+		func() {
+			defer func() {
+				if r := recover(); r != nil && !s.panics {
+					t.Errorf("%d. unexpected panic: %v", i, r)
+				} else if r == nil && s.panics {
+					t.Errorf("%d. expected panic", i)
+				}
+			}()
+			if got := ToFloat64(s.collector); got != s.want {
+				t.Errorf("%d. got %v, want %v", i, got, s.want)
+			}
+		}()
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"runtime"
+)
+
+type threadCollector struct {
+	threads, cgoCalls, maxProcs *Desc
+}
+
+// NewThreadCollector returns a collector which exports the number of OS threads
+// created by the Go runtime, the total number of cgo calls, and the current
+// GOMAXPROCS setting. Libraries making heavy use of cgo can cause an explosion
+// of OS threads, which otherwise goes unnoticed until the process hits its
+// thread limit.
+func NewThreadCollector() *threadCollector {
+	return &threadCollector{
+		threads: NewDesc(
+			"go_threads",
+			"Number of OS threads created.",
+			nil, nil,
+		),
+		cgoCalls: NewDesc(
+			"go_cgo_calls_total",
+			"Total number of cgo calls made by the current process.",
+			nil, nil,
+		),
+		maxProcs: NewDesc(
+			"go_gomaxprocs",
+			"Maximum number of CPUs executing Go code simultaneously (GOMAXPROCS).",
+			nil, nil,
+		),
+	}
+}
+
+// Describe returns all descriptions of the collector.
+func (c *threadCollector) Describe(ch chan<- *Desc) {
+	ch <- c.threads
+	ch <- c.cgoCalls
+	ch <- c.maxProcs
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *threadCollector) Collect(ch chan<- Metric) {
+	n, _ := runtime.ThreadCreateProfile(nil)
+	ch <- MustNewConstMetric(c.threads, GaugeValue, float64(n))
+	ch <- MustNewConstMetric(c.cgoCalls, CounterValue, float64(runtime.NumCgoCall()))
+	ch <- MustNewConstMetric(c.maxProcs, GaugeValue, float64(runtime.GOMAXPROCS(0)))
+}
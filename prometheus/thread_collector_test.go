@@ -0,0 +1,33 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestThreadCollector(t *testing.T) {
+	values := collectValues(t, NewThreadCollector())
+
+	if values["go_threads"] < 1 {
+		t.Errorf("want at least 1 thread, got %v", values["go_threads"])
+	}
+	if _, ok := values["go_cgo_calls_total"]; !ok {
+		t.Error("go_cgo_calls_total not collected")
+	}
+	if got, want := values["go_gomaxprocs"], float64(runtime.GOMAXPROCS(0)); got != want {
+		t.Errorf("got GOMAXPROCS %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unit is the base unit of a metric, see Opts.Unit. Following the Prometheus
+// naming conventions, only base units are supported, e.g. seconds rather than
+// milliseconds and bytes rather than megabytes.
+type Unit string
+
+// Supported units.
+const (
+	UnitSeconds Unit = "seconds"
+	UnitBytes   Unit = "bytes"
+	UnitRatio   Unit = "ratio"
+	UnitCelsius Unit = "celsius"
+	UnitMeters  Unit = "meters"
+	UnitGrams   Unit = "grams"
+	UnitVolts   Unit = "volts"
+	UnitAmperes Unit = "amperes"
+	UnitJoules  Unit = "joules"
+)
+
+var knownUnits = map[Unit]struct{}{
+	UnitSeconds: {},
+	UnitBytes:   {},
+	UnitRatio:   {},
+	UnitCelsius: {},
+	UnitMeters:  {},
+	UnitGrams:   {},
+	UnitVolts:   {},
+	UnitAmperes: {},
+	UnitJoules:  {},
+}
+
+// withUnit returns fqName with the unit appended as a suffix unless it is
+// already present. A "_total" suffix stays last, i.e. "requests_total" with
+// UnitBytes becomes "requests_bytes_total". An empty unit leaves fqName
+// unchanged. An unknown unit results in an error.
+func withUnit(fqName string, unit Unit) (string, error) {
+	if unit == "" {
+		return fqName, nil
+	}
+	if _, ok := knownUnits[unit]; !ok {
+		return fqName, fmt.Errorf("metric %s has unknown unit %q", fqName, unit)
+	}
+	name, total := fqName, ""
+	if strings.HasSuffix(name, "_total") {
+		name, total = strings.TrimSuffix(name, "_total"), "_total"
+	}
+	if !strings.HasSuffix(name, "_"+string(unit)) {
+		name += "_" + string(unit)
+	}
+	return name + total, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "testing"
+
+func TestWithUnit(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		unit Unit
+		want string
+	}{
+		{"request_duration", "", "request_duration"},
+		{"request_duration", UnitSeconds, "request_duration_seconds"},
+		{"request_duration_seconds", UnitSeconds, "request_duration_seconds"},
+		{"received_total", UnitBytes, "received_bytes_total"},
+		{"received_bytes_total", UnitBytes, "received_bytes_total"},
+	} {
+		got, err := withUnit(c.name, c.unit)
+		if err != nil {
+			t.Errorf("%s with unit %q: unexpected error: %s", c.name, c.unit, err)
+		}
+		if got != c.want {
+			t.Errorf("%s with unit %q: got %q, want %q", c.name, c.unit, got, c.want)
+		}
+	}
+	if _, err := withUnit("latency", "milliseconds"); err == nil {
+		t.Error("expected error for unknown unit")
+	}
+}
+
+func TestOptsUnit(t *testing.T) {
+	c := NewCounter(CounterOpts{Namespace: "http", Name: "received_total", Help: "Received.", Unit: UnitBytes})
+	if got, want := c.Desc().fqName, "http_received_bytes_total"; got != want {
+		t.Errorf("got name %q, want %q", got, want)
+	}
+	s := NewSummaryVec(SummaryOpts{Name: "latency", Help: "Latency.", Unit: UnitSeconds}, []string{"code"})
+	if got, want := s.desc.fqName, "latency_seconds"; got != want {
+		t.Errorf("got name %q, want %q", got, want)
+	}
+	if err := newRegistry().Register(NewGauge(GaugeOpts{Name: "size", Help: "Size.", Unit: "megabytes"})); err == nil {
+		t.Error("expected registration error for unknown unit")
+	}
+}
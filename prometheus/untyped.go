@@ -13,7 +13,11 @@
 
 package prometheus
 
-import "hash/fnv"
+import (
+	"context"
+
+	dto "github.com/prometheus/client_model/go"
+)
 
 // Untyped is a Metric that represents a single numerical value that can
 // arbitrarily go up and down.
@@ -45,12 +49,7 @@ type UntypedOpts Opts
 
 // NewUntyped creates a new Untyped metric from the provided UntypedOpts.
 func NewUntyped(opts UntypedOpts) Untyped {
-	return newValue(NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		nil,
-		opts.ConstLabels,
-	), UntypedValue, 0)
+	return newValue(newOptsDesc(Opts(opts), nil, dto.MetricType_UNTYPED), UntypedValue, 0)
 }
 
 // UntypedVec is a Collector that bundles a set of Untyped metrics that all
@@ -65,17 +64,16 @@ type UntypedVec struct {
 // partitioned by the given label names. At least one label name must be
 // provided.
 func NewUntypedVec(opts UntypedOpts, labelNames []string) *UntypedVec {
-	desc := NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		labelNames,
-		opts.ConstLabels,
-	)
+	desc := newOptsDesc(Opts(opts), labelNames, dto.MetricType_UNTYPED)
 	return &UntypedVec{
 		MetricVec: MetricVec{
-			children: map[uint64]Metric{},
-			desc:     desc,
-			hash:     fnv.New64a(),
+			desc:             desc,
+			sanitize:         opts.SanitizeLabelValues,
+			maxChildren:      opts.MaxChildren,
+			overflow:         opts.OverflowPolicy,
+			defaults:         opts.DefaultLabelValues,
+			normalizers:      opts.LabelValueNormalizers,
+			expectedChildren: opts.ExpectedChildren,
 			newMetric: func(lvs ...string) Metric {
 				return newValue(desc, UntypedValue, 0, lvs...)
 			},
@@ -105,6 +103,28 @@ func (m *UntypedVec) GetMetricWith(labels Labels) (Untyped, error) {
 	return nil, err
 }
 
+// GetOrCreateMetricWithLabelValues replaces the method of the same name in
+// MetricVec. The difference is that this method returns a Untyped and not a
+// Metric so that no type conversion is required.
+func (m *UntypedVec) GetOrCreateMetricWithLabelValues(lvs ...string) (Untyped, bool, error) {
+	metric, created, err := m.MetricVec.GetOrCreateMetricWithLabelValues(lvs...)
+	if metric != nil {
+		return metric.(Untyped), created, err
+	}
+	return nil, false, err
+}
+
+// GetOrCreateMetricWith replaces the method of the same name in MetricVec. The
+// difference is that this method returns a Untyped and not a Metric so that no
+// type conversion is required.
+func (m *UntypedVec) GetOrCreateMetricWith(labels Labels) (Untyped, bool, error) {
+	metric, created, err := m.MetricVec.GetOrCreateMetricWith(labels)
+	if metric != nil {
+		return metric.(Untyped), created, err
+	}
+	return nil, false, err
+}
+
 // WithLabelValues works as GetMetricWithLabelValues, but panics where
 // GetMetricWithLabelValues would have returned an error. By not returning an
 // error, WithLabelValues allows shortcuts like
@@ -120,6 +140,43 @@ func (m *UntypedVec) With(labels Labels) Untyped {
 	return m.MetricVec.With(labels).(Untyped)
 }
 
+// GetMetricWithContext replaces the method of the same name in MetricVec. The
+// difference is that this method returns an Untyped and not a Metric so that no
+// type conversion is required.
+func (m *UntypedVec) GetMetricWithContext(ctx context.Context, labels Labels) (Untyped, error) {
+	metric, err := m.MetricVec.GetMetricWithContext(ctx, labels)
+	if metric != nil {
+		return metric.(Untyped), err
+	}
+	return nil, err
+}
+
+// WithContext works as GetMetricWithContext, but panics where
+// GetMetricWithContext would have returned an error.
+func (m *UntypedVec) WithContext(ctx context.Context, labels Labels) Untyped {
+	return m.MetricVec.WithContext(ctx, labels).(Untyped)
+}
+
+// CurryWith returns a UntypedVec curried with the provided labels. See
+// MetricVec.CurryWith for details.
+func (m *UntypedVec) CurryWith(labels Labels) (*UntypedVec, error) {
+	curried := &UntypedVec{}
+	if err := m.MetricVec.curryInto(labels, &curried.MetricVec); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *UntypedVec) MustCurryWith(labels Labels) *UntypedVec {
+	curried, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return curried
+}
+
 // UntypedFunc is an Untyped whose value is determined at collect time by
 // calling a provided function.
 //
@@ -136,10 +193,5 @@ type UntypedFunc interface {
 // the case where an UntypedFunc is directly registered with Prometheus, the
 // provided function must be concurrency-safe.
 func NewUntypedFunc(opts UntypedOpts, function func() float64) UntypedFunc {
-	return newValueFunc(NewDesc(
-		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
-		opts.Help,
-		nil,
-		opts.ConstLabels,
-	), UntypedValue, function)
+	return newValueFunc(newOptsDesc(Opts(opts), nil, dto.MetricType_UNTYPED), UntypedValue, function)
 }
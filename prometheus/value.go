@@ -19,6 +19,7 @@ import (
 	"math"
 	"sort"
 	"sync/atomic"
+	"unicode/utf8"
 
 	dto "github.com/prometheus/client_model/go"
 
@@ -43,11 +44,15 @@ var errInconsistentCardinality = errors.New("inconsistent label cardinality")
 // ValueType. This is a low-level building block used by the library to back the
 // implementations of Counter, Gauge, and Untyped.
 type value struct {
+	// valBits contains the bits of the represented float64 value. It is
+	// only accessed atomically and has to go first in the struct to
+	// guarantee 64-bit alignment on 32-bit platforms.
+	valBits uint64
+
 	SelfCollector
 
 	desc       *Desc
 	valType    ValueType
-	valBits    uint64 // These are the bits of the represented float64 value.
 	labelPairs []*dto.LabelPair
 }
 
@@ -103,6 +108,15 @@ func (v *value) Write(out *dto.Metric) error {
 	return populateMetric(v.valType, val, v.labelPairs, out)
 }
 
+// writeForReset implements scrapeResetter.
+func (v *value) writeForReset(out *dto.Metric) (func(), error) {
+	val := math.Float64frombits(atomic.LoadUint64(&v.valBits))
+	if err := populateMetric(v.valType, val, v.labelPairs, out); err != nil {
+		return nil, err
+	}
+	return func() { v.Add(-val) }, nil
+}
+
 // valueFunc is a generic metric for simple values retrieved on collect time
 // from a function. It implements Metric and Collector. Its effective type is
 // determined by ValueType. This is a low-level building block used by the
@@ -115,6 +129,9 @@ type valueFunc struct {
 	valType    ValueType
 	function   func() float64
 	labelPairs []*dto.LabelPair
+	// labelValues, if not nil, returns the values of the variable labels
+	// of desc on each call of Write.
+	labelValues func() []string
 }
 
 // newValueFunc returns a newly allocated valueFunc with the given Desc and
@@ -139,7 +156,14 @@ func (v *valueFunc) Desc() *Desc {
 }
 
 func (v *valueFunc) Write(out *dto.Metric) error {
-	return populateMetric(v.valType, v.function(), v.labelPairs, out)
+	if v.labelValues == nil {
+		return populateMetric(v.valType, v.function(), v.labelPairs, out)
+	}
+	lvs := v.labelValues()
+	if err := validateLabelValues(v.desc, lvs); err != nil {
+		return err
+	}
+	return populateMetric(v.valType, v.function(), makeLabelPairs(v.desc, lvs), out)
 }
 
 // NewConstMetric returns a metric with one fixed value that cannot be
@@ -147,10 +171,11 @@ func (v *valueFunc) Write(out *dto.Metric) error {
 // operations. However, when implementing custom Collectors, it is useful as a
 // throw-away metric that is generated on the fly to send it to Prometheus in
 // the Collect method. NewConstMetric returns an error if the length of
-// labelValues is not consistent with the variable labels in Desc.
+// labelValues is not consistent with the variable labels in Desc or if a label
+// value is not valid UTF-8.
 func NewConstMetric(desc *Desc, valueType ValueType, value float64, labelValues ...string) (Metric, error) {
-	if len(desc.variableLabels) != len(labelValues) {
-		return nil, errInconsistentCardinality
+	if err := validateLabelValues(desc, labelValues); err != nil {
+		return nil, err
 	}
 	return &constMetric{
 		desc:       desc,
@@ -160,6 +185,22 @@ func NewConstMetric(desc *Desc, valueType ValueType, value float64, labelValues
 	}, nil
 }
 
+// validateLabelValues returns an error if the number of the provided label
+// values does not match the number of variable labels of desc or if a label
+// value is not valid UTF-8. It is used for metrics whose label values are not
+// checked by a MetricVec.
+func validateLabelValues(desc *Desc, labelValues []string) error {
+	if len(desc.variableLabels) != len(labelValues) {
+		return errInconsistentCardinality
+	}
+	for _, v := range labelValues {
+		if !utf8.ValidString(v) {
+			return fmt.Errorf("label value %q is not valid UTF-8", v)
+		}
+	}
+	return nil
+}
+
 // MustNewConstMetric is a version of NewConstMetric that panics where
 // NewConstMetric would have returned an error.
 func MustNewConstMetric(desc *Desc, valueType ValueType, value float64, labelValues ...string) Metric {
@@ -0,0 +1,215 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ValueStorage determines how counters and gauges store their value, see
+// Opts.ValueStorage.
+type ValueStorage int
+
+// Possible values for ValueStorage.
+const (
+	// StorageFloat64 stores values as float64. This is the default.
+	StorageFloat64 ValueStorage = iota
+	// StorageInt64 stores values as int64, which makes all operations a
+	// single atomic instruction. It is only suitable for metrics that
+	// change in whole numbers, like the number of requests or queued
+	// items: values that are not integers in the range of int64 are
+	// reported as instrumentation errors (see PanicOnInstrumentationError)
+	// and otherwise ignored. It saves little memory. On 64-bit platforms,
+	// a counter takes 64 instead of 80 allocated bytes and a gauge 64
+	// bytes either way, while a child of a metric vector with a single
+	// label takes about 250 bytes in total, most of them for its label.
+	StorageInt64
+)
+
+// String implements fmt.Stringer.
+func (s ValueStorage) String() string {
+	switch s {
+	case StorageFloat64:
+		return "float64"
+	case StorageInt64:
+		return "int64"
+	}
+	return fmt.Sprintf("ValueStorage(%d)", int(s))
+}
+
+// newGaugeValue returns a Gauge with the given Desc and label values, backed
+// by the given storage. See newValue.
+func newGaugeValue(desc *Desc, storage ValueStorage, labelValues ...string) Gauge {
+	switch storage {
+	case StorageInt64:
+		return newIntValue(desc, labelValues...)
+	}
+	return newValue(desc, GaugeValue, 0, labelValues...)
+}
+
+// newCounterValue returns a Counter with the given Desc and label values,
+// backed by the given storage.
+func newCounterValue(desc *Desc, storage ValueStorage, labelValues ...string) Counter {
+	if len(labelValues) != len(desc.variableLabels) {
+		panic(errInconsistentCardinality)
+	}
+	labelPairs := makeLabelPairs(desc, labelValues)
+	var result interface {
+		Counter
+		Init(Metric)
+	}
+	switch storage {
+	case StorageInt64:
+		result = &intCounter{intValue: intValue{desc: desc, labelPairs: labelPairs}}
+	default:
+		result = &counter{value: value{desc: desc, valType: CounterValue, labelPairs: labelPairs}}
+	}
+	result.Init(result) // Init self-collection.
+	return result
+}
+
+// toInt64 converts v for StorageInt64. If v is not an integer in the range of
+// int64, it reports an instrumentation error and returns false.
+func toInt64(v float64) (int64, bool) {
+	if v != math.Trunc(v) || v < -(1<<63) || v >= 1<<63 {
+		handleInstrumentationError(fmt.Errorf("value %v cannot be stored as int64", v))
+		return 0, false
+	}
+	return int64(v), true
+}
+
+// valueType returns the ValueType matching the metric type of d. Unlike value,
+// intValue does not store its ValueType to save memory.
+func (d *Desc) valueType() ValueType {
+	if d.metricType != nil {
+		switch *d.metricType {
+		case dto.MetricType_COUNTER:
+			return CounterValue
+		case dto.MetricType_GAUGE:
+			return GaugeValue
+		}
+	}
+	return UntypedValue
+}
+
+// intValue is the equivalent of value with StorageInt64.
+type intValue struct {
+	// valInt is only accessed atomically and has to go first in the
+	// struct to guarantee 64-bit alignment on 32-bit platforms.
+	valInt int64
+
+	SelfCollector
+
+	desc       *Desc
+	labelPairs []*dto.LabelPair
+}
+
+func newIntValue(desc *Desc, labelValues ...string) *intValue {
+	if len(labelValues) != len(desc.variableLabels) {
+		panic(errInconsistentCardinality)
+	}
+	result := &intValue{
+		desc:       desc,
+		labelPairs: makeLabelPairs(desc, labelValues),
+	}
+	result.Init(result)
+	return result
+}
+
+func (v *intValue) Desc() *Desc {
+	return v.desc
+}
+
+func (v *intValue) Set(val float64) {
+	if i, ok := toInt64(val); ok {
+		atomic.StoreInt64(&v.valInt, i)
+	}
+}
+
+func (v *intValue) Inc() {
+	atomic.AddInt64(&v.valInt, 1)
+}
+
+func (v *intValue) Dec() {
+	atomic.AddInt64(&v.valInt, -1)
+}
+
+func (v *intValue) Add(val float64) {
+	if i, ok := toInt64(val); ok {
+		atomic.AddInt64(&v.valInt, i)
+	}
+}
+
+func (v *intValue) Sub(val float64) {
+	if i, ok := toInt64(val); ok {
+		atomic.AddInt64(&v.valInt, -i)
+	}
+}
+
+func (v *intValue) Write(out *dto.Metric) error {
+	return populateMetric(v.desc.valueType(), float64(atomic.LoadInt64(&v.valInt)), v.labelPairs, out)
+}
+
+// writeForReset implements scrapeResetter.
+func (v *intValue) writeForReset(out *dto.Metric) (func(), error) {
+	val := atomic.LoadInt64(&v.valInt)
+	if err := populateMetric(v.desc.valueType(), float64(val), v.labelPairs, out); err != nil {
+		return nil, err
+	}
+	return func() { atomic.AddInt64(&v.valInt, -val) }, nil
+}
+
+// intCounter is the equivalent of counter with StorageInt64.
+type intCounter struct {
+	intValue
+}
+
+func (c *intCounter) Add(v float64) {
+	if v < 0 {
+		handleInstrumentationError(errors.New("counter cannot decrease in value"))
+		return
+	}
+	c.intValue.Add(v)
+}
+
+func (c *intCounter) AddMany(vs []float64) {
+	var sum int64
+	for _, v := range vs {
+		if v < 0 {
+			handleInstrumentationError(errors.New("counter cannot decrease in value"))
+			continue
+		}
+		if i, ok := toInt64(v); ok {
+			sum += i
+		}
+	}
+	if sum != 0 {
+		atomic.AddInt64(&c.valInt, sum)
+	}
+}
+
+func (c *intCounter) restoreState(m *dto.Metric) error {
+	if m.Counter == nil {
+		return fmt.Errorf("saved metric %s is not a counter", m)
+	}
+	if v := m.Counter.GetValue(); v > 0 {
+		c.Add(v)
+	}
+	return nil
+}
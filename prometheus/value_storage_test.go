@@ -0,0 +1,143 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestValueStorage(t *testing.T) {
+	for _, storage := range []ValueStorage{StorageFloat64, StorageInt64} {
+		gauges := NewGaugeVec(GaugeOpts{
+			Name:         "test_gauge",
+			Help:         "test help",
+			ValueStorage: storage,
+		}, []string{"a"})
+		g := gauges.WithLabelValues("1")
+		g.Set(40)
+		g.Inc()
+		g.Add(3)
+		g.Sub(1)
+		g.Dec()
+
+		counters := NewCounterVec(CounterOpts{
+			Name:         "test_counter",
+			Help:         "test help",
+			ValueStorage: storage,
+		}, []string{"a"})
+		c := counters.WithLabelValues("1")
+		c.Inc()
+		c.Add(40)
+		AddMany(c, []float64{2, 3})
+
+		m := &dto.Metric{}
+		if err := g.Write(m); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := m.GetGauge().GetValue(), 42.; got != want {
+			t.Errorf("%s: got gauge value %v, want %v", storage, got, want)
+		}
+		m.Reset()
+		if err := c.Write(m); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := m.GetCounter().GetValue(), 46.; got != want {
+			t.Errorf("%s: got counter value %v, want %v", storage, got, want)
+		}
+		if expected, got := "counter cannot decrease in value", decrease(c).Error(); expected != got {
+			t.Errorf("%s: expected error %q, got %q", storage, expected, got)
+		}
+	}
+
+	if err := newRegistry().Register(NewGauge(GaugeOpts{
+		Name:         "test_gauge",
+		Help:         "test help",
+		ValueStorage: StorageInt64 + 1,
+	})); err == nil {
+		t.Error("registering a gauge with unknown value storage succeeded")
+	}
+
+	if unsafe.Sizeof(intCounter{}) >= unsafe.Sizeof(counter{}) {
+		t.Error("intCounter is not smaller than counter")
+	}
+	if unsafe.Sizeof(intValue{}) >= unsafe.Sizeof(value{}) {
+		t.Error("intValue is not smaller than value")
+	}
+}
+
+func TestValueStorageInt64Rejects(t *testing.T) {
+	PanicOnInstrumentationError(false)
+	defer PanicOnInstrumentationError(true)
+
+	g := NewGauge(GaugeOpts{Name: "test_gauge", Help: "test help", ValueStorage: StorageInt64})
+	c := NewCounter(CounterOpts{Name: "test_counter", Help: "test help", ValueStorage: StorageInt64})
+	g.Set(3)
+	c.Add(3)
+	before := atomic.LoadUint64(&instrumentationErrors)
+	g.Set(0.5)
+	g.Add(1e19)
+	g.Sub(math.NaN())
+	c.Add(0.5)
+	AddMany(c, []float64{1, 0.25})
+	if got, want := atomic.LoadUint64(&instrumentationErrors)-before, uint64(5); got != want {
+		t.Errorf("got %d instrumentation errors, want %d", got, want)
+	}
+
+	m := &dto.Metric{}
+	g.Write(m)
+	if got, want := m.GetGauge().GetValue(), 3.; got != want {
+		t.Errorf("got gauge value %v, want %v", got, want)
+	}
+	m.Reset()
+	c.Write(m)
+	if got, want := m.GetCounter().GetValue(), 4.; got != want {
+		t.Errorf("got counter value %v, want %v", got, want)
+	}
+}
+
+func TestValueStorageResetOnScrape(t *testing.T) {
+	r := newRegistry()
+	c := NewCounter(CounterOpts{
+		Name:          "test_counter",
+		Help:          "test help",
+		ValueStorage:  StorageInt64,
+		ResetOnScrape: true,
+	})
+	r.MustRegister(c)
+	c.Add(3)
+	for _, want := range []float64{3, 0} {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mfs[0].Metric[0].GetCounter().GetValue(); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func decrease(c Counter) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = e.(error)
+		}
+	}()
+	c.Add(-1)
+	return nil
+}
@@ -14,10 +14,45 @@
 package prometheus
 
 import (
-	"bytes"
+	"container/list"
 	"fmt"
-	"hash"
+	"math"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// fingerprintCollisions counts the hash collisions detected between label
+// values of different children of any MetricVec. Accessed atomically. It is
+// reported by the ClientCollector.
+var fingerprintCollisions uint64
+
+// OverflowPolicy determines how a metric vector with a limited number of
+// children (see Opts.MaxChildren) deals with a label value combination that
+// would exceed the limit.
+type OverflowPolicy int
+
+// Possible values for OverflowPolicy.
+const (
+	// OverflowReject makes GetMetricWith and GetMetricWithLabelValues
+	// return an error (and With and WithLabelValues panic).
+	OverflowReject OverflowPolicy = iota
+	// OverflowEvictOldest deletes the oldest child of the vector to make
+	// room for the new one.
+	OverflowEvictOldest
+	// OverflowCollapse returns a shared overflow child instead, i.e. the
+	// child with all variable labels set to OverflowLabelValue.
+	OverflowCollapse
+	// OverflowEvictLeastRecentlyUsed deletes the child of the vector that
+	// has been retrieved least recently (by GetMetricWith,
+	// GetMetricWithLabelValues, With, or WithLabelValues) to make room for
+	// the new one, so that hot children survive while cold ones age out.
+	// Updates of a child kept by the caller do not count as use. Finding
+	// the least recently used child takes time linear in MaxChildren, so
+	// the policy suits vectors whose limit is rarely hit.
+	OverflowEvictLeastRecentlyUsed
 )
 
 // MetricVec is a Collector to bundle metrics of the same name that
@@ -26,32 +61,115 @@ import (
 // type. GaugeVec, CounterVec, SummaryVec, and UntypedVec are examples already
 // provided in this package.
 type MetricVec struct {
-	mtx      sync.RWMutex // Protects not only children, but also hash and buf.
-	children map[uint64]Metric
-	desc     *Desc
+	// dropped counts the label value combinations that did not get a
+	// child of their own because of maxChildren, or whose child was
+	// evicted. Accessed atomically and therefore first in the struct to
+	// guarantee alignment.
+	dropped uint64
+	// useClock is incremented on each retrieval of a child for
+	// OverflowEvictLeastRecentlyUsed. Accessed atomically.
+	useClock uint64
+
+	// mtx serializes all changes to the set of children and protects
+	// numChildren, order, and elements. The children themselves live in
+	// stripes selected by their hash. Looking up an existing child only
+	// takes the read lock of its stripe, so it is not stalled by the
+	// creation of children in other stripes.
+	mtx         sync.Mutex
+	stripes     [numVecStripes]vecStripe
+	numChildren int
+	desc        *Desc
+
+	// sanitize makes the vector replace invalid UTF-8 in label values
+	// instead of rejecting them.
+	sanitize bool
 
-	// hash is our own hash instance to avoid repeated allocations.
-	hash hash.Hash64
-	// buf is used to copy string contents into it for hashing,
-	// again to avoid allocations.
-	buf bytes.Buffer
+	// maxChildren and overflow limit the number of children, see
+	// Opts.MaxChildren. order and elements track the creation order of the
+	// children for OverflowEvictOldest. They are created lazily.
+	maxChildren int
+	overflow    OverflowPolicy
+	order       *list.List
+	elements    map[uint64]*list.Element
+
+	// defaults holds values for variable labels missing in GetMetricWith.
+	defaults Labels
+	// normalizers maps variable label names to functions applied to their
+	// values, see Opts.LabelValueNormalizers.
+	normalizers map[string]func(string) string
+	// expectedChildren is the capacity hint from Opts.ExpectedChildren.
+	expectedChildren int
+
+	// parent is set for curried vectors (see CurryWith), which are views
+	// on the parent vector that fill in the curried label values. All
+	// children live in the parent.
+	parent *MetricVec
+	curry  []curriedLabelValue
+
+	// createHooks and forgetHooks are registered with OnCreate and
+	// OnForget. childEvents holds the creations and deletions of children
+	// whose hooks have not been called yet. All are protected by mtx.
+	createHooks, forgetHooks []childHook
+	childEvents              []childEvent
 
 	newMetric func(labelValues ...string) Metric
+
+	// noop, if set, is returned for all label values without creating any
+	// children, see NewNoopCounterVec and friends.
+	noop Metric
+}
+
+// numVecStripes is the number of stripes the children of a MetricVec are
+// distributed over.
+const numVecStripes = 16
+
+// vecStripe holds the children of a MetricVec whose hashes fall into the
+// stripe. Its maps are only modified while also holding the mtx of the
+// MetricVec, so that holding the latter is sufficient for reading them.
+type vecStripe struct {
+	mtx      sync.RWMutex
+	children map[uint64]Metric
+	// labelValues holds the label values of each child to detect hash
+	// collisions.
+	labelValues map[uint64][]string
+	// lastUse holds the value of useClock at the last retrieval of each
+	// child for OverflowEvictLeastRecentlyUsed. The values are accessed
+	// atomically.
+	lastUse map[uint64]*uint64
+}
+
+// stripe returns the stripe responsible for the provided hash.
+func (m *MetricVec) stripe(hash uint64) *vecStripe {
+	return &m.stripes[hash%numVecStripes]
 }
 
 // Describe implements Collector. The length of the returned slice
 // is always one.
 func (m *MetricVec) Describe(ch chan<- *Desc) {
-	ch <- m.desc
+	switch {
+	case m.parent != nil:
+		m.parent.Describe(ch)
+	case m.noop != nil:
+		ch <- noopDesc
+	default:
+		ch <- m.desc
+	}
 }
 
-// Collect implements Collector.
+// Collect implements Collector. A curried vector collects all metrics of the
+// vector it has been curried from.
 func (m *MetricVec) Collect(ch chan<- Metric) {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
-
-	for _, metric := range m.children {
-		ch <- metric
+	if m.parent != nil {
+		m.parent.Collect(ch)
+		return
+	}
+	for i := range m.stripes {
+		s := &m.stripes[i]
+		s.mtx.RLock()
+		for _, metric := range s.children {
+			ch <- metric
+		}
+		s.mtx.RUnlock()
 	}
 }
 
@@ -66,7 +184,8 @@ func (m *MetricVec) Collect(ch chan<- Metric) {
 // example.
 //
 // An error is returned if the number of label values is not the same as the
-// number of VariableLabels in Desc.
+// number of VariableLabels in Desc or if a label value is not valid UTF-8 (and
+// the MetricVec has not been configured to sanitize label values).
 //
 // Note that for more than one label value, this method is prone to mistakes
 // caused by an incorrect order of arguments. Consider GetMetricWith(Labels) as
@@ -75,60 +194,111 @@ func (m *MetricVec) Collect(ch chan<- Metric) {
 // with a performance overhead (for creating and processing the Labels map).
 // See also the GaugeVec example.
 func (m *MetricVec) GetMetricWithLabelValues(lvs ...string) (Metric, error) {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
+	metric, _, err := m.GetOrCreateMetricWithLabelValues(lvs...)
+	return metric, err
+}
 
+// GetOrCreateMetricWithLabelValues works like GetMetricWithLabelValues, but
+// also reports whether the Metric was newly created by this call. This allows
+// to run one-time initialization of a child, e.g. logging its creation,
+// exactly once. If the vector collapses the label values into its overflow
+// child (see OverflowCollapse), created is false.
+func (m *MetricVec) GetOrCreateMetricWithLabelValues(lvs ...string) (metric Metric, created bool, err error) {
+	if m.parent != nil {
+		lvs, err := m.uncurryLabelValues(lvs)
+		if err != nil {
+			return nil, false, err
+		}
+		return m.parent.GetOrCreateMetricWithLabelValues(lvs...)
+	}
+	lvs, err = m.checkLabelValues(m.normalizeLabelValues(lvs))
+	if err != nil {
+		return nil, false, err
+	}
 	h, err := m.hashLabelValues(lvs)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	return m.getOrCreateMetric(h, lvs...), nil
+	return m.getOrCreateMetric(h, lvs...)
 }
 
 // GetMetricWith returns the Metric for the given Labels map (the label names
-// must match those of the VariableLabels in Desc). If that label map is
+// must match those of the VariableLabels in Desc, but labels with a default
+// value, see Opts.DefaultLabelValues, may be omitted). If that label map is
 // accessed for the first time, a new Metric is created. Implications of keeping
 // the Metric are the same as for GetMetricWithLabelValues.
 //
 // An error is returned if the number and names of the Labels are inconsistent
-// with those of the VariableLabels in Desc.
+// with those of the VariableLabels in Desc or if a label value is not valid
+// UTF-8 (and the MetricVec has not been configured to sanitize label values).
 //
 // This method is used for the same purpose as
 // GetMetricWithLabelValues(...string). See there for pros and cons of the two
 // methods.
 func (m *MetricVec) GetMetricWith(labels Labels) (Metric, error) {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
+	metric, _, err := m.GetOrCreateMetricWith(labels)
+	return metric, err
+}
+
+// GetOrCreateMetricWith works like GetMetricWith, but also reports whether the
+// Metric was newly created by this call. See
+// GetOrCreateMetricWithLabelValues.
+func (m *MetricVec) GetOrCreateMetricWith(labels Labels) (metric Metric, created bool, err error) {
+	if m.parent != nil {
+		labels, err := m.uncurryLabels(labels)
+		if err != nil {
+			return nil, false, err
+		}
+		return m.parent.GetOrCreateMetricWith(labels)
+	}
+	labels = m.normalizeLabels(m.applyDefaults(labels))
 
 	h, err := m.hashLabels(labels)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	// Existing children are found without building the label value slice.
+	if metric, ok := m.getMetricWithLabels(h, labels); ok {
+		return metric, false, nil
 	}
 	lvs := make([]string, len(labels))
 	for i, label := range m.desc.variableLabels {
 		lvs[i] = labels[label]
 	}
-	return m.getOrCreateMetric(h, lvs...), nil
+	checked, err := m.checkLabelValues(lvs)
+	if err != nil {
+		return nil, false, err
+	}
+	if m.sanitize {
+		// Sanitizing might have changed label values, so hash again.
+		lvs = checked
+		if h, err = m.hashLabelValues(lvs); err != nil {
+			return nil, false, err
+		}
+	}
+	return m.getOrCreateMetric(h, lvs...)
 }
 
 // WithLabelValues works as GetMetricWithLabelValues, but panics if an error
-// occurs. The method allows neat syntax like:
+// occurs (see PanicOnInstrumentationError). The method allows neat syntax like:
 //     httpReqs.WithLabelValues("404", "POST").Inc()
 func (m *MetricVec) WithLabelValues(lvs ...string) Metric {
 	metric, err := m.GetMetricWithLabelValues(lvs...)
 	if err != nil {
-		panic(err)
+		handleInstrumentationError(err)
+		return discardMetric
 	}
 	return metric
 }
 
-// With works as GetMetricWith, but panics if an error occurs. The method allows
-// neat syntax like:
+// With works as GetMetricWith, but panics if an error occurs (see
+// PanicOnInstrumentationError). The method allows neat syntax like:
 //     httpReqs.With(Labels{"status":"404", "method":"POST"}).Inc()
 func (m *MetricVec) With(labels Labels) Metric {
 	metric, err := m.GetMetricWith(labels)
 	if err != nil {
-		panic(err)
+		handleInstrumentationError(err)
+		return discardMetric
 	}
 	return metric
 }
@@ -149,18 +319,22 @@ func (m *MetricVec) With(labels Labels) Metric {
 // with a performance overhead (for creating and processing the Labels map).
 // See also the CounterVec example.
 func (m *MetricVec) DeleteLabelValues(lvs ...string) bool {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
-
-	h, err := m.hashLabelValues(lvs)
-	if err != nil {
-		return false
+	if m.parent != nil {
+		lvs, err := m.uncurryLabelValues(lvs)
+		if err != nil {
+			return false
+		}
+		return m.parent.DeleteLabelValues(lvs...)
 	}
-	if _, has := m.children[h]; !has {
+	h, err := m.hashLabelValues(m.normalizeLabelValues(lvs))
+	if err != nil {
 		return false
 	}
-	delete(m.children, h)
-	return true
+
+	m.mtx.Lock()
+	defer m.unlockAndNotify()
+
+	return m.deleteChild(h)
 }
 
 // Delete deletes the metric where the variable labels are the same as those
@@ -174,68 +348,592 @@ func (m *MetricVec) DeleteLabelValues(lvs ...string) bool {
 // This method is used for the same purpose as DeleteLabelValues(...string). See
 // there for pros and cons of the two methods.
 func (m *MetricVec) Delete(labels Labels) bool {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
-
-	h, err := m.hashLabels(labels)
-	if err != nil {
-		return false
+	if m.parent != nil {
+		labels, err := m.uncurryLabels(labels)
+		if err != nil {
+			return false
+		}
+		return m.parent.Delete(labels)
 	}
-	if _, has := m.children[h]; !has {
+	h, err := m.hashLabels(m.normalizeLabels(labels))
+	if err != nil {
 		return false
 	}
-	delete(m.children, h)
-	return true
+
+	m.mtx.Lock()
+	defer m.unlockAndNotify()
+
+	return m.deleteChild(h)
 }
 
-// Reset deletes all metrics in this vector.
+// Reset deletes all metrics in this vector. For a curried vector, only the
+// metrics with matching curried label values are deleted.
 func (m *MetricVec) Reset() {
+	if m.parent != nil {
+		m.parent.resetMatching(m.curry)
+		return
+	}
+	m.resetMatching(nil)
+}
+
+func (m *MetricVec) resetMatching(curry []curriedLabelValue) {
+	m.mtx.Lock()
+	defer m.unlockAndNotify()
+
+	for i := range m.stripes {
+		s := &m.stripes[i]
+		s.mtx.Lock()
+		for h := range s.children {
+			if !matchesCurry(s.labelValues[h], curry) {
+				continue
+			}
+			lvs := s.labelValues[h]
+			delete(s.children, h)
+			delete(s.labelValues, h)
+			delete(s.lastUse, h)
+			m.forgetChild(h, lvs)
+		}
+		s.mtx.Unlock()
+	}
+}
+
+// childStats returns the fully-qualified name of the MetricVec, the number of
+// children it currently holds, and the number of label value combinations
+// dropped because of its limit on children.
+func (m *MetricVec) childStats() (string, int, uint64) {
+	if m.parent != nil {
+		return m.parent.childStats()
+	}
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
-	for h := range m.children {
-		delete(m.children, h)
+	return m.desc.fqName, m.numChildren, atomic.LoadUint64(&m.dropped)
+}
+
+// applyDefaults returns labels with the default values added for all missing
+// variable labels. labels itself is not modified.
+func (m *MetricVec) applyDefaults(labels Labels) Labels {
+	if len(m.defaults) == 0 || len(labels) == len(m.desc.variableLabels) {
+		return labels
+	}
+	var withDefaults Labels
+	for _, name := range m.desc.variableLabels {
+		if _, ok := labels[name]; ok {
+			continue
+		}
+		value, ok := m.defaults[name]
+		if !ok {
+			continue
+		}
+		if withDefaults == nil {
+			withDefaults = make(Labels, len(m.desc.variableLabels))
+			for n, v := range labels {
+				withDefaults[n] = v
+			}
+		}
+		withDefaults[name] = value
+	}
+	if withDefaults == nil {
+		return labels
+	}
+	return withDefaults
+}
+
+// normalizeLabelValues returns lvs with the normalizers applied. lvs itself is
+// not modified.
+func (m *MetricVec) normalizeLabelValues(lvs []string) []string {
+	if len(m.normalizers) == 0 || len(lvs) != len(m.desc.variableLabels) {
+		return lvs
+	}
+	normalized := make([]string, len(lvs))
+	for i, lv := range lvs {
+		normalized[i] = m.normalizeLabelValue(m.desc.variableLabels[i], lv)
+	}
+	return normalized
+}
+
+// normalizeLabels returns a copy of labels with the normalizers applied, or
+// labels itself if there are no normalizers.
+func (m *MetricVec) normalizeLabels(labels Labels) Labels {
+	if len(m.normalizers) == 0 {
+		return labels
+	}
+	normalized := make(Labels, len(labels))
+	for name, value := range labels {
+		normalized[name] = m.normalizeLabelValue(name, value)
+	}
+	return normalized
+}
+
+func (m *MetricVec) normalizeLabelValue(name, value string) string {
+	if normalize, ok := m.normalizers[name]; ok {
+		return normalize(value)
 	}
+	return value
 }
 
+// checkLabelValues returns an error if any of the provided label values is not
+// valid UTF-8. If the MetricVec sanitizes label values, a copy of lvs with
+// invalid sequences replaced is returned instead. lvs is never modified.
+func (m *MetricVec) checkLabelValues(lvs []string) ([]string, error) {
+	var sanitized []string
+	for i, v := range lvs {
+		if utf8.ValidString(v) {
+			continue
+		}
+		if !m.sanitize {
+			return nil, fmt.Errorf("label value %q is not valid UTF-8", v)
+		}
+		if sanitized == nil {
+			sanitized = append(make([]string, 0, len(lvs)), lvs...)
+		}
+		sanitized[i] = SanitizeLabelValue(v)
+	}
+	if sanitized != nil {
+		return sanitized, nil
+	}
+	return lvs, nil
+}
+
+// hashLabelValues and hashLabels hash each label value on its own with xxHash
+// and combine the fixed-size results. This way, label values like ("ab", "c")
+// and ("a", "bc") result in different hashes, and long label values are hashed
+// much faster than byte by byte.
 func (m *MetricVec) hashLabelValues(vals []string) (uint64, error) {
 	if len(vals) != len(m.desc.variableLabels) {
-		return 0, errInconsistentCardinality
+		return 0, m.labelValuesError(len(vals))
 	}
-	m.hash.Reset()
+	h := hashNew()
 	for _, val := range vals {
-		m.buf.Reset()
-		m.buf.WriteString(val)
-		m.hash.Write(m.buf.Bytes())
+		h = xxMergeRound(h, xxhashString(val))
 	}
-	return m.hash.Sum64(), nil
+	return h, nil
 }
 
 func (m *MetricVec) hashLabels(labels Labels) (uint64, error) {
 	if len(labels) != len(m.desc.variableLabels) {
-		return 0, errInconsistentCardinality
+		return 0, m.labelsError(labels)
 	}
-	m.hash.Reset()
+	h := hashNew()
 	for _, label := range m.desc.variableLabels {
 		val, ok := labels[label]
 		if !ok {
-			return 0, fmt.Errorf("label name %q missing in label map", label)
+			return 0, m.labelsError(labels)
 		}
-		m.buf.Reset()
-		m.buf.WriteString(val)
-		m.hash.Write(m.buf.Bytes())
+		h = xxMergeRound(h, xxhashString(val))
 	}
-	return m.hash.Sum64(), nil
+	return h, nil
 }
 
-func (m *MetricVec) getOrCreateMetric(hash uint64, labelValues ...string) Metric {
-	metric, ok := m.children[hash]
+// LabelsError is returned by the methods of metric vectors if the provided
+// label values or labels do not match the variable labels of the vector. It
+// reports all mismatches at once.
+type LabelsError struct {
+	// FQName is the fully-qualified name of the metric vector.
+	FQName string
+	// LabelNames are the expected label names, i.e. the variable labels
+	// of the vector that are not curried.
+	LabelNames []string
+	// NumValues is the number of label values provided, or -1 if Labels
+	// have been provided.
+	NumValues int
+	// Missing are the expected label names missing in the provided Labels,
+	// Unknown the provided label names that are not expected. Both are
+	// sorted.
+	Missing, Unknown []string
+}
+
+func (e *LabelsError) Error() string {
+	if e.NumValues >= 0 {
+		return fmt.Sprintf(
+			"%s for %s: got %d label values, want %d for %q",
+			errInconsistentCardinality, e.FQName, e.NumValues, len(e.LabelNames), e.LabelNames,
+		)
+	}
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, fmt.Sprintf("missing label names %q", e.Missing))
+	}
+	if len(e.Unknown) > 0 {
+		problems = append(problems, fmt.Sprintf("unknown label names %q", e.Unknown))
+	}
+	return fmt.Sprintf("inconsistent labels for %s: %s", e.FQName, strings.Join(problems, ", "))
+}
+
+// labelValuesError returns a LabelsError for n provided label values.
+func (m *MetricVec) labelValuesError(n int) error {
+	return &LabelsError{
+		FQName:     m.desc.fqName,
+		LabelNames: m.freeLabelNames(),
+		NumValues:  n,
+	}
+}
+
+// labelsError returns a LabelsError for labels, listing all missing and unknown
+// label names.
+func (m *MetricVec) labelsError(labels Labels) error {
+	e := &LabelsError{
+		FQName:     m.desc.fqName,
+		LabelNames: m.freeLabelNames(),
+		NumValues:  -1,
+	}
+	expected := make(map[string]struct{}, len(e.LabelNames))
+	for _, name := range e.LabelNames {
+		expected[name] = struct{}{}
+		if _, ok := labels[name]; !ok {
+			e.Missing = append(e.Missing, name)
+		}
+	}
+	for name := range labels {
+		if _, ok := expected[name]; !ok {
+			e.Unknown = append(e.Unknown, name)
+		}
+	}
+	sort.Strings(e.Missing)
+	sort.Strings(e.Unknown)
+	return e
+}
+
+// freeLabelNames returns the variable label names that are not curried.
+func (m *MetricVec) freeLabelNames() []string {
+	names := make([]string, 0, len(m.desc.variableLabels))
+	for _, name := range m.desc.variableLabels {
+		if !m.isCurried(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// getOrCreateMetric returns the child for the provided hash and label values,
+// creating it if needed, and whether it was created. Only the read lock of the
+// stripe is taken if the child exists.
+func (m *MetricVec) getOrCreateMetric(hash uint64, labelValues ...string) (Metric, bool, error) {
+	if m.noop != nil {
+		return m.noop, false, nil
+	}
+	s := m.stripe(hash)
+	s.mtx.RLock()
+	metric, ok := s.getMetric(hash, labelValues)
+	if ok {
+		m.touch(s, hash)
+	}
+	s.mtx.RUnlock()
+	if ok {
+		return metric, false, nil
+	}
+
+	m.mtx.Lock()
+	defer m.unlockAndNotify()
+
+	// Check again as the child might have been created in the meantime.
+	if metric, ok := s.getMetric(hash, labelValues); ok {
+		m.touch(s, hash)
+		return metric, false, nil
+	}
+	if m.maxChildren > 0 && m.numChildren >= m.maxChildren {
+		atomic.AddUint64(&m.dropped, 1)
+		switch m.overflow {
+		case OverflowEvictOldest:
+			m.deleteChild(m.order.Front().Value.(uint64))
+		case OverflowEvictLeastRecentlyUsed:
+			m.deleteChild(m.leastRecentlyUsed())
+		case OverflowCollapse:
+			return m.overflowMetric(), false, nil
+		default:
+			return nil, false, fmt.Errorf(
+				"metric vector %s has reached its limit of %d children",
+				m.desc.fqName, m.maxChildren,
+			)
+		}
+	}
+	return m.createMetric(hash, labelValues), true, nil
+}
+
+// getMetric returns the child for the provided hash, if any, and records a
+// collision if its label values differ from the provided ones. The caller must
+// hold at least the read lock of the stripe or the mtx of the MetricVec.
+func (s *vecStripe) getMetric(hash uint64, labelValues []string) (Metric, bool) {
+	metric, ok := s.children[hash]
+	if ok && !equalLabelValues(s.labelValues[hash], labelValues) {
+		atomic.AddUint64(&fingerprintCollisions, 1)
+	}
+	return metric, ok
+}
+
+// getMetricWithLabels returns the existing child with the provided hash if its
+// label values match labels. It allocates nothing and leaves the detection of
+// hash collisions to the slower path through getOrCreateMetric. Stored label
+// values are always valid UTF-8, so a match also means that labels would have
+// passed checkLabelValues.
+func (m *MetricVec) getMetricWithLabels(hash uint64, labels Labels) (Metric, bool) {
+	s := m.stripe(hash)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	metric, ok := s.children[hash]
 	if !ok {
-		// Copy labelValues. Otherwise, they would be allocated even if we don't go
-		// down this code path.
-		copiedLabelValues := append(make([]string, 0, len(labelValues)), labelValues...)
-		metric = m.newMetric(copiedLabelValues...)
-		m.children[hash] = metric
+		return nil, false
+	}
+	lvs := s.labelValues[hash]
+	for i, name := range m.desc.variableLabels {
+		if lvs[i] != labels[name] {
+			return nil, false
+		}
+	}
+	m.touch(s, hash)
+	return metric, true
+}
+
+// touch records the retrieval of the child with the provided hash for
+// OverflowEvictLeastRecentlyUsed. The caller must hold at least the read lock
+// of the stripe.
+func (m *MetricVec) touch(s *vecStripe, hash uint64) {
+	if m.overflow != OverflowEvictLeastRecentlyUsed || m.maxChildren <= 0 {
+		return
+	}
+	atomic.StoreUint64(s.lastUse[hash], atomic.AddUint64(&m.useClock, 1))
+}
+
+// leastRecentlyUsed returns the hash of the child retrieved least recently.
+// The caller must hold the mtx of the MetricVec.
+func (m *MetricVec) leastRecentlyUsed() uint64 {
+	var (
+		oldestHash uint64
+		oldestUse  uint64 = math.MaxUint64
+	)
+	for i := range m.stripes {
+		for h, use := range m.stripes[i].lastUse {
+			if u := atomic.LoadUint64(use); u < oldestUse {
+				oldestHash, oldestUse = h, u
+			}
+		}
+	}
+	return oldestHash
+}
+
+// overflowMetric returns the child with all variable labels set to
+// OverflowLabelValue, creating it if needed (regardless of maxChildren).
+func (m *MetricVec) overflowMetric() Metric {
+	lvs := make([]string, len(m.desc.variableLabels))
+	for i := range lvs {
+		lvs[i] = OverflowLabelValue
+	}
+	h, _ := m.hashLabelValues(lvs)
+	if metric, ok := m.stripe(h).children[h]; ok {
+		return metric
+	}
+	return m.createMetric(h, lvs)
+}
+
+// createMetric creates and stores a new child. The caller must hold the mtx of
+// the MetricVec and release it with unlockAndNotify.
+func (m *MetricVec) createMetric(hash uint64, labelValues []string) Metric {
+	// Copy labelValues. Otherwise, they would be allocated even if we don't go
+	// down this code path.
+	copiedLabelValues := append(make([]string, 0, len(labelValues)), labelValues...)
+	metric := m.newMetric(copiedLabelValues...)
+	s := m.stripe(hash)
+	s.mtx.Lock()
+	if s.children == nil {
+		// Hashes are evenly distributed over the stripes.
+		size := m.expectedChildren / numVecStripes
+		s.children = make(map[uint64]Metric, size)
+		s.labelValues = make(map[uint64][]string, size)
+	}
+	s.children[hash] = metric
+	s.labelValues[hash] = copiedLabelValues
+	if m.maxChildren > 0 && m.overflow == OverflowEvictLeastRecentlyUsed {
+		if s.lastUse == nil {
+			s.lastUse = map[uint64]*uint64{}
+		}
+		use := atomic.AddUint64(&m.useClock, 1)
+		s.lastUse[hash] = &use
+	}
+	s.mtx.Unlock()
+	m.numChildren++
+	m.queueCreate(copiedLabelValues)
+	if m.maxChildren > 0 && m.overflow == OverflowEvictOldest {
+		if m.order == nil {
+			m.order = list.New()
+			m.elements = make(map[uint64]*list.Element, m.expectedChildren)
+		}
+		m.elements[hash] = m.order.PushBack(hash)
 	}
 	return metric
 }
+
+// deleteChild deletes the child with the provided hash and reports whether it
+// existed. The caller must hold the mtx of the MetricVec and release it with
+// unlockAndNotify.
+func (m *MetricVec) deleteChild(hash uint64) bool {
+	s := m.stripe(hash)
+	if _, ok := s.children[hash]; !ok {
+		return false
+	}
+	lvs := s.labelValues[hash]
+	s.mtx.Lock()
+	delete(s.children, hash)
+	delete(s.labelValues, hash)
+	delete(s.lastUse, hash)
+	s.mtx.Unlock()
+	m.forgetChild(hash, lvs)
+	return true
+}
+
+// forgetChild updates the bookkeeping of the MetricVec after the child with the
+// provided hash and label values has been removed from its stripe, queueing
+// the notification of forget hooks (see OnForget).
+func (m *MetricVec) forgetChild(hash uint64, labelValues []string) {
+	m.numChildren--
+	if e, ok := m.elements[hash]; ok {
+		m.order.Remove(e)
+		delete(m.elements, hash)
+	}
+	m.queueForget(labelValues)
+}
+
+func equalLabelValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type curriedLabelValue struct {
+	index int
+	value string
+}
+
+// CurryWith returns a vector curried with the provided labels, i.e. a view on
+// this vector with those label values fixed. Metrics retrieved from the curried
+// vector only require the remaining labels, and its GetMetricWith and
+// GetMetricWithLabelValues methods reject the curried labels. This way, a
+// subsystem can be handed a vector that only takes the labels it knows about.
+//
+// The metrics are shared with the original vector. Only register the original
+// vector (as the Collect method of a curried vector collects all metrics of the
+// original vector). Curried vectors can be curried further.
+//
+// An error is returned if a label name is not a variable label of the vector,
+// if it has been curried already, or if a label value is not valid UTF-8 (and
+// the vector has not been configured to sanitize label values).
+func (m *MetricVec) CurryWith(labels Labels) (*MetricVec, error) {
+	curried := &MetricVec{}
+	if err := m.curryInto(labels, curried); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *MetricVec) MustCurryWith(labels Labels) *MetricVec {
+	curried, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return curried
+}
+
+// curryInto initializes curried as a view on m with the provided labels
+// curried. It is used by the typed vectors to avoid copying a MetricVec.
+func (m *MetricVec) curryInto(labels Labels, curried *MetricVec) error {
+	curry := append([]curriedLabelValue(nil), m.curry...)
+	for name, value := range labels {
+		index := -1
+		for i, label := range m.desc.variableLabels {
+			if label == name {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("label name %q is not a variable label of %s", name, m.desc.fqName)
+		}
+		if m.isCurried(name) {
+			return fmt.Errorf("label name %q is already curried", name)
+		}
+		lvs, err := m.checkLabelValues([]string{m.normalizeLabelValue(name, value)})
+		if err != nil {
+			return err
+		}
+		curry = append(curry, curriedLabelValue{index: index, value: lvs[0]})
+	}
+	sort.Sort(curriedLabelValues(curry))
+
+	curried.desc = m.desc
+	curried.sanitize = m.sanitize
+	curried.normalizers = m.normalizers
+	curried.parent = m
+	if m.parent != nil {
+		curried.parent = m.parent
+	}
+	curried.curry = curry
+	return nil
+}
+
+// isCurried returns whether the provided label name is curried in m.
+func (m *MetricVec) isCurried(name string) bool {
+	for _, c := range m.curry {
+		if m.desc.variableLabels[c.index] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uncurryLabelValues returns the full list of label values, i.e. lvs with the
+// curried label values inserted at their positions.
+func (m *MetricVec) uncurryLabelValues(lvs []string) ([]string, error) {
+	if len(lvs)+len(m.curry) != len(m.desc.variableLabels) {
+		return nil, m.labelValuesError(len(lvs))
+	}
+	full := make([]string, 0, len(m.desc.variableLabels))
+	curry := m.curry
+	for i := range m.desc.variableLabels {
+		if len(curry) > 0 && curry[0].index == i {
+			full = append(full, curry[0].value)
+			curry = curry[1:]
+			continue
+		}
+		full = append(full, lvs[0])
+		lvs = lvs[1:]
+	}
+	return full, nil
+}
+
+// uncurryLabels returns a copy of labels with the curried labels added.
+func (m *MetricVec) uncurryLabels(labels Labels) (Labels, error) {
+	full := make(Labels, len(labels)+len(m.curry))
+	for name, value := range labels {
+		if m.isCurried(name) {
+			return nil, m.labelsError(labels)
+		}
+		full[name] = value
+	}
+	for _, c := range m.curry {
+		full[m.desc.variableLabels[c.index]] = c.value
+	}
+	return full, nil
+}
+
+func matchesCurry(lvs []string, curry []curriedLabelValue) bool {
+	for _, c := range curry {
+		if lvs[c.index] != c.value {
+			return false
+		}
+	}
+	return true
+}
+
+type curriedLabelValues []curriedLabelValue
+
+func (s curriedLabelValues) Len() int           { return len(s) }
+func (s curriedLabelValues) Less(i, j int) bool { return s[i].index < s[j].index }
+func (s curriedLabelValues) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
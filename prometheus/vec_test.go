@@ -14,16 +14,17 @@
 package prometheus
 
 import (
-	"hash/fnv"
+	"fmt"
 	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestDelete(t *testing.T) {
 	desc := NewDesc("test", "helpless", []string{"l1", "l2"}, nil)
 	vec := MetricVec{
-		children: map[uint64]Metric{},
-		desc:     desc,
-		hash:     fnv.New64a(),
+		desc: desc,
 		newMetric: func(lvs ...string) Metric {
 			return newValue(desc, UntypedValue, 0, lvs...)
 		},
@@ -61,9 +62,7 @@ func TestDelete(t *testing.T) {
 func TestDeleteLabelValues(t *testing.T) {
 	desc := NewDesc("test", "helpless", []string{"l1", "l2"}, nil)
 	vec := MetricVec{
-		children: map[uint64]Metric{},
-		desc:     desc,
-		hash:     fnv.New64a(),
+		desc: desc,
 		newMetric: func(lvs ...string) Metric {
 			return newValue(desc, UntypedValue, 0, lvs...)
 		},
@@ -89,3 +88,320 @@ func TestDeleteLabelValues(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 }
+
+func TestInvalidUTF8LabelValues(t *testing.T) {
+	invalid := "/path/\xff\xfe"
+
+	vec := NewCounterVec(CounterOpts{Name: "test", Help: "helpless"}, []string{"path"})
+	if _, err := vec.GetMetricWithLabelValues(invalid); err == nil {
+		t.Error("expected error for invalid UTF-8 label value")
+	}
+	if _, err := vec.GetMetricWith(Labels{"path": invalid}); err == nil {
+		t.Error("expected error for invalid UTF-8 label value")
+	}
+
+	vec = NewCounterVec(
+		CounterOpts{Name: "test", Help: "helpless", SanitizeLabelValues: true},
+		[]string{"path"},
+	)
+	vec.WithLabelValues(invalid).Inc()
+	vec.With(Labels{"path": invalid}).Inc()
+	if got, want := vec.numChildren, 1; got != want {
+		t.Fatalf("got %d children, want %d", got, want)
+	}
+	out := &dto.Metric{}
+	vec.WithLabelValues(SanitizeLabelValue(invalid)).Write(out)
+	if got, want := out.GetLabel()[0].GetValue(), "/path/�"; got != want {
+		t.Errorf("got label value %q, want %q", got, want)
+	}
+	if got, want := out.GetCounter().GetValue(), 2.; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	desc := NewDesc("test", "helpless", []string{"l"}, nil)
+	if _, err := NewConstMetric(desc, GaugeValue, 1, invalid); err == nil {
+		t.Error("expected error for invalid UTF-8 label value")
+	}
+	if d := NewDesc("test", "helpless", nil, Labels{"l": invalid}); d.err == nil {
+		t.Error("expected error for invalid UTF-8 const label value")
+	}
+}
+
+func TestCurryWith(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{Name: "test", Help: "helpless"},
+		[]string{"service", "method", "code"},
+	)
+
+	svc := vec.MustCurryWith(Labels{"service": "users"})
+	svc.WithLabelValues("GET", "200").Inc()
+	svc.With(Labels{"method": "GET", "code": "200"}).Inc()
+
+	get := svc.MustCurryWith(Labels{"method": "GET"})
+	get.WithLabelValues("500").Inc()
+
+	if got, want := vec.numChildren, 2; got != want {
+		t.Fatalf("got %d children, want %d", got, want)
+	}
+	out := &dto.Metric{}
+	vec.WithLabelValues("users", "GET", "200").Write(out)
+	if got, want := out.GetCounter().GetValue(), 2.; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := svc.GetMetricWith(Labels{"service": "x", "method": "GET", "code": "200"}); err == nil {
+		t.Error("expected error for curried label")
+	}
+	if _, err := svc.GetMetricWithLabelValues("users", "GET", "200"); err == nil {
+		t.Error("expected error for inconsistent cardinality")
+	}
+	if _, err := vec.CurryWith(Labels{"missing": "x"}); err == nil {
+		t.Error("expected error for unknown label name")
+	}
+	if _, err := svc.CurryWith(Labels{"service": "x"}); err == nil {
+		t.Error("expected error for label curried twice")
+	}
+
+	// Collecting a curried vector yields all metrics of the original.
+	ch := make(chan Metric, 10)
+	get.Collect(ch)
+	if got, want := len(ch), 2; got != want {
+		t.Errorf("got %d collected metrics, want %d", got, want)
+	}
+
+	vec.WithLabelValues("orders", "GET", "200").Inc()
+	if got, want := get.DeleteLabelValues("500"), true; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	svc.Reset()
+	if got, want := vec.numChildren, 1; got != want {
+		t.Errorf("got %d children after Reset of curried vector, want %d", got, want)
+	}
+}
+
+func TestGetOrCreateMetric(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{Name: "test_total", Help: "helpless"},
+		[]string{"service", "code"},
+	)
+	first, created, err := vec.GetOrCreateMetricWithLabelValues("users", "200")
+	if err != nil || !created {
+		t.Fatalf("got created %v, error %v; want new child", created, err)
+	}
+	again, created, err := vec.GetOrCreateMetricWith(Labels{"service": "users", "code": "200"})
+	if err != nil || created || again != first {
+		t.Errorf("got created %v, error %v; want existing child", created, err)
+	}
+	svc := vec.MustCurryWith(Labels{"service": "users"})
+	if _, created, _ := svc.GetOrCreateMetricWithLabelValues("200"); created {
+		t.Error("curried vector created existing child")
+	}
+	if _, created, _ := svc.GetOrCreateMetricWith(Labels{"code": "500"}); !created {
+		t.Error("curried vector did not create new child")
+	}
+	if _, created, err := vec.GetOrCreateMetricWithLabelValues("users"); err == nil || created {
+		t.Errorf("got created %v, error %v; want error", created, err)
+	}
+
+	gauges := NewGaugeVec(
+		GaugeOpts{Name: "test", Help: "helpless", MaxChildren: 1, OverflowPolicy: OverflowCollapse},
+		[]string{"user"},
+	)
+	gauges.WithLabelValues("a")
+	if _, created, _ := gauges.GetOrCreateMetricWithLabelValues("b"); created {
+		t.Error("collapsing into the overflow child reported as created")
+	}
+}
+
+func TestMaxChildren(t *testing.T) {
+	newVec := func(policy OverflowPolicy) *GaugeVec {
+		return NewGaugeVec(
+			GaugeOpts{Name: "test", Help: "helpless", MaxChildren: 2, OverflowPolicy: policy},
+			[]string{"user"},
+		)
+	}
+
+	vec := newVec(OverflowReject)
+	vec.WithLabelValues("a").Set(1)
+	vec.WithLabelValues("b").Set(1)
+	if _, err := vec.GetMetricWithLabelValues("c"); err == nil {
+		t.Error("expected error when exceeding MaxChildren")
+	}
+	// Existing children are still accessible.
+	if _, err := vec.GetMetricWithLabelValues("a"); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if _, _, dropped := vec.childStats(); dropped != 1 {
+		t.Errorf("got %d dropped, want 1", dropped)
+	}
+
+	vec = newVec(OverflowEvictOldest)
+	vec.WithLabelValues("a").Set(1)
+	vec.WithLabelValues("b").Set(1)
+	vec.WithLabelValues("c").Set(1)
+	if got, want := vec.DeleteLabelValues("a"), false; got != want {
+		t.Errorf("oldest child still present")
+	}
+	if got, want := vec.numChildren, 2; got != want {
+		t.Errorf("got %d children, want %d", got, want)
+	}
+	// Deleted children do not count towards eviction order.
+	vec.DeleteLabelValues("b")
+	vec.WithLabelValues("d").Set(1)
+	vec.WithLabelValues("e").Set(1)
+	if got, want := vec.DeleteLabelValues("c"), false; got != want {
+		t.Errorf("oldest child still present")
+	}
+
+	vec = newVec(OverflowEvictLeastRecentlyUsed)
+	vec.WithLabelValues("a").Set(1)
+	vec.WithLabelValues("b").Set(1)
+	vec.With(Labels{"user": "a"}).Inc() // "a" is now used more recently than "b".
+	vec.WithLabelValues("c").Set(1)
+	if got, want := vec.DeleteLabelValues("b"), false; got != want {
+		t.Errorf("least recently used child still present")
+	}
+	vec.WithLabelValues("c").Inc()
+	vec.WithLabelValues("d").Set(1)
+	if got, want := vec.DeleteLabelValues("a"), false; got != want {
+		t.Errorf("least recently used child still present")
+	}
+	if got, want := vec.numChildren, 2; got != want {
+		t.Errorf("got %d children, want %d", got, want)
+	}
+	if _, _, dropped := vec.childStats(); dropped != 2 {
+		t.Errorf("got %d evictions counted as dropped, want 2", dropped)
+	}
+	// Deleted children are not eviction candidates anymore.
+	vec.Reset()
+	vec.WithLabelValues("e").Set(1)
+	vec.WithLabelValues("f").Set(1)
+	vec.WithLabelValues("e").Inc()
+	vec.WithLabelValues("g").Set(1)
+	if got, want := vec.DeleteLabelValues("f"), false; got != want {
+		t.Errorf("least recently used child still present after Reset")
+	}
+
+	vec = newVec(OverflowCollapse)
+	vec.WithLabelValues("a").Set(1)
+	vec.WithLabelValues("b").Set(1)
+	vec.WithLabelValues("c").Add(1)
+	vec.WithLabelValues("d").Add(1)
+	out := &dto.Metric{}
+	vec.WithLabelValues(OverflowLabelValue).Write(out)
+	if got, want := out.GetGauge().GetValue(), 2.; got != want {
+		t.Errorf("got overflow value %v, want %v", got, want)
+	}
+	if got, want := vec.numChildren, 3; got != want {
+		t.Errorf("got %d children, want %d", got, want)
+	}
+}
+
+func TestDefaultLabelValues(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{
+			Name:               "test",
+			Help:               "helpless",
+			DefaultLabelValues: Labels{"code": "unknown", "unrelated": "x"},
+		},
+		[]string{"method", "code"},
+	)
+
+	vec.With(Labels{"method": "GET"}).Inc()
+	vec.With(Labels{"method": "GET", "code": "unknown"}).Inc()
+	vec.With(Labels{"method": "GET", "code": "200"}).Inc()
+
+	out := &dto.Metric{}
+	vec.WithLabelValues("GET", "unknown").Write(out)
+	if got, want := out.GetCounter().GetValue(), 2.; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := vec.GetMetricWith(Labels{"code": "200"}); err == nil {
+		t.Error("expected error for label without default")
+	}
+	if _, err := vec.GetMetricWithLabelValues("GET"); err == nil {
+		t.Error("expected error for missing label value")
+	}
+}
+
+func TestLabelsError(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{Name: "test", Help: "helpless"},
+		[]string{"method", "code", "path"},
+	)
+
+	_, err := vec.GetMetricWith(Labels{"method": "GET", "cod": "200", "host": "h"})
+	lerr, ok := err.(*LabelsError)
+	if !ok {
+		t.Fatalf("got %T, want *LabelsError", err)
+	}
+	if got, want := fmt.Sprint(lerr.Missing, lerr.Unknown), "[code path] [cod host]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := err.Error(), `inconsistent labels for test: missing label names ["code" "path"], unknown label names ["cod" "host"]`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	_, err = vec.GetMetricWithLabelValues("GET")
+	if got, want := err.Error(), `inconsistent label cardinality for test: got 1 label values, want 3 for ["method" "code" "path"]`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	curried := vec.MustCurryWith(Labels{"code": "200"})
+	_, err = curried.GetMetricWith(Labels{"method": "GET", "code": "500", "path": "/"})
+	if got, want := err.Error(), `inconsistent labels for test: unknown label names ["code"]`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHashFraming(t *testing.T) {
+	vec := NewCounterVec(CounterOpts{Name: "test", Help: "helpless"}, []string{"l1", "l2"})
+	vec.WithLabelValues("ab", "c").Inc()
+	vec.WithLabelValues("a", "bc").Inc()
+	vec.With(Labels{"l1": "", "l2": "abc"}).Inc()
+	if got, want := vec.numChildren, 3; got != want {
+		t.Errorf("got %d children, want %d", got, want)
+	}
+}
+
+func TestExistingChildAllocs(t *testing.T) {
+	vec := NewCounterVec(CounterOpts{Name: "test", Help: "helpless"}, []string{"l1", "l2"})
+	labels := Labels{"l1": "v1", "l2": "v2"}
+	vec.With(labels).Inc()
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		vec.WithLabelValues("v1", "v2").Inc()
+	}); allocs != 0 {
+		t.Errorf("WithLabelValues allocated %v times for an existing child", allocs)
+	}
+	if allocs := testing.AllocsPerRun(100, func() {
+		vec.With(labels).Inc()
+	}); allocs != 0 {
+		t.Errorf("With allocated %v times for an existing child", allocs)
+	}
+	if got, want := vec.numChildren, 1; got != want {
+		t.Errorf("got %d children, want %d", got, want)
+	}
+}
+
+func TestLookupDuringChildCreation(t *testing.T) {
+	vec := NewCounterVec(CounterOpts{Name: "test", Help: "helpless"}, []string{"l"})
+	existing := vec.WithLabelValues("existing")
+
+	// Simulate a concurrent creation of a child in another stripe, which
+	// holds the lock serializing changes to the set of children.
+	vec.mtx.Lock()
+	done := make(chan Counter)
+	go func() {
+		done <- vec.WithLabelValues("existing")
+	}()
+	select {
+	case got := <-done:
+		if got != existing {
+			t.Error("looked up a different child")
+		}
+	case <-time.After(time.Second):
+		t.Error("lookup of an existing child blocked")
+	}
+	vec.mtx.Unlock()
+}
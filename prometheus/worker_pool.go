@@ -0,0 +1,161 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"time"
+)
+
+// WorkerPoolOpts bundles the options for creating a WorkerPool. All fields are
+// optional and can safely be left at their zero value.
+type WorkerPoolOpts struct {
+	// Namespace, Subsystem, and ConstLabels are applied to all metrics of
+	// the WorkerPool. To instrument several pools, use a different
+	// Subsystem or a distinguishing const label for each of them.
+	Namespace   string
+	Subsystem   string
+	ConstLabels Labels
+
+	// QueueLength, if not nil, is called at collection time to report the
+	// number of jobs waiting for a worker, e.g. the length of a buffered
+	// channel:
+	//
+	//     QueueLength: func() float64 { return float64(len(jobs)) },
+	QueueLength func() float64
+}
+
+// WorkerPool is a Collector bundling the standard metrics of a pool of workers
+// processing jobs from a queue: the number of active workers, the duration of
+// the jobs, the number of completed and failed jobs, and (optionally) the
+// length of the queue. The metrics are named "workers_active",
+// "job_duration_seconds", "jobs_completed_total", "jobs_failed_total", and
+// "queue_length" within the namespace and subsystem from the WorkerPoolOpts.
+//
+// Workers report their jobs with Run or with Start. Create instances with
+// NewWorkerPool.
+type WorkerPool struct {
+	active            Gauge
+	duration          Summary
+	completed, failed Counter
+	queueLength       GaugeFunc
+}
+
+// NewWorkerPool returns a WorkerPool with the provided options. The WorkerPool
+// still has to be registered.
+func NewWorkerPool(opts WorkerPoolOpts) *WorkerPool {
+	p := &WorkerPool{
+		active: NewGauge(GaugeOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "workers_active",
+			Help:        "Number of workers currently processing a job.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		duration: NewSummary(SummaryOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "job_duration_seconds",
+			Help:        "Duration of processed jobs in seconds.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		completed: NewCounter(CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "jobs_completed_total",
+			Help:        "Total number of jobs completed successfully.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		failed: NewCounter(CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "jobs_failed_total",
+			Help:        "Total number of jobs that failed.",
+			ConstLabels: opts.ConstLabels,
+		}),
+	}
+	if opts.QueueLength != nil {
+		p.queueLength = NewGaugeFunc(GaugeOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "queue_length",
+			Help:        "Number of jobs waiting for a worker.",
+			ConstLabels: opts.ConstLabels,
+		}, opts.QueueLength)
+	}
+	return p
+}
+
+// Start reports the start of a job. It returns a function to be called with the
+// result of the job once it has finished (nil for success). Use it if the job
+// is not conveniently wrapped into a function, otherwise use Run.
+//
+//     done := pool.Start()
+//     err := process(job)
+//     done(err)
+func (p *WorkerPool) Start() (done func(error)) {
+	begin := time.Now()
+	p.active.Inc()
+	return func(err error) {
+		p.active.Dec()
+		p.duration.Observe(time.Since(begin).Seconds())
+		if err != nil {
+			p.failed.Inc()
+			return
+		}
+		p.completed.Inc()
+	}
+}
+
+// Run runs job and reports it. A job returning an error or panicking is
+// counted as failed. The error is returned, a panic is re-raised.
+func (p *WorkerPool) Run(job func() error) (err error) {
+	done := p.Start()
+	finished := false
+	defer func() {
+		if !finished {
+			done(errJobPanicked)
+			return
+		}
+		done(err)
+	}()
+	err = job()
+	finished = true
+	return err
+}
+
+// errJobPanicked marks a job as failed in Run.
+var errJobPanicked = errors.New("job panicked")
+
+// Describe implements Collector.
+func (p *WorkerPool) Describe(ch chan<- *Desc) {
+	p.active.Describe(ch)
+	p.duration.Describe(ch)
+	p.completed.Describe(ch)
+	p.failed.Describe(ch)
+	if p.queueLength != nil {
+		p.queueLength.Describe(ch)
+	}
+}
+
+// Collect implements Collector.
+func (p *WorkerPool) Collect(ch chan<- Metric) {
+	p.active.Collect(ch)
+	p.duration.Collect(ch)
+	p.completed.Collect(ch)
+	p.failed.Collect(ch)
+	if p.queueLength != nil {
+		p.queueLength.Collect(ch)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWorkerPool(t *testing.T) {
+	jobs := make(chan int, 10)
+	jobs <- 1
+	jobs <- 2
+	pool := NewWorkerPool(WorkerPoolOpts{
+		Subsystem:   "test",
+		QueueLength: func() float64 { return float64(len(jobs)) },
+	})
+
+	var activeDuringJob float64
+	pool.Run(func() error {
+		activeDuringJob = collectValues(t, pool)["test_workers_active"]
+		return nil
+	})
+	if err := pool.Run(func() error { return errors.New("failed") }); err == nil {
+		t.Error("expected error from Run")
+	}
+	func() {
+		defer func() { recover() }()
+		pool.Run(func() error { panic("boom") })
+	}()
+	done := pool.Start()
+	done(nil)
+
+	values := collectValues(t, pool)
+	for name, want := range map[string]float64{
+		"test_workers_active":       0,
+		"test_jobs_completed_total": 2,
+		"test_jobs_failed_total":    2,
+		"test_queue_length":         2,
+	} {
+		if got := values[name]; got != want {
+			t.Errorf("got %s %v, want %v", name, got, want)
+		}
+	}
+	if activeDuringJob != 1 {
+		t.Errorf("got %v active workers during job, want 1", activeDuringJob)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+// A string-only, single-shot implementation of the 64-bit xxHash algorithm
+// with seed 0, see https://github.com/Cyan4973/xxHash. For label values longer
+// than a few bytes, it is considerably faster than the byte-at-a-time fnv64a.
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+
+	// Initial accumulators, i.e. xxPrime1+xxPrime2 and -xxPrime1 modulo
+	// 2^64, which cannot be written as overflowing constant expressions.
+	xxInit1 uint64 = 6983438078262162902
+	xxInit4 uint64 = 7046029288634856825
+)
+
+// xxhashString returns the 64-bit xxHash of s.
+func xxhashString(s string) uint64 {
+	n := len(s)
+	var h uint64
+
+	if n >= 32 {
+		v1 := xxInit1
+		v2 := xxPrime2
+		v3 := uint64(0)
+		v4 := xxInit4
+		for len(s) >= 32 {
+			v1 = xxRound(v1, readUint64(s[0:8]))
+			v2 = xxRound(v2, readUint64(s[8:16]))
+			v3 = xxRound(v3, readUint64(s[16:24]))
+			v4 = xxRound(v4, readUint64(s[24:32]))
+			s = s[32:]
+		}
+		h = rotl(v1, 1) + rotl(v2, 7) + rotl(v3, 12) + rotl(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+
+	h += uint64(n)
+
+	for ; len(s) >= 8; s = s[8:] {
+		h ^= xxRound(0, readUint64(s[:8]))
+		h = rotl(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(s) >= 4 {
+		h ^= uint64(readUint32(s[:4])) * xxPrime1
+		h = rotl(h, 23)*xxPrime2 + xxPrime3
+		s = s[4:]
+	}
+	for ; len(s) > 0; s = s[1:] {
+		h ^= uint64(s[0]) * xxPrime5
+		h = rotl(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = rotl(acc, 31)
+	acc *= xxPrime1
+	return acc
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	val = xxRound(0, val)
+	acc ^= val
+	acc = acc*xxPrime1 + xxPrime4
+	return acc
+}
+
+func rotl(x uint64, r uint) uint64 {
+	return (x << r) | (x >> (64 - r))
+}
+
+// readUint64 and readUint32 read little-endian integers from the beginning of
+// s without converting it to a byte slice.
+func readUint64(s string) uint64 {
+	_ = s[7] // Bounds check hint to the compiler.
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+		uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56
+}
+
+func readUint32(s string) uint32 {
+	_ = s[3] // Bounds check hint to the compiler.
+	return uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 | uint32(s[3])<<24
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXXHashString(t *testing.T) {
+	scenarios := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"as", 0x1c330fb2d66be179},
+		{"asd", 0x631c37ce72a97393},
+		{"asdf", 0x415872f599cea71e},
+		{"Call me Ishmael. Some years ago--never mind how long precisely-", 0x02a2e85470d6fd96},
+	}
+	for i, s := range scenarios {
+		if got := xxhashString(s.in); got != s.want {
+			t.Errorf("%d. xxhashString(%q) = %#x, want %#x", i, s.in, got, s.want)
+		}
+	}
+}
+
+func benchmarkHashLabelValues(b *testing.B, n int) {
+	vec := NewCounterVec(CounterOpts{Name: "test", Help: "helpless"}, []string{"l1", "l2"})
+	lvs := []string{strings.Repeat("x", n), strings.Repeat("y", n)}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vec.hashLabelValues(lvs)
+	}
+}
+
+func BenchmarkHashLabelValuesShort(b *testing.B) { benchmarkHashLabelValues(b, 4) }
+func BenchmarkHashLabelValuesLong(b *testing.B)  { benchmarkHashLabelValues(b, 64) }
+func BenchmarkHashLabelValuesPath(b *testing.B)  { benchmarkHashLabelValues(b, 256) }
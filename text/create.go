@@ -21,245 +21,292 @@
 package text
 
 import (
-	"bytes"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	dto "github.com/prometheus/client_model/go"
 )
 
+// bufPool recycles the buffers MetricFamilyToText renders a metric family into
+// before writing it out in one go.
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
 // MetricFamilyToText converts a MetricFamily proto message into text format and
 // writes the resulting lines to 'out'. It returns the number of bytes written
 // and any error encountered.  This function does not perform checks on the
-// content of the metric and label names, i.e. invalid metric or label names
-// will result in invalid text format output.
+// content of the metric and label names. Names outside the legacy character
+// set, e.g. UTF-8 names like "http.server.requests", are written quoted and
+// escaped like label values, with a quoted metric name moved into the braces:
+//
+//     {"http.server.requests","service.name"="checkout"} 42
+//
+// Nothing is written if the MetricFamily is inconsistent.
 // This method fulfills the type 'prometheus.encoder'.
 func MetricFamilyToText(out io.Writer, in *dto.MetricFamily) (int, error) {
-	var written int
-
 	// Fail-fast checks.
 	if len(in.Metric) == 0 {
-		return written, fmt.Errorf("MetricFamily has no metrics: %s", in)
+		return 0, fmt.Errorf("MetricFamily has no metrics: %s", in)
 	}
 	name := in.GetName()
 	if name == "" {
-		return written, fmt.Errorf("MetricFamily has no name: %s", in)
+		return 0, fmt.Errorf("MetricFamily has no name: %s", in)
 	}
 	if in.Type == nil {
-		return written, fmt.Errorf("MetricFamily has no type: %s", in)
+		return 0, fmt.Errorf("MetricFamily has no type: %s", in)
 	}
 
+	bp := bufPool.Get().(*[]byte)
+	b := (*bp)[:0]
+	defer func() {
+		*bp = b[:0]
+		bufPool.Put(bp)
+	}()
+
 	// Comments, first HELP, then TYPE.
 	if in.Help != nil {
-		n, err := fmt.Fprintf(
-			out, "# HELP %s %s\n",
-			name, escapeString(*in.Help, false),
-		)
-		written += n
-		if err != nil {
-			return written, err
-		}
+		b = append(b, "# HELP "...)
+		b = appendMetricName(b, name)
+		b = append(b, ' ')
+		b = appendEscaped(b, *in.Help, false)
+		b = append(b, '\n')
 	}
 	metricType := in.GetType()
-	n, err := fmt.Fprintf(
-		out, "# TYPE %s %s\n",
-		name, strings.ToLower(metricType.String()),
-	)
-	written += n
-	if err != nil {
-		return written, err
-	}
+	b = append(b, "# TYPE "...)
+	b = appendMetricName(b, name)
+	b = append(b, ' ')
+	b = appendLower(b, metricType.String())
+	b = append(b, '\n')
 
 	// Finally the samples, one line for each.
 	for _, metric := range in.Metric {
 		switch metricType {
 		case dto.MetricType_COUNTER:
 			if metric.Counter == nil {
-				return written, fmt.Errorf(
+				return 0, fmt.Errorf(
 					"expected counter in metric %s", metric,
 				)
 			}
-			n, err = writeSample(
-				name, metric, "", "",
+			b = appendSample(
+				b, name, "", metric, "", 0,
 				metric.Counter.GetValue(),
-				out,
 			)
 		case dto.MetricType_GAUGE:
 			if metric.Gauge == nil {
-				return written, fmt.Errorf(
+				return 0, fmt.Errorf(
 					"expected gauge in metric %s", metric,
 				)
 			}
-			n, err = writeSample(
-				name, metric, "", "",
+			b = appendSample(
+				b, name, "", metric, "", 0,
 				metric.Gauge.GetValue(),
-				out,
 			)
 		case dto.MetricType_UNTYPED:
 			if metric.Untyped == nil {
-				return written, fmt.Errorf(
+				return 0, fmt.Errorf(
 					"expected untyped in metric %s", metric,
 				)
 			}
-			n, err = writeSample(
-				name, metric, "", "",
+			b = appendSample(
+				b, name, "", metric, "", 0,
 				metric.Untyped.GetValue(),
-				out,
 			)
 		case dto.MetricType_SUMMARY:
 			if metric.Summary == nil {
-				return written, fmt.Errorf(
+				return 0, fmt.Errorf(
 					"expected summary in metric %s", metric,
 				)
 			}
 			for _, q := range metric.Summary.Quantile {
-				n, err = writeSample(
-					name, metric,
-					"quantile", fmt.Sprint(q.GetQuantile()),
+				b = appendSample(
+					b, name, "", metric,
+					"quantile", q.GetQuantile(),
 					q.GetValue(),
-					out,
 				)
-				written += n
-				if err != nil {
-					return written, err
-				}
 			}
-			n, err = writeSample(
-				name+"_sum", metric, "", "",
+			b = appendSample(
+				b, name, "_sum", metric, "", 0,
 				metric.Summary.GetSampleSum(),
-				out,
 			)
-			if err != nil {
-				return written, err
-			}
-			written += n
-			n, err = writeSample(
-				name+"_count", metric, "", "",
+			b = appendSample(
+				b, name, "_count", metric, "", 0,
 				float64(metric.Summary.GetSampleCount()),
-				out,
 			)
 		default:
-			return written, fmt.Errorf(
+			return 0, fmt.Errorf(
 				"unexpected type in metric %s", metric,
 			)
 		}
-		written += n
-		if err != nil {
-			return written, err
-		}
 	}
-	return written, nil
+	return out.Write(b)
 }
 
-// writeSample writes a single sample in text format to out, given the metric
-// name, the metric proto message itself, optionally an additional label name
-// and value (use empty strings if not required), and the value. The function
-// returns the number of bytes written and any error encountered.
-func writeSample(
-	name string,
+// appendSample appends a single sample in text format to b, given the metric
+// name and a suffix for it, the metric proto message itself, optionally an
+// additional label name and its numeric value (use an empty name if not
+// required), and the value. It returns the extended buffer.
+func appendSample(
+	b []byte,
+	name, suffix string,
 	metric *dto.Metric,
-	additionalLabelName, additionalLabelValue string,
+	additionalLabelName string, additionalLabelValue float64,
 	value float64,
-	out io.Writer,
-) (int, error) {
-	var written int
-	n, err := fmt.Fprint(out, name)
-	written += n
-	if err != nil {
-		return written, err
-	}
-	n, err = labelPairsToText(
-		metric.Label,
-		additionalLabelName, additionalLabelValue,
-		out,
-	)
-	written += n
-	if err != nil {
-		return written, err
-	}
-	n, err = fmt.Fprintf(out, " %v", value)
-	written += n
-	if err != nil {
-		return written, err
+) []byte {
+	// A metric name that has to be quoted goes into the braces.
+	quoted := !isLegacyMetricName(name)
+	if quoted {
+		b = append(b, `{"`...)
+		b = appendEscaped(b, name, true)
+		b = append(b, suffix...)
+		b = append(b, '"')
+	} else {
+		b = append(b, name...)
+		b = append(b, suffix...)
 	}
+	b = appendLabelPairs(b, quoted, metric.Label, additionalLabelName, additionalLabelValue)
+	b = append(b, ' ')
+	b = appendFloat(b, value)
 	if metric.TimestampMs != nil {
-		n, err = fmt.Fprintf(out, " %v", *metric.TimestampMs)
-		written += n
-		if err != nil {
-			return written, err
-		}
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, *metric.TimestampMs, 10)
 	}
-	n, err = out.Write([]byte{'\n'})
-	written += n
-	if err != nil {
-		return written, err
-	}
-	return written, nil
+	return append(b, '\n')
 }
 
-// labelPairsToText converts a slice of LabelPair proto messages plus the
-// explicitly given additional label pair into text formatted as required by the
-// text format and writes it to 'out'. An empty slice in combination with an
-// empty string 'additionalLabelName' results in nothing being
-// written. Otherwise, the label pairs are written, escaped as required by the
-// text format, and enclosed in '{...}'. The function returns the number of
-// bytes written and any error encountered.
-func labelPairsToText(
+// appendLabelPairs appends a slice of LabelPair proto messages plus the
+// explicitly given additional label pair to b, formatted as required by the
+// text format. An empty slice in combination with an empty string
+// 'additionalLabelName' results in nothing being appended. Otherwise, the label
+// pairs are appended, escaped as required by the text format, and enclosed in
+// '{...}'. If 'opened' is true, the opening brace and the quoted metric name
+// have been appended already, so the label pairs continue the list, and the
+// closing brace is appended in any case.
+func appendLabelPairs(
+	b []byte,
+	opened bool,
 	in []*dto.LabelPair,
-	additionalLabelName, additionalLabelValue string,
-	out io.Writer,
-) (int, error) {
-	if len(in) == 0 && additionalLabelName == "" {
-		return 0, nil
+	additionalLabelName string, additionalLabelValue float64,
+) []byte {
+	if !opened && len(in) == 0 && additionalLabelName == "" {
+		return b
+	}
+	separator := byte('{')
+	if opened {
+		separator = ','
 	}
-	var written int
-	separator := '{'
 	for _, lp := range in {
-		n, err := fmt.Fprintf(
-			out, `%c%s="%s"`,
-			separator, lp.GetName(), escapeString(lp.GetValue(), true),
-		)
-		written += n
-		if err != nil {
-			return written, err
-		}
+		b = append(b, separator)
+		b = appendLabelName(b, lp.GetName())
+		b = append(b, `="`...)
+		b = appendEscaped(b, lp.GetValue(), true)
+		b = append(b, '"')
 		separator = ','
 	}
 	if additionalLabelName != "" {
-		n, err := fmt.Fprintf(
-			out, `%c%s="%s"`,
-			separator, additionalLabelName,
-			escapeString(additionalLabelValue, true),
-		)
-		written += n
-		if err != nil {
-			return written, err
+		b = append(b, separator)
+		b = append(b, additionalLabelName...)
+		b = append(b, `="`...)
+		b = appendFloat(b, additionalLabelValue)
+		b = append(b, '"')
+	}
+	return append(b, '}')
+}
+
+// appendMetricName appends name to b, quoted and escaped if it is not a legacy
+// metric name.
+func appendMetricName(b []byte, name string) []byte {
+	if isLegacyMetricName(name) {
+		return append(b, name...)
+	}
+	b = append(b, '"')
+	b = appendEscaped(b, name, true)
+	return append(b, '"')
+}
+
+// appendLabelName appends name to b, quoted and escaped if it is not a legacy
+// label name.
+func appendLabelName(b []byte, name string) []byte {
+	if isLegacyLabelName(name) {
+		return append(b, name...)
+	}
+	b = append(b, '"')
+	b = appendEscaped(b, name, true)
+	return append(b, '"')
+}
+
+// isLegacyMetricName reports whether name matches [a-zA-Z_:][a-zA-Z0-9_:]*.
+func isLegacyMetricName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || c >= '0' && c <= '9' && i > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLegacyLabelName reports whether name matches [a-zA-Z_][a-zA-Z0-9_]*.
+func isLegacyLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= '0' && c <= '9' && i > 0) {
+			return false
 		}
 	}
-	n, err := out.Write([]byte{'}'})
-	written += n
-	if err != nil {
-		return written, err
+	return true
+}
+
+// appendFloat appends f formatted like the %v verb of package fmt does.
+func appendFloat(b []byte, f float64) []byte {
+	return strconv.AppendFloat(b, f, 'g', -1, 64)
+}
+
+// appendLower appends the ASCII string s converted to lower case to b.
+func appendLower(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		b = append(b, c)
 	}
-	return written, nil
+	return b
 }
 
-// escapeString replaces '\' by '\\', new line character by '\n', and - if
-// includeDoubleQuote is true - '"' by '\"'.
-func escapeString(v string, includeDoubleQuote bool) string {
-	result := bytes.NewBuffer(make([]byte, 0, len(v)))
+// appendEscaped appends v to b with '\' replaced by '\\', new line character by
+// '\n', and - if includeDoubleQuote is true - '"' by '\"'. Invalid UTF-8 is
+// replaced by the Unicode replacement character.
+func appendEscaped(b []byte, v string, includeDoubleQuote bool) []byte {
+	if !strings.ContainsAny(v, "\\\n\"") && utf8.ValidString(v) {
+		return append(b, v...)
+	}
+	var r [utf8.UTFMax]byte
 	for _, c := range v {
 		switch {
 		case c == '\\':
-			result.WriteString(`\\`)
+			b = append(b, `\\`...)
 		case includeDoubleQuote && c == '"':
-			result.WriteString(`\"`)
+			b = append(b, `\"`...)
 		case c == '\n':
-			result.WriteString(`\n`)
+			b = append(b, `\n`...)
 		default:
-			result.WriteRune(c)
+			n := utf8.EncodeRune(r[:], c)
+			b = append(b, r[:n]...)
 		}
 	}
-	return result.String()
+	return b
 }
@@ -15,6 +15,7 @@ package text
 
 import (
 	"bytes"
+	"io/ioutil"
 	"math"
 	"strings"
 	"testing"
@@ -108,7 +109,7 @@ name{labelname="val2",basename="basevalue"} 0.23 1234567890
 							},
 						},
 						Gauge: &dto.Gauge{
-							Value: proto.Float64(3.14E42),
+							Value: proto.Float64(3.14e42),
 						},
 					},
 				},
@@ -219,6 +220,75 @@ summary_name{name_1="value 1",name_2="value 2",quantile="0.9"} 2
 summary_name{name_1="value 1",name_2="value 2",quantile="0.99"} 3
 summary_name_sum{name_1="value 1",name_2="value 2"} 2010.1971
 summary_name_count{name_1="value 1",name_2="value 2"} 4711
+`,
+		},
+		// 4: UTF-8 metric and label names.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("http.server.duration"),
+				Help: proto.String("Dotted name."),
+				Type: dto.MetricType_SUMMARY.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Summary: &dto.Summary{
+							SampleCount: proto.Uint64(1),
+							SampleSum:   proto.Float64(2),
+						},
+					},
+					&dto.Metric{
+						Label: []*dto.LabelPair{
+							&dto.LabelPair{
+								Name:  proto.String("code"),
+								Value: proto.String("200"),
+							},
+							&dto.LabelPair{
+								Name:  proto.String("service.\"name\""),
+								Value: proto.String("checkout"),
+							},
+						},
+						Summary: &dto.Summary{
+							SampleCount: proto.Uint64(3),
+							SampleSum:   proto.Float64(4),
+							Quantile: []*dto.Quantile{
+								&dto.Quantile{
+									Quantile: proto.Float64(0.5),
+									Value:    proto.Float64(1),
+								},
+							},
+						},
+					},
+				},
+			},
+			out: `# HELP "http.server.duration" Dotted name.
+# TYPE "http.server.duration" summary
+{"http.server.duration_sum"} 2
+{"http.server.duration_count"} 1
+{"http.server.duration",code="200","service.\"name\""="checkout",quantile="0.5"} 1
+{"http.server.duration_sum",code="200","service.\"name\""="checkout"} 4
+{"http.server.duration_count",code="200","service.\"name\""="checkout"} 3
+`,
+		},
+		// 5: Legacy metric name with a UTF-8 label name.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("target_info"),
+				Type: dto.MetricType_GAUGE.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Label: []*dto.LabelPair{
+							&dto.LabelPair{
+								Name:  proto.String("service.name"),
+								Value: proto.String("checkout"),
+							},
+						},
+						Gauge: &dto.Gauge{
+							Value: proto.Float64(1),
+						},
+					},
+				},
+			},
+			out: `# TYPE target_info gauge
+target_info{"service.name"="checkout"} 1
 `,
 		},
 	}
@@ -345,3 +415,39 @@ func BenchmarkCreateError(b *testing.B) {
 		testCreateError(b)
 	}
 }
+
+func TestCreateAllocs(t *testing.T) {
+	mf := &dto.MetricFamily{
+		Name: proto.String("request_duration_seconds"),
+		Help: proto.String("Request duration."),
+		Type: dto.MetricType_SUMMARY.Enum(),
+		Metric: []*dto.Metric{
+			&dto.Metric{
+				Label: []*dto.LabelPair{
+					&dto.LabelPair{
+						Name:  proto.String("path"),
+						Value: proto.String(`/api/"quoted"`),
+					},
+				},
+				Summary: &dto.Summary{
+					SampleCount: proto.Uint64(42),
+					SampleSum:   proto.Float64(1.5),
+					Quantile: []*dto.Quantile{
+						&dto.Quantile{
+							Quantile: proto.Float64(0.99),
+							Value:    proto.Float64(math.Inf(+1)),
+						},
+					},
+				},
+				TimestampMs: proto.Int64(1234567),
+			},
+		},
+	}
+	if allocs := testing.AllocsPerRun(100, func() {
+		if _, err := MetricFamilyToText(ioutil.Discard, mf); err != nil {
+			t.Fatal(err)
+		}
+	}); allocs != 0 {
+		t.Errorf("MetricFamilyToText allocated %v times", allocs)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+var influxEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+
+// MetricFamilyToInflux converts a MetricFamily proto message into the InfluxDB
+// line protocol and writes the resulting lines to 'out'. It returns the number
+// of bytes written and any error encountered.
+//
+// Each metric results in one line. The metric name is used as the measurement,
+// and the labels are used as the tag set (labels with an empty value are
+// omitted). Counters, gauges, and untyped metrics have a single field
+// "value". Summaries have the fields "count", "sum", and one field per
+// quantile, named after the quantile (e.g. "0.99"). Fields with a NaN or
+// infinite value are omitted, as the line protocol cannot represent them, and
+// metrics without any remaining fields are skipped. If the metric has a
+// timestamp, it is written in nanoseconds (the default precision of the line
+// protocol). Otherwise, the timestamp is omitted, and InfluxDB will use the
+// time of ingestion.
+// This method fulfills the type 'prometheus.encoder'.
+func MetricFamilyToInflux(out io.Writer, in *dto.MetricFamily) (int, error) {
+	var written int
+
+	// Fail-fast checks.
+	if len(in.Metric) == 0 {
+		return written, fmt.Errorf("MetricFamily has no metrics: %s", in)
+	}
+	name := in.GetName()
+	if name == "" {
+		return written, fmt.Errorf("MetricFamily has no name: %s", in)
+	}
+	if in.Type == nil {
+		return written, fmt.Errorf("MetricFamily has no type: %s", in)
+	}
+
+	var line bytes.Buffer
+	for _, metric := range in.Metric {
+		var fields []string
+		addField := func(key string, value float64) {
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				return
+			}
+			fields = append(fields, influxEscaper.Replace(key)+"="+strconv.FormatFloat(value, 'g', -1, 64))
+		}
+
+		switch in.GetType() {
+		case dto.MetricType_COUNTER:
+			if metric.Counter == nil {
+				return written, fmt.Errorf(
+					"expected counter in metric %s", metric,
+				)
+			}
+			addField("value", metric.Counter.GetValue())
+		case dto.MetricType_GAUGE:
+			if metric.Gauge == nil {
+				return written, fmt.Errorf(
+					"expected gauge in metric %s", metric,
+				)
+			}
+			addField("value", metric.Gauge.GetValue())
+		case dto.MetricType_UNTYPED:
+			if metric.Untyped == nil {
+				return written, fmt.Errorf(
+					"expected untyped in metric %s", metric,
+				)
+			}
+			addField("value", metric.Untyped.GetValue())
+		case dto.MetricType_SUMMARY:
+			if metric.Summary == nil {
+				return written, fmt.Errorf(
+					"expected summary in metric %s", metric,
+				)
+			}
+			addField("count", float64(metric.Summary.GetSampleCount()))
+			addField("sum", metric.Summary.GetSampleSum())
+			for _, q := range metric.Summary.Quantile {
+				addField(fmt.Sprint(q.GetQuantile()), q.GetValue())
+			}
+		default:
+			return written, fmt.Errorf(
+				"unexpected type in metric %s", metric,
+			)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		line.Reset()
+		line.WriteString(influxEscaper.Replace(name))
+		for _, lp := range metric.Label {
+			if lp.GetValue() == "" {
+				continue
+			}
+			line.WriteByte(',')
+			line.WriteString(influxEscaper.Replace(lp.GetName()))
+			line.WriteByte('=')
+			line.WriteString(influxEscaper.Replace(lp.GetValue()))
+		}
+		line.WriteByte(' ')
+		line.WriteString(strings.Join(fields, ","))
+		if metric.TimestampMs != nil {
+			line.WriteByte(' ')
+			line.WriteString(strconv.FormatInt(metric.GetTimestampMs()*1e6, 10))
+		}
+		line.WriteByte('\n')
+
+		n, err := out.Write(line.Bytes())
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestInflux(t *testing.T) {
+	var scenarios = []struct {
+		in  *dto.MetricFamily
+		out string
+	}{
+		// 0: Counter with escaped tags, empty label, and timestamp.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("requests_total"),
+				Help: proto.String("doc string"),
+				Type: dto.MetricType_COUNTER.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Label: []*dto.LabelPair{
+							&dto.LabelPair{
+								Name:  proto.String("empty"),
+								Value: proto.String(""),
+							},
+							&dto.LabelPair{
+								Name:  proto.String("path"),
+								Value: proto.String("/a b,c=d"),
+							},
+						},
+						Counter: &dto.Counter{
+							Value: proto.Float64(42),
+						},
+						TimestampMs: proto.Int64(1234),
+					},
+				},
+			},
+			out: `requests_total,path=/a\ b\,c\=d value=42 1234000000
+`,
+		},
+		// 1: Gauge, NaN value is skipped.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("temperature"),
+				Type: dto.MetricType_GAUGE.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Gauge: &dto.Gauge{
+							Value: proto.Float64(math.NaN()),
+						},
+					},
+					&dto.Metric{
+						Label: []*dto.LabelPair{
+							&dto.LabelPair{
+								Name:  proto.String("room"),
+								Value: proto.String("kitchen"),
+							},
+						},
+						Gauge: &dto.Gauge{
+							Value: proto.Float64(-3.5e-7),
+						},
+					},
+				},
+			},
+			out: `temperature,room=kitchen value=-3.5e-07
+`,
+		},
+		// 2: Summary.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("latency"),
+				Type: dto.MetricType_SUMMARY.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Summary: &dto.Summary{
+							SampleCount: proto.Uint64(3),
+							SampleSum:   proto.Float64(1.5),
+							Quantile: []*dto.Quantile{
+								&dto.Quantile{
+									Quantile: proto.Float64(0.5),
+									Value:    proto.Float64(0.4),
+								},
+								&dto.Quantile{
+									Quantile: proto.Float64(0.99),
+									Value:    proto.Float64(math.Inf(1)),
+								},
+							},
+						},
+					},
+				},
+			},
+			out: `latency count=3,sum=1.5,0.5=0.4
+`,
+		},
+	}
+
+	for i, scenario := range scenarios {
+		out := bytes.NewBuffer(make([]byte, 0, len(scenario.out)))
+		n, err := MetricFamilyToInflux(out, scenario.in)
+		if err != nil {
+			t.Errorf("%d. error: %s", i, err)
+			continue
+		}
+		if expected, got := len(scenario.out), n; expected != got {
+			t.Errorf(
+				"%d. expected %d bytes written, got %d",
+				i, expected, got,
+			)
+		}
+		if expected, got := scenario.out, out.String(); expected != got {
+			t.Errorf(
+				"%d. expected out=%q, got %q",
+				i, expected, got,
+			)
+		}
+	}
+}
+
+func TestInfluxError(t *testing.T) {
+	in := &dto.MetricFamily{
+		Name: proto.String("name"),
+		Type: dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{
+			&dto.Metric{
+				Untyped: &dto.Untyped{
+					Value: proto.Float64(1),
+				},
+			},
+		},
+	}
+	var out bytes.Buffer
+	_, err := MetricFamilyToInflux(&out, in)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if expected, got := "expected counter in metric", err.Error(); !strings.HasPrefix(got, expected) {
+		t.Errorf("expected error starting with %q, got %q", expected, got)
+	}
+}
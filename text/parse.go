@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -99,6 +100,43 @@ func (p *Parser) TextToMetricFamilies(in io.Reader) (map[string]*dto.MetricFamil
 	return p.metricFamiliesByName, p.err
 }
 
+// ParseText reads 'in' as the simple and flat text-based exchange format and
+// returns the resulting MetricFamily proto messages sorted by name, with the
+// label pairs of each Metric sorted by label name. This is the same order as
+// used by the registry when gathering metrics, so that text created from a
+// registry can be parsed and compared with (or merged into) protobufs gathered
+// directly. See Parser.TextToMetricFamilies for details about the parsing.
+//
+// ParseText uses a fresh Parser and is thus safe to be called concurrently.
+func ParseText(in io.Reader) ([]*dto.MetricFamily, error) {
+	var p Parser
+	mfsByName, err := p.TextToMetricFamilies(in)
+	if err != nil {
+		return nil, err
+	}
+	mfs := make([]*dto.MetricFamily, 0, len(mfsByName))
+	for _, mf := range mfsByName {
+		for _, m := range mf.Metric {
+			sort.Sort(labelPairsByName(m.Label))
+		}
+		mfs = append(mfs, mf)
+	}
+	sort.Sort(metricFamiliesByName(mfs))
+	return mfs, nil
+}
+
+type labelPairsByName []*dto.LabelPair
+
+func (s labelPairsByName) Len() int           { return len(s) }
+func (s labelPairsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s labelPairsByName) Less(i, j int) bool { return s[i].GetName() < s[j].GetName() }
+
+type metricFamiliesByName []*dto.MetricFamily
+
+func (s metricFamiliesByName) Len() int           { return len(s) }
+func (s metricFamiliesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s metricFamiliesByName) Less(i, j int) bool { return s[i].GetName() < s[j].GetName() }
+
 func (p *Parser) reset(in io.Reader) {
 	p.metricFamiliesByName = map[string]*dto.MetricFamily{}
 	if p.buf == nil {
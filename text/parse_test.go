@@ -372,6 +372,32 @@ func TestParse(t *testing.T) {
 	testParse(t)
 }
 
+func TestParseText(t *testing.T) {
+	in := `
+# TYPE b_metric counter
+b_metric{z="1",a="2"} 3
+a_metric 1
+`
+	mfs, err := ParseText(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 2 {
+		t.Fatalf("expected 2 metric families, got %d", len(mfs))
+	}
+	if expected, got := "a_metric", mfs[0].GetName(); expected != got {
+		t.Errorf("expected first metric family %q, got %q", expected, got)
+	}
+	labels := mfs[1].Metric[0].Label
+	if expected, got := "a", labels[0].GetName(); expected != got {
+		t.Errorf("expected first label %q, got %q", expected, got)
+	}
+
+	if _, err := ParseText(strings.NewReader("metric{label=} 1\n")); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
 func BenchmarkParse(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		testParse(b)
@@ -30,6 +30,22 @@ func WriteProtoDelimited(w io.Writer, p *dto.MetricFamily) (int, error) {
 	return ext.WriteDelimited(w, p)
 }
 
+// ReadProtoDelimited reads MetricFamilies in delimited protobuf format (as
+// written by WriteProtoDelimited) from the reader until EOF.
+func ReadProtoDelimited(r io.Reader) ([]*dto.MetricFamily, error) {
+	var mfs []*dto.MetricFamily
+	for {
+		mf := &dto.MetricFamily{}
+		if _, err := ext.ReadDelimited(r, mf); err != nil {
+			if err == io.EOF {
+				return mfs, nil
+			}
+			return nil, err
+		}
+		mfs = append(mfs, mf)
+	}
+}
+
 // WriteProtoText writes the MetricFamily to the writer in text format and
 // returns the number of bytes written and any error encountered.
 func WriteProtoText(w io.Writer, p *dto.MetricFamily) (int, error) {
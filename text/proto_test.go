@@ -0,0 +1,65 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"bytes"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestReadProtoDelimited(t *testing.T) {
+	in := []*dto.MetricFamily{
+		{
+			Name: proto.String("requests_total"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{
+				{Counter: &dto.Counter{Value: proto.Float64(42)}},
+			},
+		},
+		{
+			Name: proto.String("queue_length"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{
+				{Gauge: &dto.Gauge{Value: proto.Float64(3)}},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	for _, mf := range in {
+		if _, err := WriteProtoDelimited(&buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encoded := buf.Bytes()
+
+	out, err := ReadProtoDelimited(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(in) {
+		t.Fatalf("got %d metric families, want %d", len(out), len(in))
+	}
+	for i := range in {
+		if !proto.Equal(out[i], in[i]) {
+			t.Errorf("%d. got %s, want %s", i, out[i], in[i])
+		}
+	}
+
+	if _, err := ReadProtoDelimited(bytes.NewReader(encoded[:len(encoded)-1])); err == nil {
+		t.Error("expected error for truncated input")
+	}
+}